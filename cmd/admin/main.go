@@ -0,0 +1,121 @@
+// Команда admin управляет пользователями админки без доступа к API — например, чтобы завести
+// первого суперадмина:
+//
+//	ADMIN_PASSWORD='...' go run ./cmd/admin -create alice -role superadmin
+//	go run ./cmd/admin -list
+//	go run ./cmd/admin -id 2 -role viewer
+//	go run ./cmd/admin -id 2 -disable
+//	ADMIN_PASSWORD='...' go run ./cmd/admin -id 2 -password
+//
+// Пароль берётся из ADMIN_PASSWORD, а если переменная пуста — из первой строки stdin.
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/service"
+	"strings"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func main() {
+	create := flag.String("create", "", "логин нового админа")
+	id := flag.Int64("id", 0, "id админа, которого нужно изменить")
+	role := flag.String("role", "", "роль: viewer, operator, finance, superadmin")
+	disable := flag.Bool("disable", false, "заблокировать админа и отозвать его сессии")
+	enable := flag.Bool("enable", false, "разблокировать админа")
+	password := flag.Bool("password", false, "сменить пароль админа")
+	list := flag.Bool("list", false, "список админов")
+	flag.Parse()
+
+	logrus.SetFormatter(new(logrus.JSONFormatter))
+	if err := godotenv.Load(); err != nil {
+		logrus.Infof("Ошибка инициализации переменных окружения .env: %s \n", err)
+	}
+
+	viper.AddConfigPath("configs")
+	viper.SetConfigName("config")
+	if err := viper.ReadInConfig(); err != nil {
+		logrus.Fatalf("Ошибка (viper) при инициализации конгфига .yaml: %s \n", err.Error())
+	}
+
+	db, err := repository.NewPostgresDB(repository.Config{
+		Host:     viper.GetString("db.host"),
+		Port:     viper.GetString("db.port"),
+		Username: viper.GetString("db.username"),
+		Password: os.Getenv("DB_PASS_LOCAL"),
+		DBName:   viper.GetString("db.dbname"),
+		SSLMode:  viper.GetString("db.sslmode"),
+	})
+	if err != nil {
+		logrus.Fatalf("Ошибка при инициализации базы данных: %s \n", err.Error())
+	}
+	admins := service.NewAdminService(repository.NewRepository(db), service.AdminConfig{
+		SessionTTL: viper.GetDuration("admin.session_ttl"),
+	})
+	// В журнал аудита действия команды пишутся на пользователя ОС, который её запустил
+	meta := models.RequestMeta{Actor: "cli:" + os.Getenv("USER")}
+
+	switch {
+	case *list:
+		users, err := admins.GetAdmins()
+		if err != nil {
+			logrus.Fatalf("Ошибка при чтении админов: %s", err)
+		}
+		for _, u := range users {
+			fmt.Printf("%d\t%s\t%s\tdisabled=%t\n", u.ID, u.Username, u.Role, u.Disabled)
+		}
+
+	case *create != "":
+		admin, err := admins.CreateAdmin(*create, readPassword(), *role, meta)
+		if err != nil {
+			logrus.Fatalf("Ошибка при создании админа: %s", err)
+		}
+		logrus.Infof("Создан админ %q (id %d) с ролью %s", admin.Username, admin.ID, admin.Role)
+
+	case *id != 0 && *password:
+		if err := admins.SetAdminPassword(*id, readPassword(), meta); err != nil {
+			logrus.Fatalf("Ошибка при смене пароля: %s", err)
+		}
+		logrus.Infof("Пароль админа %d изменён", *id)
+
+	case *id != 0 && (*role != "" || *disable || *enable):
+		var input models.AdminUpdateInput
+		if *role != "" {
+			input.Role = role
+		}
+		if *disable || *enable {
+			input.Disabled = disable
+		}
+		// actorID 0: команда не действует от имени какого-либо админа
+		admin, err := admins.UpdateAdmin(0, *id, input, meta)
+		if err != nil {
+			logrus.Fatalf("Ошибка при изменении админа: %s", err)
+		}
+		logrus.Infof("Админ %q: роль %s, disabled=%t", admin.Username, admin.Role, admin.Disabled)
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+}
+
+func readPassword() string {
+	if password := os.Getenv("ADMIN_PASSWORD"); password != "" {
+		return password
+	}
+	fmt.Fprint(os.Stderr, "Пароль: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		logrus.Fatalf("Ошибка при чтении пароля: %s", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
@@ -0,0 +1,83 @@
+// Команда auditverify проверяет цепочку хэшей журнала аудита от первой записи до последней.
+// Код выхода 1 — цепочка сломана: запись изменена, удалена или вставлена в обход сервиса.
+//
+// Удаление последних записей цепочка сама не выдаёт: сохраняйте last_id и last_hash из вывода
+// вне базы и передавайте их при следующей проверке:
+//
+//	go run ./cmd/auditverify -expect-id 1234 -expect-hash 5f3a...
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/service"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func main() {
+	expectID := flag.Int64("expect-id", 0, "id записи из прошлой проверки, которая должна остаться в цепочке")
+	expectHash := flag.String("expect-hash", "", "хэш этой записи из прошлой проверки")
+	flag.Parse()
+
+	logrus.SetFormatter(new(logrus.JSONFormatter))
+	if err := godotenv.Load(); err != nil {
+		logrus.Infof("Ошибка инициализации переменных окружения .env: %s \n", err)
+	}
+
+	viper.AddConfigPath("configs")
+	viper.SetConfigName("config")
+	if err := viper.ReadInConfig(); err != nil {
+		logrus.Fatalf("Ошибка (viper) при инициализации конгфига .yaml: %s \n", err.Error())
+	}
+
+	db, err := repository.NewPostgresDB(repository.Config{
+		Host:     viper.GetString("db.host"),
+		Port:     viper.GetString("db.port"),
+		Username: viper.GetString("db.username"),
+		Password: os.Getenv("DB_PASS_LOCAL"),
+		DBName:   viper.GetString("db.dbname"),
+		SSLMode:  viper.GetString("db.sslmode"),
+	})
+	if err != nil {
+		logrus.Fatalf("Ошибка при инициализации базы данных: %s \n", err.Error())
+	}
+	repos := repository.NewRepository(db)
+
+	result, err := service.NewAuditService(repos.Audit).Verify()
+	if err != nil {
+		logrus.Fatalf("Ошибка при проверке журнала аудита: %s", err)
+	}
+
+	// Запись из прошлой проверки должна быть на месте с тем же хэшем
+	if result.Valid && *expectID > 0 {
+		switch {
+		case result.LastID < *expectID:
+			result.Valid = false
+			result.Reason = fmt.Sprintf("chain ends at entry %d, expected entry %d to exist", result.LastID, *expectID)
+		default:
+			entries, err := repos.Audit.GetAuditChain(*expectID-1, 1)
+			if err != nil {
+				logrus.Fatalf("Ошибка при чтении журнала аудита: %s", err)
+			}
+			if len(entries) == 0 || entries[0].ID != *expectID || entries[0].Hash != *expectHash {
+				result.Valid = false
+				result.BrokenID = *expectID
+				result.Reason = "entry does not match the hash from the previous check"
+			}
+		}
+	}
+
+	out, _ := json.MarshalIndent(result, "", "  ")
+	fmt.Println(string(out))
+	if !result.Valid {
+		logrus.Errorf("Цепочка журнала аудита сломана: %s", result.Reason)
+		os.Exit(1)
+	}
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 	"github.com/sirupsen/logrus"
@@ -9,8 +11,11 @@ import (
 	production "production_wallet_back"
 
 	"production_wallet_back/pkg/handler"
+	"production_wallet_back/pkg/keystore"
+	"production_wallet_back/pkg/money"
 	"production_wallet_back/pkg/repository"
 	"production_wallet_back/pkg/service"
+	"production_wallet_back/pkg/tronclient"
 )
 
 func main() {
@@ -38,9 +43,162 @@ func main() {
 	}
 	logrus.Info("База данных подключена")
 
+	keys, err := keystore.NewFromEnv()
+	if err != nil {
+		logrus.Fatalf("Ошибка при инициализации хранилища ключей: %s \n", err.Error())
+	}
+
+	network, err := LoadNetwork()
+	if err != nil {
+		logrus.Fatalf("Ошибка в настройках сети TRON: %s \n", err.Error())
+	}
+	logrus.Infof("Сеть TRON: %s (%s)", network.Name, network.GridURL)
+	chain := tronclient.NewTronHTTPClient(os.Getenv("TRONGRID_API_KEY"), network)
+	if viper.IsSet("fees.params_ttl") {
+		chain.ParamsTTL = viper.GetDuration("fees.params_ttl")
+	}
+	if viper.IsSet("fees.resources_ttl") {
+		chain.ResourcesTTL = viper.GetDuration("fees.resources_ttl")
+	}
+
+	settlementMin, err := money.Parse(viper.GetString("settlement.min_amount"))
+	if err != nil {
+		logrus.Fatalf("Ошибка в settlement.min_amount: %s \n", err.Error())
+	}
+
+	gasLowBalance, err := money.Parse(viper.GetString("gas.low_balance"))
+	if err != nil {
+		logrus.Fatalf("Ошибка в gas.low_balance: %s \n", err.Error())
+	}
+	feePayerKey := os.Getenv("FEE_PAYER_PRIVATE_KEY")
+	if feePayerKey == "" {
+		feePayerKey = os.Getenv("HOT_WALLET_PRIVATE_KEY")
+	}
+
+	// Токеном бота подписан initData при логине: без него подпись может посчитать кто угодно
+	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
+	if botToken == "" {
+		logrus.Fatal("TELEGRAM_BOT_TOKEN не задан")
+	}
+
+	// Без срока действия перехваченный initData позволял бы войти в любой момент
+	initDataTTL := viper.GetDuration("auth.init_data_ttl")
+	if initDataTTL <= 0 {
+		logrus.Fatal("auth.init_data_ttl должен быть больше нуля")
+	}
+
+	receiptsDir := viper.GetString("orders.receipts_dir")
+	if err := os.MkdirAll(receiptsDir, 0o750); err != nil {
+		logrus.Fatalf("Ошибка при создании каталога чеков: %s \n", err.Error())
+	}
+
+	// Секретами подписываются JWT и котировки: с пустым или коротким их может подделать кто угодно
+	authCfg := service.AuthConfig{
+		TokenSecret: os.Getenv("AUTH_TOKEN_SECRET"),
+		AccessTTL:   viper.GetDuration("auth.access_ttl"),
+		RefreshTTL:  viper.GetDuration("auth.refresh_ttl"),
+	}
+	if err := authCfg.Validate(); err != nil {
+		logrus.Fatalf("Ошибка в AUTH_TOKEN_SECRET: %s \n", err.Error())
+	}
+	quoteCfg := service.QuoteConfig{
+		Secret: os.Getenv("QUOTE_SIGNING_SECRET"),
+		TTL:    viper.GetDuration("quotes.ttl"),
+	}
+	if err := quoteCfg.Validate(); err != nil {
+		logrus.Fatalf("Ошибка в QUOTE_SIGNING_SECRET: %s \n", err.Error())
+	}
+
 	repos := repository.NewRepository(db)
-	service := service.NewService(repos)
-	handler := handler.NewHandler(service)
+	service := service.NewService(repos, chain, keys, service.Config{
+		Auth: authCfg,
+		Admin: service.AdminConfig{
+			SessionTTL: viper.GetDuration("admin.session_ttl"),
+		},
+		Wallet: service.WalletConfig{
+			CoinGeckoAPIKey: os.Getenv("COINGECKO_API_KEY"),
+		},
+		Quotes: quoteCfg,
+		Orders: service.OrderConfig{
+			TTL:           viper.GetDuration("orders.ttl"),
+			MaxTTL:        viper.GetDuration("orders.max_ttl"),
+			SweepInterval: viper.GetDuration("orders.sweep_interval"),
+			BatchSize:     viper.GetInt("orders.batch_size"),
+			ClaimLease:    viper.GetDuration("orders.claim_lease"),
+			BotToken:      botToken,
+		},
+		Scanner: service.ScannerConfig{
+			Enabled:       viper.GetBool("scanner.enabled"),
+			Confirmations: viper.GetInt64("scanner.confirmations"),
+			PollInterval:  viper.GetDuration("scanner.poll_interval"),
+			StartBlock:    viper.GetInt64("scanner.start_block"),
+			BatchBlocks:   viper.GetInt64("scanner.batch_blocks"),
+		},
+		Withdrawals: service.WithdrawalConfig{
+			Workers:      viper.GetInt("withdrawals.workers"),
+			PollInterval: viper.GetDuration("withdrawals.poll_interval"),
+			Lease:        viper.GetDuration("withdrawals.lease"),
+			MaxBackoff:   viper.GetDuration("withdrawals.max_backoff"),
+			MaxAttempts:  viper.GetInt("withdrawals.max_attempts"),
+		},
+		Tracker: service.TrackerConfig{
+			Confirmations: viper.GetInt64("tracker.confirmations"),
+			PollInterval:  viper.GetDuration("tracker.poll_interval"),
+			BatchSize:     viper.GetInt("tracker.batch_size"),
+			ExpireAfter:   viper.GetDuration("tracker.expire_after"),
+		},
+		Settlement: service.SettlementConfig{
+			Enabled:         viper.GetBool("settlement.enabled"),
+			TreasuryAddress: viper.GetString("settlement.treasury_address"),
+			Interval:        viper.GetDuration("settlement.interval"),
+			PollInterval:    viper.GetDuration("settlement.poll_interval"),
+			MinAmount:       settlementMin,
+			Confirmations:   viper.GetInt64("settlement.confirmations"),
+			Lease:           viper.GetDuration("settlement.lease"),
+			MaxAttempts:     viper.GetInt("settlement.max_attempts"),
+			MaxBackoff:      viper.GetDuration("settlement.max_backoff"),
+		},
+		Gas: service.GasConfig{
+			FeePayerKey:    feePayerKey,
+			LowBalance:     gasLowBalance,
+			CheckInterval:  viper.GetDuration("gas.check_interval"),
+			ConfirmTimeout: viper.GetDuration("gas.confirm_timeout"),
+			PollInterval:   viper.GetDuration("gas.poll_interval"),
+		},
+		Alerts: service.AlertConfig{
+			ChatID:   viper.GetInt64("alerts.chat_id"),
+			Interval: viper.GetDuration("alerts.interval"),
+			BotToken: botToken,
+		},
+		Resources: service.ResourceConfig{
+			Enabled:      viper.GetBool("resources.enabled"),
+			TreasuryKey:  os.Getenv("ENERGY_TREASURY_PRIVATE_KEY"),
+			PollInterval: viper.GetDuration("resources.poll_interval"),
+			Lease:        viper.GetDuration("resources.lease"),
+			MaxHold:      viper.GetDuration("resources.max_hold"),
+			MaxAttempts:  viper.GetInt("resources.max_attempts"),
+			MaxBackoff:   viper.GetDuration("resources.max_backoff"),
+		},
+		Idempotency: service.IdempotencyConfig{
+			LockTTL:         viper.GetDuration("idempotency.lock_ttl"),
+			Retention:       viper.GetDuration("idempotency.retention"),
+			CleanupInterval: viper.GetDuration("idempotency.cleanup_interval"),
+		},
+	})
+	go service.Scanner.Run(context.Background())
+	go service.Tracker.Run(context.Background())
+	go service.Withdrawal.Run(context.Background())
+	go service.Idempotency.Run(context.Background())
+	go service.Settlement.Run(context.Background())
+	go service.Order.Run(context.Background())
+	go service.Gas.Run(context.Background())
+	go service.Resources.Run(context.Background())
+	handler := handler.NewHandler(service, handler.Config{
+		BotToken:       botToken,
+		InitDataTTL:    initDataTTL,
+		ReceiptsDir:    receiptsDir,
+		MaxReceiptSize: viper.GetInt64("orders.max_receipt_size"),
+	})
 
 	srv := new(production.Server)
 	if err := srv.Run(os.Getenv("PORT"), handler.InitRoute()); err != nil {
@@ -54,3 +212,24 @@ func InitConfig() error {
 	viper.SetConfigName("config")
 	return viper.ReadInConfig()
 }
+
+// LoadNetwork возвращает профиль сети из network.<active>. TRON_NETWORK переопределяет network.active.
+func LoadNetwork() (tronclient.Network, error) {
+	name := viper.GetString("network.active")
+	if env := os.Getenv("TRON_NETWORK"); env != "" {
+		name = env
+	}
+	if !viper.IsSet("network." + name) {
+		return tronclient.Network{}, fmt.Errorf("unknown network %q", name)
+	}
+
+	var network tronclient.Network
+	if err := viper.UnmarshalKey("network."+name, &network); err != nil {
+		return network, err
+	}
+	network.Name = name
+	if network.GridURL == "" || network.USDTContract == "" {
+		return network, fmt.Errorf("network %q: trongrid_url and usdt_contract are required", name)
+	}
+	return network, nil
+}
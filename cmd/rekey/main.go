@@ -0,0 +1,94 @@
+// Команда rekey перешифровывает ключи всех кошельков текущей версией мастер-ключа.
+//
+// Ротация без простоя:
+//  1. добавить новый ключ в WALLET_MASTER_KEYS (старый оставить) и перезапустить сервер —
+//     он читает обе версии, а новые кошельки шифрует новой;
+//  2. запустить `go run ./cmd/rekey`;
+//  3. когда записей со старой версией не осталось, убрать старый ключ из окружения.
+package main
+
+import (
+	"flag"
+	"os"
+	"production_wallet_back/pkg/keystore"
+	"production_wallet_back/pkg/repository"
+
+	"github.com/joho/godotenv"
+	_ "github.com/lib/pq"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/viper"
+)
+
+func main() {
+	batchSize := flag.Int("batch", 100, "количество кошельков за один проход")
+	flag.Parse()
+
+	logrus.SetFormatter(new(logrus.JSONFormatter))
+	if err := godotenv.Load(); err != nil {
+		logrus.Infof("Ошибка инициализации переменных окружения .env: %s \n", err)
+	}
+
+	viper.AddConfigPath("configs")
+	viper.SetConfigName("config")
+	if err := viper.ReadInConfig(); err != nil {
+		logrus.Fatalf("Ошибка (viper) при инициализации конгфига .yaml: %s \n", err.Error())
+	}
+
+	keys, err := keystore.NewFromEnv()
+	if err != nil {
+		logrus.Fatalf("Ошибка при инициализации хранилища ключей: %s \n", err.Error())
+	}
+
+	db, err := repository.NewPostgresDB(repository.Config{
+		Host:     viper.GetString("db.host"),
+		Port:     viper.GetString("db.port"),
+		Username: viper.GetString("db.username"),
+		Password: os.Getenv("DB_PASS_LOCAL"),
+		DBName:   viper.GetString("db.dbname"),
+		SSLMode:  viper.GetString("db.sslmode"),
+	})
+	if err != nil {
+		logrus.Fatalf("Ошибка при инициализации базы данных: %s \n", err.Error())
+	}
+	repos := repository.NewRepository(db)
+
+	current := keys.CurrentVersion()
+	logrus.Infof("Перешифровка ключей кошельков в версию %d", current)
+
+	rewrapped, failed := 0, 0
+	failedIDs := make(map[int64]bool)
+	for {
+		batch, err := repos.Wallet.GetWalletKeysToRewrap(current, *batchSize+len(failedIDs))
+		if err != nil {
+			logrus.Fatalf("Ошибка при чтении кошельков: %s", err)
+		}
+
+		progress := false
+		for _, w := range batch {
+			if failedIDs[w.WalletID] {
+				continue
+			}
+			progress = true
+
+			key, err := keys.Rewrap(w.EncryptedKey)
+			if err == nil {
+				err = repos.Wallet.UpdateWalletKey(w.WalletID, w.EncryptedKey, key)
+			}
+			if err != nil {
+				logrus.Errorf("Кошелёк %d (%s): %s", w.WalletID, w.Address, err)
+				failedIDs[w.WalletID] = true
+				failed++
+				continue
+			}
+			rewrapped++
+		}
+		if !progress {
+			break
+		}
+	}
+
+	logrus.Infof("Готово: перешифровано %d, ошибок %d", rewrapped, failed)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,96 @@
+package models
+
+import "time"
+
+// Роли пользователей админки
+const (
+	AdminRoleViewer     = "viewer"     // только просмотр
+	AdminRoleOperator   = "operator"   // оплата и отмена заказов
+	AdminRoleFinance    = "finance"    // возвраты и отмена заказов
+	AdminRoleSuperadmin = "superadmin" // всё, включая экспорт ключей и управление админами
+)
+
+// Права, которыми закрыты маршруты /api/admin
+const (
+	PermOrdersRead    = "orders:read"
+	PermOrdersOperate = "orders:operate" // взять, отпустить, оплатить заказ
+	PermOrdersCancel  = "orders:cancel"
+	PermOrdersRefund  = "orders:refund"
+	PermWalletsRead   = "wallets:read"
+	PermLedgerRead    = "ledger:read"   // журнал, сверка и неуспешные транзакции
+	PermLedgerAdjust  = "ledger:adjust" // ручное зачисление на кошелёк против внешнего счёта
+	PermAuditRead     = "audit:read"
+	PermKeysExport    = "keys:export"
+	PermAdminsManage  = "admins:manage"
+	PermStakeManage   = "stake:manage" // заморозка TRX казначейства под энергию
+)
+
+var readPermissions = []string{PermOrdersRead, PermWalletsRead, PermLedgerRead}
+
+var rolePermissions = map[string][]string{
+	AdminRoleViewer:   readPermissions,
+	AdminRoleOperator: append([]string{PermOrdersOperate, PermOrdersCancel}, readPermissions...),
+	AdminRoleFinance:  append([]string{PermOrdersCancel, PermOrdersRefund, PermLedgerAdjust, PermAuditRead, PermStakeManage}, readPermissions...),
+	AdminRoleSuperadmin: append([]string{PermOrdersOperate, PermOrdersCancel, PermOrdersRefund, PermLedgerAdjust, PermAuditRead, PermStakeManage, PermKeysExport, PermAdminsManage},
+		readPermissions...),
+}
+
+// ValidAdminRole роль входит в список известных
+func ValidAdminRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
+
+// RoleHasPermission у роли есть право perm
+func RoleHasPermission(role, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+type AdminUser struct {
+	ID           int64      `db:"id" json:"id"`
+	Username     string     `db:"username" json:"username"`
+	PasswordHash string     `db:"password_hash" json:"-"`
+	Role         string     `db:"role" json:"role"`
+	Disabled     bool       `db:"disabled" json:"disabled"`
+	LastLoginAt  *time.Time `db:"last_login_at" json:"last_login_at,omitempty"`
+	CreatedAt    time.Time  `db:"created_at" json:"created_at"`
+}
+
+type AdminSession struct {
+	ID        int64      `db:"id" json:"id"`
+	AdminID   int64      `db:"admin_id" json:"admin_id"`
+	TokenHash string     `db:"token_hash" json:"-"`
+	UserAgent string     `db:"user_agent" json:"user_agent"`
+	IP        string     `db:"ip" json:"ip"`
+	ExpiresAt time.Time  `db:"expires_at" json:"expires_at"`
+	RevokedAt *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt time.Time  `db:"created_at" json:"created_at"`
+}
+
+// AdminToken токен сессии админки, выдаётся при входе один раз
+type AdminToken struct {
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type AdminLoginInput struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type AdminCreateInput struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+	Role     string `json:"role" binding:"required"`
+}
+
+// AdminUpdateInput пустые поля не меняются
+type AdminUpdateInput struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
@@ -0,0 +1,107 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Действия, которые пишутся в журнал аудита
+const (
+	AuditAdminLogin    = "admin.login"
+	AuditAdminLogout   = "admin.logout"
+	AuditAdminCreate   = "admin.create"
+	AuditAdminUpdate   = "admin.update"
+	AuditAdminPassword = "admin.password"
+
+	AuditKeyExport       = "wallet.key_export"
+	AuditDeposit         = "wallet.deposit"
+	AuditGasTopUp        = "wallet.gas_topup"
+	AuditVirtualWithdraw = "wallet.virtual_withdraw"
+	AuditDepositCredit   = "deposit.credit"
+
+	AuditWithdrawalRequest = "withdrawal.request"
+	AuditWithdrawalFinish  = "withdrawal.finish"
+	AuditSettlementCreate  = "settlement.create"
+	AuditSettlementFinish  = "settlement.finish"
+	AuditStake             = "treasury.stake"
+
+	AuditOrderCreate     = "order.create"
+	AuditOrderTransition = "order.transition"
+	AuditOrderClaim      = "order.claim"
+	AuditOrderRelease    = "order.release"
+	AuditOrderPay        = "order.pay"
+)
+
+// RequestMeta кто и откуда выполняет действие. Для фоновых воркеров — только Actor = system.
+type RequestMeta struct {
+	Actor          string `json:"-"`
+	IP             string `json:"ip,omitempty"`
+	UserAgent      string `json:"user_agent,omitempty"`
+	Method         string `json:"method,omitempty"`
+	Path           string `json:"path,omitempty"`
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// SystemRequest метаданные действий фоновых воркеров
+func SystemRequest() RequestMeta {
+	return RequestMeta{Actor: ActorSystem}
+}
+
+// AuditEntry запись журнала аудита. Hash считается от PrevHash и остальных полей (pkg/audit).
+type AuditEntry struct {
+	ID        int64         `db:"id" json:"id"`
+	Actor     string        `db:"actor" json:"actor"`
+	Action    string        `db:"action" json:"action"`
+	Target    string        `db:"target" json:"target"`
+	Metadata  AuditSnapshot `db:"metadata" json:"metadata"`
+	Before    AuditSnapshot `db:"before" json:"before"`
+	After     AuditSnapshot `db:"after" json:"after"`
+	PrevHash  string        `db:"prev_hash" json:"prev_hash"`
+	Hash      string        `db:"hash" json:"hash"`
+	CreatedAt time.Time     `db:"created_at" json:"created_at"`
+}
+
+// AuditSnapshot JSON из журнала ровно в том виде, в каком от него считался хэш; NULL — пустой
+type AuditSnapshot []byte
+
+func (s *AuditSnapshot) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*s = nil
+	case []byte:
+		*s = append(AuditSnapshot(nil), v...)
+	case string:
+		*s = AuditSnapshot(v)
+	default:
+		return fmt.Errorf("cannot scan %T into AuditSnapshot", src)
+	}
+	return nil
+}
+
+func (s AuditSnapshot) MarshalJSON() ([]byte, error) {
+	if len(s) == 0 {
+		return []byte("null"), nil
+	}
+	return s, nil
+}
+
+// AuditFilter отбор записей журнала; пустые поля не фильтруют. BeforeID — страница до этой записи.
+type AuditFilter struct {
+	Actor    string
+	Action   string
+	Target   string
+	Since    *time.Time
+	Until    *time.Time
+	BeforeID int64
+	Limit    int
+}
+
+// AuditVerification итог проверки цепочки журнала
+type AuditVerification struct {
+	Checked  int64  `json:"checked"`
+	Valid    bool   `json:"valid"`
+	BrokenID int64  `json:"broken_id,omitempty"`
+	Reason   string `json:"reason,omitempty"`
+	LastID   int64  `json:"last_id"`
+	LastHash string `json:"last_hash"`
+}
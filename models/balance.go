@@ -1,16 +1,22 @@
 package models
 
-import "time"
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
 
 type Balance struct {
-	ID          int64     `db:"id" json:"id"`
-	WalletID    int64     `db:"wallet_id" json:"wallet_id"`
-	TokenSymbol string    `db:"token_symbol" json:"token_symbol"`
-	Amount      float64   `db:"amount" json:"amount"` // можно использовать decimal.Decimal для высокой точности
-	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+	ID          int64        `db:"id" json:"id"`
+	WalletID    int64        `db:"wallet_id" json:"wallet_id"`
+	TokenSymbol string       `db:"token_symbol" json:"token_symbol"`
+	Amount      money.Amount `db:"amount" json:"amount"`
+	UpdatedAt   time.Time    `db:"updated_at" json:"updated_at"`
 }
 
+// DepositInput ручное зачисление. Reference — внешний номер платежа: зачисление с уже
+// использованным номером не проводится повторно.
 type DepositInput struct {
-	TokenSymbol string  `json:"token_symbol" binding:"required"`
-	Amount      float64 `json:"amount" binding:"required"`
+	TokenSymbol string       `json:"token_symbol" binding:"required"`
+	Amount      money.Amount `json:"amount" binding:"required"`
+	Reference   string       `json:"reference" binding:"required,max=80"`
 }
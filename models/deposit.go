@@ -0,0 +1,21 @@
+package models
+
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
+
+// Deposit входящий перевод на кошелёк пользователя, найденный сканером
+type Deposit struct {
+	ID          int64        `json:"id" db:"id"`
+	WalletID    int64        `json:"wallet_id" db:"wallet_id"`
+	TxHash      string       `json:"tx_hash" db:"tx_hash"`
+	LogIndex    int          `json:"log_index" db:"log_index"`
+	BlockNumber int64        `json:"block_number" db:"block_number"`
+	FromAddress string       `json:"from_address" db:"from_address"`
+	TokenSymbol string       `json:"token_symbol" db:"token_symbol"`
+	Amount      money.Amount `json:"amount" db:"amount"`
+	Status      string       `json:"status" db:"status"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	CreditedAt  *time.Time   `json:"credited_at" db:"credited_at"`
+}
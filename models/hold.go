@@ -0,0 +1,38 @@
+package models
+
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
+
+// Статусы удержания
+const (
+	HoldActive   = "active"
+	HoldCaptured = "captured" // заказ оплачен, сумма стала виртуальным списанием
+	HoldReleased = "released"
+	HoldRefunded = "refunded" // оплаченный заказ возвращён, виртуальное списание аннулировано
+)
+
+// BalanceHold удержание суммы заказа с доступного остатка кошелька
+type BalanceHold struct {
+	ID                int64        `json:"id" db:"id"`
+	WalletID          int64        `json:"wallet_id" db:"wallet_id"`
+	OrderID           int64        `json:"order_id" db:"order_id"`
+	Amount            money.Amount `json:"amount" db:"amount"`
+	Status            string       `json:"status" db:"status"`
+	VirtualTransferID *int64       `json:"virtual_transfer_id,omitempty" db:"virtual_transfer_id"`
+	CreatedAt         time.Time    `json:"created_at" db:"created_at"`
+	ClosedAt          *time.Time   `json:"closed_at,omitempty" db:"closed_at"`
+}
+
+// ReservedBalance части остатка кошелька в сети, уже обещанные другим списаниям
+type ReservedBalance struct {
+	PendingVirtual money.Amount `json:"pending_virtual" db:"pending_virtual"` // виртуальные списания до расчёта
+	Held           money.Amount `json:"held" db:"held"`                       // удержания под неоплаченные заказы
+	Withdrawing    money.Amount `json:"withdrawing" db:"withdrawing"`         // незавершённые выводы
+}
+
+// Total сумма всех резервов
+func (r ReservedBalance) Total() money.Amount {
+	return r.PendingVirtual + r.Held + r.Withdrawing
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyKey запрос, выполненный с заголовком Idempotency-Key, и его ответ
+type IdempotencyKey struct {
+	ID           int64      `db:"id"`
+	TelegramID   int64      `db:"telegram_id"`
+	Key          string     `db:"key"`
+	Method       string     `db:"method"`
+	Path         string     `db:"path"`
+	RequestHash  string     `db:"request_hash"`
+	StatusCode   *int       `db:"status_code"` // nil, пока запрос выполняется
+	ContentType  string     `db:"content_type"`
+	ResponseBody []byte     `db:"response_body"`
+	LockedUntil  time.Time  `db:"locked_until"`
+	CreatedAt    time.Time  `db:"created_at"`
+	CompletedAt  *time.Time `db:"completed_at"`
+}
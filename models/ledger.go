@@ -0,0 +1,82 @@
+package models
+
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
+
+// Виды счетов журнала. Счёт определяется видом, токеном и, для кошельков пользователей, wallet_id.
+const (
+	AccountWallet             = "wallet"              // средства пользователя
+	AccountHotWallet          = "hot_wallet"          // горячий кошелёк сервиса, он же плательщик газа
+	AccountFees               = "fees"                // комиссии сети, оплаченные сервисом
+	AccountPendingWithdrawals = "pending_withdrawals" // выводы, списанные с пользователя, но ещё не ушедшие в сеть
+	AccountOrderSettlement    = "order_settlement"    // оплаты заказов, ожидающие расчёта
+	AccountExternal           = "external"            // внешний мир: блокчейн и ручные корректировки
+)
+
+// Виды проводок
+const (
+	EntryOpeningBalance      = "opening_balance"
+	EntryDeposit             = "deposit"
+	EntryManualDeposit       = "manual_deposit"
+	EntryWithdrawalReserve   = "withdrawal_reserve"
+	EntryWithdrawalSettle    = "withdrawal_settle"
+	EntryWithdrawalRelease   = "withdrawal_release"
+	EntryGasTopUp            = "gas_topup"
+	EntryVirtualTransfer     = "virtual_transfer"      // виртуальное списание: с кошелька в ожидающие расчёта
+	EntryVirtualTransferVoid = "virtual_transfer_void" // возврат заказа: обратно на кошелёк
+	EntrySettlement          = "settlement"
+)
+
+// Posting изменение одного счёта. Положительная сумма увеличивает остаток счёта,
+// отрицательная уменьшает. WalletID заполняется только для AccountWallet.
+type Posting struct {
+	Account     string       `json:"account"`
+	WalletID    int64        `json:"wallet_id,omitempty"`
+	TokenSymbol string       `json:"token_symbol"`
+	Amount      money.Amount `json:"amount"`
+}
+
+// LedgerEntry проводка журнала. Сумма Postings по каждому токену равна нулю.
+// Reference делает проводку идемпотентной: вторая проводка с тем же Reference не записывается.
+// Overdraft разрешает увести кошелёк в минус: для фактов, которые уже произошли в сети
+// и не могут быть отклонены. Такой минус потом виден в отчётах.
+type LedgerEntry struct {
+	ID          int64     `json:"id" db:"id"`
+	Kind        string    `json:"kind" db:"kind"`
+	Reference   string    `json:"reference,omitempty" db:"reference"`
+	Description string    `json:"description,omitempty" db:"description"`
+	CreatedAt   time.Time `json:"created_at" db:"created_at"`
+	Postings    []Posting `json:"postings" db:"-"`
+	Overdraft   bool      `json:"-" db:"-"`
+}
+
+// LedgerAccount счёт журнала с остатком, посчитанным по проводкам
+type LedgerAccount struct {
+	ID          int64        `json:"id" db:"id"`
+	Code        string       `json:"code" db:"code"`
+	Kind        string       `json:"kind" db:"kind"`
+	WalletID    *int64       `json:"wallet_id,omitempty" db:"wallet_id"`
+	TokenSymbol string       `json:"token_symbol" db:"token_symbol"`
+	Balance     money.Amount `json:"balance" db:"balance"`
+}
+
+// LedgerLine строка выписки по счёту
+type LedgerLine struct {
+	EntryID     int64        `json:"entry_id" db:"entry_id"`
+	Kind        string       `json:"kind" db:"kind"`
+	Reference   string       `json:"reference,omitempty" db:"reference"`
+	Description string       `json:"description,omitempty" db:"description"`
+	TokenSymbol string       `json:"token_symbol" db:"token_symbol"`
+	Amount      money.Amount `json:"amount" db:"amount"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+}
+
+// BalanceMismatch остаток в balances, который разошёлся с журналом
+type BalanceMismatch struct {
+	WalletID      int64        `json:"wallet_id" db:"wallet_id"`
+	TokenSymbol   string       `json:"token_symbol" db:"token_symbol"`
+	Balance       money.Amount `json:"balance" db:"balance"`
+	LedgerBalance money.Amount `json:"ledger_balance" db:"ledger_balance"`
+}
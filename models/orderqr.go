@@ -1,10 +1,87 @@
 package models
 
+import (
+	"production_wallet_back/pkg/money"
+	"production_wallet_back/pkg/sbpqr"
+	"time"
+)
+
+// Состояния заказа
+const (
+	OrderCreated          = "created"
+	OrderAwaitingOperator = "awaiting_operator"
+	OrderPaid             = "paid"
+	OrderExpired          = "expired"
+	OrderCancelled        = "cancelled"
+	OrderRefunded         = "refunded"
+)
+
+// Инициаторы переходов, кроме пользователя (user:<telegram_id>) и оператора (operator:<имя>)
+const (
+	ActorSystem   = "system"
+	ActorOperator = "operator"
+	ActorAdmin    = "admin"
+)
+
 type OrderQR struct {
-	Id         int64   `json:"id" db:"id"`
-	TelegramId int64   `json:"telegram_id" db:"telegram_id"`
-	QRCode     string  `json:"qr_code" db:"qrcode"`
-	Summa      float64 `json:"summa" db:"summa"`
-	Crypto     float64 `json:"crypto" db:"crypto"`
-	IsPaid     bool    `json:"is_paid" db:"ispaid"`
+	Id         int64          `json:"id" db:"id"`
+	TelegramId int64          `json:"telegram_id" db:"telegram_id"`
+	QRCode     string         `json:"qr_code" db:"qrcode"`
+	Summa      float64        `json:"summa" db:"summa"`
+	Crypto     money.Amount   `json:"crypto" db:"crypto"`
+	IsPaid     bool           `json:"is_paid" db:"ispaid"` // устарело, state = paid
+	State      string         `json:"state" db:"state"`
+	CreatedAt  time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt  time.Time      `json:"updated_at" db:"updated_at"`
+	ExpiresAt  time.Time      `json:"expires_at" db:"expires_at"` // после этого заказ не оплачивается и уходит в expired
+	QuoteID    *string        `json:"quote_id,omitempty" db:"quote_id"`
+	QRData     *sbpqr.Payment `json:"qr_data,omitempty" db:"qr_data"` // разобранный QRCode
+
+	ClaimedBy      *string    `json:"claimed_by,omitempty" db:"claimed_by"` // оператор, взявший заказ в работу
+	ClaimExpiresAt *time.Time `json:"claim_expires_at,omitempty" db:"claim_expires_at"`
+	BankReference  *string    `json:"bank_reference,omitempty" db:"bank_reference"` // номер операции в банке оператора
+	ReceiptPath    *string    `json:"-" db:"receipt_path"`
+}
+
+// Действия операторов с заказом
+const (
+	OrderActionClaim   = "claim"
+	OrderActionRelease = "release"
+	OrderActionPay     = "pay"
+)
+
+// OrderAction действие оператора с заказом
+type OrderAction struct {
+	ID        int64     `json:"id" db:"id"`
+	OrderID   int64     `json:"order_id" db:"order_id"`
+	Actor     string    `json:"actor" db:"actor"`
+	Action    string    `json:"action" db:"action"`
+	Details   string    `json:"details,omitempty" db:"details"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// OrderPayment отметка об оплате QR оператором
+type OrderPayment struct {
+	BankReference string
+	ReceiptPath   string // пусто — без чека
+}
+
+// OrderTransition переход заказа между состояниями
+type OrderTransition struct {
+	ID        int64     `json:"id" db:"id"`
+	OrderID   int64     `json:"order_id" db:"order_id"`
+	FromState string    `json:"from_state" db:"from_state"`
+	ToState   string    `json:"to_state" db:"to_state"`
+	Actor     string    `json:"actor" db:"actor"`
+	Reason    string    `json:"reason,omitempty" db:"reason"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// OrderState заказ вместе с удержанием, историей переходов и действиями операторов
+type OrderState struct {
+	OrderQR
+	HasReceipt  bool              `json:"has_receipt"`
+	Hold        *BalanceHold      `json:"hold,omitempty"`
+	Transitions []OrderTransition `json:"transitions"`
+	Actions     []OrderAction     `json:"actions"`
 }
@@ -0,0 +1,22 @@
+package models
+
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
+
+// Quote зафиксированный курс конвертации. Amount в FromCurrency, Converted в ToCurrency.
+// Signature — HMAC полей котировки, по ней заказ проверяет, что суммы выдал сервер.
+type Quote struct {
+	ID           string       `json:"id" db:"id"`
+	TelegramID   int64        `json:"-" db:"telegram_id"`
+	FromCurrency string       `json:"from" db:"from_currency"`
+	ToCurrency   string       `json:"to" db:"to_currency"`
+	Rate         float64      `json:"rate" db:"rate"`
+	Amount       money.Amount `json:"amount" db:"amount"`
+	Converted    money.Amount `json:"converted" db:"converted"`
+	Signature    string       `json:"signature" db:"signature"`
+	ExpiresAt    time.Time    `json:"expires_at" db:"expires_at"`
+	UsedAt       *time.Time   `json:"-" db:"used_at"`
+	CreatedAt    time.Time    `json:"-" db:"created_at"`
+}
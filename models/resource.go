@@ -0,0 +1,50 @@
+package models
+
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
+
+// Состояния делегирования энергии
+const (
+	DelegationDelegating = "delegating" // делегирование подписано, ждёт блока
+	DelegationActive     = "active"     // энергия на кошельке пользователя
+	DelegationReclaiming = "reclaiming" // отзыв подписан, ждёт блока
+	DelegationReclaimed  = "reclaimed"
+	DelegationFailed     = "failed" // делегировать не удалось, перевод оплачивается сжиганием TRX
+)
+
+// EnergyDelegation энергия со стейка казначейства, выданная кошельку под один перевод USDT
+type EnergyDelegation struct {
+	ID              int64        `json:"id" db:"id"`
+	Reference       string       `json:"reference" db:"reference"`
+	ReceiverAddress string       `json:"receiver_address" db:"receiver_address"`
+	Energy          int64        `json:"energy" db:"energy"`
+	Amount          money.Amount `json:"amount" db:"amount"` // делегированный стейк, TRX
+	State           string       `json:"state" db:"state"`
+	Released        bool         `json:"released" db:"released"` // перевод завершён, энергию можно забирать
+	DelegateTxID    string       `json:"delegate_tx_id,omitempty" db:"delegate_tx_id"`
+	ReclaimTxID     string       `json:"reclaim_tx_id,omitempty" db:"reclaim_tx_id"`
+	SignedTx        string       `json:"-" db:"signed_tx"`
+	TxExpiresAt     *time.Time   `json:"-" db:"tx_expires_at"`
+	Attempts        int          `json:"attempts" db:"attempts"`
+	LastError       string       `json:"last_error,omitempty" db:"last_error"`
+	NextRunAt       time.Time    `json:"-" db:"next_run_at"`
+	LeaseToken      string       `json:"-" db:"lease_token"`
+	LockedUntil     *time.Time   `json:"-" db:"locked_until"`
+	CreatedAt       time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt       time.Time    `json:"updated_at" db:"updated_at"`
+}
+
+// ResourceStatus стейк казначейства и делегирования, которые ещё не отозваны
+type ResourceStatus struct {
+	TreasuryAddress string             `json:"treasury_address"`
+	DelegatableTRX  money.Amount       `json:"delegatable_trx"`
+	Energy          int64              `json:"energy"`
+	Delegations     []EnergyDelegation `json:"delegations"`
+}
+
+// StakeInput заморозка TRX казначейства под энергию
+type StakeInput struct {
+	Amount money.Amount `json:"amount" binding:"required"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+type Session struct {
+	ID               int64      `db:"id" json:"id"`
+	TelegramID       int64      `db:"telegram_id" json:"telegram_id"`
+	RefreshTokenHash string     `db:"refresh_token_hash" json:"-"`
+	UserAgent        string     `db:"user_agent" json:"user_agent"`
+	ExpiresAt        time.Time  `db:"expires_at" json:"expires_at"`
+	RevokedAt        *time.Time `db:"revoked_at" json:"revoked_at,omitempty"`
+	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
+}
+
+type TokenPair struct {
+	AccessToken     string    `json:"access_token"`
+	AccessExpiresAt time.Time `json:"access_expires_at"`
+	RefreshToken    string    `json:"refresh_token"`
+}
+
+type RefreshInput struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+type LogoutInput struct {
+	All bool `json:"all"` // завершить все сессии пользователя (logout-everywhere)
+}
@@ -1,20 +1,81 @@
 package models
 
-import "time"
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
+
+// Статусы транзакций в сети
+const (
+	TxPending   = "pending"
+	TxConfirmed = "confirmed"
+	TxFailed    = "failed"
+	TxExpired   = "expired"
+)
 
 type Transaction struct {
-	ID           int64     `db:"id"`
-	FromWalletID int64     `db:"from_wallet_id"`
-	ToAddress    string    `db:"to_address"`
-	TokenSymbol  string    `db:"token_symbol"`
-	Amount       float64   `db:"amount"`  // как и в балансе — по желанию можно заменить на decimal.Decimal
-	TxHash       *string   `db:"tx_hash"` // может быть NULL
-	Status       string    `db:"status"`
-	CreatedAt    time.Time `db:"created_at"`
+	ID            int64        `db:"id"`
+	FromWalletID  int64        `db:"from_wallet_id"`
+	ToAddress     string       `db:"to_address"`
+	TokenSymbol   string       `db:"token_symbol"`
+	Amount        money.Amount `db:"amount"`
+	TxHash        *string      `db:"tx_hash"` // может быть NULL
+	Status        string       `db:"status"`
+	CreatedAt     time.Time    `db:"created_at"`
+	ExpiresAt     *time.Time   `db:"expires_at"`
+	BlockNumber   *int64       `db:"block_number"`
+	Result        string       `db:"result"`
+	FailureReason string       `db:"failure_reason"`
+	EnergyUsed    int64        `db:"energy_used"`
+	EnergyFee     int64        `db:"energy_fee"`
+	NetFee        int64        `db:"net_fee"`
+	Fee           int64        `db:"fee"`
 }
 
 type WithdrawInput struct {
-	Amount      float64 `json:"amount" binding:"required"`
-	ToAddress   string  `json:"to_address" binding:"required"`
-	TokenSymbol string  `json:"token_symbol" binding:"required"`
+	Amount      money.Amount `json:"amount" binding:"required"`
+	ToAddress   string       `json:"to_address" binding:"required"`
+	TokenSymbol string       `json:"token_symbol" binding:"required"`
+}
+
+type GasTopUp struct {
+	TxID        string       `json:"tx_id,omitempty"`
+	Address     string       `json:"address"`
+	RequiredTRX money.Amount `json:"required_trx"`
+	BalanceTRX  money.Amount `json:"balance_trx"`
+	AddedTRX    money.Amount `json:"added_trx"`
+	Confirmed   bool         `json:"confirmed"` // перевод TRX подтверждён (или докидывать не понадобилось)
+}
+
+// GasTopUpTx перевод TRX с плательщика газа на address. Статусы — как у транзакций в сети.
+type GasTopUpTx struct {
+	ID          int64        `db:"id"`
+	TxID        string       `db:"tx_id"`
+	Address     string       `db:"address"`
+	Amount      money.Amount `db:"amount"`
+	Description string       `db:"description"`
+	Status      string       `db:"status"`
+	ExpiresAt   time.Time    `db:"expires_at"`
+	CreatedAt   time.Time    `db:"created_at"`
+	UpdatedAt   time.Time    `db:"updated_at"`
+}
+
+// GasStatus остаток кошелька-плательщика газа
+type GasStatus struct {
+	Address    string       `json:"address"`
+	BalanceTRX money.Amount `json:"balance_trx"`
+	LowBalance money.Amount `json:"low_balance"`
+	Low        bool         `json:"low"`
+}
+
+type GasTopUpInput struct {
+	ToAddress string       `json:"to_address" binding:"required"`
+	Amount    money.Amount `json:"amount" binding:"required"` // сумма USDT будущего перевода
+}
+
+// FailedTransaction неуспешная транзакция с владельцем кошелька, для админки
+type FailedTransaction struct {
+	Transaction
+	UserID      int64  `json:"user_id" db:"user_id"`
+	FromAddress string `json:"from_address" db:"from_address"`
 }
@@ -1,12 +1,19 @@
 package models
 
-import "time"
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
 
+// VirtualTransfer виртуальное списание. SettlementID — пакет расчёта, в который оно попало,
+// TxHash — перевод этого пакета в сети.
 type VirtualTransfer struct {
-	ID          int64      `db:"id"`
-	WalletID    int64      `db:"wallet_id"`
-	Amount      float64    `db:"amount"`
-	Status      string     `db:"status"`
-	CreatedAt   time.Time  `db:"created_at"`
-	ProcessedAt *time.Time `db:"processed_at"`
+	ID           int64        `db:"id"`
+	WalletID     int64        `db:"wallet_id"`
+	Amount       money.Amount `db:"amount"`
+	Status       string       `db:"status"`
+	SettlementID *int64       `db:"settlement_id"`
+	TxHash       *string      `db:"tx_hash"`
+	CreatedAt    time.Time    `db:"created_at"`
+	ProcessedAt  *time.Time   `db:"processed_at"`
 }
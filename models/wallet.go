@@ -1,34 +1,38 @@
 package models
 
-import "time"
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
 
 type Wallet struct {
-	ID         int64     `db:"id" json:"id"`
-	UserID     int64     `db:"user_id" json:"user_id"`
-	PrivateKey string    `db:"private_key" json:"private_key"`
-	Address    string    `db:"address" json:"address"`
-	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	ID        int64     `db:"id" json:"id"`
+	UserID    int64     `db:"user_id" json:"user_id"`
+	Address   string    `db:"address" json:"address"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
 }
 type WalletResponce struct {
 	WalletID int64  `json:"id" db:"id"`
 	Address  string `json:"address" db:"address"`
 }
 type ConvertRequest struct {
-	Amount float64 `json:"amount"` // сумма
-	From   string  `json:"from"`   // исходная валюта, например: "RUB"
-	To     string  `json:"to"`     // целевая валюта, например: "USDT"
-	QRLink string  `json:"qr_link"`
+	Amount money.Amount `json:"amount"` // сумма
+	From   string       `json:"from"`   // исходная валюта, например: "RUB"
+	To     string       `json:"to"`     // целевая валюта, например: "USDT"
+	QRLink string       `json:"qr_link"`
 }
 
+// OrderCreateRequest суммы заказа берутся из котировки, выданной /convert
 type OrderCreateRequest struct {
-	Amount float64 `json:"amount"`
-	Crypto float64 `json:"crypto"`
-	QRLink string  `json:"qr_link"`
+	QuoteID    string `json:"quote_id" binding:"required"`
+	QRLink     string `json:"qr_link" binding:"required"`
+	TTLSeconds int64  `json:"ttl_seconds,omitempty"` // срок жизни QR, 0 — orders.ttl из конфига
 }
 
 type ConvertResponse struct {
-	ConvertedAmount float64 `json:"convertedAmount"`
-	Currency        string  `json:"currency"`
-	Wallet          string  `json:"wallet,omitempty"`
-	Message         string  `json:"message"`
+	ConvertedAmount money.Amount `json:"convertedAmount"`
+	Currency        string       `json:"currency"`
+	Wallet          string       `json:"wallet,omitempty"`
+	Message         string       `json:"message"`
+	Quote           *Quote       `json:"quote,omitempty"` // по quote.id создаётся заказ
 }
@@ -0,0 +1,15 @@
+package models
+
+// EncryptedKey приватный ключ кошелька в зашифрованном виде (envelope encryption).
+// KeyVersion = 0 означает старую запись, где private_key хранится открытым текстом.
+type EncryptedKey struct {
+	Ciphertext string `db:"private_key"`
+	WrappedKey string `db:"wrapped_key"`
+	KeyVersion int    `db:"key_version"`
+}
+
+type WalletKey struct {
+	WalletID int64  `db:"id"`
+	Address  string `db:"address"`
+	EncryptedKey
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"production_wallet_back/pkg/money"
+	"time"
+)
+
+// Состояния заявки на вывод
+const (
+	WithdrawalRequested  = "requested"
+	WithdrawalGasFunding = "gas_funding"
+	WithdrawalSigning    = "signing"
+	WithdrawalBroadcast  = "broadcast"
+	WithdrawalConfirmed  = "confirmed"
+	WithdrawalFailed     = "failed"
+)
+
+// WithdrawalJob заявка на вывод, которую асинхронно выполняет воркер
+type WithdrawalJob struct {
+	ID          int64        `json:"id" db:"id"`
+	WalletID    int64        `json:"-" db:"wallet_id"`
+	TelegramID  int64        `json:"-" db:"telegram_id"`
+	FromAddress string       `json:"from_address" db:"from_address"`
+	ToAddress   string       `json:"to_address" db:"to_address"`
+	TokenSymbol string       `json:"token_symbol" db:"token_symbol"`
+	Amount      money.Amount `json:"amount" db:"amount"`
+	State       string       `json:"state" db:"state"`
+	GasTxID     string       `json:"gas_tx_id,omitempty" db:"gas_tx_id"`
+	GasSignedTx string       `json:"-" db:"gas_signed_tx"`
+	GasAmount   money.Amount `json:"-" db:"gas_amount"`
+	TxID        string       `json:"tx_id,omitempty" db:"tx_id"`
+	SignedTx    string       `json:"-" db:"signed_tx"`
+	TxExpiresAt *time.Time   `json:"-" db:"tx_expires_at"`
+	Attempts    int          `json:"attempts" db:"attempts"`
+	LastError   string       `json:"last_error,omitempty" db:"last_error"`
+	NextRunAt   time.Time    `json:"-" db:"next_run_at"`
+	LeaseToken  string       `json:"-" db:"lease_token"`
+	LockedUntil *time.Time   `json:"-" db:"locked_until"`
+	CreatedAt   time.Time    `json:"created_at" db:"created_at"`
+	UpdatedAt   time.Time    `json:"updated_at" db:"updated_at"`
+}
@@ -0,0 +1,165 @@
+package audit
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"production_wallet_back/models"
+)
+
+// newChain цепочка из n записей, посчитанная так же, как её пишет репозиторий
+func newChain(n int) []models.AuditEntry {
+	start := time.Date(2026, 1, 2, 3, 4, 5, 123456000, time.UTC)
+	entries := make([]models.AuditEntry, n)
+	prev := GenesisHash
+	for i := range entries {
+		e := models.AuditEntry{
+			ID:        int64(i + 1),
+			Actor:     "admin:root",
+			Action:    "order.pay",
+			Target:    "order:" + string(rune('a'+i)),
+			Metadata:  models.AuditSnapshot(`{"ip":"10.0.0.1"}`),
+			Before:    models.AuditSnapshot(`{"state":"awaiting_operator"}`),
+			After:     models.AuditSnapshot(`{"state":"paid"}`),
+			CreatedAt: start.Add(time.Duration(i) * time.Second),
+			PrevHash:  prev,
+		}
+		e.Hash = Hash(prev, e)
+		prev = e.Hash
+		entries[i] = e
+	}
+	return entries
+}
+
+func verify(entries []models.AuditEntry) models.AuditVerification {
+	v := NewVerifier()
+	v.Add(entries)
+	return v.Result()
+}
+
+func TestVerifyValidChain(t *testing.T) {
+	chain := newChain(5)
+
+	// Пачки проверяются подряд, как их читает AuditService.Verify
+	v := NewVerifier()
+	if !v.Add(chain[:2]) || !v.Add(chain[2:]) || !v.Add(nil) {
+		t.Fatalf("valid chain rejected: %+v", v.Result())
+	}
+	got := v.Result()
+	if !got.Valid || got.Checked != 5 || got.LastID != 5 || got.LastHash != chain[4].Hash {
+		t.Fatalf("result = %+v", got)
+	}
+
+	if empty := verify(nil); !empty.Valid || empty.LastHash != GenesisHash {
+		t.Fatalf("empty chain = %+v", empty)
+	}
+}
+
+func TestVerifyDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name       string
+		tamper     func([]models.AuditEntry) []models.AuditEntry
+		wantBroken int64
+	}{
+		{name: "edited actor", wantBroken: 3, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[2].Actor = "admin:other"
+			return c
+		}},
+		{name: "edited action", wantBroken: 2, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[1].Action = "order.cancel"
+			return c
+		}},
+		{name: "edited target", wantBroken: 1, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[0].Target = "order:zzz"
+			return c
+		}},
+		{name: "edited metadata", wantBroken: 4, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[3].Metadata = models.AuditSnapshot(`{"ip":"10.0.0.2"}`)
+			return c
+		}},
+		{name: "edited before snapshot", wantBroken: 5, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[4].Before = nil
+			return c
+		}},
+		{name: "edited after snapshot", wantBroken: 3, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[2].After = models.AuditSnapshot(`{"state":"cancelled"}`)
+			return c
+		}},
+		{name: "edited time", wantBroken: 2, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[1].CreatedAt = c[1].CreatedAt.Add(-time.Hour)
+			return c
+		}},
+		{name: "edited hash", wantBroken: 3, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[2].Hash = strings.Repeat("f", 64)
+			return c
+		}},
+		{name: "deleted row", wantBroken: 4, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			return append(c[:2:2], c[3:]...)
+		}},
+		{name: "deleted first row", wantBroken: 2, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			return c[1:]
+		}},
+		{name: "reordered rows", wantBroken: 4, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			c[2], c[3] = c[3], c[2]
+			return c
+		}},
+		{name: "relinked prev_hash", wantBroken: 4, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			// Запись перепривязана к более ранней и перехэширована: ссылка не совпадает с соседом
+			c[3].PrevHash = c[1].Hash
+			c[3].Hash = Hash(c[3].PrevHash, c[3])
+			return c
+		}},
+		{name: "inserted row", wantBroken: 3, tamper: func(c []models.AuditEntry) []models.AuditEntry {
+			forged := c[2]
+			forged.ID, forged.Action = 99, "wallet.key_export"
+			forged.Hash = Hash(forged.PrevHash, forged)
+			return append(c[:2:2], append([]models.AuditEntry{forged}, c[2:]...)...)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := verify(tt.tamper(newChain(5)))
+			if got.Valid {
+				t.Fatalf("tampered chain accepted: %+v", got)
+			}
+			if got.BrokenID != tt.wantBroken {
+				t.Fatalf("broken id = %d, want %d (%s)", got.BrokenID, tt.wantBroken, got.Reason)
+			}
+		})
+	}
+}
+
+func TestVerifierStopsAfterBreak(t *testing.T) {
+	chain := newChain(4)
+	chain[1].Actor = "admin:other"
+
+	v := NewVerifier()
+	if v.Add(chain[:2]) {
+		t.Fatal("broken batch accepted")
+	}
+	// Следующая пачка сама по себе корректна, но результат остаётся на первой поломке
+	if v.Add(chain[2:]) {
+		t.Fatal("verifier continued after a break")
+	}
+	got := v.Result()
+	if got.BrokenID != 2 || got.Checked != 1 || got.LastID != 1 {
+		t.Fatalf("result = %+v", got)
+	}
+}
+
+func TestHashFieldBoundaries(t *testing.T) {
+	// Поля с префиксом длины: перенос символа между соседними полями меняет хэш
+	at := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := models.AuditEntry{Actor: "ab", Action: "c", CreatedAt: at}
+	b := models.AuditEntry{Actor: "a", Action: "bc", CreatedAt: at}
+	if Hash(GenesisHash, a) == Hash(GenesisHash, b) {
+		t.Fatal("hash does not separate fields")
+	}
+	// ID и зона времени в хэш не входят
+	c := a
+	c.ID, c.CreatedAt = 42, at.In(time.FixedZone("MSK", 3*60*60))
+	if Hash(GenesisHash, a) != Hash(GenesisHash, c) {
+		t.Fatal("hash depends on id or time zone")
+	}
+}
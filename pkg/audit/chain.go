@@ -0,0 +1,76 @@
+// Package audit считает и проверяет цепочку хэшей журнала аудита.
+//
+// Хэш записи — sha256 от хэша предыдущей записи и полей самой записи, каждое поле
+// с префиксом длины. Первая запись ссылается на GenesisHash.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"production_wallet_back/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GenesisHash prev_hash первой записи журнала
+var GenesisHash = strings.Repeat("0", 64)
+
+// Hash хэш записи e, следующей за записью с хэшем prevHash. ID в хэш не входит:
+// порядок задаёт сама цепочка.
+func Hash(prevHash string, e models.AuditEntry) string {
+	h := sha256.New()
+	for _, field := range []string{
+		prevHash,
+		e.CreatedAt.UTC().Format(time.RFC3339Nano),
+		e.Actor,
+		e.Action,
+		e.Target,
+		string(e.Metadata),
+		string(e.Before),
+		string(e.After),
+	} {
+		h.Write([]byte(strconv.Itoa(len(field)) + ":" + field + ";"))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verifier проверяет записи по порядку, пачками. Первая ошибка фиксируется в Result.
+type Verifier struct {
+	result models.AuditVerification
+}
+
+func NewVerifier() *Verifier {
+	return &Verifier{result: models.AuditVerification{Valid: true, LastHash: GenesisHash}}
+}
+
+// Add проверяет следующую пачку записей. false — цепочка сломана, дальше проверять нечего.
+func (v *Verifier) Add(entries []models.AuditEntry) bool {
+	for _, e := range entries {
+		if !v.result.Valid {
+			return false
+		}
+		switch {
+		case e.PrevHash != v.result.LastHash:
+			v.fail(e.ID, fmt.Sprintf("prev_hash %s does not match hash %s of the previous entry %d", e.PrevHash, v.result.LastHash, v.result.LastID))
+		case Hash(e.PrevHash, e) != e.Hash:
+			v.fail(e.ID, "entry contents do not match its hash")
+		default:
+			v.result.Checked++
+			v.result.LastID = e.ID
+			v.result.LastHash = e.Hash
+		}
+	}
+	return v.result.Valid
+}
+
+func (v *Verifier) Result() models.AuditVerification {
+	return v.result
+}
+
+func (v *Verifier) fail(id int64, reason string) {
+	v.result.Valid = false
+	v.result.BrokenID = id
+	v.result.Reason = reason
+}
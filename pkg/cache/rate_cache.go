@@ -31,7 +31,7 @@ func GetCachedRate(key string) (float64, bool) {
 		return 0, false
 	}
 
-	logrus.Infof("Курс взят из кэша для", key)
+	logrus.Infof("Курс взят из кэша для %s", key)
 	return rateData.Rate, true
 }
 
@@ -45,5 +45,5 @@ func SetCachedRate(key string, rate float64) {
 		Timestamp: time.Now(),
 	}
 
-	logrus.Infof("Курс сохранён в кэш для", key)
+	logrus.Infof("Курс сохранён в кэш для %s", key)
 }
@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/middleware"
+	"production_wallet_back/pkg/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminLogin вход в админку по логину и паролю; токен сессии передаётся дальше в Authorization: Bearer
+func (h *Handler) AdminLogin(c *gin.Context) {
+	var input models.AdminLoginInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "username and password are required")
+		return
+	}
+
+	admin, token, err := h.service.Admin.Login(input.Username, input.Password, requestMeta(c))
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			logrus.Warnf("AdminLogin: failed login for %q from %s", input.Username, c.ClientIP())
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, "cannot login admin")
+		return
+	}
+	logrus.Infof("AdminLogin: %q (%s) logged in from %s", admin.Username, admin.Role, c.ClientIP())
+
+	wrapOkJSON(c, map[string]interface{}{
+		"admin": admin,
+		"token": token,
+	})
+}
+
+func (h *Handler) AdminLogout(c *gin.Context) {
+	if err := h.service.Admin.Logout(c.GetInt64(middleware.AdminSessionIDKey), requestMeta(c)); err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "cannot logout admin")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"status": "ok",
+	})
+}
+
+func (h *Handler) AdminMe(c *gin.Context) {
+	wrapOkJSON(c, map[string]interface{}{
+		"admin": currentAdmin(c),
+	})
+}
+
+func (h *Handler) AdminUsers(c *gin.Context) {
+	admins, err := h.service.Admin.GetAdmins()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "failed to get admin users")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": admins,
+	})
+}
+
+func (h *Handler) CreateAdminUser(c *gin.Context) {
+	var input models.AdminCreateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "username, password and role are required")
+		return
+	}
+	admin, err := h.service.Admin.CreateAdmin(input.Username, input.Password, input.Role, requestMeta(c))
+	if err != nil {
+		adminErrorResponse(c, err)
+		return
+	}
+	logrus.Infof("CreateAdminUser: %q created %q with role %s", currentAdmin(c).Username, admin.Username, admin.Role)
+	wrapOkJSON(c, map[string]interface{}{
+		"data": admin,
+	})
+}
+
+// UpdateAdminUser меняет роль админа или блокирует его ({"role": "viewer"}, {"disabled": true})
+func (h *Handler) UpdateAdminUser(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid admin id")
+		return
+	}
+	var input models.AdminUpdateInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
+		return
+	}
+	actor := currentAdmin(c)
+	admin, err := h.service.Admin.UpdateAdmin(actor.ID, id, input, requestMeta(c))
+	if err != nil {
+		adminErrorResponse(c, err)
+		return
+	}
+	logrus.Infof("UpdateAdminUser: %q set %q role %s, disabled %t", actor.Username, admin.Username, admin.Role, admin.Disabled)
+	wrapOkJSON(c, map[string]interface{}{
+		"data": admin,
+	})
+}
+
+// currentAdmin админ, проверенный middleware.AdminAuth
+func currentAdmin(c *gin.Context) models.AdminUser {
+	value, _ := c.Get(middleware.AdminKey)
+	admin, _ := value.(models.AdminUser)
+	return admin
+}
+
+func adminErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrAdminNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrAdminExists), errors.Is(err, service.ErrAdminSelfUpdate):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrInvalidAdminRole), errors.Is(err, service.ErrInvalidAdminInput):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, "admin user operation failed")
+	}
+}
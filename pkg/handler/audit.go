@@ -0,0 +1,76 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/service"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminAudit записи журнала аудита, новые первыми. Фильтры: ?actor=&action=&target=,
+// ?since=&until= в RFC 3339, страницы — ?before_id=<id последней записи>&limit=.
+func (h *Handler) AdminAudit(c *gin.Context) {
+	filter := models.AuditFilter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+		Target: c.Query("target"),
+	}
+	var err error
+	if filter.Since, err = timeQuery(c, "since"); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid since")
+		return
+	}
+	if filter.Until, err = timeQuery(c, "until"); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid until")
+		return
+	}
+	if filter.BeforeID, err = strconv.ParseInt(c.DefaultQuery("before_id", "0"), 10, 64); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid before_id")
+		return
+	}
+	if filter.Limit, err = strconv.Atoi(c.DefaultQuery("limit", "0")); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid limit")
+		return
+	}
+
+	entries, err := h.service.Audit.GetEntries(filter)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidAuditFilter) {
+			newErrorResponse(c, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, "failed to get audit log")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": entries,
+	})
+}
+
+// AdminAuditVerify проверяет цепочку хэшей журнала аудита целиком
+func (h *Handler) AdminAuditVerify(c *gin.Context) {
+	result, err := h.service.Audit.Verify()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "failed to verify audit log")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": result,
+	})
+}
+
+func timeQuery(c *gin.Context, key string) (*time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -1,56 +1,99 @@
 package handler
 
 import (
-	"database/sql"
 	"errors"
-	"github.com/gin-gonic/gin"
 	"net/http"
 	"production_wallet_back/models"
-	"strconv"
+	"production_wallet_back/pkg/middleware"
+	"production_wallet_back/pkg/service"
+
+	"github.com/gin-gonic/gin"
 )
 
+// Login открывает сессию для пользователя из проверенного initData и выдаёт пару токенов
 func (h *Handler) Login(c *gin.Context) {
-	var input models.User
+	value, ok := c.Get(middleware.TelegramUserKey)
+	if !ok {
+		newErrorResponse(c, http.StatusUnauthorized, "telegram user not found")
+		return
+	}
+	tgUser := value.(middleware.TelegramUser)
+
+	input := models.User{
+		TelegramID: tgUser.ID,
+		Username:   tgUser.Username,
+		FirstName:  tgUser.FirstName,
+		LastName:   tgUser.LastName,
+	}
+
+	user, tokens, err := h.service.Authorization.Login(input, c.Request.UserAgent())
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "cannot login user")
+		return
+	}
+
+	wrapOkJSON(c, map[string]interface{}{
+		"user":   user,
+		"tokens": tokens,
+	})
+}
 
-	if err := c.BindJSON(&input); err != nil {
-		newErrorResponse(c, http.StatusBadRequest, "invalid request body")
+func (h *Handler) Refresh(c *gin.Context) {
+	var input models.RefreshInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "refresh_token is required")
 		return
 	}
 
-	user, err := h.service.Authorization.GetUserByTelegramId(input.TelegramID)
+	tokens, err := h.service.Authorization.Refresh(input.RefreshToken)
 	if err != nil {
-		// Если пользователь не найден — создаём
-		if errors.Is(err, sql.ErrNoRows) {
-			id, err := h.service.Authorization.CreateUser(input)
-			if err != nil {
-				newErrorResponse(c, http.StatusInternalServerError, "cannot create user")
-				return
-			}
+		if errors.Is(err, service.ErrInvalidToken) || errors.Is(err, service.ErrSessionRevoked) {
+			newErrorResponse(c, http.StatusUnauthorized, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusInternalServerError, "cannot refresh session")
+		return
+	}
+
+	wrapOkJSON(c, map[string]interface{}{
+		"tokens": tokens,
+	})
+}
 
-			input.ID = id
-			c.JSON(http.StatusOK, input)
+// Logout завершает текущую сессию, а с {"all": true} — все сессии пользователя
+func (h *Handler) Logout(c *gin.Context) {
+	var input models.LogoutInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid request body")
 			return
 		}
+	}
 
-		newErrorResponse(c, http.StatusInternalServerError, "something went wrong")
+	var err error
+	if input.All {
+		var telegramId int64
+		telegramId, err = GetTelegramId(c)
+		if err == nil {
+			err = h.service.Authorization.LogoutAll(telegramId)
+		}
+	} else {
+		err = h.service.Authorization.Logout(c.GetInt64(middleware.SessionIDKey))
+	}
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "cannot logout")
 		return
 	}
 
-	// Пользователь уже есть
 	wrapOkJSON(c, map[string]interface{}{
-		"user": user,
+		"status": "logged out",
 	})
 }
 
 func (h *Handler) GetMe(c *gin.Context) {
-	telegramIdStr := c.Query("telegram_id")
-	if telegramIdStr == "" {
-		newErrorResponse(c, http.StatusBadRequest, "telegram_id is required")
-		return
-	}
-	telegramId, err := strconv.ParseInt(telegramIdStr, 10, 64)
+	telegramId, err := GetTelegramId(c)
 	if err != nil {
-		newErrorResponse(c, http.StatusBadRequest, "telegram_id is required")
+		newErrorResponse(c, http.StatusUnauthorized, "invalid telegram_id")
 		return
 	}
 	user, err := h.service.Authorization.GetUserByTelegramId(telegramId)
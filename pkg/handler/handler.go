@@ -1,6 +1,9 @@
 package handler
 
 import (
+	"time"
+
+	"production_wallet_back/models"
 	"production_wallet_back/pkg/middleware"
 	"production_wallet_back/pkg/service"
 
@@ -8,13 +11,22 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+type Config struct {
+	BotToken       string
+	InitDataTTL    time.Duration
+	ReceiptsDir    string // куда сохраняются чеки об оплате заказов
+	MaxReceiptSize int64
+}
+
 type Handler struct {
 	service *service.Service
+	cfg     Config
 }
 
-func NewHandler(service *service.Service) *Handler {
+func NewHandler(service *service.Service, cfg Config) *Handler {
 	return &Handler{
 		service: service,
+		cfg:     cfg,
 	}
 }
 
@@ -24,52 +36,90 @@ func (h *Handler) InitRoute() *gin.Engine {
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"https://platapay.ru", "http://localhost:5173", "http://172.20.10.4:5173", "http://100.100.0.103"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Telegram-ID"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Length", "Content-Type", "Authorization", "X-Telegram-ID", "X-Telegram-Init-Data", middleware.IdempotencyKeyHeader},
+		ExposeHeaders:    []string{"Content-Length", middleware.IdempotencyReplayedHeader},
 		AllowCredentials: true,
 	}))
 
+	authMiddleware := middleware.AuthMiddleware(h.service.Authorization)
+	// Для запросов, двигающих деньги: повтор с тем же Idempotency-Key не выполняется второй раз
+	idempotent := middleware.Idempotency(h.service.Idempotency)
+	// Админка: сессия админа, а на каждом маршруте — право, которое должно быть у его роли
+	adminAuth := middleware.AdminAuth(h.service.Admin)
+	can := middleware.RequirePermission
+
 	auth := router.Group("/auth")
 	{
-		auth.POST("/login", h.Login)
-		auth.GET("/me", h.GetMe)
+		auth.POST("/login", middleware.TelegramInitData(h.cfg.BotToken, h.cfg.InitDataTTL), h.Login)
+		auth.POST("/refresh", h.Refresh)
+		auth.POST("/logout", authMiddleware, h.Logout)
+		auth.GET("/me", authMiddleware, h.GetMe)
 	}
 
 	api := router.Group("/api")
 	{
-		wallet := api.Group("/wallet", middleware.AuthMiddleware())
+		wallet := api.Group("/wallet", authMiddleware)
 		{
 			wallet.GET("/", h.GetWallet)
 			wallet.POST("/create", h.CreateWallet)
 			wallet.GET("/balance", h.GetBalance)
-			wallet.POST("/deposit", h.Deposit)
-			wallet.POST("/withdraw", h.Withdraw)
-			wallet.POST("/withdraw/test", h.WithdrawTest)
-			wallet.POST("/withdraw/auto-trx", h.WithdrawWithAutoTRX)
+			wallet.POST("/withdraw", idempotent, h.Withdraw)
+			wallet.GET("/withdrawals/:id", h.GetWithdrawal)
 			wallet.GET("/transactions", h.GetTransactions)
 			wallet.POST("/convert", h.Convert)
-			wallet.POST("/virtual-withdraw", h.VirtualWithdraw)
+			wallet.POST("/virtual-withdraw", idempotent, h.VirtualWithdraw)
 
 			wallet.GET("/state/order/:id", h.StateOrder)
-			wallet.POST("/create/sbp/order", h.CreateOrder)
+			wallet.POST("/create/sbp/order", idempotent, h.CreateOrder)
 			wallet.GET("/orders/history", h.OrdersHistory)
+			wallet.POST("/orders/:id/cancel", h.CancelOrder)
 
 			wallet.POST("/pay", h.Pay)
 			wallet.POST("/check-balance", h.CheckUSDTBalance)
 			wallet.POST("/check-tx", h.CheckTransactionStatus)
 			wallet.POST("/check-trx-balance", h.CheckTRXBalance)
 			wallet.POST("/estimate-trx", h.EstimateRequiredTRX)
-			wallet.POST("/send-trx-for-gas", h.SendTRXForGasEndpoint)
-			wallet.POST("/get-address", h.GetAddressFromPrivateKey)
+			wallet.POST("/send-trx-for-gas", idempotent, h.SendTRXForGasEndpoint)
 
 		}
 
-		admin := api.Group("/admin")
+		adminSession := api.Group("/admin/auth")
 		{
-			admin.GET("/privat-key", h.PrivatKey)
-			admin.POST("/payqr/:id", h.PayQR)
-			admin.GET("/orders", h.Orders)
-			admin.GET("/wallets-with-history", h.AdminWalletsWithHistory)
+			adminSession.POST("/login", h.AdminLogin)
+			adminSession.POST("/logout", adminAuth, h.AdminLogout)
+			adminSession.GET("/me", adminAuth, h.AdminMe)
+		}
+
+		admin := api.Group("/admin", adminAuth)
+		{
+			admin.GET("/privat-key", can(models.PermKeysExport), h.PrivatKey)
+
+			admin.GET("/orders", can(models.PermOrdersRead), h.Orders)
+			admin.GET("/orders/:id", can(models.PermOrdersRead), h.AdminOrder)
+			admin.GET("/orders/:id/receipt", can(models.PermOrdersRead), h.OrderReceipt)
+			admin.POST("/orders/:id/claim", can(models.PermOrdersOperate), h.ClaimOrder)
+			admin.POST("/orders/:id/release", can(models.PermOrdersOperate), h.ReleaseOrder)
+			admin.POST("/orders/:id/pay", can(models.PermOrdersOperate), h.PayQR)
+			admin.POST("/payqr/:id", can(models.PermOrdersOperate), h.PayQR)
+			admin.POST("/orders/:id/cancel", can(models.PermOrdersCancel), h.AdminCancelOrder)
+			admin.POST("/orders/:id/refund", can(models.PermOrdersRefund), h.AdminRefundOrder)
+
+			admin.GET("/wallets-with-history", can(models.PermWalletsRead), h.AdminWalletsWithHistory)
+			admin.GET("/transactions/failed", can(models.PermLedgerRead), h.AdminFailedTransactions)
+			admin.GET("/ledger/accounts", can(models.PermLedgerRead), h.AdminLedgerAccounts)
+			admin.GET("/ledger/wallets/:id", can(models.PermLedgerRead), h.AdminWalletLedger)
+			admin.GET("/ledger/reconcile", can(models.PermLedgerRead), h.AdminLedgerReconcile)
+			admin.POST("/wallets/:telegram_id/deposit", can(models.PermLedgerAdjust), h.AdminDeposit)
+			admin.GET("/gas", can(models.PermLedgerRead), h.AdminGasStatus)
+			admin.GET("/resources", can(models.PermLedgerRead), h.AdminResources)
+			admin.POST("/resources/stake", can(models.PermStakeManage), h.AdminStake)
+
+			admin.GET("/audit", can(models.PermAuditRead), h.AdminAudit)
+			admin.GET("/audit/verify", can(models.PermAuditRead), h.AdminAuditVerify)
+
+			admin.GET("/users", can(models.PermAdminsManage), h.AdminUsers)
+			admin.POST("/users", can(models.PermAdminsManage), h.CreateAdminUser)
+			admin.PATCH("/users/:id", can(models.PermAdminsManage), h.UpdateAdminUser)
 		}
 
 	}
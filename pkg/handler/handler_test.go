@@ -0,0 +1,328 @@
+package handler
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	wallet2 "production_wallet_back/internal/wallet"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/keystore"
+	"production_wallet_back/pkg/money"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/service"
+	"production_wallet_back/pkg/tronclient"
+
+	"github.com/gin-gonic/gin"
+)
+
+const testBotToken = "123456:TEST-bot-token"
+
+// memAuth пользователи и сессии в памяти вместо Postgres
+type memAuth struct {
+	mu       sync.Mutex
+	users    map[int64]models.User
+	sessions map[int64]models.Session
+}
+
+func newMemAuth() *memAuth {
+	return &memAuth{users: make(map[int64]models.User), sessions: make(map[int64]models.Session)}
+}
+
+func (m *memAuth) GetUserByTelegramId(id int64) (models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (m *memAuth) CreateUser(user models.User) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user.ID = int64(len(m.users) + 1)
+	m.users[user.TelegramID] = user
+	return user.ID, nil
+}
+
+func (m *memAuth) CreateSession(session models.Session) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session.ID = int64(len(m.sessions) + 1)
+	m.sessions[session.ID] = session
+	return session.ID, nil
+}
+
+func (m *memAuth) GetSession(id int64) (models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok {
+		return session, sql.ErrNoRows
+	}
+	return session, nil
+}
+
+func (m *memAuth) GetSessionByRefreshHash(hash string) (models.Session, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, session := range m.sessions {
+		if session.RefreshTokenHash == hash {
+			return session, nil
+		}
+	}
+	return models.Session{}, sql.ErrNoRows
+}
+
+func (m *memAuth) RotateSessionRefresh(id int64, oldHash, newHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session, ok := m.sessions[id]
+	if !ok || session.RefreshTokenHash != oldHash {
+		return sql.ErrNoRows
+	}
+	session.RefreshTokenHash, session.ExpiresAt = newHash, expiresAt
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *memAuth) RevokeSession(id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	session := m.sessions[id]
+	now := time.Now()
+	session.RevokedAt = &now
+	m.sessions[id] = session
+	return nil
+}
+
+func (m *memAuth) RevokeUserSessions(telegramID int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for id, session := range m.sessions {
+		if session.TelegramID == telegramID {
+			session.RevokedAt = &now
+			m.sessions[id] = session
+		}
+	}
+	return nil
+}
+
+// testAPI API поверх FakeChain: сеть в памяти, пользователи и сессии тоже
+type testAPI struct {
+	t      *testing.T
+	router *gin.Engine
+	chain  *tronclient.FakeChain
+	token  string
+	userID int64
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+	api := newTestAPIWithRepos(t, &repository.Repository{Authorization: newMemAuth()})
+	api.login(279058397)
+	return api
+}
+
+// newTestAPIWithRepos API поверх FakeChain и переданных репозиториев, без входа
+func newTestAPIWithRepos(t *testing.T, repos *repository.Repository) *testAPI {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	keys, err := keystore.New(map[int][]byte{1: bytes.Repeat([]byte{7}, 32)}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := tronclient.NewFakeChain()
+	services := service.NewService(repos, chain, keys, service.Config{
+		Auth: service.AuthConfig{
+			TokenSecret: strings.Repeat("s", 32),
+			AccessTTL:   time.Minute,
+			RefreshTTL:  time.Hour,
+		},
+	})
+	h := NewHandler(services, Config{BotToken: testBotToken, InitDataTTL: time.Hour})
+	return &testAPI{t: t, router: h.InitRoute(), chain: chain}
+}
+
+// login проходит /auth/login с initData, подписанным тестовым токеном бота
+func (a *testAPI) login(telegramID int64) {
+	values := url.Values{
+		"auth_date": {strconv.FormatInt(time.Now().Unix(), 10)},
+		"user":      {`{"id":` + strconv.FormatInt(telegramID, 10) + `,"username":"test"}`},
+	}
+	pairs := make([]string, 0, len(values))
+	for key := range values {
+		pairs = append(pairs, key+"="+values.Get(key))
+	}
+	sort.Strings(pairs)
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(testBotToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(pairs, "\n")))
+	values.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+
+	req := httptest.NewRequest(http.MethodPost, "/auth/login", nil)
+	req.Header.Set("X-Telegram-Init-Data", values.Encode())
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		a.t.Fatalf("login: %d %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Tokens models.TokenPair `json:"tokens"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		a.t.Fatal(err)
+	}
+	a.token, a.userID = resp.Tokens.AccessToken, telegramID
+}
+
+func (a *testAPI) post(path string, body interface{}, out interface{}) int {
+	a.t.Helper()
+	raw, err := json.Marshal(body)
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(raw))
+	req.Header.Set("Content-Type", "application/json")
+	if a.token != "" {
+		req.Header.Set("Authorization", "Bearer "+a.token)
+	}
+	rec := httptest.NewRecorder()
+	a.router.ServeHTTP(rec, req)
+	if out != nil && rec.Code == http.StatusOK {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			a.t.Fatalf("%s: %v: %s", path, err, rec.Body)
+		}
+	}
+	return rec.Code
+}
+
+func newTestWallet(t *testing.T) *wallet2.Wallet {
+	t.Helper()
+	w, err := wallet2.GenerateTRONWallet()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWalletRoutesRequireToken(t *testing.T) {
+	api := newTestAPI(t)
+	api.token = ""
+	if code := api.post("/api/wallet/check-trx-balance", gin.H{"address": newTestWallet(t).Address}, nil); code != http.StatusUnauthorized {
+		t.Fatalf("code = %d, want 401", code)
+	}
+}
+
+func TestDepositIsAdminOnly(t *testing.T) {
+	api := newTestAPI(t)
+	body := gin.H{"token_symbol": "USDT", "amount": "1000"}
+	if code := api.post("/api/wallet/deposit", body, nil); code != http.StatusNotFound {
+		t.Fatalf("user deposit: code = %d, want 404", code)
+	}
+	if models.RoleHasPermission(models.AdminRoleOperator, models.PermLedgerAdjust) {
+		t.Fatal("operator can credit wallets")
+	}
+}
+
+func TestCheckTRXBalance(t *testing.T) {
+	api := newTestAPI(t)
+	user := newTestWallet(t)
+	api.chain.SetTRXBalance(user.Address, money.MustParse("12.5"))
+
+	var resp struct {
+		Balance money.Amount `json:"balance"`
+	}
+	if code := api.post("/api/wallet/check-trx-balance", gin.H{"address": user.Address}, &resp); code != http.StatusOK {
+		t.Fatalf("code = %d", code)
+	}
+	if resp.Balance != money.MustParse("12.5") {
+		t.Fatalf("balance = %s, want 12.5", resp.Balance)
+	}
+	if code := api.post("/api/wallet/check-trx-balance", gin.H{"address": "not-an-address"}, nil); code != http.StatusInternalServerError {
+		t.Fatalf("invalid address: code = %d, want 500", code)
+	}
+}
+
+func TestEstimateTRX(t *testing.T) {
+	api := newTestAPI(t)
+	from, to := newTestWallet(t), newTestWallet(t)
+	api.chain.SetUSDTBalance(from.Address, money.MustParse("100"))
+	api.chain.SetTRXBalance(from.Address, money.MustParse("5"))
+
+	var resp struct {
+		RequiredTRX    money.Amount           `json:"required_trx"`
+		MissingTRX     money.Amount           `json:"missing_trx"`
+		SufficientUSDT bool                   `json:"sufficient_usdt"`
+		Fee            tronclient.FeeEstimate `json:"fee"`
+	}
+	body := gin.H{"from_address": from.Address, "to_address": to.Address, "amount": "10"}
+	if code := api.post("/api/wallet/estimate-trx", body, &resp); code != http.StatusOK {
+		t.Fatalf("code = %d", code)
+	}
+	// 28 000 энергии по 420 SUN и 345 байт bandwidth по 1000 SUN
+	if resp.RequiredTRX != money.MustParse("12.105") || resp.MissingTRX != money.MustParse("7.105") || !resp.SufficientUSDT {
+		t.Fatalf("resp = %+v", resp)
+	}
+	if resp.Fee.EnergyBurned != 28_000 || resp.Fee.FeeLimit != money.MustParse("11.76") {
+		t.Fatalf("fee = %+v", resp.Fee)
+	}
+
+	// Застейканная энергия сжигание покрывает
+	api.chain.SetEnergy(from.Address, 30_000)
+	if code := api.post("/api/wallet/estimate-trx", body, &resp); code != http.StatusOK {
+		t.Fatalf("code = %d", code)
+	}
+	if resp.RequiredTRX != money.MustParse("0.345") || resp.MissingTRX != 0 || resp.Fee.EnergyFromStake != 28_000 {
+		t.Fatalf("with energy: resp = %+v", resp)
+	}
+}
+
+func TestCheckTransactionStatus(t *testing.T) {
+	api := newTestAPI(t)
+	from, to := newTestWallet(t), newTestWallet(t)
+	api.chain.SetUSDTBalance(from.Address, money.MustParse("10"))
+	api.chain.SetTRXBalance(from.Address, money.MustParse("20"))
+
+	txID, err := api.chain.SendUSDT(from.PrivateKey, to.Address, money.MustParse("4"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var resp struct {
+		Status tronclient.TransactionInfo `json:"status"`
+	}
+	if code := api.post("/api/wallet/check-tx", gin.H{"tx_id": txID}, &resp); code != http.StatusOK {
+		t.Fatalf("code = %d", code)
+	}
+	if resp.Status.Found {
+		t.Fatalf("transaction is found before its block: %+v", resp.Status)
+	}
+
+	api.chain.MineBlocks(1)
+	if code := api.post("/api/wallet/check-tx", gin.H{"tx_id": txID}, &resp); code != http.StatusOK {
+		t.Fatalf("code = %d", code)
+	}
+	if !resp.Status.Found || !resp.Status.Succeeded() {
+		t.Fatalf("status = %+v", resp.Status)
+	}
+	if balance, _ := api.chain.GetUSDTBalance(to.Address); balance != money.MustParse("4") {
+		t.Fatalf("receiver balance = %s, want 4", balance)
+	}
+}
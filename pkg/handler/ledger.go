@@ -0,0 +1,111 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/service"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// AdminLedgerAccounts счета журнала с остатками
+func (h *Handler) AdminLedgerAccounts(c *gin.Context) {
+	accounts, err := h.service.Ledger.GetAccounts()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "failed to get ledger accounts")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": accounts,
+	})
+}
+
+// AdminWalletLedger выписка журнала по кошельку
+func (h *Handler) AdminWalletLedger(c *gin.Context) {
+	walletID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid wallet id")
+		return
+	}
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid limit")
+		return
+	}
+
+	lines, err := h.service.Ledger.GetWalletStatement(walletID, limit)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "failed to get wallet ledger")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": lines,
+	})
+}
+
+// AdminLedgerReconcile расхождения balances с журналом. Пустой список — всё сходится.
+func (h *Handler) AdminLedgerReconcile(c *gin.Context) {
+	mismatches, err := h.service.Ledger.Reconcile()
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "failed to reconcile ledger")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"balanced": len(mismatches) == 0,
+		"data":     mismatches,
+	})
+}
+
+// AdminGasStatus адрес и остаток кошелька-плательщика газа
+func (h *Handler) AdminGasStatus(c *gin.Context) {
+	status, err := h.service.Gas.Status()
+	if errors.Is(err, service.ErrFeePayerNotConfigured) {
+		newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "failed to get fee-payer balance")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": status,
+	})
+}
+
+// AdminDeposit ручное зачисление на кошелёк пользователя :telegram_id против внешнего счёта
+func (h *Handler) AdminDeposit(c *gin.Context) {
+	telegramId, err := strconv.ParseInt(c.Param("telegram_id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
+		return
+	}
+	var input models.DepositInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "token_symbol, amount and reference are required")
+		return
+	}
+
+	err = h.service.Wallet.Deposit(telegramId, input.TokenSymbol, input.Amount, input.Reference, requestMeta(c))
+	switch {
+	case errors.Is(err, service.ErrInvalidAmount):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, service.ErrDepositReplayed):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		newErrorResponse(c, http.StatusNotFound, "wallet not found")
+		return
+	case err != nil:
+		logrus.Errorf("failed to deposit: %s", err.Error())
+		newErrorResponse(c, http.StatusInternalServerError, "failed to deposit")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"status": "deposite successful",
+	})
+}
@@ -0,0 +1,346 @@
+package handler
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/service"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+type orderReasonInput struct {
+	Reason string `json:"reason"`
+}
+
+func (h *Handler) CreateOrder(c *gin.Context) {
+	telegramId, err := GetTelegramId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
+		return
+	}
+	var req models.OrderCreateRequest
+	if err := c.BindJSON(&req); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	order, err := h.service.Order.CreateOrder(models.OrderQR{
+		TelegramId: telegramId,
+		QRCode:     req.QRLink,
+	}, req.QuoteID, time.Duration(req.TTLSeconds)*time.Second, requestMeta(c))
+	switch {
+	case errors.Is(err, service.ErrInvalidAmount), errors.Is(err, service.ErrInvalidOrderTTL), errors.Is(err, service.ErrWalletNotFound),
+		errors.Is(err, service.ErrQuoteInvalid), errors.Is(err, service.ErrInvalidQR):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, service.ErrQuoteNotFound):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+		return
+	case errors.Is(err, service.ErrQuoteExpired), errors.Is(err, service.ErrQuoteUsed):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+		return
+	case errors.Is(err, service.ErrInsufficientFunds):
+		newErrorResponse(c, http.StatusBadRequest, "insufficient available balance")
+		return
+	case err != nil:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	wrapOkJSON(c, map[string]interface{}{
+		"data":       "order created successfully",
+		"order_id":   order.Id,
+		"state":      order.State,
+		"expires_at": order.ExpiresAt,
+	})
+}
+
+// receiptExtensions форматы чеков об оплате
+var receiptExtensions = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".pdf": true}
+
+// AdminOrder заказ с удержанием, историей переходов и действиями операторов
+func (h *Handler) AdminOrder(c *gin.Context) {
+	orderId, ok := orderIdParam(c)
+	if !ok {
+		return
+	}
+	state, err := h.service.Order.GetOrder(orderId)
+	if err != nil {
+		orderErrorResponse(c, err)
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": state,
+	})
+}
+
+// ClaimOrder оператор берёт заказ в работу; другие операторы видят его занятым до конца аренды
+func (h *Handler) ClaimOrder(c *gin.Context) {
+	orderId, ok := orderIdParam(c)
+	if !ok {
+		return
+	}
+	state, err := h.service.Order.ClaimOrder(orderId, currentAdmin(c).Username, requestMeta(c))
+	if err != nil {
+		orderErrorResponse(c, err)
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": state,
+	})
+}
+
+// ReleaseOrder оператор отказывается от взятого заказа
+func (h *Handler) ReleaseOrder(c *gin.Context) {
+	orderId, ok := orderIdParam(c)
+	if !ok {
+		return
+	}
+	state, err := h.service.Order.ReleaseOrder(orderId, currentAdmin(c).Username, requestMeta(c))
+	if err != nil {
+		orderErrorResponse(c, err)
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": state,
+	})
+}
+
+// PayQR оператор, взявший заказ, отмечает оплату QR. Номер операции в банке — bank_reference
+// в JSON или форме; чек — необязательный файл receipt в multipart/form-data.
+func (h *Handler) PayQR(c *gin.Context) {
+	orderId, ok := orderIdParam(c)
+	if !ok {
+		return
+	}
+	operator := currentAdmin(c).Username
+
+	var payment models.OrderPayment
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		payment.BankReference = strings.TrimSpace(c.PostForm("bank_reference"))
+		if file, err := c.FormFile("receipt"); err == nil {
+			path, err := h.saveReceipt(c, orderId, file)
+			if err != nil {
+				newErrorResponse(c, http.StatusBadRequest, err.Error())
+				return
+			}
+			payment.ReceiptPath = path
+		}
+	} else {
+		var input struct {
+			BankReference string `json:"bank_reference"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid input")
+			return
+		}
+		payment.BankReference = strings.TrimSpace(input.BankReference)
+	}
+
+	state, err := h.service.Order.PayOrder(orderId, operator, payment, requestMeta(c))
+	if err != nil {
+		if payment.ReceiptPath != "" {
+			os.Remove(payment.ReceiptPath)
+		}
+		orderErrorResponse(c, err)
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"id":   orderId,
+		"data": state,
+	})
+}
+
+// OrderReceipt файл чека об оплате заказа
+func (h *Handler) OrderReceipt(c *gin.Context) {
+	orderId, ok := orderIdParam(c)
+	if !ok {
+		return
+	}
+	path, err := h.service.Order.GetOrderReceipt(orderId)
+	if err != nil {
+		orderErrorResponse(c, err)
+		return
+	}
+	c.File(path)
+}
+
+// saveReceipt сохраняет чек в ReceiptsDir под случайным именем
+func (h *Handler) saveReceipt(c *gin.Context, orderId int64, file *multipart.FileHeader) (string, error) {
+	if file.Size > h.cfg.MaxReceiptSize {
+		return "", fmt.Errorf("receipt is larger than %d bytes", h.cfg.MaxReceiptSize)
+	}
+	ext := strings.ToLower(filepath.Ext(file.Filename))
+	if !receiptExtensions[ext] {
+		return "", fmt.Errorf("receipt must be jpg, png or pdf")
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	path := filepath.Join(h.cfg.ReceiptsDir, fmt.Sprintf("%d_%s%s", orderId, hex.EncodeToString(suffix), ext))
+	if err := c.SaveUploadedFile(file, path); err != nil {
+		logrus.Errorf("Чек заказа %d не сохранён: %s", orderId, err)
+		return "", fmt.Errorf("failed to save receipt")
+	}
+	return path, nil
+}
+
+// AdminCancelOrder отмена заказа оператором
+func (h *Handler) AdminCancelOrder(c *gin.Context) {
+	h.adminTransitionOrder(c, models.OrderCancelled)
+}
+
+// AdminRefundOrder возврат по оплаченному заказу
+func (h *Handler) AdminRefundOrder(c *gin.Context) {
+	h.adminTransitionOrder(c, models.OrderRefunded)
+}
+
+func (h *Handler) adminTransitionOrder(c *gin.Context, to string) {
+	orderId, ok := orderIdParam(c)
+	if !ok {
+		return
+	}
+	var input orderReasonInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid input")
+			return
+		}
+	}
+
+	actor := service.OperatorActor(currentAdmin(c).Username)
+	state, err := h.service.Order.TransitionOrder(orderId, to, actor, input.Reason, requestMeta(c))
+	if err != nil {
+		orderErrorResponse(c, err)
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"id":   orderId,
+		"data": state,
+	})
+}
+
+// Orders заказы с их состоянием. По умолчанию — ожидающие оператора, другие состояния
+// перечисляются в ?state=paid,expired
+func (h *Handler) Orders(c *gin.Context) {
+	var states []string
+	if raw := c.Query("state"); raw != "" {
+		states = strings.Split(raw, ",")
+	}
+	orders, err := h.service.Order.GetOrders(states)
+	if errors.Is(err, service.ErrInvalidOrderState) {
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": orders,
+	})
+}
+
+func (h *Handler) OrdersHistory(c *gin.Context) {
+	telegramId, err := GetTelegramId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
+		return
+	}
+
+	orders, err := h.service.Order.OrdersHistory(telegramId)
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": orders,
+	})
+}
+
+// StateOrder состояние заказа пользователя с историей переходов
+func (h *Handler) StateOrder(c *gin.Context) {
+	telegramId, err := GetTelegramId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
+		return
+	}
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+
+	state, err := h.service.Order.GetOrderState(telegramId, orderId)
+	if err != nil {
+		orderErrorResponse(c, err)
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": state,
+	})
+}
+
+// CancelOrder отмена своего заказа пользователем, пока он не оплачен
+func (h *Handler) CancelOrder(c *gin.Context) {
+	telegramId, err := GetTelegramId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
+		return
+	}
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid order_id")
+		return
+	}
+	var input orderReasonInput
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			newErrorResponse(c, http.StatusBadRequest, "invalid input")
+			return
+		}
+	}
+
+	state, err := h.service.Order.CancelOrder(telegramId, orderId, input.Reason, requestMeta(c))
+	if err != nil {
+		orderErrorResponse(c, err)
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": state,
+	})
+}
+
+func orderIdParam(c *gin.Context) (int64, bool) {
+	orderId, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid order_id")
+		return 0, false
+	}
+	return orderId, true
+}
+
+func orderErrorResponse(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, service.ErrOrderNotFound), errors.Is(err, service.ErrNoReceipt):
+		newErrorResponse(c, http.StatusNotFound, err.Error())
+	case errors.Is(err, service.ErrInvalidTransition), errors.Is(err, service.ErrOrderClaimed), errors.Is(err, service.ErrRefundSettled):
+		newErrorResponse(c, http.StatusConflict, err.Error())
+	case errors.Is(err, service.ErrBankReference):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+	default:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	}
+}
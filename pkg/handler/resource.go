@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// AdminResources стейк казначейства и делегирования энергии, которые ещё не отозваны
+func (h *Handler) AdminResources(c *gin.Context) {
+	status, err := h.service.Resources.Status()
+	if errors.Is(err, service.ErrStakeNotConfigured) {
+		newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		newErrorResponse(c, http.StatusInternalServerError, "failed to get treasury resources")
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"data": status,
+	})
+}
+
+// AdminStake замораживает TRX казначейства под энергию (Stake 2.0)
+func (h *Handler) AdminStake(c *gin.Context) {
+	var input models.StakeInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "amount is required")
+		return
+	}
+
+	txID, err := h.service.Resources.Stake(input.Amount, requestMeta(c))
+	switch {
+	case errors.Is(err, service.ErrInvalidAmount):
+		newErrorResponse(c, http.StatusBadRequest, err.Error())
+		return
+	case errors.Is(err, service.ErrStakeNotConfigured):
+		newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+		return
+	case err != nil:
+		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	wrapOkJSON(c, map[string]interface{}{
+		"tx_id": txID,
+	})
+}
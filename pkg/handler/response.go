@@ -1,8 +1,12 @@
 package handler
 
 import (
+	"errors"
 	"net/http"
-	"strconv"
+
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/middleware"
+	"production_wallet_back/pkg/service"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
@@ -21,11 +25,33 @@ func wrapOkJSON(c *gin.Context, response map[string]interface{}) {
 	c.JSON(http.StatusOK, response)
 }
 
+// GetTelegramId возвращает telegram_id, проверенный AuthMiddleware
 func GetTelegramId(c *gin.Context) (int64, error) {
-	telegramIDStr := c.GetHeader("X-Telegram-ID")
-	if telegramIDStr == "" {
-		return 0, nil
+	value, ok := c.Get(middleware.TelegramIDKey)
+	if !ok {
+		return 0, errors.New("telegram_id not found in context")
+	}
+	telegramID, ok := value.(int64)
+	if !ok {
+		return 0, errors.New("telegram_id has invalid type")
+	}
+	return telegramID, nil
+}
+
+// requestMeta кто и откуда выполняет запрос — для журнала аудита. Инициатор — админ
+// из сессии админки или пользователь из access-токена.
+func requestMeta(c *gin.Context) models.RequestMeta {
+	meta := models.RequestMeta{
+		IP:             c.ClientIP(),
+		UserAgent:      c.Request.UserAgent(),
+		Method:         c.Request.Method,
+		Path:           c.Request.URL.Path,
+		IdempotencyKey: c.GetHeader(middleware.IdempotencyKeyHeader),
+	}
+	if value, ok := c.Get(middleware.AdminKey); ok {
+		meta.Actor = service.AdminActor(value.(models.AdminUser).Username)
+	} else if telegramId, err := GetTelegramId(c); err == nil {
+		meta.Actor = service.UserActor(telegramId)
 	}
-	telegramID, err := strconv.ParseInt(telegramIDStr, 10, 64)
-	return telegramID, err
+	return meta
 }
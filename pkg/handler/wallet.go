@@ -1,97 +1,19 @@
 package handler
 
 import (
-	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
-	"math"
 	"net/http"
 	wallet2 "production_wallet_back/internal/wallet"
 	"production_wallet_back/models"
-	"production_wallet_back/pkg/tronclient"
-	"production_wallet_back/pkg/utils"
+	"production_wallet_back/pkg/money"
+	"production_wallet_back/pkg/service"
 	"strconv"
-	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/sirupsen/logrus"
 )
 
-func (h *Handler) WithdrawTest(c *gin.Context) {
-	// Создаем контекст с таймаутом в 5 минут
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
-	defer cancel()
-
-	// Заменяем стандартный контекст на наш с таймаутом
-	c.Request = c.Request.WithContext(ctx)
-
-	var req struct {
-		PrivKey      string  `json:"priv_key"`
-		ToAddress    string  `json:"to_address"`
-		Amount       float64 `json:"amount"`
-		USDTContract string  `json:"usdt_contract"` // Адрес вашего контракта USDT
-	}
-
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
-		return
-	}
-
-	if req.USDTContract == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "usdt_contract address is required"})
-		return
-	}
-
-	// Создаем временный клиент с правильным адресом контракта
-	tempClient := tronclient.NewTronHTTPClient(h.service.Wallet.GetAPIKey(), req.USDTContract)
-
-	// Получаем адрес отправителя из приватного ключа
-	fromAddr, _, _, err := wallet2.GetTronAddressFromPrivKey(req.PrivKey)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid private key: %v", err)})
-		return
-	}
-
-	// Проверяем баланс USDT отправителя
-	fromBalance, err := tempClient.GetUSDTBalance(fromAddr)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check balance: %v", err)})
-		return
-	}
-
-	fmt.Printf("Checking balance for address %s: %.6f USDT\n", fromAddr, fromBalance)
-
-	if fromBalance < req.Amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("insufficient USDT balance: have %.6f, need %.6f", fromBalance, req.Amount)})
-		return
-	}
-
-	// В случае с USDT мы делаем прямой transfer без approve
-	// Так как это ваш собственный контракт и в нем не требуется approve
-	txID, err := h.service.Wallet.WithdrawWithContract(req.PrivKey, req.ToAddress, req.Amount, req.USDTContract)
-	if err != nil {
-		// Проверяем, связана ли ошибка с недостатком TRX
-		if err.Error() == "insufficient TRX balance for energy" {
-			// Получаем дополнительную информацию
-			trxBalance, trxErr := tempClient.GetTRXBalance(fromAddr)
-			if trxErr == nil {
-				c.JSON(http.StatusBadRequest, gin.H{
-					"error":       fmt.Sprintf("insufficient TRX for gas fees: %v. Current TRX balance: %.6f. You need to add some TRX to your wallet for transaction fees.", err, trxBalance),
-					"trx_balance": trxBalance,
-					"need_trx":    true,
-				})
-				return
-			}
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("transfer failed: %v", err)})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"transfer_tx": txID,
-	})
-}
-
 func (h *Handler) CreateWallet(c *gin.Context) {
 	telegramId, err := GetTelegramId(c)
 	if err != nil {
@@ -125,9 +47,8 @@ func (h *Handler) CreateWallet(c *gin.Context) {
 	}
 
 	wrapOkJSON(c, map[string]interface{}{
-		"wallet_id":   walletID,
-		"address":     wallet.Address,
-		"private_key": wallet.PrivateKey,
+		"wallet_id": walletID,
+		"address":   wallet.Address,
 	})
 }
 func (h *Handler) GetWallet(c *gin.Context) {
@@ -157,7 +78,7 @@ func (h *Handler) GetBalance(c *gin.Context) {
 	if err != nil {
 		logrus.Errorf("failed to get balance: %s", err.Error())
 	}
-	logrus.Infof("balance of THJW81cGM7QAkYu2dkN7LxxNK3cDWKK6ac - ", balance)
+	logrus.Infof("balance of THJW81cGM7QAkYu2dkN7LxxNK3cDWKK6ac - %s", balance)
 	balances, err := h.service.Wallet.GetBalance(telegramId)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, "failed to get balances")
@@ -167,33 +88,10 @@ func (h *Handler) GetBalance(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"balances": balances})
 }
 
-func (h *Handler) Deposit(c *gin.Context) {
-	telegramId, err := GetTelegramId(c)
-	if err != nil {
-		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
-		return
-	}
-	var input models.DepositInput
-	if err := c.ShouldBindJSON(&input); err != nil {
-		newErrorResponse(c, http.StatusBadRequest, "invalid input")
-		return
-	}
-
-	err = h.service.Wallet.Deposit(telegramId, input.TokenSymbol, input.Amount)
-
-	if err != nil {
-		logrus.Errorf("failed to deposit: %s", err.Error())
-		newErrorResponse(c, http.StatusInternalServerError, "failed to deposit")
-		return
-	}
-	wrapOkJSON(c, map[string]interface{}{
-		"status": "deposite successful",
-	})
-}
-
-// Конвертация валюты (RUB --> USDT ). Надо передать в теле запроса {amount:int,from:int,to:int}
+// Конвертация валюты (RUB --> USDT ). Надо передать в теле запроса {amount:int,from:int,to:int}.
+// В ответе котировка quote: по её id создаётся заказ, пока она не истекла.
 func (h *Handler) Convert(c *gin.Context) {
-	_, err := GetTelegramId(c)
+	telegramId, err := GetTelegramId(c)
 	if err != nil {
 		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
 		return
@@ -205,7 +103,7 @@ func (h *Handler) Convert(c *gin.Context) {
 
 	}
 
-	err, res := h.service.Wallet.Convert(req)
+	err, res := h.service.Wallet.Convert(telegramId, req)
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
@@ -215,156 +113,122 @@ func (h *Handler) Convert(c *gin.Context) {
 	})
 }
 
-func (h *Handler) CreateOrder(c *gin.Context) {
-	telegramId, err := GetTelegramId(c)
+func (h *Handler) PrivatKey(c *gin.Context) {
+	// Админский маршрут: telegram_id пользователя передаётся явно в заголовке
+	telegramId, err := strconv.ParseInt(c.GetHeader("X-Telegram-ID"), 10, 64)
+	logrus.Infof("Get privat key by telegram_id: %d, admin: %q", telegramId, currentAdmin(c).Username)
 	if err != nil {
 		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
 		return
 	}
-	var req models.OrderCreateRequest
-	if err := c.BindJSON(&req); err != nil {
-		newErrorResponse(c, http.StatusBadRequest, err.Error())
-		return
-	}
-	data := models.OrderQR{
-		TelegramId: telegramId,
-		QRCode:     req.QRLink,
-		Summa:      req.Amount,
-		Crypto:     req.Crypto,
-		IsPaid:     false,
-	}
-
-	orderId, err := h.service.Wallet.CreateOrder(data)
-
-	go func(input models.OrderQR) {
-		logrus.Println("Отправка уведомления на почту")
-		utils.SendMailMailjet(input.TelegramId, input.QRCode, input.Summa, input.Crypto)
-		utils.SendMail(input.TelegramId, input.QRCode, input.Summa, input.Crypto)
-	}(data)
 
+	key, err := h.service.Wallet.GetPrivatKey(telegramId, requestMeta(c))
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, err.Error())
 		return
 	}
+	logrus.Infof("private key get successfully")
 	wrapOkJSON(c, map[string]interface{}{
-		"data":     "order created successfully",
-		"order_id": orderId,
+		"key": key,
 	})
-
 }
 
-func (h *Handler) PrivatKey(c *gin.Context) {
+// Withdraw ставит вывод USDT с кошелька текущего пользователя в очередь и сразу возвращает заявку.
+// Ключ подписи в запросе не передаётся, статус заявки — GET /withdrawals/:id.
+func (h *Handler) Withdraw(c *gin.Context) {
 	telegramId, err := GetTelegramId(c)
-	logrus.Infof("Get privat key by telegram_id: %s", telegramId)
 	if err != nil {
 		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
 		return
 	}
-
-	key, err := h.service.Wallet.GetPrivatKey(telegramId)
-	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+	var input models.WithdrawInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid input")
 		return
 	}
-	logrus.Infof("private key get successfully")
-	wrapOkJSON(c, map[string]interface{}{
-		"key": key,
-	})
-}
-
-func (h *Handler) PayQR(c *gin.Context) {
-	logrus.Infof("PayQR")
-	idString := c.Param("id")
-	orderId, err := strconv.Atoi(idString)
-	if err != nil {
-		newErrorResponse(c, http.StatusBadRequest, "invalid order_id")
+	if input.TokenSymbol != "USDT" {
+		newErrorResponse(c, http.StatusBadRequest, "only USDT withdrawals are supported")
 		return
 	}
-	logrus.Infof("order id: %d", orderId)
 
-	status, err := h.service.Wallet.PayQR(orderId)
+	job, err := h.service.Withdrawal.Withdraw(telegramId, input.ToAddress, input.Amount, requestMeta(c))
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		if errors.Is(err, service.ErrInvalidAmount) {
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+			return
+		}
+		newErrorResponse(c, http.StatusBadRequest, fmt.Sprintf("withdraw failed: %v", err))
 		return
 	}
-	wrapOkJSON(c, map[string]interface{}{
-		"id":     orderId,
-		"status": status,
+
+	c.JSON(http.StatusAccepted, map[string]interface{}{
+		"status": "withdraw queued",
+		"job_id": job.ID,
+		"data":   job,
 	})
 }
 
-func (h *Handler) Orders(c *gin.Context) {
-
-	orders, err := h.service.Wallet.GetOrders()
+// GetWithdrawal возвращает состояние заявки на вывод текущего пользователя
+func (h *Handler) GetWithdrawal(c *gin.Context) {
+	telegramId, err := GetTelegramId(c)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
 		return
 	}
-	wrapOkJSON(c, map[string]interface{}{
-		"data": orders,
-	})
-}
-func (h *Handler) OrdersHistory(c *gin.Context) {
-	telegramId, err := GetTelegramId(c)
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
+		newErrorResponse(c, http.StatusBadRequest, "invalid withdrawal id")
 		return
 	}
 
-	logrus.Infof("Getting orders history for user with id: %d.", telegramId)
-
-	orders, err := h.service.Wallet.OrdersHistory(telegramId)
+	job, err := h.service.Withdrawal.GetWithdrawal(telegramId, id)
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		newErrorResponse(c, http.StatusNotFound, err.Error())
 		return
 	}
-
 	wrapOkJSON(c, map[string]interface{}{
-		"data": orders,
+		"data": job,
 	})
-
 }
 
-func (h *Handler) StateOrder(c *gin.Context) {
-	_, err := GetTelegramId(c)
+// SendTRXForGasEndpoint докидывает недостающий TRX с плательщика газа на кошелёк пользователя под
+// будущий перевод и ждёт подтверждения. Не дождавшись, отвечает 202 с confirmed = false.
+func (h *Handler) SendTRXForGasEndpoint(c *gin.Context) {
+	telegramId, err := GetTelegramId(c)
 	if err != nil {
 		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
 		return
 	}
-	idString := c.Param("id")
-	OrderId, err := strconv.Atoi(idString)
-	if err != nil {
-		newErrorResponse(c, http.StatusBadRequest, "invalid order_id")
+	var input models.GasTopUpInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "to_address and amount are required")
 		return
 	}
 
-	state, err := h.service.Wallet.GetOrderState(OrderId)
+	gas, err := h.service.Wallet.TopUpGas(c.Request.Context(), telegramId, input.ToAddress, input.Amount, requestMeta(c))
 	if err != nil {
-		newErrorResponse(c, http.StatusInternalServerError, err.Error())
+		switch {
+		case errors.Is(err, service.ErrInvalidAmount):
+			newErrorResponse(c, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrFeePayerNotConfigured), errors.Is(err, service.ErrFeePayerLowBalance):
+			newErrorResponse(c, http.StatusServiceUnavailable, err.Error())
+		case errors.Is(err, service.ErrGasTopUpPending):
+			newErrorResponse(c, http.StatusConflict, err.Error())
+		default:
+			newErrorResponse(c, http.StatusInternalServerError, fmt.Sprintf("failed to send TRX: %v", err))
+		}
 		return
 	}
-	wrapOkJSON(c, map[string]interface{}{
-		"data": state,
-	})
-}
-
-func (h *Handler) Withdraw(c *gin.Context) {
-	//var input models.WithdrawInput
-	//telegramId, err := GetTelegramId(c)
-	//if err != nil {
-	//	newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
-	//	return
-	//}
-
-	//err = h.service.Wallet.Withdraw(telegramId, input.ToAddress, input.TokenSymbol, input.Amount)
-	//if err != nil {
-	//	newErrorResponse(c, http.StatusBadRequest, err.Error())
-	//}
 
+	if !gas.Confirmed {
+		c.JSON(http.StatusAccepted, map[string]interface{}{
+			"data": gas,
+		})
+		return
+	}
 	wrapOkJSON(c, map[string]interface{}{
-		"status": "withdraw successful",
+		"data": gas,
 	})
-
 }
 
 func (h *Handler) GetTransactions(c *gin.Context) {
@@ -410,11 +274,12 @@ func (h *Handler) Pay(c *gin.Context) {
 
 }
 
-// CheckUSDTBalance проверяет баланс USDT для указанного адреса с учетом виртуальных списаний
+// CheckUSDTBalance проверяет баланс USDT в сети для указанного адреса с учетом виртуальных списаний
+// и удержаний под заказы.
+// balances не перезаписывается: его меняют только проводки журнала.
 func (h *Handler) CheckUSDTBalance(c *gin.Context) {
 	var req struct {
-		Address      string `json:"address"`
-		USDTContract string `json:"usdt_contract"`
+		Address string `json:"address"`
 	}
 
 	if err := c.BindJSON(&req); err != nil {
@@ -422,20 +287,13 @@ func (h *Handler) CheckUSDTBalance(c *gin.Context) {
 		return
 	}
 
-	if req.USDTContract == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "usdt_contract address is required"})
-		return
-	}
-
 	if req.Address == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "address is required"})
 		return
 	}
 
-	tempClient := tronclient.NewTronHTTPClient(h.service.Wallet.GetAPIKey(), req.USDTContract)
-
 	// Получаем реальный баланс с блокчейна
-	balance, err := tempClient.GetUSDTBalance(req.Address)
+	balance, err := h.service.Wallet.GetUSDTBalance(req.Address)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check balance: %v", err)})
 		return
@@ -448,72 +306,53 @@ func (h *Handler) CheckUSDTBalance(c *gin.Context) {
 		return
 	}
 
-	// Обновляем баланс в БД
-	err = h.service.Wallet.UpdateBalance(wallet.WalletID, "USDT", balance)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to update balance in DB"})
-		return
-	}
-
-	// Получаем сумму виртуальных списаний
-	pendingSum, err := h.service.Wallet.SumPendingVirtualTransfers(wallet.WalletID)
+	// Виртуальные списания, удержания под неоплаченные заказы и незавершённые выводы
+	reserved, err := h.service.Wallet.GetReservedBalance(wallet.WalletID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get pending sum"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get reserved balance"})
 		return
 	}
 
-	available := balance - pendingSum
-
-	// Округляем available_balance до 4 знаков после запятой
-	available = math.Floor(available*10000) / 10000
-
 	c.JSON(http.StatusOK, gin.H{
 		"address":           req.Address,
 		"real_balance":      balance,
-		"pending_virtual":   pendingSum,
-		"available_balance": available,
+		"pending_virtual":   reserved.PendingVirtual,
+		"held":              reserved.Held,
+		"withdrawing":       reserved.Withdrawing,
+		"available_balance": balance - reserved.Total(),
 	})
 }
 
-// Endpoint для виртуального списания USDT (виртуальная оплата)
+// VirtualWithdraw виртуальное списание USDT (виртуальная оплата) с кошелька текущего пользователя.
+// Проверка остатка и запись списания атомарны, параллельные запросы не уводят доступный остаток в минус.
 func (h *Handler) VirtualWithdraw(c *gin.Context) {
+	telegramId, err := GetTelegramId(c)
+	if err != nil {
+		newErrorResponse(c, http.StatusBadRequest, "invalid telegram_id")
+		return
+	}
 	var req struct {
-		Address string  `json:"address"`
-		Amount  float64 `json:"amount"`
+		Amount money.Amount `json:"amount"`
 	}
 	if err := c.BindJSON(&req); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
 		return
 	}
-	if req.Address == "" || req.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "address and positive amount required"})
+	if req.Amount.Validate() != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "positive amount required"})
 		return
 	}
-	// Получаем wallet_id по адресу
-	wallet, err := h.service.Wallet.GetWalletByAddress(req.Address)
-	if err != nil {
+
+	_, err = h.service.Wallet.VirtualWithdraw(telegramId, req.Amount, requestMeta(c))
+	switch {
+	case errors.Is(err, service.ErrWalletNotFound):
 		c.JSON(http.StatusBadRequest, gin.H{"error": "wallet not found"})
 		return
-	}
-	// Проверяем доступный баланс
-	realBalance, err := h.service.Wallet.GetUSDTBalance(req.Address)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get real balance"})
-		return
-	}
-	pendingSum, err := h.service.Wallet.SumPendingVirtualTransfers(wallet.WalletID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to get pending sum"})
-		return
-	}
-	available := realBalance - pendingSum
-	if req.Amount > available {
+	case errors.Is(err, service.ErrInsufficientFunds):
 		c.JSON(http.StatusBadRequest, gin.H{"error": "insufficient available balance"})
 		return
-	}
-	// Добавляем виртуальное списание
-	err = h.service.Wallet.AddVirtualTransfer(wallet.WalletID, req.Amount)
-	if err != nil {
+	case err != nil:
+		logrus.Errorf("virtual withdraw: %s", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to add virtual transfer"})
 		return
 	}
@@ -536,10 +375,7 @@ func (h *Handler) CheckTransactionStatus(c *gin.Context) {
 		return
 	}
 
-	// Создаем временный клиент
-	tempClient := tronclient.NewTronHTTPClient(h.service.Wallet.GetAPIKey(), "")
-
-	status, err := tempClient.GetTransactionStatus(req.TxID)
+	info, err := h.service.Wallet.GetTransactionInfo(req.TxID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check transaction status: %v", err)})
 		return
@@ -547,7 +383,7 @@ func (h *Handler) CheckTransactionStatus(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"tx_id":  req.TxID,
-		"status": status,
+		"status": info,
 	})
 }
 
@@ -567,10 +403,7 @@ func (h *Handler) CheckTRXBalance(c *gin.Context) {
 		return
 	}
 
-	// Создаем временный клиент
-	tempClient := tronclient.NewTronHTTPClient(h.service.Wallet.GetAPIKey(), "")
-
-	balance, err := tempClient.GetTRXBalance(req.Address)
+	balance, err := h.service.Wallet.GetTRXBalance(req.Address)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check TRX balance: %v", err)})
 		return
@@ -582,13 +415,13 @@ func (h *Handler) CheckTRXBalance(c *gin.Context) {
 	})
 }
 
-// EstimateRequiredTRX проверяет необходимое количество TRX для транзакции
+// EstimateRequiredTRX проверяет необходимое количество TRX для транзакции. В fee — сколько
+// энергии и bandwidth покрывает стейк, сколько сжигается по текущим ценам сети и fee_limit.
 func (h *Handler) EstimateRequiredTRX(c *gin.Context) {
 	var req struct {
-		FromAddress  string  `json:"from_address"`
-		ToAddress    string  `json:"to_address"`
-		Amount       float64 `json:"amount"`
-		USDTContract string  `json:"usdt_contract"`
+		FromAddress string       `json:"from_address"`
+		ToAddress   string       `json:"to_address"`
+		Amount      money.Amount `json:"amount"`
 	}
 
 	if err := c.BindJSON(&req); err != nil {
@@ -596,35 +429,28 @@ func (h *Handler) EstimateRequiredTRX(c *gin.Context) {
 		return
 	}
 
-	if req.USDTContract == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "usdt_contract address is required"})
-		return
-	}
-
 	if req.FromAddress == "" || req.ToAddress == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "from_address and to_address are required"})
 		return
 	}
 
-	// Создаем временный клиент с нужным адресом контракта
-	tempClient := tronclient.NewTronHTTPClient(h.service.Wallet.GetAPIKey(), req.USDTContract)
-
 	// Получаем текущий баланс TRX
-	currentTRX, err := tempClient.GetTRXBalance(req.FromAddress)
+	currentTRX, err := h.service.Wallet.GetTRXBalance(req.FromAddress)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get TRX balance: %v", err)})
 		return
 	}
 
 	// Оцениваем необходимый TRX
-	requiredTRX, err := tempClient.EstimateRequiredTRX(req.FromAddress, req.ToAddress, req.Amount)
+	fee, err := h.service.Wallet.EstimateTransferFee(req.FromAddress, req.ToAddress, req.Amount)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to estimate required TRX: %v", err)})
 		return
 	}
+	requiredTRX := fee.BurnTRX
 
 	// Проверяем баланс USDT
-	usdtBalance, err := tempClient.GetUSDTBalance(req.FromAddress)
+	usdtBalance, err := h.service.Wallet.GetUSDTBalance(req.FromAddress)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to get USDT balance: %v", err)})
 		return
@@ -639,294 +465,31 @@ func (h *Handler) EstimateRequiredTRX(c *gin.Context) {
 		"current_usdt":    usdtBalance,
 		"sufficient_trx":  currentTRX >= requiredTRX,
 		"sufficient_usdt": usdtBalance >= req.Amount,
-		"missing_trx":     requiredTRX - currentTRX,
-	})
-}
-
-// WithdrawWithAutoTRX автоматически добавляет TRX для газа и выполняет перевод USDT
-func (h *Handler) WithdrawWithAutoTRX(c *gin.Context) {
-	// Создаем контекст с таймаутом в 5 минут
-	ctx, cancel := context.WithTimeout(c.Request.Context(), 5*time.Minute)
-	defer cancel()
-
-	// Заменяем стандартный контекст на наш с таймаутом
-	c.Request = c.Request.WithContext(ctx)
-
-	var req struct {
-		PrivKey       string  `json:"priv_key"`
-		ToAddress     string  `json:"to_address"`
-		Amount        float64 `json:"amount"`
-		USDTContract  string  `json:"usdt_contract"`
-		SystemPrivKey string  `json:"system_priv_key"` // Приватный ключ владельца для отправки TRX
-		AutoAddTRX    bool    `json:"auto_add_trx"`    // Автоматически добавлять TRX
-	}
-
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
-		return
-	}
-
-	if req.USDTContract == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "usdt_contract address is required"})
-		return
-	}
-
-	// Создаем временный клиент с правильным адресом контракта
-	tempClient := tronclient.NewTronHTTPClient(h.service.Wallet.GetAPIKey(), req.USDTContract)
-
-	// Получаем адрес отправителя из приватного ключа
-	fromAddr, _, _, err := wallet2.GetTronAddressFromPrivKey(req.PrivKey)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid private key: %v", err)})
-		return
-	}
-
-	fmt.Printf("=== WithdrawWithAutoTRX DEBUG ===\n")
-	fmt.Printf("From Address: %s\n", fromAddr)
-	fmt.Printf("To Address: %s\n", req.ToAddress)
-	fmt.Printf("Amount: %.6f USDT\n", req.Amount)
-
-	// 1. Проверяем баланс USDT отправителя
-	fromBalance, err := tempClient.GetUSDTBalance(fromAddr)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check USDT balance: %v", err)})
-		return
-	}
-
-	fmt.Printf("Current USDT balance: %.6f\n", fromBalance)
-	fmt.Printf("USDT Contract used: %s\n", req.USDTContract)
-	fmt.Printf("From Address: %s\n", fromAddr)
-
-	// Дополнительная проверка через другой endpoint
-	fmt.Printf("=== Additional USDT Balance Check ===\n")
-	checkReq := struct {
-		Address      string `json:"address"`
-		USDTContract string `json:"usdt_contract"`
-	}{
-		Address:      fromAddr,
-		USDTContract: req.USDTContract,
-	}
-
-	checkJSON, _ := json.Marshal(checkReq)
-	fmt.Printf("Check request: %s\n", string(checkJSON))
-
-	if fromBalance < req.Amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("insufficient USDT balance: have %.6f, need %.6f", fromBalance, req.Amount)})
-		return
-	}
-
-	// 2. Проверяем текущий баланс TRX
-	trxBalance, err := tempClient.GetTRXBalance(fromAddr)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check TRX balance: %v", err)})
-		return
-	}
-
-	fmt.Printf("Current TRX balance: %.6f\n", trxBalance)
-
-	// 3. Оцениваем необходимый TRX для транзакции
-	requiredTRX, err := tempClient.EstimateRequiredTRX(fromAddr, req.ToAddress, req.Amount)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to estimate required TRX: %v", err)})
-		return
-	}
-
-	fmt.Printf("Estimated required TRX: %.6f\n", requiredTRX)
-
-	// 4. Если TRX недостаточно и включена автоматическая добавка
-	if trxBalance < requiredTRX && req.AutoAddTRX && req.SystemPrivKey != "" {
-		// Вычисляем сколько TRX нужно добавить (с запасом в 1 TRX)
-		trxToAdd := requiredTRX - trxBalance + 1.0
-
-		fmt.Printf("TRX insufficient. Adding %.6f TRX to address %s\n", trxToAdd, fromAddr)
-
-		// Проверяем баланс системного кошелька
-		systemAddr, _, _, err := wallet2.GetTronAddressFromPrivKey(req.SystemPrivKey)
-		if err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid system private key: %v", err)})
-			return
-		}
-
-		systemTrxBalance, err := tempClient.GetTRXBalance(systemAddr)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check system TRX balance: %v", err)})
-			return
-		}
-
-		fmt.Printf("System TRX balance: %.6f\n", systemTrxBalance)
-
-		if systemTrxBalance < trxToAdd {
-			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("insufficient TRX in system wallet: have %.6f, need %.6f", systemTrxBalance, trxToAdd)})
-			return
-		}
-
-		// 5. Отправляем TRX с системного кошелька на адрес пользователя
-		fmt.Printf("Sending %.6f TRX from system wallet to user wallet...\n", trxToAdd)
-
-		trxTxID, err := h.service.Wallet.SendTRXForGas(req.SystemPrivKey, fromAddr, trxToAdd)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to send TRX for gas: %v", err)})
-			return
-		}
-
-		fmt.Printf("TRX sent successfully: %s\n", trxTxID)
-
-		// 6. Ждем обработки транзакции TRX
-		fmt.Printf("Waiting for TRX transaction to be processed...\n")
-		time.Sleep(time.Second * 10) // Ждем 10 секунд
-
-		// 7. Проверяем новый баланс TRX
-		newTrxBalance, err := tempClient.GetTRXBalance(fromAddr)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check new TRX balance: %v", err)})
-			return
-		}
-
-		fmt.Printf("New TRX balance: %.6f\n", newTrxBalance)
-
-		if newTrxBalance < requiredTRX {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("TRX transfer completed but balance still insufficient: have %.6f, need %.6f", newTrxBalance, requiredTRX)})
-			return
-		}
-	} else if trxBalance < requiredTRX {
-		// Если TRX недостаточно и автоматическое добавление отключено
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":        fmt.Sprintf("insufficient TRX for gas fees: have %.6f, need %.6f. Enable auto_add_trx to automatically add TRX.", trxBalance, requiredTRX),
-			"trx_balance":  trxBalance,
-			"required_trx": requiredTRX,
-			"need_trx":     true,
-		})
-		return
-	}
-
-	// 8. Выполняем перевод USDT
-	fmt.Printf("Executing USDT transfer...\n")
-	txID, err := h.service.Wallet.WithdrawWithContract(req.PrivKey, req.ToAddress, req.Amount, req.USDTContract)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("USDT transfer failed: %v", err)})
-		return
-	}
-
-	fmt.Printf("USDT transfer completed successfully: %s\n", txID)
-	fmt.Printf("=== WithdrawWithAutoTRX COMPLETED ===\n")
-
-	c.JSON(http.StatusOK, gin.H{
-		"transfer_tx":      txID,
-		"auto_trx_added":   req.AutoAddTRX && trxBalance < requiredTRX,
-		"trx_added_amount": requiredTRX - trxBalance + 1.0,
-		"message":          "Transfer completed successfully",
-	})
-}
-
-// SendTRXForGasEndpoint отправляет TRX для оплаты газа
-func (h *Handler) SendTRXForGasEndpoint(c *gin.Context) {
-	var req struct {
-		SystemPrivKey string  `json:"system_priv_key"` // Приватный ключ владельца
-		ToAddress     string  `json:"to_address"`      // Адрес получателя
-		Amount        float64 `json:"amount"`          // Количество TRX
-	}
-
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
-		return
-	}
-
-	if req.SystemPrivKey == "" || req.ToAddress == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "system_priv_key and to_address are required"})
-		return
-	}
-
-	if req.Amount <= 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be greater than 0"})
-		return
-	}
-
-	fmt.Printf("=== SendTRXForGas DEBUG ===\n")
-	fmt.Printf("To Address: %s\n", req.ToAddress)
-	fmt.Printf("Amount: %.6f TRX\n", req.Amount)
-
-	// Проверяем баланс системного кошелька
-	systemAddr, _, _, err := wallet2.GetTronAddressFromPrivKey(req.SystemPrivKey)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid system private key: %v", err)})
-		return
-	}
-
-	tempClient := tronclient.NewTronHTTPClient(h.service.Wallet.GetAPIKey(), "")
-	systemTrxBalance, err := tempClient.GetTRXBalance(systemAddr)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to check system TRX balance: %v", err)})
-		return
-	}
-
-	fmt.Printf("System TRX balance: %.6f\n", systemTrxBalance)
-
-	if systemTrxBalance < req.Amount {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("insufficient TRX in system wallet: have %.6f, need %.6f", systemTrxBalance, req.Amount)})
-		return
-	}
-
-	// Отправляем TRX
-	fmt.Printf("Sending %.6f TRX from system wallet to %s...\n", req.Amount, req.ToAddress)
-
-	txID, err := h.service.Wallet.SendTRXForGas(req.SystemPrivKey, req.ToAddress, req.Amount)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": fmt.Sprintf("failed to send TRX: %v", err)})
-		return
-	}
-
-	fmt.Printf("TRX sent successfully: %s\n", txID)
-	fmt.Printf("=== SendTRXForGas COMPLETED ===\n")
-
-	c.JSON(http.StatusOK, gin.H{
-		"tx_id":          txID,
-		"amount":         req.Amount,
-		"to_address":     req.ToAddress,
-		"system_address": systemAddr,
-		"message":        "TRX sent successfully for gas fees",
+		"missing_trx":     max(requiredTRX-currentTRX, 0),
+		"fee":             fee,
 	})
 }
 
-// GetAddressFromPrivateKey получает адрес из приватного ключа
-func (h *Handler) GetAddressFromPrivateKey(c *gin.Context) {
-	var req struct {
-		PrivKey string `json:"priv_key"`
-	}
-
-	if err := c.BindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid input"})
-		return
-	}
-
-	if req.PrivKey == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "priv_key is required"})
+// AdminFailedTransactions неуспешные и истёкшие транзакции всех пользователей
+func (h *Handler) AdminFailedTransactions(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if err != nil || limit <= 0 {
+		newErrorResponse(c, http.StatusBadRequest, "invalid limit")
 		return
 	}
 
-	// Получаем адрес из приватного ключа
-	fromAddr, fromAddrHex, _, err := wallet2.GetTronAddressFromPrivKey(req.PrivKey)
+	txs, err := h.service.Tracker.GetFailedTransactions(limit)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid private key: %v", err)})
+		newErrorResponse(c, http.StatusInternalServerError, "failed to get transactions")
 		return
 	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"private_key": req.PrivKey,
-		"address":     fromAddr,
-		"address_hex": fromAddrHex,
+	wrapOkJSON(c, map[string]interface{}{
+		"data": txs,
 	})
 }
 
-// AdminWalletsWithHistory возвращает список всех кошельков с историей списаний
+// AdminWalletsWithHistory все кошельки с историей виртуальных и реальных списаний
 func (h *Handler) AdminWalletsWithHistory(c *gin.Context) {
-	// Проверка секретного ключа
-	const adminSecret = "@$KC@f~vms|IXP#" // Задай свой ключ!
-	secret := c.GetHeader("X-Admin-Secret")
-	if secret != adminSecret {
-		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
-		return
-	}
-
 	wallets, err := h.service.Wallet.GetAllWallets()
 	if err != nil {
 		newErrorResponse(c, http.StatusInternalServerError, "failed to get wallets")
@@ -934,14 +497,15 @@ func (h *Handler) AdminWalletsWithHistory(c *gin.Context) {
 	}
 
 	type HistoryItem struct {
-		ID          int64   `json:"id"`
-		Amount      float64 `json:"amount"`
-		Type        string  `json:"type"` // "virtual" или "real"
-		Status      string  `json:"status"`
-		ToAddress   string  `json:"to_address,omitempty"`
-		TxHash      *string `json:"tx_hash,omitempty"`
-		CreatedAt   string  `json:"created_at"`
-		ProcessedAt *string `json:"processed_at,omitempty"`
+		ID          int64        `json:"id"`
+		Amount      money.Amount `json:"amount"`
+		Type        string       `json:"type"` // "virtual" или "real"
+		Status      string       `json:"status"`
+		ToAddress   string       `json:"to_address,omitempty"`
+		TxHash      *string      `json:"tx_hash,omitempty"`
+		Reason      string       `json:"failure_reason,omitempty"`
+		CreatedAt   string       `json:"created_at"`
+		ProcessedAt *string      `json:"processed_at,omitempty"`
 	}
 
 	var result []map[string]interface{}
@@ -976,6 +540,7 @@ func (h *Handler) AdminWalletsWithHistory(c *gin.Context) {
 				Status:    r.Status,
 				ToAddress: r.ToAddress,
 				TxHash:    r.TxHash,
+				Reason:    r.FailureReason,
 				CreatedAt: r.CreatedAt.Format("2006-01-02T15:04:05Z07:00"),
 			})
 		}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+	"production_wallet_back/pkg/repository"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+)
+
+// newDBTestAPI API поверх FakeChain и Postgres из TEST_DATABASE_URL (база с применёнными
+// миграциями schema). Без переменной тест пропускается.
+func newDBTestAPI(t *testing.T) (*testAPI, *repository.Repository) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := sqlx.Connect("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	repos := repository.NewRepository(db)
+	api := newTestAPIWithRepos(t, repos)
+	api.login(time.Now().UnixNano() % 1_000_000_000_000)
+	return api, repos
+}
+
+type createdWallet struct {
+	WalletID int64  `json:"wallet_id"`
+	Address  string `json:"address"`
+}
+
+// createFundedWallet создаёт кошелёк пользователя с amount USDT в сети и в журнале
+func createFundedWallet(t *testing.T, api *testAPI, repos *repository.Repository, amount money.Amount) createdWallet {
+	t.Helper()
+	var created createdWallet
+	if code := api.post("/api/wallet/create", nil, &created); code != http.StatusOK {
+		t.Fatalf("create wallet: code = %d", code)
+	}
+	api.chain.SetUSDTBalance(created.Address, amount)
+	entry := models.AuditEntry{Actor: models.ActorSystem, Action: models.AuditDeposit, Target: "test"}
+	if err := repos.Wallet.Deposit(api.userID, "USDT", amount, "test:"+created.Address, entry); err != nil {
+		t.Fatal(err)
+	}
+	return created
+}
+
+func TestVirtualWithdrawConcurrent(t *testing.T) {
+	api, repos := newDBTestAPI(t)
+	created := createFundedWallet(t, api, repos, money.MustParse("10"))
+
+	// Чужой адрес в теле ни на что не влияет: списание идёт с кошелька из токена
+	other := newTestWallet(t)
+	const requests = 25
+	codes := make(chan int, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- api.post("/api/wallet/virtual-withdraw", gin.H{"address": other.Address, "amount": "1"}, nil)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	ok := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			ok++
+		case http.StatusBadRequest:
+		default:
+			t.Fatalf("unexpected code %d", code)
+		}
+	}
+	if ok != 10 {
+		t.Fatalf("%d of %d withdrawals of 1 USDT succeeded on a 10 USDT balance, want 10", ok, requests)
+	}
+	pending, err := repos.Wallet.SumPendingVirtualTransfers(created.WalletID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending != money.MustParse("10") {
+		t.Fatalf("pending = %s, want 10", pending)
+	}
+}
+
+func TestWithdrawalReservesAvailableBalance(t *testing.T) {
+	api, repos := newDBTestAPI(t)
+	created := createFundedWallet(t, api, repos, money.MustParse("10"))
+	to := newTestWallet(t).Address
+
+	withdraw := func(amount string) int {
+		return api.post("/api/wallet/withdraw", gin.H{"to_address": to, "amount": amount, "token_symbol": "USDT"}, nil)
+	}
+	virtual := func(amount string) int {
+		return api.post("/api/wallet/virtual-withdraw", gin.H{"amount": amount}, nil)
+	}
+
+	if code := withdraw("6"); code != http.StatusAccepted {
+		t.Fatalf("withdraw 6: code = %d", code)
+	}
+	// Вывод ещё в очереди, но его сумма уже недоступна для виртуальных списаний
+	if code := virtual("5"); code != http.StatusBadRequest {
+		t.Fatalf("virtual 5 after withdraw 6: code = %d, want 400", code)
+	}
+	if code := virtual("4"); code != http.StatusOK {
+		t.Fatalf("virtual 4: code = %d", code)
+	}
+	if code := withdraw("1"); code != http.StatusBadRequest {
+		t.Fatalf("withdraw 1 with nothing available: code = %d, want 400", code)
+	}
+
+	reserved, err := repos.Wallet.GetReservedBalance(created.WalletID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved.Withdrawing != money.MustParse("6") || reserved.PendingVirtual != money.MustParse("4") || reserved.Total() != money.MustParse("10") {
+		t.Fatalf("reserved = %+v", reserved)
+	}
+}
+
+func TestManualDepositReplayIsRejected(t *testing.T) {
+	api, repos := newDBTestAPI(t)
+	created := createFundedWallet(t, api, repos, money.MustParse("10"))
+
+	entry := models.AuditEntry{Actor: models.ActorSystem, Action: models.AuditDeposit, Target: "test"}
+	reference := "payment:" + created.Address
+	if err := repos.Wallet.Deposit(api.userID, "USDT", money.MustParse("5"), reference, entry); err != nil {
+		t.Fatal(err)
+	}
+	// Повтор того же платежа (ретрай, двойной клик) не зачисляется второй раз
+	if err := repos.Wallet.Deposit(api.userID, "USDT", money.MustParse("5"), reference, entry); !errors.Is(err, repository.ErrDepositReplayed) {
+		t.Fatalf("replay: err = %v, want ErrDepositReplayed", err)
+	}
+
+	balances, err := repos.Wallet.GetBalances(api.userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, b := range balances {
+		if b.TokenSymbol == "USDT" && b.Amount != money.MustParse("15") {
+			t.Fatalf("USDT balance = %s, want 15", b.Amount)
+		}
+	}
+}
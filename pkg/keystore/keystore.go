@@ -0,0 +1,218 @@
+package keystore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"production_wallet_back/models"
+	"strconv"
+	"strings"
+)
+
+const (
+	// MasterKeysEnv список мастер-ключей в виде "1:<base64>,2:<base64>"
+	MasterKeysEnv = "WALLET_MASTER_KEYS"
+	// MasterKeyVersionEnv версия, которой шифруются новые ключи (по умолчанию — максимальная)
+	MasterKeyVersionEnv = "WALLET_MASTER_KEY_VERSION"
+
+	keySize = 32
+)
+
+var (
+	ErrNoMasterKey      = errors.New("master key is not configured")
+	ErrUnknownVersion   = errors.New("unknown master key version")
+	ErrMalformedPayload = errors.New("malformed encrypted payload")
+)
+
+// Keystore шифрует приватные ключи кошельков: ключ шифруется случайным DEK (AES-256-GCM),
+// а DEK — мастер-ключом. При ротации перешифровывается только DEK.
+type Keystore struct {
+	masterKeys map[int][]byte
+	current    int
+}
+
+func New(masterKeys map[int][]byte, current int) (*Keystore, error) {
+	if len(masterKeys) == 0 {
+		return nil, ErrNoMasterKey
+	}
+	for version, key := range masterKeys {
+		if version <= 0 {
+			return nil, fmt.Errorf("master key version must be positive, got %d", version)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("master key v%d must be %d bytes, got %d", version, keySize, len(key))
+		}
+	}
+	if _, ok := masterKeys[current]; !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, current)
+	}
+	return &Keystore{masterKeys: masterKeys, current: current}, nil
+}
+
+// NewFromEnv читает мастер-ключи из WALLET_MASTER_KEYS и WALLET_MASTER_KEY_VERSION
+func NewFromEnv() (*Keystore, error) {
+	raw := os.Getenv(MasterKeysEnv)
+	if raw == "" {
+		return nil, ErrNoMasterKey
+	}
+
+	keys := make(map[int][]byte)
+	current := 0
+	for _, item := range strings.Split(raw, ",") {
+		parts := strings.SplitN(strings.TrimSpace(item), ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid %s entry %q", MasterKeysEnv, item)
+		}
+		version, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key version %q: %v", parts[0], err)
+		}
+		key, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid master key v%d: %v", version, err)
+		}
+		keys[version] = key
+		if version > current {
+			current = version
+		}
+	}
+
+	if v := os.Getenv(MasterKeyVersionEnv); v != "" {
+		version, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", MasterKeyVersionEnv, err)
+		}
+		current = version
+	}
+	return New(keys, current)
+}
+
+// CurrentVersion версия мастер-ключа для новых записей
+func (k *Keystore) CurrentVersion() int {
+	return k.current
+}
+
+// Encrypt шифрует приватный ключ новым DEK, обёрнутым текущим мастер-ключом
+func (k *Keystore) Encrypt(plaintext []byte) (models.EncryptedKey, error) {
+	dek := make([]byte, keySize)
+	if _, err := rand.Read(dek); err != nil {
+		return models.EncryptedKey{}, err
+	}
+
+	ciphertext, err := seal(dek, plaintext, nil)
+	if err != nil {
+		return models.EncryptedKey{}, err
+	}
+	wrapped, err := k.wrap(dek, k.current)
+	if err != nil {
+		return models.EncryptedKey{}, err
+	}
+
+	return models.EncryptedKey{
+		Ciphertext: ciphertext,
+		WrappedKey: wrapped,
+		KeyVersion: k.current,
+	}, nil
+}
+
+// Decrypt возвращает приватный ключ в открытом виде. Вызывать только там, где ключ нужен для подписи.
+func (k *Keystore) Decrypt(key models.EncryptedKey) ([]byte, error) {
+	if key.KeyVersion == 0 {
+		return []byte(key.Ciphertext), nil
+	}
+
+	dek, err := k.unwrap(key.WrappedKey, key.KeyVersion)
+	if err != nil {
+		return nil, err
+	}
+	return open(dek, key.Ciphertext, nil)
+}
+
+// Rewrap переносит запись под текущий мастер-ключ. Старые записи в открытом виде шифруются целиком.
+func (k *Keystore) Rewrap(key models.EncryptedKey) (models.EncryptedKey, error) {
+	if key.KeyVersion == 0 {
+		return k.Encrypt([]byte(key.Ciphertext))
+	}
+	if key.KeyVersion == k.current {
+		return key, nil
+	}
+
+	dek, err := k.unwrap(key.WrappedKey, key.KeyVersion)
+	if err != nil {
+		return models.EncryptedKey{}, err
+	}
+	wrapped, err := k.wrap(dek, k.current)
+	if err != nil {
+		return models.EncryptedKey{}, err
+	}
+
+	return models.EncryptedKey{
+		Ciphertext: key.Ciphertext,
+		WrappedKey: wrapped,
+		KeyVersion: k.current,
+	}, nil
+}
+
+func (k *Keystore) wrap(dek []byte, version int) (string, error) {
+	master, ok := k.masterKeys[version]
+	if !ok {
+		return "", fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return seal(master, dek, versionAD(version))
+}
+
+func (k *Keystore) unwrap(wrapped string, version int) ([]byte, error) {
+	master, ok := k.masterKeys[version]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownVersion, version)
+	}
+	return open(master, wrapped, versionAD(version))
+}
+
+// versionAD привязывает обёрнутый DEK к версии мастер-ключа
+func versionAD(version int) []byte {
+	return []byte("wallet-dek-v" + strconv.Itoa(version))
+}
+
+// seal шифрует AES-256-GCM и возвращает base64(nonce|ciphertext)
+func seal(key, plaintext, additionalData []byte) (string, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	out := gcm.Seal(nonce, nonce, plaintext, additionalData)
+	return base64.StdEncoding.EncodeToString(out), nil
+}
+
+func open(key []byte, payload string, additionalData []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil || len(raw) < gcm.NonceSize() {
+		return nil, ErrMalformedPayload
+	}
+	nonce, ciphertext := raw[:gcm.NonceSize()], raw[gcm.NonceSize():]
+	plaintext, err := gcm.Open(nil, nonce, ciphertext, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt: %v", err)
+	}
+	return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
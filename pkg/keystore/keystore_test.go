@@ -0,0 +1,220 @@
+package keystore
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"production_wallet_back/models"
+)
+
+const testPrivateKey = "4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d"
+
+func masterKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, keySize)
+}
+
+func newKeystore(t *testing.T, keys map[int][]byte, current int) *Keystore {
+	t.Helper()
+	k, err := New(keys, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
+
+// flipLastByte портит последний байт base64-пакета: у GCM это тег
+func flipLastByte(t *testing.T, payload string) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[len(raw)-1] ^= 0x01
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+// flipByte портит байт шифртекста сразу за nonce
+func flipByte(t *testing.T, payload string) string {
+	t.Helper()
+	raw, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw[12] ^= 0x80
+	return base64.StdEncoding.EncodeToString(raw)
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	k := newKeystore(t, map[int][]byte{1: masterKey(1)}, 1)
+	key, err := k.Encrypt([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyVersion != 1 || key.Ciphertext == testPrivateKey || key.WrappedKey == "" {
+		t.Fatalf("key = %+v", key)
+	}
+	plaintext, err := k.Decrypt(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != testPrivateKey {
+		t.Fatalf("plaintext = %q", plaintext)
+	}
+
+	// Каждый ключ шифруется своим DEK
+	other, err := k.Encrypt([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other.Ciphertext == key.Ciphertext || other.WrappedKey == key.WrappedKey {
+		t.Fatal("two encryptions produced the same payload")
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	k := newKeystore(t, map[int][]byte{1: masterKey(1)}, 1)
+	key, err := k.Encrypt([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Тот же мастер-ключ под двумя версиями: DEK привязан к версии через AAD
+	sameBytes := newKeystore(t, map[int][]byte{1: masterKey(1), 2: masterKey(1)}, 2)
+
+	tests := []struct {
+		name     string
+		keystore *Keystore
+		key      models.EncryptedKey
+		wantErr  error
+	}{
+		{name: "wrong master key", keystore: newKeystore(t, map[int][]byte{1: masterKey(2)}, 1), key: key},
+		{name: "unknown version", keystore: k, key: models.EncryptedKey{Ciphertext: key.Ciphertext, WrappedKey: key.WrappedKey, KeyVersion: 2}, wantErr: ErrUnknownVersion},
+		{name: "version swapped", keystore: sameBytes, key: models.EncryptedKey{Ciphertext: key.Ciphertext, WrappedKey: key.WrappedKey, KeyVersion: 2}},
+		{name: "tampered ciphertext", keystore: k, key: models.EncryptedKey{Ciphertext: flipByte(t, key.Ciphertext), WrappedKey: key.WrappedKey, KeyVersion: 1}},
+		{name: "tampered tag", keystore: k, key: models.EncryptedKey{Ciphertext: flipLastByte(t, key.Ciphertext), WrappedKey: key.WrappedKey, KeyVersion: 1}},
+		{name: "tampered wrapped key", keystore: k, key: models.EncryptedKey{Ciphertext: key.Ciphertext, WrappedKey: flipByte(t, key.WrappedKey), KeyVersion: 1}},
+		{name: "not base64", keystore: k, key: models.EncryptedKey{Ciphertext: "%%%", WrappedKey: key.WrappedKey, KeyVersion: 1}, wantErr: ErrMalformedPayload},
+		{name: "too short", keystore: k, key: models.EncryptedKey{Ciphertext: key.Ciphertext, WrappedKey: "AAAA", KeyVersion: 1}, wantErr: ErrMalformedPayload},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plaintext, err := tt.keystore.Decrypt(tt.key)
+			if err == nil {
+				t.Fatalf("decrypted %q", plaintext)
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRewrap(t *testing.T) {
+	old := newKeystore(t, map[int][]byte{1: masterKey(1)}, 1)
+	key, err := old.Encrypt([]byte(testPrivateKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newKeystore(t, map[int][]byte{1: masterKey(1), 2: masterKey(2)}, 2)
+	rewrapped, err := rotated.Rewrap(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Перешифровывается только DEK
+	if rewrapped.KeyVersion != 2 || rewrapped.Ciphertext != key.Ciphertext || rewrapped.WrappedKey == key.WrappedKey {
+		t.Fatalf("rewrapped = %+v", rewrapped)
+	}
+
+	// После ротации старый мастер-ключ можно убрать: запись читается одним новым
+	onlyNew := newKeystore(t, map[int][]byte{2: masterKey(2)}, 2)
+	plaintext, err := onlyNew.Decrypt(rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(plaintext) != testPrivateKey {
+		t.Fatalf("plaintext = %q", plaintext)
+	}
+	if _, err := onlyNew.Decrypt(key); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("old record with old key removed: err = %v, want ErrUnknownVersion", err)
+	}
+	if _, err := old.Decrypt(rewrapped); !errors.Is(err, ErrUnknownVersion) {
+		t.Fatalf("rewrapped record under old keystore: err = %v, want ErrUnknownVersion", err)
+	}
+	// Обёрнутый новым ключом DEK не открывается старым, даже если подставить версию
+	if _, err := old.Decrypt(models.EncryptedKey{Ciphertext: rewrapped.Ciphertext, WrappedKey: rewrapped.WrappedKey, KeyVersion: 1}); err == nil {
+		t.Fatal("old master key decrypted a record rewrapped under the new one")
+	}
+
+	// Запись под текущей версией не меняется
+	same, err := rotated.Rewrap(rewrapped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same != rewrapped {
+		t.Fatalf("rewrap under current version changed the record: %+v", same)
+	}
+}
+
+func TestRewrapLegacyPlaintext(t *testing.T) {
+	k := newKeystore(t, map[int][]byte{1: masterKey(1)}, 1)
+	legacy := models.EncryptedKey{Ciphertext: testPrivateKey}
+	if plaintext, err := k.Decrypt(legacy); err != nil || string(plaintext) != testPrivateKey {
+		t.Fatalf("legacy decrypt: %q, %v", plaintext, err)
+	}
+
+	encrypted, err := k.Rewrap(legacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.KeyVersion != 1 || encrypted.Ciphertext == testPrivateKey {
+		t.Fatalf("encrypted = %+v", encrypted)
+	}
+	if plaintext, err := k.Decrypt(encrypted); err != nil || string(plaintext) != testPrivateKey {
+		t.Fatalf("decrypt after rewrap: %q, %v", plaintext, err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    map[int][]byte
+		current int
+		wantErr error
+	}{
+		{name: "no keys", keys: nil, current: 1, wantErr: ErrNoMasterKey},
+		{name: "unknown current", keys: map[int][]byte{1: masterKey(1)}, current: 2, wantErr: ErrUnknownVersion},
+		{name: "short key", keys: map[int][]byte{1: []byte("short")}, current: 1},
+		{name: "zero version", keys: map[int][]byte{0: masterKey(1)}, current: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(tt.keys, tt.current)
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if tt.wantErr != nil && !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNewFromEnv(t *testing.T) {
+	t.Setenv(MasterKeysEnv, "1:"+base64.StdEncoding.EncodeToString(masterKey(1))+", 3:"+base64.StdEncoding.EncodeToString(masterKey(3)))
+	t.Setenv(MasterKeyVersionEnv, "")
+	k, err := NewFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if k.CurrentVersion() != 3 {
+		t.Fatalf("current = %d, want the highest version 3", k.CurrentVersion())
+	}
+
+	t.Setenv(MasterKeyVersionEnv, "1")
+	if k, err = NewFromEnv(); err != nil || k.CurrentVersion() != 1 {
+		t.Fatalf("pinned version: %v, %v", k, err)
+	}
+}
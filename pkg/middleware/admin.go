@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"net/http"
+	"production_wallet_back/models"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// AdminKey ключ в gin.Context с админом (models.AdminUser) из проверенной сессии
+	AdminKey = "admin"
+	// AdminSessionIDKey ключ в gin.Context с id сессии админки
+	AdminSessionIDKey = "admin_session_id"
+)
+
+// AdminTokenValidator проверяет токен сессии админки
+type AdminTokenValidator interface {
+	ValidateAdminToken(token string) (admin models.AdminUser, sessionID int64, err error)
+}
+
+// AdminAuth пускает в админку по токену сессии из Authorization: Bearer <token>
+// и кладёт админа в контекст. Отказы пишутся в лог с адресом клиента.
+func AdminAuth(validator AdminTokenValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) {
+			logrus.Warnf("AdminAuth: denied %s %s from %s: no token", c.Request.Method, c.Request.URL.Path, c.ClientIP())
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "admin session token is required in 'Authorization' header"})
+			return
+		}
+
+		admin, sessionID, err := validator.ValidateAdminToken(strings.TrimPrefix(header, bearerPrefix))
+		if err != nil {
+			logrus.Warnf("AdminAuth: denied %s %s from %s: %s", c.Request.Method, c.Request.URL.Path, c.ClientIP(), err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(AdminKey, admin)
+		c.Set(AdminSessionIDKey, sessionID)
+		c.Next()
+	}
+}
+
+// RequirePermission пропускает только админов, у роли которых есть право perm.
+// Ставится после AdminAuth на каждый маршрут админки.
+func RequirePermission(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, _ := c.Get(AdminKey)
+		admin, ok := value.(models.AdminUser)
+		if !ok || !models.RoleHasPermission(admin.Role, perm) {
+			logrus.Warnf("RequirePermission: denied %s %s for admin %q (role %q) from %s: %s required",
+				c.Request.Method, c.Request.URL.Path, admin.Username, admin.Role, c.ClientIP(), perm)
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "permission '" + perm + "' is required"})
+			return
+		}
+		c.Next()
+	}
+}
@@ -1,21 +1,171 @@
 package middleware
 
 import (
-	"github.com/sirupsen/logrus"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// TelegramIDKey ключ в gin.Context, под которым лежит проверенный telegram_id
+	TelegramIDKey = "telegram_id"
+	// TelegramUserKey ключ в gin.Context с пользователем из проверенного initData
+	TelegramUserKey = "telegram_user"
+	// SessionIDKey ключ в gin.Context с id сессии из access-токена
+	SessionIDKey = "session_id"
+
+	initDataHeader = "X-Telegram-Init-Data"
+	bearerPrefix   = "Bearer "
+
+	// maxInitDataClockSkew насколько auth_date может опережать часы сервера
+	maxInitDataClockSkew = time.Minute
 )
 
-func AuthMiddleware() gin.HandlerFunc {
+var (
+	ErrInitDataEmpty     = errors.New("init data is empty")
+	ErrInitDataMalformed = errors.New("init data is malformed")
+	ErrInitDataSignature = errors.New("init data signature is invalid")
+	ErrInitDataExpired   = errors.New("init data is expired")
+	ErrInitDataFuture    = errors.New("init data auth_date is in the future")
+	// ErrInitDataMaxAge без срока действия перехваченный initData годится для логина навсегда
+	ErrInitDataMaxAge = errors.New("init data max age is not configured")
+	// ErrBotTokenEmpty без токена бота подпись initData может посчитать кто угодно
+	ErrBotTokenEmpty = errors.New("telegram bot token is not configured")
+)
+
+// TelegramUser пользователь из поля user в initData
+type TelegramUser struct {
+	ID        int64  `json:"id"`
+	Username  string `json:"username"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+// InitData проверенные данные Telegram Mini App
+type InitData struct {
+	User     TelegramUser
+	AuthDate time.Time
+	QueryID  string
+}
+
+// ValidateInitData проверяет подпись initData (HMAC-SHA256 от токена бота) и срок её действия.
+// Алгоритм описан в https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+func ValidateInitData(raw string, botToken string, maxAge time.Duration, now time.Time) (InitData, error) {
+	var data InitData
+	if botToken == "" {
+		return data, ErrBotTokenEmpty
+	}
+	if maxAge <= 0 {
+		return data, ErrInitDataMaxAge
+	}
+	if raw == "" {
+		return data, ErrInitDataEmpty
+	}
+
+	values, err := url.ParseQuery(raw)
+	if err != nil {
+		return data, ErrInitDataMalformed
+	}
+
+	hash := values.Get("hash")
+	if hash == "" {
+		return data, ErrInitDataMalformed
+	}
+
+	// data-check-string: все поля кроме hash, отсортированные по ключу, через \n
+	pairs := make([]string, 0, len(values))
+	for key := range values {
+		if key == "hash" {
+			continue
+		}
+		pairs = append(pairs, key+"="+values.Get(key))
+	}
+	sort.Strings(pairs)
+	dataCheckString := strings.Join(pairs, "\n")
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(dataCheckString))
+	expected := hex.EncodeToString(mac.Sum(nil))
+
+	if !hmac.Equal([]byte(expected), []byte(strings.ToLower(hash))) {
+		return data, ErrInitDataSignature
+	}
+
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return data, ErrInitDataMalformed
+	}
+	data.AuthDate = time.Unix(authDate, 0)
+	if now.Sub(data.AuthDate) > maxAge {
+		return data, ErrInitDataExpired
+	}
+	if data.AuthDate.Sub(now) > maxInitDataClockSkew {
+		return data, ErrInitDataFuture
+	}
+
+	if err := json.Unmarshal([]byte(values.Get("user")), &data.User); err != nil || data.User.ID == 0 {
+		return data, ErrInitDataMalformed
+	}
+	data.QueryID = values.Get("query_id")
+
+	return data, nil
+}
+
+// TokenValidator проверяет access-токен и возвращает telegram_id и id сессии
+type TokenValidator interface {
+	ValidateAccessToken(token string) (telegramID int64, sessionID int64, err error)
+}
+
+// TelegramInitData принимает подписанный initData из заголовка X-Telegram-Init-Data
+// и кладёт проверенного пользователя в контекст. Используется только при логине.
+func TelegramInitData(botToken string, maxAge time.Duration) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		telegramID := c.GetHeader("X-Telegram-ID")
-		if telegramID == "" {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "telegram_id is required in 'X-Telegram-ID' header"})
-			c.Abort()
+		data, err := ValidateInitData(c.GetHeader(initDataHeader), botToken, maxAge, time.Now())
+		if err != nil {
+			logrus.Warnf("TelegramInitData: %s", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "invalid telegram init data: " + err.Error()})
+			return
+		}
+		logrus.Infof("TelegramInitData: telegram_id: %d", data.User.ID)
+		c.Set(TelegramIDKey, data.User.ID)
+		c.Set(TelegramUserKey, data.User)
+		c.Next()
+	}
+}
+
+// AuthMiddleware проверяет access-токен из заголовка Authorization: Bearer <token>
+// и отклоняет запросы с отозванной сессией
+func AuthMiddleware(validator TokenValidator) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "access token is required in 'Authorization' header"})
+			return
+		}
+
+		telegramID, sessionID, err := validator.ValidateAccessToken(strings.TrimPrefix(header, bearerPrefix))
+		if err != nil {
+			logrus.Warnf("AuthMiddleware: %s", err)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
 			return
 		}
-		logrus.Infof("AuthMiddleware: telegram_id: %s", telegramID)
+		logrus.Infof("AuthMiddleware: telegram_id: %d, session_id: %d", telegramID, sessionID)
+		c.Set(TelegramIDKey, telegramID)
+		c.Set(SessionIDKey, sessionID)
 		c.Next()
 	}
 }
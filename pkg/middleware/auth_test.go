@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testBotToken = "123456:TEST-bot-token"
+
+// signInitData собирает initData так же, как его подписывает Telegram
+func signInitData(botToken string, values url.Values) string {
+	pairs := make([]string, 0, len(values))
+	for key := range values {
+		pairs = append(pairs, key+"="+values.Get(key))
+	}
+	sort.Strings(pairs)
+
+	secret := hmac.New(sha256.New, []byte("WebAppData"))
+	secret.Write([]byte(botToken))
+	mac := hmac.New(sha256.New, secret.Sum(nil))
+	mac.Write([]byte(strings.Join(pairs, "\n")))
+
+	signed := url.Values{}
+	for key := range values {
+		signed.Set(key, values.Get(key))
+	}
+	signed.Set("hash", hex.EncodeToString(mac.Sum(nil)))
+	return signed.Encode()
+}
+
+func TestValidateInitData(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	fields := func(authDate time.Time, user string) url.Values {
+		return url.Values{
+			"auth_date": {strconv.FormatInt(authDate.Unix(), 10)},
+			"query_id":  {"AAHdF6IQAAAAAN0XohDhrOrc"},
+			"user":      {user},
+		}
+	}
+	user := `{"id":279058397,"username":"vdkfrost","first_name":"Vladislav"}`
+	valid := signInitData(testBotToken, fields(now.Add(-time.Minute), user))
+
+	tests := []struct {
+		name    string
+		raw     string
+		token   string
+		maxAge  time.Duration
+		wantErr error
+		wantID  int64
+	}{
+		{name: "valid", raw: valid, token: testBotToken, maxAge: time.Hour, wantID: 279058397},
+		{name: "no max age", raw: valid, token: testBotToken, wantErr: ErrInitDataMaxAge},
+		{name: "negative max age", raw: valid, token: testBotToken, maxAge: -time.Hour, wantErr: ErrInitDataMaxAge},
+		{name: "clock skew", raw: signInitData(testBotToken, fields(now.Add(30*time.Second), user)), token: testBotToken, maxAge: time.Hour, wantID: 279058397},
+		{name: "from the future", raw: signInitData(testBotToken, fields(now.Add(10*time.Minute), user)), token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataFuture},
+		{name: "empty", raw: "", token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataEmpty},
+		{name: "no hash", raw: fields(now, user).Encode(), token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataMalformed},
+		{name: "bad query", raw: "%zz", token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataMalformed},
+		{name: "other bot", raw: valid, token: "654321:OTHER-bot-token", maxAge: time.Hour, wantErr: ErrInitDataSignature},
+		{name: "empty token", raw: valid, token: "", wantErr: ErrBotTokenEmpty},
+		{name: "tampered user", raw: strings.Replace(valid, "279058397", "279058398", 1), token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataSignature},
+		{name: "expired", raw: signInitData(testBotToken, fields(now.Add(-2*time.Hour), user)), token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataExpired},
+		{name: "bad auth_date", raw: signInitData(testBotToken, url.Values{"auth_date": {"yesterday"}, "user": {user}}), token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataMalformed},
+		{name: "no user id", raw: signInitData(testBotToken, fields(now, `{"username":"nobody"}`)), token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataMalformed},
+		{name: "bad user json", raw: signInitData(testBotToken, fields(now, `{"id":`)), token: testBotToken, maxAge: time.Hour, wantErr: ErrInitDataMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := ValidateInitData(tt.raw, tt.token, tt.maxAge, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && data.User.ID != tt.wantID {
+				t.Fatalf("user id = %d, want %d", data.User.ID, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestValidateInitDataUppercaseHash(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	values, _ := url.ParseQuery(signInitData(testBotToken, url.Values{
+		"auth_date": {strconv.FormatInt(now.Unix(), 10)},
+		"user":      {`{"id":42}`},
+	}))
+	values.Set("hash", strings.ToUpper(values.Get("hash")))
+
+	data, err := ValidateInitData(values.Encode(), testBotToken, time.Hour, now)
+	if err != nil {
+		t.Fatalf("err = %v", err)
+	}
+	if data.User.ID != 42 || !data.AuthDate.Equal(now) {
+		t.Fatalf("data = %+v", data)
+	}
+}
@@ -0,0 +1,128 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+
+	"production_wallet_back/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// IdempotencyKeyHeader ключ, с которым клиент повторяет один и тот же запрос
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotencyReplayedHeader выставляется в ответе, взятом из сохранённого
+	IdempotencyReplayedHeader = "Idempotency-Replayed"
+
+	maxIdempotencyKeyLength = 255
+)
+
+// IdempotencyStore хранит ключи и ответы. started = false — ключ уже использовался.
+// ReleaseRequest снимает ключ без ответа, чтобы повтор выполнился заново.
+type IdempotencyStore interface {
+	StartRequest(key models.IdempotencyKey) (rec models.IdempotencyKey, started bool, err error)
+	CompleteRequest(id int64, statusCode int, contentType string, body []byte) error
+	ReleaseRequest(id int64) error
+}
+
+// Idempotency выполняет запрос с заголовком Idempotency-Key не больше одного раза.
+// Повтор с тем же ключом и телом получает сохранённый ответ, с другим телом — 422,
+// пока первый запрос ещё выполняется — 409. Ответ 5xx не сохраняется: ключ снимается,
+// и повтор выполняет запрос заново. Запросы без заголовка проходят как есть.
+// Ключи принадлежат пользователю, поэтому middleware ставится после AuthMiddleware.
+func Idempotency(store IdempotencyStore) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key is too long"})
+			return
+		}
+		telegramID, ok := c.Get(TelegramIDKey)
+		if !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "failed to read request body"})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		hash := requestHash(c.Request.Method, c.Request.URL.Path, body)
+
+		rec, started, err := store.StartRequest(models.IdempotencyKey{
+			TelegramID:  telegramID.(int64),
+			Key:         key,
+			Method:      c.Request.Method,
+			Path:        c.Request.URL.Path,
+			RequestHash: hash,
+		})
+		if err != nil {
+			logrus.Errorf("Idempotency: %s", err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "failed to check Idempotency-Key"})
+			return
+		}
+
+		if !started {
+			switch {
+			case rec.RequestHash != hash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used with a different request"})
+			case rec.StatusCode == nil:
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "request with this Idempotency-Key is still in progress"})
+			default:
+				logrus.Infof("Idempotency: replay %s for telegram_id %d", key, rec.TelegramID)
+				c.Header(IdempotencyReplayedHeader, "true")
+				c.Data(*rec.StatusCode, rec.ContentType, rec.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err := store.ReleaseRequest(rec.ID); err != nil {
+				logrus.Errorf("Idempotency: failed to release %s: %s", key, err)
+			}
+			return
+		}
+		if err := store.CompleteRequest(rec.ID, recorder.Status(), recorder.Header().Get("Content-Type"), recorder.body.Bytes()); err != nil {
+			logrus.Errorf("Idempotency: failed to save response for %s: %s", key, err)
+		}
+	}
+}
+
+func requestHash(method, path string, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(method + " " + path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder копирует тело ответа, чтобы сохранить его для повторов
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"production_wallet_back/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// memoryIdempotency хранилище ключей в памяти для одного пользователя
+type memoryIdempotency struct {
+	keys   map[string]models.IdempotencyKey
+	nextID int64
+}
+
+func (m *memoryIdempotency) StartRequest(key models.IdempotencyKey) (models.IdempotencyKey, bool, error) {
+	if rec, ok := m.keys[key.Key]; ok {
+		return rec, false, nil
+	}
+	m.nextID++
+	key.ID = m.nextID
+	m.keys[key.Key] = key
+	return key, true, nil
+}
+
+func (m *memoryIdempotency) CompleteRequest(id int64, statusCode int, contentType string, body []byte) error {
+	for k, rec := range m.keys {
+		if rec.ID == id {
+			rec.StatusCode, rec.ContentType, rec.ResponseBody = &statusCode, contentType, body
+			m.keys[k] = rec
+		}
+	}
+	return nil
+}
+
+func (m *memoryIdempotency) ReleaseRequest(id int64) error {
+	for k, rec := range m.keys {
+		if rec.ID == id && rec.StatusCode == nil {
+			delete(m.keys, k)
+		}
+	}
+	return nil
+}
+
+func TestIdempotency(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		statuses     []int
+		wantCalls    int
+		wantStatus   int
+		wantReplayed bool
+	}{
+		{name: "success is replayed", statuses: []int{http.StatusOK, http.StatusOK}, wantCalls: 1, wantStatus: http.StatusOK, wantReplayed: true},
+		{name: "client error is replayed", statuses: []int{http.StatusBadRequest, http.StatusOK}, wantCalls: 1, wantStatus: http.StatusBadRequest, wantReplayed: true},
+		{name: "server error is retried", statuses: []int{http.StatusInternalServerError, http.StatusOK}, wantCalls: 2, wantStatus: http.StatusOK},
+		{name: "bad gateway is retried", statuses: []int{http.StatusBadGateway, http.StatusCreated}, wantCalls: 2, wantStatus: http.StatusCreated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &memoryIdempotency{keys: map[string]models.IdempotencyKey{}}
+			calls := 0
+			router := gin.New()
+			router.POST("/withdraw", func(c *gin.Context) { c.Set(TelegramIDKey, int64(42)) }, Idempotency(store), func(c *gin.Context) {
+				c.JSON(tt.statuses[calls], gin.H{"call": calls})
+				calls++
+			})
+
+			var resp *httptest.ResponseRecorder
+			for range tt.statuses {
+				req := httptest.NewRequest(http.MethodPost, "/withdraw", strings.NewReader(`{"amount":"10"}`))
+				req.Header.Set(IdempotencyKeyHeader, "key-1")
+				resp = httptest.NewRecorder()
+				router.ServeHTTP(resp, req)
+			}
+
+			if calls != tt.wantCalls {
+				t.Fatalf("handler calls = %d, want %d", calls, tt.wantCalls)
+			}
+			if resp.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.Code, tt.wantStatus)
+			}
+			if replayed := resp.Header().Get(IdempotencyReplayedHeader) == "true"; replayed != tt.wantReplayed {
+				t.Fatalf("replayed = %v, want %v", replayed, tt.wantReplayed)
+			}
+		})
+	}
+}
@@ -0,0 +1,239 @@
+// Package money хранит суммы токенов точно, в целых базовых единицах.
+// У USDT (TRC20) и TRX по 6 знаков после запятой: 1 единица = 10^-6 USDT = 1 SUN.
+package money
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Decimals число знаков после запятой
+	Decimals = 6
+	// One единица токена в базовых единицах
+	One Amount = 1_000_000
+	// Max максимальная сумма, 10^12 токенов. С запасом помещается в int64 и NUMERIC(30, 6),
+	// а суммы нескольких значений не переполняются.
+	Max Amount = 1_000_000_000_000 * One
+)
+
+var (
+	ErrSyntax    = errors.New("invalid amount")
+	ErrPrecision = fmt.Errorf("amount has more than %d decimal places", Decimals)
+	ErrRange     = errors.New("amount is out of range")
+)
+
+// Amount сумма в базовых единицах (10^-6)
+type Amount int64
+
+// FromUnits сумма из базовых единиц (SUN, 10^-6 USDT)
+func FromUnits(units int64) Amount {
+	return Amount(units)
+}
+
+// FromBig сумма из uint256 значения контракта
+func FromBig(units *big.Int) (Amount, error) {
+	if !units.IsInt64() || Amount(units.Int64()) > Max || Amount(units.Int64()) < -Max {
+		return 0, fmt.Errorf("%w: %s units", ErrRange, units)
+	}
+	return Amount(units.Int64()), nil
+}
+
+// Parse разбирает десятичную запись вида "12", "-0.5", "12.345678".
+// Больше 6 значащих знаков после запятой — ErrPrecision, нули сверх шести отбрасываются.
+func Parse(s string) (Amount, error) {
+	s = strings.TrimSpace(s)
+	neg := false
+	switch {
+	case strings.HasPrefix(s, "-"):
+		neg, s = true, s[1:]
+	case strings.HasPrefix(s, "+"):
+		s = s[1:]
+	}
+
+	intPart, fracPart, hasDot := strings.Cut(s, ".")
+	if intPart == "" && fracPart == "" || hasDot && fracPart == "" || !digits(intPart) || !digits(fracPart) {
+		return 0, fmt.Errorf("%w: %q", ErrSyntax, s)
+	}
+	if len(fracPart) > Decimals {
+		if strings.Trim(fracPart[Decimals:], "0") != "" {
+			return 0, fmt.Errorf("%w: %q", ErrPrecision, s)
+		}
+		fracPart = fracPart[:Decimals]
+	}
+	fracPart += strings.Repeat("0", Decimals-len(fracPart))
+
+	intPart = strings.TrimLeft(intPart, "0")
+	if len(intPart) > 13 {
+		return 0, fmt.Errorf("%w: %q", ErrRange, s)
+	}
+	units, err := strconv.ParseInt(intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %q", ErrRange, s)
+	}
+	a := Amount(units)
+	if neg {
+		a = -a
+	}
+	if a > Max || a < -Max {
+		return 0, fmt.Errorf("%w: %q", ErrRange, s)
+	}
+	return a, nil
+}
+
+// MustParse как Parse, но паникует. Только для констант.
+func MustParse(s string) Amount {
+	a, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return a
+}
+
+func digits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Units сумма в базовых единицах
+func (a Amount) Units() int64 {
+	return int64(a)
+}
+
+// Big сумма в базовых единицах для ABI-кодирования
+func (a Amount) Big() *big.Int {
+	return big.NewInt(int64(a))
+}
+
+// String десятичная запись без лишних нулей: "12.5", "0.000001", "3"
+func (a Amount) String() string {
+	sign := ""
+	units := int64(a)
+	if units < 0 {
+		sign, units = "-", -units
+	}
+	s := fmt.Sprintf("%s%d.%06d", sign, units/int64(One), units%int64(One))
+	return strings.TrimSuffix(strings.TrimRight(s, "0"), ".")
+}
+
+// Float64 приближённое значение. Только для логов и внешних API с плавающей точкой.
+func (a Amount) Float64() float64 {
+	return float64(a) / float64(One)
+}
+
+func (a Amount) IsPositive() bool {
+	return a > 0
+}
+
+// Validate проверяет, что сумма положительная и не больше Max
+func (a Amount) Validate() error {
+	if a <= 0 {
+		return fmt.Errorf("%w: must be greater than 0", ErrRange)
+	}
+	if a > Max {
+		return fmt.Errorf("%w: must not exceed %s", ErrRange, Max)
+	}
+	return nil
+}
+
+// MulPercent увеличивает сумму на percent процентов с округлением вверх
+func (a Amount) MulPercent(percent int64) Amount {
+	v := new(big.Int).Mul(a.Big(), big.NewInt(100+percent))
+	return Amount(ceilDiv(v, big.NewInt(100)).Int64())
+}
+
+// DivRate делит сумму в одной валюте на курс rate (цена единицы токена в этой валюте)
+// и возвращает сумму в токене. Результат округляется вверх до 10^-6: пользователь
+// никогда не платит меньше точного значения.
+func (a Amount) DivRate(rate float64) (Amount, error) {
+	if rate <= 0 || math.IsNaN(rate) || math.IsInf(rate, 0) {
+		return 0, fmt.Errorf("invalid rate %v", rate)
+	}
+	r, ok := new(big.Rat).SetString(strconv.FormatFloat(rate, 'f', -1, 64))
+	if !ok {
+		return 0, fmt.Errorf("invalid rate %v", rate)
+	}
+	// units / rate = units * denom / num
+	num := new(big.Int).Mul(a.Big(), r.Denom())
+	result := ceilDiv(num, r.Num())
+	if !result.IsInt64() || Amount(result.Int64()) > Max {
+		return 0, fmt.Errorf("%w: %s / %v", ErrRange, a, rate)
+	}
+	return Amount(result.Int64()), nil
+}
+
+// ceilDiv деление с округлением к +бесконечности, d > 0
+func ceilDiv(n, d *big.Int) *big.Int {
+	q, m := new(big.Int).DivMod(n, d, new(big.Int))
+	if m.Sign() != 0 {
+		q.Add(q, big.NewInt(1))
+	}
+	return q
+}
+
+// MarshalJSON пишет сумму JSON-числом без потери точности
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalJSON принимает число или строку: 12.5 и "12.5". Значение разбирается
+// из текста, без промежуточного float64.
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	if unquoted, err := strconv.Unquote(s); err == nil {
+		s = unquoted
+	} else if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("%w: exponent notation is not supported: %s", ErrSyntax, s)
+	}
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Scan читает NUMERIC из Postgres (lib/pq отдаёт его текстом)
+func (a *Amount) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*a = 0
+		return nil
+	case []byte:
+		return a.scanString(string(v))
+	case string:
+		return a.scanString(v)
+	case int64:
+		return a.scanString(strconv.FormatInt(v, 10))
+	case float64:
+		return a.scanString(strconv.FormatFloat(v, 'f', -1, 64))
+	default:
+		return fmt.Errorf("cannot scan %T into amount", src)
+	}
+}
+
+func (a *Amount) scanString(s string) error {
+	parsed, err := Parse(s)
+	if err != nil {
+		return err
+	}
+	*a = parsed
+	return nil
+}
+
+// Value пишет сумму в NUMERIC десятичной строкой
+func (a Amount) Value() (driver.Value, error) {
+	return a.String(), nil
+}
@@ -0,0 +1,128 @@
+package money
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr error
+	}{
+		{in: "12", want: 12 * One},
+		{in: "12.5", want: 12_500_000},
+		{in: "0.000001", want: 1},
+		{in: ".5", want: 500_000},
+		{in: "5.", wantErr: ErrSyntax},
+		{in: "  7.25 ", want: 7_250_000},
+		{in: "+3", want: 3 * One},
+		{in: "-0.5", want: -500_000},
+		{in: "-", wantErr: ErrSyntax},
+		{in: "--1", wantErr: ErrSyntax},
+		{in: "", wantErr: ErrSyntax},
+		{in: ".", wantErr: ErrSyntax},
+		{in: "1e6", wantErr: ErrSyntax},
+		{in: "1,5", wantErr: ErrSyntax},
+		{in: "0x10", wantErr: ErrSyntax},
+		{in: "1.2.3", wantErr: ErrSyntax},
+		{in: "1.1234567", wantErr: ErrPrecision},
+		{in: "0.0000001", wantErr: ErrPrecision},
+		{in: "1.123456000", want: 1_123_456},
+		{in: "000012.000000", want: 12 * One},
+		{in: "1000000000000", want: Max},
+		{in: "-1000000000000", want: -Max},
+		{in: "1000000000000.000001", wantErr: ErrRange},
+		{in: "10000000000000", wantErr: ErrRange},
+		{in: "99999999999999999999", wantErr: ErrRange},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := Parse(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Parse(%q) err = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("Parse(%q) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStringRoundTrip(t *testing.T) {
+	for _, s := range []string{"0", "3", "12.5", "0.000001", "-0.5", "1000000000000"} {
+		a := MustParse(s)
+		if a.String() != s {
+			t.Fatalf("MustParse(%q).String() = %q", s, a.String())
+		}
+	}
+}
+
+func TestDivRate(t *testing.T) {
+	tests := []struct {
+		name    string
+		amount  Amount
+		rate    float64
+		want    Amount
+		wantErr bool
+	}{
+		{name: "exact", amount: MustParse("10"), rate: 2.5, want: MustParse("4")},
+		{name: "rounds up", amount: MustParse("1"), rate: 3, want: MustParse("0.333334")},
+		{name: "rub to usdt", amount: MustParse("100"), rate: 90.5, want: MustParse("1.104973")},
+		{name: "smallest unit", amount: 1, rate: 1_000_000, want: 1},
+		{name: "zero", amount: 0, rate: 95.1, want: 0},
+		{name: "rate below one", amount: MustParse("1"), rate: 0.3, want: MustParse("3.333334")},
+		{name: "overflow", amount: Max, rate: 0.5, wantErr: true},
+		{name: "zero rate", amount: One, rate: 0, wantErr: true},
+		{name: "negative rate", amount: One, rate: -1, wantErr: true},
+		{name: "nan", amount: One, rate: math.NaN(), wantErr: true},
+		{name: "inf", amount: One, rate: math.Inf(1), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.amount.DivRate(tt.rate)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DivRate(%v) err = %v, wantErr %v", tt.rate, err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("%s / %v = %s, want %s", tt.amount, tt.rate, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMulPercent(t *testing.T) {
+	if got := MustParse("10").MulPercent(30); got != MustParse("13") {
+		t.Fatalf("10 + 30%% = %s", got)
+	}
+	if got := Amount(1).MulPercent(30); got != 2 {
+		t.Fatalf("1 unit + 30%% = %d, want rounded up to 2", got)
+	}
+}
+
+func TestUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{in: `12.5`, want: 12_500_000},
+		{in: `"12.5"`, want: 12_500_000},
+		{in: `null`, want: 0},
+		{in: `1e3`, wantErr: true},
+		{in: `"abc"`, wantErr: true},
+		{in: `0.1234567`, wantErr: true},
+	}
+	for _, tt := range tests {
+		var a Amount
+		err := a.UnmarshalJSON([]byte(tt.in))
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("UnmarshalJSON(%s) err = %v, wantErr %v", tt.in, err, tt.wantErr)
+		}
+		if err == nil && a != tt.want {
+			t.Fatalf("UnmarshalJSON(%s) = %d, want %d", tt.in, a, tt.want)
+		}
+	}
+}
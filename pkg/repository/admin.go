@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"production_wallet_back/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrAdminExists админ с таким логином уже есть
+var ErrAdminExists = errors.New("admin user already exists")
+
+type AdminPostgres struct {
+	db *sqlx.DB
+}
+
+func NewAdminPostgres(db *sqlx.DB) *AdminPostgres {
+	return &AdminPostgres{db: db}
+}
+
+func (r *AdminPostgres) CreateAdmin(admin models.AdminUser) (models.AdminUser, error) {
+	var created models.AdminUser
+	query := `
+	INSERT INTO admin_users (username, password_hash, role) VALUES ($1, $2, $3)
+	ON CONFLICT (username) DO NOTHING
+	RETURNING *
+	`
+	err := r.db.Get(&created, query, admin.Username, admin.PasswordHash, admin.Role)
+	if errors.Is(err, sql.ErrNoRows) {
+		return created, ErrAdminExists
+	}
+	return created, err
+}
+
+func (r *AdminPostgres) GetAdmin(id int64) (models.AdminUser, error) {
+	var admin models.AdminUser
+	err := r.db.Get(&admin, `SELECT * FROM admin_users WHERE id = $1`, id)
+	return admin, err
+}
+
+func (r *AdminPostgres) GetAdminByUsername(username string) (models.AdminUser, error) {
+	var admin models.AdminUser
+	err := r.db.Get(&admin, `SELECT * FROM admin_users WHERE username = $1`, username)
+	return admin, err
+}
+
+func (r *AdminPostgres) GetAdmins() ([]models.AdminUser, error) {
+	var admins []models.AdminUser
+	err := r.db.Select(&admins, `SELECT * FROM admin_users ORDER BY id`)
+	return admins, err
+}
+
+// UpdateAdmin меняет роль и блокировку. Сессии заблокированного админа отзываются в той же транзакции.
+func (r *AdminPostgres) UpdateAdmin(id int64, role string, disabled bool) (models.AdminUser, error) {
+	var admin models.AdminUser
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return admin, err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE admin_users SET role = $1, disabled = $2 WHERE id = $3 RETURNING *`
+	if err := tx.Get(&admin, query, role, disabled, id); err != nil {
+		return admin, err
+	}
+	if disabled {
+		if _, err := tx.Exec(`UPDATE admin_sessions SET revoked_at = NOW() WHERE admin_id = $1 AND revoked_at IS NULL`, id); err != nil {
+			return admin, err
+		}
+	}
+	return admin, tx.Commit()
+}
+
+func (r *AdminPostgres) SetAdminPassword(id int64, passwordHash string) error {
+	res, err := r.db.Exec(`UPDATE admin_users SET password_hash = $1 WHERE id = $2`, passwordHash, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// CreateAdminSession открывает сессию и отмечает время входа
+func (r *AdminPostgres) CreateAdminSession(session models.AdminSession) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	query := `
+	INSERT INTO admin_sessions (admin_id, token_hash, user_agent, ip, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	RETURNING id
+	`
+	err = tx.QueryRow(query, session.AdminID, session.TokenHash, session.UserAgent, session.IP, session.ExpiresAt).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(`UPDATE admin_users SET last_login_at = NOW() WHERE id = $1`, session.AdminID); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+func (r *AdminPostgres) GetAdminSessionByHash(hash string) (models.AdminSession, error) {
+	var session models.AdminSession
+	err := r.db.Get(&session, `SELECT * FROM admin_sessions WHERE token_hash = $1`, hash)
+	return session, err
+}
+
+func (r *AdminPostgres) RevokeAdminSession(id int64) error {
+	_, err := r.db.Exec(`UPDATE admin_sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`, id)
+	return err
+}
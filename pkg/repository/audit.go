@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/audit"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type AuditPostgres struct {
+	db *sqlx.DB
+}
+
+func NewAuditPostgres(db *sqlx.DB) *AuditPostgres {
+	return &AuditPostgres{db: db}
+}
+
+// AppendAudit дописывает запись в конец цепочки отдельной транзакцией
+func (r *AuditPostgres) AppendAudit(entry models.AuditEntry) (models.AuditEntry, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return entry, err
+	}
+	defer tx.Rollback()
+
+	if entry, err = appendAudit(tx, entry); err != nil {
+		return entry, err
+	}
+	return entry, tx.Commit()
+}
+
+// appendAudit дописывает запись в конец цепочки в транзакции tx: запись о движении денег
+// фиксируется или откатывается вместе с ним. Таблица блокируется от параллельных вставок
+// до конца транзакции, чтобы у двух записей не оказалось одного prev_hash.
+func appendAudit(tx *sqlx.Tx, entry models.AuditEntry) (models.AuditEntry, error) {
+	if _, err := tx.Exec(`LOCK TABLE audit_log IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return entry, err
+	}
+	err := tx.Get(&entry.PrevHash, `SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1`)
+	if errors.Is(err, sql.ErrNoRows) {
+		entry.PrevHash = audit.GenesisHash
+	} else if err != nil {
+		return entry, err
+	}
+
+	// Postgres хранит микросекунды: хэш считается от того же времени, что будет прочитано
+	entry.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Hash = audit.Hash(entry.PrevHash, entry)
+
+	query := `
+	INSERT INTO audit_log (actor, action, target, metadata, before, after, prev_hash, hash, created_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	RETURNING id
+	`
+	err = tx.QueryRow(query, entry.Actor, entry.Action, entry.Target, nullJSON(entry.Metadata), nullJSON(entry.Before), nullJSON(entry.After),
+		entry.PrevHash, entry.Hash, entry.CreatedAt).Scan(&entry.ID)
+	return entry, err
+}
+
+// recordAudit дописывает в tx запись entry со снимками before и after, снятыми в той же транзакции.
+// Если запись не легла, движение денег откатывается вместе с транзакцией.
+func recordAudit(tx *sqlx.Tx, entry models.AuditEntry, before, after interface{}) error {
+	var err error
+	if before != nil {
+		if entry.Before, err = json.Marshal(before); err != nil {
+			return err
+		}
+	}
+	if after != nil {
+		if entry.After, err = json.Marshal(after); err != nil {
+			return err
+		}
+	}
+	if _, err = appendAudit(tx, entry); err != nil {
+		return fmt.Errorf("failed to write audit %s %s: %w", entry.Action, entry.Target, err)
+	}
+	return nil
+}
+
+// GetAuditEntries записи журнала по фильтру, новые первыми
+func (r *AuditPostgres) GetAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+	add := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if filter.Actor != "" {
+		add("actor = $%d", filter.Actor)
+	}
+	if filter.Action != "" {
+		add("action = $%d", filter.Action)
+	}
+	if filter.Target != "" {
+		add("target = $%d", filter.Target)
+	}
+	if filter.Since != nil {
+		add("created_at >= $%d", *filter.Since)
+	}
+	if filter.Until != nil {
+		add("created_at < $%d", *filter.Until)
+	}
+	if filter.BeforeID > 0 {
+		add("id < $%d", filter.BeforeID)
+	}
+
+	query := `SELECT * FROM audit_log`
+	if len(conditions) > 0 {
+		query += ` WHERE ` + strings.Join(conditions, " AND ")
+	}
+	args = append(args, filter.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	var entries []models.AuditEntry
+	err := r.db.Select(&entries, query, args...)
+	return entries, err
+}
+
+// GetAuditChain записи после afterID по порядку цепочки, для проверки
+func (r *AuditPostgres) GetAuditChain(afterID int64, limit int) ([]models.AuditEntry, error) {
+	var entries []models.AuditEntry
+	err := r.db.Select(&entries, `SELECT * FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2`, afterID, limit)
+	return entries, err
+}
+
+// nullJSON пустой снимок пишется как NULL
+func nullJSON(raw []byte) interface{} {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
@@ -1,8 +1,11 @@
 package repository
 
 import (
-	"github.com/jmoiron/sqlx"
+	"database/sql"
 	"production_wallet_back/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
 )
 
 type AuthPostgres struct {
@@ -36,3 +39,57 @@ func (r *AuthPostgres) CreateUser(user models.User) (int64, error) {
 	).Scan(&id)
 	return id, err
 }
+
+func (r *AuthPostgres) CreateSession(session models.Session) (int64, error) {
+	var id int64
+	query := `
+		INSERT INTO sessions (telegram_id, refresh_token_hash, user_agent, expires_at)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id
+	`
+	err := r.db.QueryRow(query, session.TelegramID, session.RefreshTokenHash, session.UserAgent, session.ExpiresAt).Scan(&id)
+	return id, err
+}
+
+func (r *AuthPostgres) GetSession(id int64) (models.Session, error) {
+	var session models.Session
+	query := `SELECT id, telegram_id, refresh_token_hash, COALESCE(user_agent, '') AS user_agent, expires_at, revoked_at, created_at FROM sessions WHERE id = $1`
+	err := r.db.Get(&session, query, id)
+	return session, err
+}
+
+func (r *AuthPostgres) GetSessionByRefreshHash(hash string) (models.Session, error) {
+	var session models.Session
+	query := `SELECT id, telegram_id, refresh_token_hash, COALESCE(user_agent, '') AS user_agent, expires_at, revoked_at, created_at FROM sessions WHERE refresh_token_hash = $1`
+	err := r.db.Get(&session, query, hash)
+	return session, err
+}
+
+// RotateSessionRefresh заменяет refresh-токен сессии, только если старый ещё актуален
+func (r *AuthPostgres) RotateSessionRefresh(id int64, oldHash, newHash string, expiresAt time.Time) error {
+	query := `
+		UPDATE sessions SET refresh_token_hash = $1, expires_at = $2
+		WHERE id = $3 AND refresh_token_hash = $4 AND revoked_at IS NULL AND expires_at > NOW()
+	`
+	res, err := r.db.Exec(query, newHash, expiresAt, id, oldHash)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (r *AuthPostgres) RevokeSession(id int64) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, id)
+	return err
+}
+
+// RevokeUserSessions завершает все активные сессии пользователя
+func (r *AuthPostgres) RevokeUserSessions(telegramID int64) error {
+	query := `UPDATE sessions SET revoked_at = NOW() WHERE telegram_id = $1 AND revoked_at IS NULL`
+	_, err := r.db.Exec(query, telegramID)
+	return err
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+type DepositPostgres struct {
+	db *sqlx.DB
+}
+
+func NewDepositPostgres(db *sqlx.DB) *DepositPostgres {
+	return &DepositPostgres{db: db}
+}
+
+// GetCheckpoint возвращает последний обработанный блок сканера. found = false, если сканер ещё не запускался.
+func (r *DepositPostgres) GetCheckpoint(name string) (block int64, found bool, err error) {
+	query := `SELECT block_number FROM scanner_checkpoints WHERE name = $1`
+	err = r.db.Get(&block, query, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	return block, true, nil
+}
+
+// GetWalletIDsByAddresses возвращает id кошельков по адресам. Адреса без кошелька в результат не попадают.
+func (r *DepositPostgres) GetWalletIDsByAddresses(addresses []string) (map[string]int64, error) {
+	var rows []models.WalletResponce
+	query := `SELECT id, address FROM wallets WHERE address = ANY($1)`
+	if err := r.db.Select(&rows, query, pq.Array(addresses)); err != nil {
+		return nil, err
+	}
+
+	ids := make(map[string]int64, len(rows))
+	for _, w := range rows {
+		ids[w.Address] = w.WalletID
+	}
+	return ids, nil
+}
+
+// SaveBlockDeposits записывает найденные в блоке депозиты и сдвигает checkpoint в одной транзакции.
+// Повторная запись того же блока после рестарта ничего не дублирует.
+func (r *DepositPostgres) SaveBlockDeposits(name string, block int64, deposits []models.Deposit) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	INSERT INTO deposits (wallet_id, tx_hash, log_index, block_number, from_address, token_symbol, amount)
+	VALUES ($1, $2, $3, $4, $5, $6, $7)
+	ON CONFLICT (tx_hash, log_index) DO NOTHING
+	`
+	for _, d := range deposits {
+		if _, err := tx.Exec(query, d.WalletID, d.TxHash, d.LogIndex, d.BlockNumber, d.FromAddress, d.TokenSymbol, d.Amount); err != nil {
+			return fmt.Errorf("failed to save deposit %s:%d: %v", d.TxHash, d.LogIndex, err)
+		}
+	}
+
+	queryCheckpoint := `
+	INSERT INTO scanner_checkpoints (name, block_number) VALUES ($1, $2)
+	ON CONFLICT (name) DO UPDATE SET block_number = EXCLUDED.block_number, updated_at = NOW()
+	`
+	if _, err := tx.Exec(queryCheckpoint, name, block); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetDepositsToConfirm возвращает pending депозиты из блоков не новее maxBlock
+func (r *DepositPostgres) GetDepositsToConfirm(maxBlock int64) ([]models.Deposit, error) {
+	var deposits []models.Deposit
+	query := `SELECT * FROM deposits WHERE status = 'pending' AND block_number <= $1 ORDER BY block_number, id`
+	err := r.db.Select(&deposits, query, maxBlock)
+	return deposits, err
+}
+
+// CreditDeposit зачисляет депозит на баланс проводкой в журнале. Зачисление происходит ровно один раз:
+// проводка и запись audit пишутся только если статус удалось перевести из pending.
+func (r *DepositPostgres) CreditDeposit(id int64, audit models.AuditEntry) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var d models.Deposit
+	query := `
+	UPDATE deposits SET status = 'credited', credited_at = NOW()
+	WHERE id = $1 AND status = 'pending'
+	RETURNING *
+	`
+	err = tx.Get(&d, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = postEntry(tx, models.LedgerEntry{
+		Kind:      models.EntryDeposit,
+		Reference: fmt.Sprintf("deposit:%d", id),
+		Postings: []models.Posting{
+			{Account: models.AccountExternal, TokenSymbol: d.TokenSymbol, Amount: -d.Amount},
+			{Account: models.AccountWallet, WalletID: d.WalletID, TokenSymbol: d.TokenSymbol, Amount: d.Amount},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err := recordAudit(tx, audit, nil, d); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// MarkDepositOrphaned помечает депозит, транзакция которого пропала из сети после реорганизации
+func (r *DepositPostgres) MarkDepositOrphaned(id int64) error {
+	query := `UPDATE deposits SET status = 'orphaned' WHERE id = $1 AND status = 'pending'`
+	_, err := r.db.Exec(query, id)
+	return err
+}
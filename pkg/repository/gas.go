@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"production_wallet_back/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrGasTopUpPending на адрес уже идёт перевод газа
+var ErrGasTopUpPending = errors.New("gas top-up to this address is already pending")
+
+type GasPostgres struct {
+	db *sqlx.DB
+}
+
+func NewGasPostgres(db *sqlx.DB) *GasPostgres {
+	return &GasPostgres{db: db}
+}
+
+// ReserveGasTopUp записывает подписанный перевод газа до отправки. Если на тот же адрес уже
+// есть перевод в pending, ничего не пишется и возвращается ErrGasTopUpPending: уникальный
+// индекс по pending-адресу сериализует параллельные докидывания. Если передан audit,
+// запись журнала аудита пишется в той же транзакции и без неё перевод не записывается.
+func (r *GasPostgres) ReserveGasTopUp(topUp models.GasTopUpTx, audit *models.AuditEntry) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var reserved models.GasTopUpTx
+	query := `
+	INSERT INTO gas_topups (tx_id, address, amount, description, expires_at)
+	VALUES ($1, $2, $3, $4, $5)
+	ON CONFLICT (address) WHERE status = 'pending' DO NOTHING
+	RETURNING *
+	`
+	err = tx.Get(&reserved, query, topUp.TxID, topUp.Address, topUp.Amount, topUp.Description, topUp.ExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrGasTopUpPending
+	}
+	if err != nil {
+		return err
+	}
+	if audit != nil {
+		if err := recordAudit(tx, *audit, nil, reserved); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// GetPendingGasTopUps переводы газа, ещё не подтверждённые в сети, старые первыми
+func (r *GasPostgres) GetPendingGasTopUps(limit int) ([]models.GasTopUpTx, error) {
+	var topUps []models.GasTopUpTx
+	query := `SELECT * FROM gas_topups WHERE status = 'pending' ORDER BY id LIMIT $1`
+	err := r.db.Select(&topUps, query, limit)
+	return topUps, err
+}
+
+// FinishGasTopUp закрывает перевод газа txID со статусом status и освобождает адрес
+func (r *GasPostgres) FinishGasTopUp(txID string, status string) error {
+	query := `UPDATE gas_topups SET status = $1, updated_at = NOW() WHERE tx_id = $2 AND status = 'pending'`
+	_, err := r.db.Exec(query, status, txID)
+	return err
+}
@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// lockAvailable блокирует строку кошелька и возвращает остаток, доступный для новых списаний:
+// balance в сети минус pending виртуальные списания, активные удержания и незавершённые выводы,
+// кроме заявки excludeWithdrawalID (0 — без исключений). Все, кто списывает с этого остатка,
+// берут ту же блокировку.
+func lockAvailable(tx *sqlx.Tx, walletID int64, balance money.Amount, excludeWithdrawalID int64) (money.Amount, error) {
+	var locked int64
+	if err := tx.Get(&locked, `SELECT id FROM wallets WHERE id = $1 FOR UPDATE`, walletID); err != nil {
+		return 0, err
+	}
+	reserved, err := reservedBalance(tx, walletID, excludeWithdrawalID)
+	if err != nil {
+		return 0, err
+	}
+	return balance - reserved.Total(), nil
+}
+
+// reservedBalance резервы кошелька, которые lockAvailable вычитает из остатка в сети
+func reservedBalance(q sqlx.Queryer, walletID int64, excludeWithdrawalID int64) (models.ReservedBalance, error) {
+	var reserved models.ReservedBalance
+	query := `
+	SELECT
+		(SELECT COALESCE(SUM(amount), 0) FROM usdt_virtual_transfers
+		 WHERE wallet_id = $1 AND status = 'pending') AS pending_virtual,
+		(SELECT COALESCE(SUM(amount), 0) FROM balance_holds
+		 WHERE wallet_id = $1 AND status = 'active') AS held,
+		(SELECT COALESCE(SUM(amount), 0) FROM withdrawal_jobs
+		 WHERE wallet_id = $1 AND id <> $2 AND state NOT IN ('confirmed', 'failed')) AS withdrawing
+	`
+	err := sqlx.Get(q, &reserved, query, walletID, excludeWithdrawalID)
+	return reserved, err
+}
+
+// createHold удерживает amount под заказ, если он помещается в доступный остаток
+func createHold(tx *sqlx.Tx, walletID, orderID int64, amount, balance money.Amount) (models.BalanceHold, error) {
+	var hold models.BalanceHold
+	available, err := lockAvailable(tx, walletID, balance, 0)
+	if err != nil {
+		return hold, err
+	}
+	if available < amount {
+		return hold, fmt.Errorf("%w: available %s, need %s", ErrInsufficientBalance, available, amount)
+	}
+	query := `INSERT INTO balance_holds (wallet_id, order_id, amount) VALUES ($1, $2, $3) RETURNING *`
+	err = tx.Get(&hold, query, walletID, orderID, amount)
+	return hold, err
+}
+
+// captureHold превращает активное удержание заказа в pending виртуальное списание,
+// которое затем переводится на казначейство воркером settlement
+func captureHold(tx *sqlx.Tx, orderID int64) error {
+	var hold models.BalanceHold
+	err := tx.Get(&hold, `SELECT * FROM balance_holds WHERE order_id = $1 AND status = 'active' FOR UPDATE`, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	transferID, err := insertVirtualTransfer(tx, hold.WalletID, hold.Amount)
+	if err != nil {
+		return err
+	}
+	query := `UPDATE balance_holds SET status = 'captured', virtual_transfer_id = $1, closed_at = NOW() WHERE id = $2`
+	_, err = tx.Exec(query, transferID, hold.ID)
+	return err
+}
+
+// insertVirtualTransfer создаёт pending виртуальное списание и сразу списывает его с кошелька
+// в журнале: до расчёта сумма лежит на счёте ожидающих расчёта
+func insertVirtualTransfer(tx *sqlx.Tx, walletID int64, amount money.Amount) (int64, error) {
+	var id int64
+	query := `INSERT INTO usdt_virtual_transfers (wallet_id, amount) VALUES ($1, $2) RETURNING id`
+	if err := tx.Get(&id, query, walletID, amount); err != nil {
+		return 0, err
+	}
+	_, err := postEntry(tx, models.LedgerEntry{
+		Kind:      models.EntryVirtualTransfer,
+		Reference: fmt.Sprintf("virtual_transfer:%d", id),
+		Postings: []models.Posting{
+			{Account: models.AccountWallet, WalletID: walletID, TokenSymbol: "USDT", Amount: -amount},
+			{Account: models.AccountOrderSettlement, TokenSymbol: "USDT", Amount: amount},
+		},
+	})
+	return id, err
+}
+
+// refundHold отменяет списание оплаченного заказа: его виртуальное списание, ещё не попавшее
+// в пакет расчёта, аннулируется, а сумма обратной проводкой возвращается на кошелёк.
+// Списание в пакете или уже переведённое на казначейство так не вернуть — ErrRefundSettled.
+func refundHold(tx *sqlx.Tx, orderID int64) error {
+	var hold models.BalanceHold
+	err := tx.Get(&hold, `SELECT * FROM balance_holds WHERE order_id = $1 AND status = 'captured' FOR UPDATE`, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if hold.VirtualTransferID == nil {
+		return fmt.Errorf("hold %d has no virtual transfer", hold.ID)
+	}
+	transferID := *hold.VirtualTransferID
+
+	// Под блокировкой кошелька пакет расчёта не заберёт списание, пока оно аннулируется
+	var locked int64
+	if err := tx.Get(&locked, `SELECT id FROM wallets WHERE id = $1 FOR UPDATE`, hold.WalletID); err != nil {
+		return err
+	}
+	queryVoid := `
+	UPDATE usdt_virtual_transfers SET status = 'voided'
+	WHERE id = $1 AND status = 'pending' AND settlement_id IS NULL
+	`
+	res, err := tx.Exec(queryVoid, transferID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: virtual transfer %d", ErrRefundSettled, transferID)
+	}
+
+	// Списания, созданные до проводки virtual_transfer, с кошелька в журнале не списывались
+	reference := fmt.Sprintf("virtual_transfer:%d", transferID)
+	debited, err := entryExists(tx, reference)
+	if err != nil {
+		return err
+	}
+	if debited {
+		_, err = postEntry(tx, models.LedgerEntry{
+			Kind:      models.EntryVirtualTransferVoid,
+			Reference: reference + ":void",
+			Postings: []models.Posting{
+				{Account: models.AccountOrderSettlement, TokenSymbol: "USDT", Amount: -hold.Amount},
+				{Account: models.AccountWallet, WalletID: hold.WalletID, TokenSymbol: "USDT", Amount: hold.Amount},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE balance_holds SET status = 'refunded', closed_at = NOW() WHERE id = $1`, hold.ID)
+	return err
+}
+
+// releaseHold снимает активное удержание заказа
+func releaseHold(tx *sqlx.Tx, orderID int64) error {
+	query := `UPDATE balance_holds SET status = 'released', closed_at = NOW() WHERE order_id = $1 AND status = 'active'`
+	_, err := tx.Exec(query, orderID)
+	return err
+}
@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"production_wallet_back/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type IdempotencyPostgres struct {
+	db *sqlx.DB
+}
+
+func NewIdempotencyPostgres(db *sqlx.DB) *IdempotencyPostgres {
+	return &IdempotencyPostgres{db: db}
+}
+
+// StartIdempotentRequest записывает ключ и блокирует его на lock. Если ключ уже есть,
+// возвращает его с started = false. Незавершённый запрос с тем же телом, блокировка
+// которого истекла (сервер упал посреди запроса), забирается заново.
+func (r *IdempotencyPostgres) StartIdempotentRequest(key models.IdempotencyKey, lock time.Duration) (models.IdempotencyKey, bool, error) {
+	var rec models.IdempotencyKey
+	query := `
+	INSERT INTO idempotency_keys (telegram_id, key, method, path, request_hash, locked_until)
+	VALUES ($1, $2, $3, $4, $5, NOW() + $6 * INTERVAL '1 second')
+	ON CONFLICT (telegram_id, key) DO UPDATE SET locked_until = EXCLUDED.locked_until
+	WHERE idempotency_keys.status_code IS NULL
+	  AND idempotency_keys.locked_until < NOW()
+	  AND idempotency_keys.request_hash = EXCLUDED.request_hash
+	RETURNING *
+	`
+	err := r.db.Get(&rec, query, key.TelegramID, key.Key, key.Method, key.Path, key.RequestHash, lock.Seconds())
+	if err == nil {
+		return rec, true, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return rec, false, err
+	}
+
+	queryExisting := `SELECT * FROM idempotency_keys WHERE telegram_id = $1 AND key = $2`
+	err = r.db.Get(&rec, queryExisting, key.TelegramID, key.Key)
+	return rec, false, err
+}
+
+// CompleteIdempotentRequest сохраняет ответ, который получат повторы запроса
+func (r *IdempotencyPostgres) CompleteIdempotentRequest(id int64, statusCode int, contentType string, body []byte) error {
+	query := `
+	UPDATE idempotency_keys SET status_code = $1, content_type = $2, response_body = $3, completed_at = NOW()
+	WHERE id = $4
+	`
+	_, err := r.db.Exec(query, statusCode, contentType, body, id)
+	return err
+}
+
+// ReleaseIdempotentRequest удаляет незавершённый ключ, чтобы повтор выполнился заново
+func (r *IdempotencyPostgres) ReleaseIdempotentRequest(id int64) error {
+	_, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE id = $1 AND status_code IS NULL`, id)
+	return err
+}
+
+// DeleteIdempotencyKeys удаляет ключи старше before
+func (r *IdempotencyPostgres) DeleteIdempotencyKeys(before time.Time) (int64, error) {
+	res, err := r.db.Exec(`DELETE FROM idempotency_keys WHERE created_at < $1`, before)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
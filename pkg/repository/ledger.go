@@ -0,0 +1,210 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	// ErrInsufficientBalance проводка увела бы остаток кошелька пользователя в минус
+	ErrInsufficientBalance = errors.New("insufficient balance")
+	// ErrUnbalancedEntry сумма строк проводки по токену не равна нулю
+	ErrUnbalancedEntry = errors.New("ledger entry is not balanced")
+)
+
+type LedgerPostgres struct {
+	db *sqlx.DB
+}
+
+func NewLedgerPostgres(db *sqlx.DB) *LedgerPostgres {
+	return &LedgerPostgres{db: db}
+}
+
+// Post записывает проводку в отдельной транзакции. Если проводка с таким Reference
+// уже есть, ничего не меняется и возвращается id 0.
+func (r *LedgerPostgres) Post(entry models.LedgerEntry) (int64, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := postEntry(tx, entry)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// GetAccounts возвращает все счета с остатками по журналу
+func (r *LedgerPostgres) GetAccounts() ([]models.LedgerAccount, error) {
+	var accounts []models.LedgerAccount
+	query := `
+	SELECT a.id, a.code, a.kind, a.wallet_id, a.token_symbol, COALESCE(SUM(p.amount), 0) AS balance
+	FROM ledger_accounts a
+	LEFT JOIN ledger_postings p ON p.account_id = a.id
+	GROUP BY a.id
+	ORDER BY a.code
+	`
+	err := r.db.Select(&accounts, query)
+	return accounts, err
+}
+
+// GetWalletLines возвращает последние строки журнала по счетам кошелька
+func (r *LedgerPostgres) GetWalletLines(walletID int64, limit int) ([]models.LedgerLine, error) {
+	var lines []models.LedgerLine
+	query := `
+	SELECT e.id AS entry_id, e.kind, COALESCE(e.reference, '') AS reference, e.description,
+	       a.token_symbol, p.amount, e.created_at
+	FROM ledger_postings p
+	JOIN ledger_entries e ON e.id = p.entry_id
+	JOIN ledger_accounts a ON a.id = p.account_id
+	WHERE a.kind = 'wallet' AND a.wallet_id = $1
+	ORDER BY e.id DESC
+	LIMIT $2
+	`
+	err := r.db.Select(&lines, query, walletID, limit)
+	return lines, err
+}
+
+// Reconcile сверяет balances с остатками счетов кошельков в журнале и возвращает расхождения
+func (r *LedgerPostgres) Reconcile() ([]models.BalanceMismatch, error) {
+	var mismatches []models.BalanceMismatch
+	query := `
+	WITH ledger AS (
+		SELECT a.wallet_id, a.token_symbol, SUM(p.amount) AS amount
+		FROM ledger_accounts a
+		JOIN ledger_postings p ON p.account_id = a.id
+		WHERE a.kind = 'wallet'
+		GROUP BY a.wallet_id, a.token_symbol
+	)
+	SELECT COALESCE(b.wallet_id, l.wallet_id) AS wallet_id,
+	       COALESCE(b.token_symbol, l.token_symbol) AS token_symbol,
+	       COALESCE(b.amount, 0) AS balance,
+	       COALESCE(l.amount, 0) AS ledger_balance
+	FROM balances b
+	FULL JOIN ledger l ON l.wallet_id = b.wallet_id AND l.token_symbol = b.token_symbol
+	WHERE COALESCE(b.amount, 0) <> COALESCE(l.amount, 0)
+	ORDER BY 1, 2
+	`
+	err := r.db.Select(&mismatches, query)
+	return mismatches, err
+}
+
+// postEntry записывает проводку в транзакции вызывающего и в ней же меняет balances
+// для счетов кошельков. Проводка с уже записанным Reference пропускается, возвращается id 0.
+func postEntry(tx *sqlx.Tx, entry models.LedgerEntry) (int64, error) {
+	if err := checkBalanced(entry.Postings); err != nil {
+		return 0, err
+	}
+
+	var id int64
+	query := `
+	INSERT INTO ledger_entries (kind, reference, description) VALUES ($1, NULLIF($2, ''), $3)
+	ON CONFLICT (reference) DO NOTHING
+	RETURNING id
+	`
+	err := tx.Get(&id, query, entry.Kind, entry.Reference, entry.Description)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for _, p := range entry.Postings {
+		accountID, err := ledgerAccountID(tx, p)
+		if err != nil {
+			return 0, err
+		}
+		queryPosting := `INSERT INTO ledger_postings (entry_id, account_id, amount) VALUES ($1, $2, $3)`
+		if _, err := tx.Exec(queryPosting, id, accountID, p.Amount); err != nil {
+			return 0, err
+		}
+		if p.Account == models.AccountWallet {
+			if err := applyBalance(tx, p, entry.Overdraft); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return id, nil
+}
+
+// entryExists проверяет, записана ли проводка с ключом reference
+func entryExists(tx *sqlx.Tx, reference string) (bool, error) {
+	var exists bool
+	err := tx.Get(&exists, `SELECT EXISTS (SELECT 1 FROM ledger_entries WHERE reference = $1)`, reference)
+	return exists, err
+}
+
+func checkBalanced(postings []models.Posting) error {
+	if len(postings) < 2 {
+		return fmt.Errorf("%w: at least two postings are required", ErrUnbalancedEntry)
+	}
+	sums := make(map[string]money.Amount)
+	for _, p := range postings {
+		if p.Amount == 0 || p.Amount > money.Max || p.Amount < -money.Max {
+			return fmt.Errorf("%w: invalid posting amount %s", ErrUnbalancedEntry, p.Amount)
+		}
+		if (p.Account == models.AccountWallet) != (p.WalletID != 0) {
+			return fmt.Errorf("%w: wallet_id is required only for wallet accounts", ErrUnbalancedEntry)
+		}
+		sums[p.TokenSymbol] += p.Amount
+	}
+	for token, sum := range sums {
+		if sum != 0 {
+			return fmt.Errorf("%w: %s postings sum to %s", ErrUnbalancedEntry, token, sum)
+		}
+	}
+	return nil
+}
+
+// ledgerAccountID возвращает id счёта, создавая его при первой проводке
+func ledgerAccountID(tx *sqlx.Tx, p models.Posting) (int64, error) {
+	code := p.Account + ":" + p.TokenSymbol
+	var walletID *int64
+	if p.Account == models.AccountWallet {
+		code = fmt.Sprintf("%s:%d:%s", p.Account, p.WalletID, p.TokenSymbol)
+		walletID = &p.WalletID
+	}
+
+	var id int64
+	query := `
+	INSERT INTO ledger_accounts (code, kind, wallet_id, token_symbol) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (code) DO UPDATE SET code = EXCLUDED.code
+	RETURNING id
+	`
+	err := tx.Get(&id, query, code, p.Account, walletID, p.TokenSymbol)
+	return id, err
+}
+
+// applyBalance переносит строку проводки по кошельку в balances. Списание больше остатка —
+// ErrInsufficientBalance, если overdraft не разрешён.
+func applyBalance(tx *sqlx.Tx, p models.Posting, overdraft bool) error {
+	if p.Amount > 0 || overdraft {
+		query := `
+		INSERT INTO balances (wallet_id, token_symbol, amount) VALUES ($1, $2, $3)
+		ON CONFLICT (wallet_id, token_symbol) DO UPDATE SET amount = balances.amount + EXCLUDED.amount, updated_at = NOW()
+		`
+		_, err := tx.Exec(query, p.WalletID, p.TokenSymbol, p.Amount)
+		return err
+	}
+
+	query := `
+	UPDATE balances SET amount = amount + $1, updated_at = NOW()
+	WHERE wallet_id = $2 AND token_symbol = $3 AND amount + $1 >= 0
+	`
+	res, err := tx.Exec(query, p.Amount, p.WalletID, p.TokenSymbol)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("%w: wallet %d, %s %s", ErrInsufficientBalance, p.WalletID, p.Amount, p.TokenSymbol)
+	}
+	return nil
+}
@@ -0,0 +1,361 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrOrderStateChanged заказ успели перевести в другое состояние между чтением и переходом
+	ErrOrderStateChanged = errors.New("order state was changed concurrently")
+	// ErrQuoteUnavailable котировка уже использована или истекла
+	ErrQuoteUnavailable = errors.New("quote is already used or expired")
+	// ErrOrderClaimed заказ взят другим оператором или аренда этого оператора истекла
+	ErrOrderClaimed = errors.New("order is claimed by another operator")
+	// ErrRefundSettled списание заказа уже в пакете расчёта или переведено на казначейство
+	ErrRefundSettled = errors.New("order funds are already being settled")
+)
+
+type OrderPostgres struct {
+	db *sqlx.DB
+}
+
+func NewOrderPostgres(db *sqlx.DB) *OrderPostgres {
+	return &OrderPostgres{db: db}
+}
+
+// CreateOrder создаёт заказ, удерживает его сумму с доступного остатка кошелька (balance в сети
+// минус списания и удержания) и в той же транзакции ставит его в очередь операторов:
+// created -> awaiting_operator от имени системы. Котировка qr.QuoteID помечается использованной в той же транзакции, повторно она не пройдёт —
+// ErrQuoteUnavailable. Не хватает остатка — ErrInsufficientBalance, заказ не создаётся.
+// Запись audit о заказе пишется в ту же транзакцию.
+func (r *OrderPostgres) CreateOrder(qr models.OrderQR, walletID int64, balance money.Amount, actor string, audit models.AuditEntry) (models.OrderQR, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	defer tx.Rollback()
+
+	if qr.QuoteID != nil {
+		queryQuote := `UPDATE quotes SET used_at = NOW() WHERE id = $1 AND used_at IS NULL AND expires_at > NOW()`
+		res, err := tx.Exec(queryQuote, *qr.QuoteID)
+		if err != nil {
+			return models.OrderQR{}, err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return models.OrderQR{}, ErrQuoteUnavailable
+		}
+	}
+
+	var order models.OrderQR
+	query := `
+	INSERT INTO orderqr (telegram_id, qrcode, summa, crypto, state, expires_at, quote_id, qr_data)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	RETURNING *
+	`
+	err = tx.Get(&order, query, qr.TelegramId, qr.QRCode, qr.Summa, qr.Crypto, models.OrderCreated, qr.ExpiresAt, qr.QuoteID, qr.QRData)
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	if _, err := createHold(tx, walletID, order.Id, order.Crypto, balance); err != nil {
+		return models.OrderQR{}, err
+	}
+	if err := addOrderTransition(tx, order.Id, "", models.OrderCreated, actor, ""); err != nil {
+		return models.OrderQR{}, err
+	}
+	order, err = transitionOrder(tx, order.Id, models.OrderCreated, models.OrderAwaitingOperator, models.ActorSystem, "queued for operator")
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	// id заказа появляется только здесь, поэтому цель записи журнала подставляет репозиторий
+	audit.Target = fmt.Sprintf("order:%d", order.Id)
+	if err := recordAudit(tx, audit, nil, order); err != nil {
+		return models.OrderQR{}, err
+	}
+	return order, tx.Commit()
+}
+
+func (r *OrderPostgres) GetOrder(id int64) (models.OrderQR, error) {
+	var order models.OrderQR
+	err := r.db.Get(&order, `SELECT * FROM orderqr WHERE id = $1`, id)
+	return order, err
+}
+
+// GetOrderHold удержание под заказ, found = false — заказ создан без удержания
+func (r *OrderPostgres) GetOrderHold(orderID int64) (hold models.BalanceHold, found bool, err error) {
+	err = r.db.Get(&hold, `SELECT * FROM balance_holds WHERE order_id = $1`, orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return hold, false, nil
+	}
+	return hold, err == nil, err
+}
+
+// GetOrderTransitions история переходов заказа от создания
+func (r *OrderPostgres) GetOrderTransitions(id int64) ([]models.OrderTransition, error) {
+	transitions := []models.OrderTransition{}
+	query := `SELECT * FROM order_transitions WHERE order_id = $1 ORDER BY id`
+	err := r.db.Select(&transitions, query, id)
+	return transitions, err
+}
+
+// GetOrdersByStates заказы в указанных состояниях, старые первыми
+func (r *OrderPostgres) GetOrdersByStates(states []string) ([]models.OrderQR, error) {
+	orders := []models.OrderQR{}
+	query := `SELECT * FROM orderqr WHERE state = ANY($1) ORDER BY created_at, id`
+	err := r.db.Select(&orders, query, pq.Array(states))
+	return orders, err
+}
+
+// GetOverdueOrders неоплаченные заказы с истёкшим сроком, самые старые первыми
+func (r *OrderPostgres) GetOverdueOrders(limit int) ([]models.OrderQR, error) {
+	orders := []models.OrderQR{}
+	query := `
+	SELECT * FROM orderqr
+	WHERE state IN ('created', 'awaiting_operator') AND expires_at <= NOW()
+	ORDER BY expires_at
+	LIMIT $1
+	`
+	err := r.db.Select(&orders, query, limit)
+	return orders, err
+}
+
+func (r *OrderPostgres) OrdersHistory(telegramId int64) ([]models.OrderQR, error) {
+	orders := []models.OrderQR{}
+	query := `SELECT * FROM orderqr WHERE telegram_id = $1 ORDER BY id DESC`
+	err := r.db.Select(&orders, query, telegramId)
+	return orders, err
+}
+
+// TransitionOrder переводит заказ из from в to и пишет переход в историю.
+// Если заказ уже не в from, ничего не меняется и возвращается ErrOrderStateChanged.
+// Запись audit со снимками заказа до и после перехода пишется в ту же транзакцию.
+func (r *OrderPostgres) TransitionOrder(id int64, from, to, actor, reason string, audit models.AuditEntry) (models.OrderQR, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockOrder(tx, id)
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	order, err := transitionOrder(tx, id, from, to, actor, reason)
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	if err := recordAudit(tx, audit, before, order); err != nil {
+		return models.OrderQR{}, err
+	}
+	return order, tx.Commit()
+}
+
+// ClaimOrder берёт заказ в работу оператору actor до NOW() + lease. Заказ, взятый другим
+// оператором, можно взять только после истечения его аренды, иначе ErrOrderClaimed.
+// Повторный вызов тем же оператором продлевает аренду. Действие и запись audit со снимками
+// заказа пишутся в той же транзакции.
+func (r *OrderPostgres) ClaimOrder(id int64, actor string, lease time.Duration, audit models.AuditEntry) (models.OrderQR, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockOrder(tx, id)
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	var order models.OrderQR
+	query := `
+	UPDATE orderqr SET claimed_by = $1, claim_expires_at = NOW() + $2 * INTERVAL '1 second', updated_at = NOW()
+	WHERE id = $3 AND state = 'awaiting_operator'
+	  AND (claimed_by IS NULL OR claimed_by = $1 OR claim_expires_at <= NOW())
+	RETURNING *
+	`
+	err = tx.Get(&order, query, actor, lease.Seconds(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OrderQR{}, ErrOrderClaimed
+	}
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	details := "until " + order.ClaimExpiresAt.Format(time.RFC3339)
+	if err := addOrderAction(tx, id, actor, models.OrderActionClaim, details); err != nil {
+		return models.OrderQR{}, err
+	}
+	if err := recordAudit(tx, audit, before, order); err != nil {
+		return models.OrderQR{}, err
+	}
+	return order, tx.Commit()
+}
+
+// ReleaseOrder возвращает заказ в общую очередь. Отпустить можно только свою действующую аренду.
+// Действие и запись audit пишутся в той же транзакции.
+func (r *OrderPostgres) ReleaseOrder(id int64, actor string, audit models.AuditEntry) (models.OrderQR, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockOrder(tx, id)
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	var order models.OrderQR
+	query := `
+	UPDATE orderqr SET claimed_by = NULL, claim_expires_at = NULL, updated_at = NOW()
+	WHERE id = $1 AND claimed_by = $2 AND claim_expires_at > NOW()
+	RETURNING *
+	`
+	err = tx.Get(&order, query, id, actor)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OrderQR{}, ErrOrderClaimed
+	}
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	if err := addOrderAction(tx, id, actor, models.OrderActionRelease, ""); err != nil {
+		return models.OrderQR{}, err
+	}
+	if err := recordAudit(tx, audit, before, order); err != nil {
+		return models.OrderQR{}, err
+	}
+	return order, tx.Commit()
+}
+
+// PayOrder отмечает заказ оплаченным оператором actor. Заказ должен быть взят им и аренда
+// ещё действовать, иначе ErrOrderClaimed. Номер операции, чек и запись audit сохраняются
+// вместе с переходом.
+func (r *OrderPostgres) PayOrder(id int64, actor string, payment models.OrderPayment, audit models.AuditEntry) (models.OrderQR, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	defer tx.Rollback()
+
+	before, err := lockOrder(tx, id)
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+
+	query := `
+	UPDATE orderqr SET bank_reference = $1, receipt_path = NULLIF($2, '')
+	WHERE id = $3 AND state = 'awaiting_operator' AND claimed_by = $4 AND claim_expires_at > NOW()
+	`
+	res, err := tx.Exec(query, payment.BankReference, payment.ReceiptPath, id, actor)
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return models.OrderQR{}, ErrOrderClaimed
+	}
+
+	order, err := transitionOrder(tx, id, models.OrderAwaitingOperator, models.OrderPaid, actor, "bank reference "+payment.BankReference)
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	details := "bank reference " + payment.BankReference
+	if payment.ReceiptPath != "" {
+		details += ", receipt attached"
+	}
+	if err := addOrderAction(tx, id, actor, models.OrderActionPay, details); err != nil {
+		return models.OrderQR{}, err
+	}
+	if err := recordAudit(tx, audit, before, order); err != nil {
+		return models.OrderQR{}, err
+	}
+	return order, tx.Commit()
+}
+
+// ReleaseExpiredClaims снимает истёкшие аренды с неоплаченных заказов и возвращает их число
+func (r *OrderPostgres) ReleaseExpiredClaims() (int64, error) {
+	query := `
+	WITH expired AS (
+		SELECT id, claimed_by FROM orderqr
+		WHERE claimed_by IS NOT NULL AND claim_expires_at <= NOW() AND state = 'awaiting_operator'
+		FOR UPDATE SKIP LOCKED
+	), released AS (
+		UPDATE orderqr o SET claimed_by = NULL, claim_expires_at = NULL, updated_at = NOW()
+		FROM expired e WHERE o.id = e.id
+		RETURNING o.id
+	)
+	INSERT INTO order_actions (order_id, actor, action, details)
+	SELECT e.id, 'system', 'release', 'claim of ' || e.claimed_by || ' expired'
+	FROM expired e JOIN released r ON r.id = e.id
+	`
+	res, err := r.db.Exec(query)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// GetOrderActions действия операторов с заказом
+func (r *OrderPostgres) GetOrderActions(id int64) ([]models.OrderAction, error) {
+	actions := []models.OrderAction{}
+	err := r.db.Select(&actions, `SELECT * FROM order_actions WHERE order_id = $1 ORDER BY id`, id)
+	return actions, err
+}
+
+// transitionOrder меняет состояние в транзакции вызывающего. Оплата превращает удержание
+// в виртуальное списание, возврат его аннулирует, отмена и просрочка снимают удержание. Аренда оператора
+// снимается с любым переходом, кроме оплаты и возврата, где остаётся, кто оплатил.
+func transitionOrder(tx *sqlx.Tx, id int64, from, to, actor, reason string) (models.OrderQR, error) {
+	var order models.OrderQR
+	query := `
+	UPDATE orderqr SET state = $1, ispaid = ($1 = 'paid'), updated_at = NOW(),
+		claimed_by = CASE WHEN $1 IN ('paid', 'refunded') THEN claimed_by END,
+		claim_expires_at = NULL
+	WHERE id = $2 AND state = $3
+	RETURNING *
+	`
+	err := tx.Get(&order, query, to, id, from)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OrderQR{}, fmt.Errorf("%w: order %d is no longer %s", ErrOrderStateChanged, id, from)
+	}
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	switch to {
+	case models.OrderPaid:
+		err = captureHold(tx, id)
+	case models.OrderRefunded:
+		err = refundHold(tx, id)
+	case models.OrderCancelled, models.OrderExpired:
+		err = releaseHold(tx, id)
+	}
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	if err := addOrderTransition(tx, id, from, to, actor, reason); err != nil {
+		return models.OrderQR{}, err
+	}
+	return order, nil
+}
+
+// lockOrder блокирует строку заказа до конца транзакции и возвращает снимок до изменений
+func lockOrder(tx *sqlx.Tx, id int64) (models.OrderQR, error) {
+	var order models.OrderQR
+	err := tx.Get(&order, `SELECT * FROM orderqr WHERE id = $1 FOR UPDATE`, id)
+	return order, err
+}
+
+func addOrderTransition(tx *sqlx.Tx, orderID int64, from, to, actor, reason string) error {
+	query := `INSERT INTO order_transitions (order_id, from_state, to_state, actor, reason) VALUES ($1, $2, $3, $4, $5)`
+	_, err := tx.Exec(query, orderID, from, to, actor, reason)
+	return err
+}
+
+func addOrderAction(tx *sqlx.Tx, orderID int64, actor, action, details string) error {
+	query := `INSERT INTO order_actions (order_id, actor, action, details) VALUES ($1, $2, $3, $4)`
+	_, err := tx.Exec(query, orderID, actor, action, details)
+	return err
+}
@@ -0,0 +1,30 @@
+package repository
+
+import (
+	"production_wallet_back/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type QuotePostgres struct {
+	db *sqlx.DB
+}
+
+func NewQuotePostgres(db *sqlx.DB) *QuotePostgres {
+	return &QuotePostgres{db: db}
+}
+
+func (r *QuotePostgres) CreateQuote(q models.Quote) error {
+	query := `
+	INSERT INTO quotes (id, telegram_id, from_currency, to_currency, rate, amount, converted, signature, expires_at)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`
+	_, err := r.db.Exec(query, q.ID, q.TelegramID, q.FromCurrency, q.ToCurrency, q.Rate, q.Amount, q.Converted, q.Signature, q.ExpiresAt)
+	return err
+}
+
+func (r *QuotePostgres) GetQuote(id string) (models.Quote, error) {
+	var q models.Quote
+	err := r.db.Get(&q, `SELECT * FROM quotes WHERE id = $1`, id)
+	return q, err
+}
@@ -2,6 +2,8 @@ package repository
 
 import (
 	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -9,31 +11,35 @@ import (
 type Authorization interface {
 	GetUserByTelegramId(int64) (models.User, error)
 	CreateUser(models.User) (int64, error)
+
+	CreateSession(session models.Session) (int64, error)
+	GetSession(id int64) (models.Session, error)
+	GetSessionByRefreshHash(hash string) (models.Session, error)
+	RotateSessionRefresh(id int64, oldHash, newHash string, expiresAt time.Time) error
+	RevokeSession(id int64) error
+	RevokeUserSessions(telegramID int64) error
 }
 type Wallet interface {
-	CreateWallet(userID int64, privKey, address string) (int64, error)
+	CreateWallet(userID int64, address string, key models.EncryptedKey) (int64, error)
 	GetWallet(telegramId int64) (models.WalletResponce, error)
 	InitBalance(walletID int64, tokenSymbol string) error
 	GetBalances(telegramID int64) ([]models.Balance, error)
-	Deposit(telegramId int64, tokenSymbol string, amount float64) error
-	WithdrawBalance(walletID int64, amount float64, tokenSymbol string) error
-	CreateTransaction(walletID int64, toId string, token string, amount float64, status string, tx_hash string) error
+	Deposit(telegramId int64, tokenSymbol string, amount money.Amount, reference string, audit models.AuditEntry) error
+	CreateTransaction(walletID int64, toId string, token string, amount money.Amount, status string, tx_hash string) error
 	GetTransactions(telegramId int64) ([]models.Transaction, error)
-	Pay(telegramId int64, tokenSymbol string, amount float64) error
+	Pay(telegramId int64, tokenSymbol string, amount money.Amount) error
 	Convert(models.ConvertRequest) (error, models.ConvertResponse)
 
-	CreateOrder(qr models.OrderQR) (int, error)
-	OrdersHistory(telegramId int64) ([]models.OrderQR, error)
-	GetOrderState(orderId int) (bool, error)
-	GetOrders() ([]models.OrderQR, error)
-	PayQR(orderId int) (bool, error)
-	GetPrivatKey(telegramId int64) (string, error)
-	AddVirtualTransfer(walletID int64, amount float64) error
-	SumPendingVirtualTransfers(walletID int64) (float64, error)
+	GetWalletKey(telegramId int64) (models.WalletKey, error)
+	GetWalletKeysToRewrap(currentVersion int, limit int) ([]models.WalletKey, error)
+	UpdateWalletKey(walletID int64, old models.EncryptedKey, key models.EncryptedKey) error
+	ReserveVirtualTransfer(walletID int64, amount money.Amount, balance money.Amount, audit models.AuditEntry) (models.VirtualTransfer, error)
+	SumPendingVirtualTransfers(walletID int64) (money.Amount, error)
+	SumActiveHolds(walletID int64) (money.Amount, error)
+	GetReservedBalance(walletID int64) (models.ReservedBalance, error)
 	GetPendingVirtualTransfers(walletID int64) ([]models.VirtualTransfer, error)
 	MarkVirtualTransfersProcessed(ids []int64) error
 	GetWalletByAddress(address string) (models.WalletResponce, error)
-	UpdateBalance(walletID int64, tokenSymbol string, amount float64) error
 
 	// Новый метод для админки
 	GetAllWallets() ([]models.Wallet, error)
@@ -41,14 +47,146 @@ type Wallet interface {
 	GetTransactionsByWalletID(walletID int64, tokenSymbol string) ([]models.Transaction, error)
 }
 
+// Order заказы на оплату СБП QR. Состояние меняется только через TransitionOrder,
+// каждый переход пишется в order_transitions.
+type Order interface {
+	CreateOrder(qr models.OrderQR, walletID int64, balance money.Amount, actor string, audit models.AuditEntry) (models.OrderQR, error)
+	GetOrder(id int64) (models.OrderQR, error)
+	GetOrderHold(orderID int64) (hold models.BalanceHold, found bool, err error)
+	GetOrderTransitions(id int64) ([]models.OrderTransition, error)
+	GetOrdersByStates(states []string) ([]models.OrderQR, error)
+	GetOverdueOrders(limit int) ([]models.OrderQR, error)
+	OrdersHistory(telegramId int64) ([]models.OrderQR, error)
+	TransitionOrder(id int64, from, to, actor, reason string, audit models.AuditEntry) (models.OrderQR, error)
+	ClaimOrder(id int64, actor string, lease time.Duration, audit models.AuditEntry) (models.OrderQR, error)
+	ReleaseOrder(id int64, actor string, audit models.AuditEntry) (models.OrderQR, error)
+	PayOrder(id int64, actor string, payment models.OrderPayment, audit models.AuditEntry) (models.OrderQR, error)
+	ReleaseExpiredClaims() (int64, error)
+	GetOrderActions(id int64) ([]models.OrderAction, error)
+}
+
+// Admin пользователи и сессии админки
+type Admin interface {
+	CreateAdmin(admin models.AdminUser) (models.AdminUser, error)
+	GetAdmin(id int64) (models.AdminUser, error)
+	GetAdminByUsername(username string) (models.AdminUser, error)
+	GetAdmins() ([]models.AdminUser, error)
+	UpdateAdmin(id int64, role string, disabled bool) (models.AdminUser, error)
+	SetAdminPassword(id int64, passwordHash string) error
+
+	CreateAdminSession(session models.AdminSession) (int64, error)
+	GetAdminSessionByHash(hash string) (models.AdminSession, error)
+	RevokeAdminSession(id int64) error
+}
+
+// Audit журнал аудита: только добавление записей и чтение
+type Audit interface {
+	AppendAudit(entry models.AuditEntry) (models.AuditEntry, error)
+	GetAuditEntries(filter models.AuditFilter) ([]models.AuditEntry, error)
+	GetAuditChain(afterID int64, limit int) ([]models.AuditEntry, error)
+}
+
+// Quote котировки курса, выданные /convert
+type Quote interface {
+	CreateQuote(q models.Quote) error
+	GetQuote(id string) (models.Quote, error)
+}
+
+type Deposit interface {
+	GetCheckpoint(name string) (block int64, found bool, err error)
+	GetWalletIDsByAddresses(addresses []string) (map[string]int64, error)
+	SaveBlockDeposits(name string, block int64, deposits []models.Deposit) error
+	GetDepositsToConfirm(maxBlock int64) ([]models.Deposit, error)
+	CreditDeposit(id int64, audit models.AuditEntry) error
+	MarkDepositOrphaned(id int64) error
+}
+
+type Withdrawal interface {
+	CreateWithdrawalJob(job models.WithdrawalJob, balance money.Amount, audit models.AuditEntry) (models.WithdrawalJob, error)
+	GetWithdrawalJob(id int64) (models.WithdrawalJob, error)
+	ClaimWithdrawalJob(token string, lease time.Duration) (job models.WithdrawalJob, found bool, err error)
+	SaveWithdrawalJob(job models.WithdrawalJob, release bool, audit *models.AuditEntry) error
+	LockAvailableForWithdrawal(job models.WithdrawalJob, balance money.Amount) (money.Amount, error)
+}
+
+type Transaction interface {
+	CreatePendingTransaction(tx models.Transaction) (int64, error)
+	GetPendingTransactions(limit int) ([]models.Transaction, error)
+	UpdateTransactionStatus(tx models.Transaction) error
+	GetFailedTransactions(limit int) ([]models.FailedTransaction, error)
+}
+
+// Ledger журнал двойной записи. Проводки бизнес-операций пишут репозитории этих операций
+// в своих транзакциях, здесь — отдельные проводки и отчёты.
+type Ledger interface {
+	Post(entry models.LedgerEntry) (int64, error)
+	GetAccounts() ([]models.LedgerAccount, error)
+	GetWalletLines(walletID int64, limit int) ([]models.LedgerLine, error)
+	Reconcile() ([]models.BalanceMismatch, error)
+}
+
+type Settlement interface {
+	CreateSettlements(toAddress string, minAmount money.Amount, audit models.AuditEntry) ([]models.Settlement, error)
+	ClaimSettlement(token string, lease time.Duration) (settlement models.Settlement, found bool, err error)
+	SaveSettlement(settlement models.Settlement, release bool, audit *models.AuditEntry) error
+}
+
+// Delegation делегирования энергии со стейка казначейства под переводы пользователей
+type Delegation interface {
+	CreateDelegation(d models.EnergyDelegation) (delegation models.EnergyDelegation, created bool, err error)
+	GetDelegation(reference string) (delegation models.EnergyDelegation, found bool, err error)
+	GetOpenDelegations() ([]models.EnergyDelegation, error)
+	ReleaseDelegation(reference string) error
+	ClaimDelegation(token string, lease time.Duration) (delegation models.EnergyDelegation, found bool, err error)
+	SaveDelegation(d models.EnergyDelegation, release bool) error
+}
+
+// Gas переводы TRX с плательщика газа, не больше одного в пути на адрес
+type Gas interface {
+	ReserveGasTopUp(topUp models.GasTopUpTx, audit *models.AuditEntry) error
+	GetPendingGasTopUps(limit int) ([]models.GasTopUpTx, error)
+	FinishGasTopUp(txID string, status string) error
+}
+
+type Idempotency interface {
+	StartIdempotentRequest(key models.IdempotencyKey, lock time.Duration) (models.IdempotencyKey, bool, error)
+	CompleteIdempotentRequest(id int64, statusCode int, contentType string, body []byte) error
+	ReleaseIdempotentRequest(id int64) error
+	DeleteIdempotencyKeys(before time.Time) (int64, error)
+}
+
 type Repository struct {
 	Authorization
 	Wallet
+	Admins       Admin
+	Audit        Audit
+	Orders       Order
+	Quotes       Quote
+	Deposits     Deposit
+	Withdrawals  Withdrawal
+	Transactions Transaction
+	Ledger       Ledger
+	Idempotency  Idempotency
+	Settlements  Settlement
+	Delegations  Delegation
+	Gas          Gas
 }
 
 func NewRepository(db *sqlx.DB) *Repository {
 	return &Repository{
 		Authorization: NewAuthPostgres(db),
 		Wallet:        NewWalletPostgres(db),
+		Admins:        NewAdminPostgres(db),
+		Audit:         NewAuditPostgres(db),
+		Orders:        NewOrderPostgres(db),
+		Quotes:        NewQuotePostgres(db),
+		Deposits:      NewDepositPostgres(db),
+		Withdrawals:   NewWithdrawalPostgres(db),
+		Transactions:  NewTransactionPostgres(db),
+		Ledger:        NewLedgerPostgres(db),
+		Idempotency:   NewIdempotencyPostgres(db),
+		Settlements:   NewSettlementPostgres(db),
+		Delegations:   NewDelegationPostgres(db),
+		Gas:           NewGasPostgres(db),
 	}
 }
@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"production_wallet_back/models"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type DelegationPostgres struct {
+	db *sqlx.DB
+}
+
+func NewDelegationPostgres(db *sqlx.DB) *DelegationPostgres {
+	return &DelegationPostgres{db: db}
+}
+
+// CreateDelegation создаёт делегирование под перевод d.Reference. Если оно уже есть,
+// возвращается существующее, а created = false.
+func (r *DelegationPostgres) CreateDelegation(d models.EnergyDelegation) (delegation models.EnergyDelegation, created bool, err error) {
+	query := `
+	INSERT INTO energy_delegations (reference, receiver_address, energy, amount)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT (reference) DO NOTHING
+	RETURNING *
+	`
+	err = r.db.Get(&delegation, query, d.Reference, d.ReceiverAddress, d.Energy, d.Amount)
+	if errors.Is(err, sql.ErrNoRows) {
+		delegation, _, err = r.GetDelegation(d.Reference)
+		return delegation, false, err
+	}
+	return delegation, err == nil, err
+}
+
+func (r *DelegationPostgres) GetDelegation(reference string) (delegation models.EnergyDelegation, found bool, err error) {
+	err = r.db.Get(&delegation, `SELECT * FROM energy_delegations WHERE reference = $1`, reference)
+	if errors.Is(err, sql.ErrNoRows) {
+		return delegation, false, nil
+	}
+	return delegation, err == nil, err
+}
+
+// GetOpenDelegations делегирования, энергия по которым ещё не вернулась казначейству
+func (r *DelegationPostgres) GetOpenDelegations() ([]models.EnergyDelegation, error) {
+	delegations := []models.EnergyDelegation{}
+	query := `SELECT * FROM energy_delegations WHERE state NOT IN ('reclaimed', 'failed') ORDER BY id`
+	err := r.db.Select(&delegations, query)
+	return delegations, err
+}
+
+// ReleaseDelegation отмечает, что перевод завершён и энергию можно забирать сразу
+func (r *DelegationPostgres) ReleaseDelegation(reference string) error {
+	query := `
+	UPDATE energy_delegations SET released = TRUE, next_run_at = NOW(), updated_at = NOW()
+	WHERE reference = $1 AND state NOT IN ('reclaimed', 'failed')
+	`
+	_, err := r.db.Exec(query, reference)
+	return err
+}
+
+// ClaimDelegation берёт в работу одно готовое к запуску делегирование и выдаёт на него аренду
+func (r *DelegationPostgres) ClaimDelegation(token string, lease time.Duration) (delegation models.EnergyDelegation, found bool, err error) {
+	query := `
+	UPDATE energy_delegations SET lease_token = $1, locked_until = NOW() + $2 * INTERVAL '1 second'
+	WHERE id = (
+		SELECT id FROM energy_delegations
+		WHERE state NOT IN ('reclaimed', 'failed')
+		  AND next_run_at <= NOW()
+		  AND (locked_until IS NULL OR locked_until < NOW())
+		ORDER BY next_run_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *
+	`
+	err = r.db.Get(&delegation, query, token, lease.Seconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		return delegation, false, nil
+	}
+	if err != nil {
+		return delegation, false, err
+	}
+	return delegation, true, nil
+}
+
+// SaveDelegation сохраняет состояние делегирования, пока аренда действует. released пишет
+// только ReleaseDelegation: если перевод завершился во время шага, активное делегирование
+// всё равно будет отозвано сразу.
+func (r *DelegationPostgres) SaveDelegation(d models.EnergyDelegation, release bool) error {
+	query := `
+	UPDATE energy_delegations SET
+		state = $1, delegate_tx_id = $2, reclaim_tx_id = $3, signed_tx = $4, tx_expires_at = $5,
+		attempts = $6, last_error = $7, updated_at = NOW(),
+		next_run_at = CASE WHEN released AND $1 = 'active' THEN NOW() ELSE $8 END,
+		locked_until = CASE WHEN $9 THEN NULL ELSE locked_until END
+	WHERE id = $10 AND lease_token = $11
+	`
+	res, err := r.db.Exec(query, d.State, d.DelegateTxID, d.ReclaimTxID, d.SignedTx, d.TxExpiresAt,
+		d.Attempts, d.LastError, d.NextRunAt, release, d.ID, d.LeaseToken)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
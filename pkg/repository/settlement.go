@@ -0,0 +1,187 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type SettlementPostgres struct {
+	db *sqlx.DB
+}
+
+func NewSettlementPostgres(db *sqlx.DB) *SettlementPostgres {
+	return &SettlementPostgres{db: db}
+}
+
+// CreateSettlements собирает pending виртуальные списания без пакета в пакеты по кошелькам.
+// Кошелёк попадает в пакет, если сумма не меньше minAmount и у него нет незавершённого пакета.
+// Каждый пакет пишется в журнал аудита записью audit в своей транзакции.
+func (r *SettlementPostgres) CreateSettlements(toAddress string, minAmount money.Amount, audit models.AuditEntry) ([]models.Settlement, error) {
+	var walletIDs []int64
+	query := `
+	SELECT DISTINCT v.wallet_id FROM usdt_virtual_transfers v
+	WHERE v.status = 'pending' AND v.settlement_id IS NULL
+	  AND NOT EXISTS (
+		SELECT 1 FROM settlements s WHERE s.wallet_id = v.wallet_id AND s.state NOT IN ('confirmed', 'failed')
+	  )
+	ORDER BY v.wallet_id
+	`
+	if err := r.db.Select(&walletIDs, query); err != nil {
+		return nil, err
+	}
+
+	var created []models.Settlement
+	for _, walletID := range walletIDs {
+		settlement, ok, err := r.createSettlement(walletID, toAddress, minAmount, audit)
+		if err != nil {
+			return created, fmt.Errorf("wallet %d: %v", walletID, err)
+		}
+		if ok {
+			created = append(created, settlement)
+		}
+	}
+	return created, nil
+}
+
+// createSettlement собирает пакет одного кошелька под той же блокировкой строки кошелька,
+// что и ReserveVirtualTransfer, поэтому новое списание не проскочит мимо пакета
+func (r *SettlementPostgres) createSettlement(walletID int64, toAddress string, minAmount money.Amount, audit models.AuditEntry) (models.Settlement, bool, error) {
+	var settlement models.Settlement
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return settlement, false, err
+	}
+	defer tx.Rollback()
+
+	var wallet models.Wallet
+	queryWallet := `SELECT id, user_id, address, created_at FROM wallets WHERE id = $1 FOR UPDATE`
+	if err := tx.Get(&wallet, queryWallet, walletID); err != nil {
+		return settlement, false, err
+	}
+
+	var sum money.Amount
+	querySum := `
+	SELECT COALESCE(SUM(amount), 0) FROM usdt_virtual_transfers
+	WHERE wallet_id = $1 AND status = 'pending' AND settlement_id IS NULL
+	`
+	if err := tx.Get(&sum, querySum, walletID); err != nil {
+		return settlement, false, err
+	}
+	if sum <= 0 || sum < minAmount {
+		return settlement, false, nil
+	}
+
+	query := `
+	INSERT INTO settlements (wallet_id, telegram_id, from_address, to_address, token_symbol, amount)
+	VALUES ($1, $2, $3, $4, 'USDT', $5)
+	RETURNING *
+	`
+	if err := tx.Get(&settlement, query, wallet.ID, wallet.UserID, wallet.Address, toAddress, sum); err != nil {
+		return settlement, false, err
+	}
+	queryLink := `
+	UPDATE usdt_virtual_transfers SET settlement_id = $1
+	WHERE wallet_id = $2 AND status = 'pending' AND settlement_id IS NULL
+	`
+	if _, err := tx.Exec(queryLink, settlement.ID, walletID); err != nil {
+		return settlement, false, err
+	}
+	audit.Target = fmt.Sprintf("settlement:%d", settlement.ID)
+	if err := recordAudit(tx, audit, nil, settlement); err != nil {
+		return settlement, false, err
+	}
+	return settlement, true, tx.Commit()
+}
+
+// ClaimSettlement берёт в работу один готовый к запуску пакет и выдаёт на него аренду
+func (r *SettlementPostgres) ClaimSettlement(token string, lease time.Duration) (settlement models.Settlement, found bool, err error) {
+	query := `
+	UPDATE settlements SET lease_token = $1, locked_until = NOW() + $2 * INTERVAL '1 second'
+	WHERE id = (
+		SELECT id FROM settlements
+		WHERE state NOT IN ('confirmed', 'failed')
+		  AND next_run_at <= NOW()
+		  AND (locked_until IS NULL OR locked_until < NOW())
+		ORDER BY next_run_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *
+	`
+	err = r.db.Get(&settlement, query, token, lease.Seconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		return settlement, false, nil
+	}
+	if err != nil {
+		return settlement, false, err
+	}
+	return settlement, true, nil
+}
+
+// SaveSettlement сохраняет состояние пакета, пока аренда действует. Вместе с итогом пакета
+// в той же транзакции меняются его списания: confirmed — processed с хэшем перевода,
+// failed — отвязываются от пакета и попадут в следующий. Если передан audit, запись пишется туда же.
+func (r *SettlementPostgres) SaveSettlement(s models.Settlement, release bool, audit *models.AuditEntry) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE settlements SET
+		state = $1, gas_tx_id = $2, gas_signed_tx = $3, gas_amount = $4, tx_id = $5, signed_tx = $6, tx_expires_at = $7,
+		attempts = $8, last_error = $9, next_run_at = $10, updated_at = NOW(),
+		locked_until = CASE WHEN $11 THEN NULL ELSE locked_until END
+	WHERE id = $12 AND lease_token = $13
+	`
+	res, err := tx.Exec(query, s.State, s.GasTxID, s.GasSignedTx, s.GasAmount, s.TxID, s.SignedTx, s.TxExpiresAt,
+		s.Attempts, s.LastError, s.NextRunAt, release, s.ID, s.LeaseToken)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+
+	switch s.State {
+	case models.SettlementConfirmed:
+		queryProcessed := `
+		UPDATE usdt_virtual_transfers SET status = 'processed', processed_at = NOW(), tx_hash = $1
+		WHERE settlement_id = $2 AND status = 'pending'
+		`
+		if _, err := tx.Exec(queryProcessed, s.TxID, s.ID); err != nil {
+			return err
+		}
+		// Кошелёк списан ещё при создании списаний, здесь сумма уходит из ожидающих расчёта во внешний мир
+		_, err := postEntry(tx, models.LedgerEntry{
+			Kind:        models.EntrySettlement,
+			Reference:   fmt.Sprintf("settlement:%d", s.ID),
+			Description: "virtual transfers settled by " + s.TxID,
+			Postings: []models.Posting{
+				{Account: models.AccountOrderSettlement, TokenSymbol: s.TokenSymbol, Amount: -s.Amount},
+				{Account: models.AccountExternal, TokenSymbol: s.TokenSymbol, Amount: s.Amount},
+			},
+		})
+		if err != nil {
+			return err
+		}
+	case models.SettlementFailed:
+		queryRelease := `UPDATE usdt_virtual_transfers SET settlement_id = NULL WHERE settlement_id = $1 AND status = 'pending'`
+		if _, err := tx.Exec(queryRelease, s.ID); err != nil {
+			return err
+		}
+	}
+	if audit != nil {
+		if err := recordAudit(tx, *audit, nil, nil); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"production_wallet_back/models"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type TransactionPostgres struct {
+	db *sqlx.DB
+}
+
+func NewTransactionPostgres(db *sqlx.DB) *TransactionPostgres {
+	return &TransactionPostgres{db: db}
+}
+
+// CreatePendingTransaction записывает отправляемую транзакцию, дальше её статус ведёт трекер
+func (r *TransactionPostgres) CreatePendingTransaction(tx models.Transaction) (int64, error) {
+	var id int64
+	query := `
+	INSERT INTO transactions (from_wallet_id, to_address, token_symbol, amount, tx_hash, status, expires_at)
+	VALUES ($1, $2, $3, $4, $5, 'pending', $6)
+	RETURNING id
+	`
+	err := r.db.Get(&id, query, tx.FromWalletID, tx.ToAddress, tx.TokenSymbol, tx.Amount, tx.TxHash, tx.ExpiresAt)
+	return id, err
+}
+
+// GetPendingTransactions возвращает транзакции, которые ещё ждут результата в сети
+func (r *TransactionPostgres) GetPendingTransactions(limit int) ([]models.Transaction, error) {
+	var txs []models.Transaction
+	query := `
+	SELECT id, from_wallet_id, to_address, token_symbol, amount, tx_hash, status, created_at, expires_at,
+	       block_number, result, failure_reason, energy_used, energy_fee, net_fee, fee
+	FROM transactions
+	WHERE status = 'pending' AND tx_hash IS NOT NULL
+	ORDER BY updated_at
+	LIMIT $1
+	`
+	err := r.db.Select(&txs, query, limit)
+	return txs, err
+}
+
+// UpdateTransactionStatus сохраняет результат из сети. Меняются только pending-записи.
+func (r *TransactionPostgres) UpdateTransactionStatus(tx models.Transaction) error {
+	query := `
+	UPDATE transactions SET
+		status = $1, block_number = $2, result = $3, failure_reason = $4,
+		energy_used = $5, energy_fee = $6, net_fee = $7, fee = $8, updated_at = NOW()
+	WHERE id = $9 AND status = 'pending'
+	`
+	_, err := r.db.Exec(query, tx.Status, tx.BlockNumber, tx.Result, tx.FailureReason,
+		tx.EnergyUsed, tx.EnergyFee, tx.NetFee, tx.Fee, tx.ID)
+	return err
+}
+
+// GetFailedTransactions возвращает неуспешные и истёкшие транзакции для админки
+func (r *TransactionPostgres) GetFailedTransactions(limit int) ([]models.FailedTransaction, error) {
+	var txs []models.FailedTransaction
+	query := `
+	SELECT t.id, t.from_wallet_id, t.to_address, t.token_symbol, t.amount, t.tx_hash, t.status, t.created_at,
+	       t.expires_at, t.block_number, t.result, t.failure_reason, t.energy_used, t.energy_fee, t.net_fee, t.fee,
+	       w.user_id, w.address AS from_address
+	FROM transactions t
+	JOIN wallets w ON w.id = t.from_wallet_id
+	WHERE t.status IN ('failed', 'expired')
+	ORDER BY t.created_at DESC
+	LIMIT $1
+	`
+	err := r.db.Select(&txs, query, limit)
+	return txs, err
+}
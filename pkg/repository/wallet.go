@@ -5,11 +5,16 @@ import (
 	"fmt"
 	"log"
 	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
 	"github.com/sirupsen/logrus"
 )
 
+// ErrDepositReplayed ручное зачисление с этим номером уже проведено
+var ErrDepositReplayed = errors.New("deposit with this reference is already posted")
+
 type WalletPostgres struct {
 	db *sqlx.DB
 }
@@ -18,86 +23,47 @@ func NewWalletPostgres(db *sqlx.DB) *WalletPostgres {
 	return &WalletPostgres{db: db}
 }
 
-func (r *WalletPostgres) GetPrivatKey(telegramId int64) (string, error) {
-	var privKey string
-	query := `SELECT private_key FROM wallets WHERE user_id = $1`
-	err := r.db.QueryRow(query, telegramId).Scan(&privKey)
-	if err != nil {
-		logrus.Errorf("get private key error: %v", err)
-		return "", err
-	}
-	return privKey, nil
-}
-
-func (r *WalletPostgres) OrdersHistory(telegramId int64) ([]models.OrderQR, error) {
-	var orders []models.OrderQR
-	query := "SELECT * FROM orderqr WHERE telegram_id = $1"
-	err := r.db.Select(&orders, query, telegramId)
-	if err != nil {
-		logrus.Error(err)
-		return nil, err
-	}
-	return orders, nil
-}
-
-func (r *WalletPostgres) PayQR(orderId int) (bool, error) {
-	logrus.Infof("Pay QR for order %d", orderId)
-	query := "UPDATE orderQR SET ispaid = true WHERE id = $1"
-	_, err := r.db.Exec(query, orderId)
+// GetWalletKey возвращает зашифрованный приватный ключ кошелька пользователя
+func (r *WalletPostgres) GetWalletKey(telegramId int64) (models.WalletKey, error) {
+	var key models.WalletKey
+	query := `SELECT id, address, private_key, wrapped_key, key_version FROM wallets WHERE user_id = $1`
+	err := r.db.Get(&key, query, telegramId)
 	if err != nil {
-		logrus.Error(err)
-		return false, err
+		logrus.Errorf("get wallet key error: %v", err)
+		return key, err
 	}
-	logrus.Infof("ispaid: %v", true)
-	return true, nil
+	return key, nil
 }
 
-func (r *WalletPostgres) GetOrders() ([]models.OrderQR, error) {
-	logrus.Info("Geting new orders")
-	var orders []models.OrderQR
-	query := "SELECT * FROM orderqr WHERE ispaid is false;"
-	err := r.db.Select(&orders, query)
-	if err != nil {
-		return []models.OrderQR{}, err
-	}
-	if len(orders) == 0 {
-		return []models.OrderQR{}, errors.New("no orders found")
-	}
-	logrus.Infof("GetOrders: %v", orders)
-	return orders, nil
+// GetWalletKeysToRewrap возвращает кошельки, ключи которых зашифрованы не текущей версией мастер-ключа
+func (r *WalletPostgres) GetWalletKeysToRewrap(currentVersion int, limit int) ([]models.WalletKey, error) {
+	var keys []models.WalletKey
+	query := `SELECT id, address, private_key, wrapped_key, key_version FROM wallets WHERE key_version <> $1 ORDER BY id LIMIT $2`
+	err := r.db.Select(&keys, query, currentVersion, limit)
+	return keys, err
 }
 
-func (r *WalletPostgres) GetOrderState(orderId int) (bool, error) {
-	logrus.Infof("Getting order state for order %d", orderId)
-	query := "SELECT ispaid FROM orderqr WHERE id = $1"
-	var ispaid bool
-	err := r.db.QueryRow(query, orderId).Scan(&ispaid)
+// UpdateWalletKey сохраняет перешифрованный ключ, если запись не изменилась с момента чтения
+func (r *WalletPostgres) UpdateWalletKey(walletID int64, old models.EncryptedKey, key models.EncryptedKey) error {
+	query := `
+	UPDATE wallets SET private_key = $1, wrapped_key = $2, key_version = $3
+	WHERE id = $4 AND key_version = $5 AND private_key = $6
+	`
+	res, err := r.db.Exec(query, key.Ciphertext, key.WrappedKey, key.KeyVersion, walletID, old.KeyVersion, old.Ciphertext)
 	if err != nil {
-		logrus.Error(err)
-		return false, err
+		return err
 	}
-	logrus.Infof("Getting order state for order %d", orderId)
-	return ispaid, nil
-}
-
-func (r *WalletPostgres) CreateOrder(qr models.OrderQR) (int, error) {
-	logrus.Infof("Creating order with %v", qr)
-	var orderid int
-	query := "insert into orderqr (telegram_id, qrcode, summa, crypto) values ($1,$2,$3, $4) RETURNING id;"
-	err := r.db.QueryRow(query, qr.TelegramId, qr.QRCode, qr.Summa, qr.Crypto).Scan(&orderid)
-	if err != nil {
-		logrus.Error(err)
-		return 0, err
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("wallet %d key was changed concurrently", walletID)
 	}
-	logrus.Infof("Created order with %v", qr)
-	return orderid, nil
+	return nil
 }
 
-func (r *WalletPostgres) CreateWallet(userID int64, privKey, address string) (int64, error) {
+func (r *WalletPostgres) CreateWallet(userID int64, address string, key models.EncryptedKey) (int64, error) {
 	log.Printf("Creating wallet: userID=%d, address=%s", userID, address)
 	var walletId int64
-	query := `INSERT INTO wallets (user_id, private_key, address) VALUES ($1, $2, $3) returning id;`
-	err := r.db.QueryRow(query, userID, privKey, address).Scan(&walletId)
+	query := `INSERT INTO wallets (user_id, private_key, wrapped_key, key_version, address) VALUES ($1, $2, $3, $4, $5) returning id;`
+	err := r.db.QueryRow(query, userID, key.Ciphertext, key.WrappedKey, key.KeyVersion, address).Scan(&walletId)
 	if err != nil {
 		return 0, errors.New(fmt.Sprintf("Error creating wallet: %s", err))
 	}
@@ -144,54 +110,62 @@ func (r *WalletPostgres) GetBalances(telegramID int64) ([]models.Balance, error)
 	return balances, err
 }
 
-func (r *WalletPostgres) Deposit(telegramId int64, tokenSymbol string, amount float64) error {
+// Deposit ручное зачисление на кошелёк пользователя проводкой против внешнего счёта. Остатки до
+// и после снимаются под блокировкой строки кошелька, запись audit пишется в той же транзакции.
+func (r *WalletPostgres) Deposit(telegramId int64, tokenSymbol string, amount money.Amount, reference string, audit models.AuditEntry) error {
 	tx, err := r.db.Beginx()
 	if err != nil {
 		return err
 	}
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback()
-		} else if err != nil {
-			tx.Rollback()
-		} else {
-			err = tx.Commit()
-		}
-	}()
+	defer tx.Rollback()
 
 	var walletId int64
-	queryWallet := "SELECT w.id FROM wallets w JOIN users u on u.telegram_id = w.user_id WHERE u.telegram_id = $1;"
+	queryWallet := "SELECT w.id FROM wallets w JOIN users u on u.telegram_id = w.user_id WHERE u.telegram_id = $1 FOR UPDATE OF w;"
 	err = tx.Get(&walletId, queryWallet, telegramId)
 	if err != nil {
 		return err
 	}
-	queryBalance := "UPDATE balances SET amount = amount + $1 WHERE WALLET_id = $2;"
-	_, err = tx.Exec(queryBalance, amount, walletId)
+	before, err := walletBalances(tx, walletId)
+	if err != nil {
+		return err
+	}
+	id, err := postEntry(tx, models.LedgerEntry{
+		Kind:      models.EntryManualDeposit,
+		Reference: "manual_deposit:" + reference,
+		Postings: []models.Posting{
+			{Account: models.AccountExternal, TokenSymbol: tokenSymbol, Amount: -amount},
+			{Account: models.AccountWallet, WalletID: walletId, TokenSymbol: tokenSymbol, Amount: amount},
+		},
+	})
 	if err != nil {
 		return err
 	}
+	if id == 0 {
+		return fmt.Errorf("%w: %s", ErrDepositReplayed, reference)
+	}
+	after, err := walletBalances(tx, walletId)
+	if err != nil {
+		return err
+	}
+	if err := recordAudit(tx, audit, before, after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
 
-	return nil
+// walletBalances остатки кошелька внутри транзакции
+func walletBalances(tx *sqlx.Tx, walletID int64) ([]models.Balance, error) {
+	var balances []models.Balance
+	query := `SELECT wallet_id, token_symbol, amount, updated_at FROM balances WHERE wallet_id = $1 ORDER BY token_symbol`
+	err := tx.Select(&balances, query, walletID)
+	return balances, err
 }
 
 func (r *WalletPostgres) Convert(req models.ConvertRequest) (error, models.ConvertResponse) {
 	return nil, models.ConvertResponse{}
 }
 
-func (r *WalletPostgres) WithdrawBalance(walletID int64, amount float64, tokenSymbol string) error {
-	query := `
-	UPDATE balances
-	SET amount = amount - $1, updated_at = NOW()
-	WHERE wallet_id = $2 and token_symbol = $3 and amount >= $1
-	`
-	_, err := r.db.Exec(query, amount, walletID, tokenSymbol)
-	if err != nil {
-		return errors.New(fmt.Sprintf("Error executing withdrawal: %s", err))
-	}
-	return nil
-}
-
-func (r *WalletPostgres) CreateTransaction(walletID int64, to_address string, token string, amount float64, status string, tx_hash string) error {
+func (r *WalletPostgres) CreateTransaction(walletID int64, to_address string, token string, amount money.Amount, status string, tx_hash string) error {
 	query := `
 		INSERT INTO transactions (from_wallet_id, to_address, token_symbol, amount, tx_hash, status)
 		VALUES ($1, $2, $3, $4, $5, $6);`
@@ -204,7 +178,8 @@ func (r *WalletPostgres) CreateTransaction(walletID int64, to_address string, to
 
 func (r *WalletPostgres) GetTransactions(telegramID int64) ([]models.Transaction, error) {
 	query := `
-	SELECT t.id, t.from_wallet_id, t.to_address, t.token_symbol, t.amount, t.tx_hash, t.status, t.created_at
+	SELECT t.id, t.from_wallet_id, t.to_address, t.token_symbol, t.amount, t.tx_hash, t.status, t.created_at,
+	       t.block_number, t.result, t.failure_reason, t.fee
 	FROM transactions t
 	JOIN wallets w ON w.id = t.from_wallet_id
 	WHERE w.user_id = $1
@@ -229,6 +204,10 @@ func (r *WalletPostgres) GetTransactions(telegramID int64) ([]models.Transaction
 			&tx.TxHash,
 			&tx.Status,
 			&tx.CreatedAt,
+			&tx.BlockNumber,
+			&tx.Result,
+			&tx.FailureReason,
+			&tx.Fee,
 		); err != nil {
 			return nil, err
 		}
@@ -238,25 +217,63 @@ func (r *WalletPostgres) GetTransactions(telegramID int64) ([]models.Transaction
 	return transactions, nil
 }
 
-func (r *WalletPostgres) Pay(telegramId int64, tokenSymbol string, amount float64) error {
+func (r *WalletPostgres) Pay(telegramId int64, tokenSymbol string, amount money.Amount) error {
 	return nil
 }
 
-// Добавить виртуальное списание
-func (r *WalletPostgres) AddVirtualTransfer(walletID int64, amount float64) error {
-	query := `INSERT INTO usdt_virtual_transfers (wallet_id, amount) VALUES ($1, $2)`
-	_, err := r.db.Exec(query, walletID, amount)
-	return err
+// ReserveVirtualTransfer добавляет виртуальное списание, если оно помещается в доступный остаток
+// balance минус pending-списания, удержания под заказы и незавершённые выводы. Проверка и вставка идут под блокировкой строки кошелька,
+// поэтому параллельные списания выполняются по очереди и не уводят остаток в минус.
+func (r *WalletPostgres) ReserveVirtualTransfer(walletID int64, amount money.Amount, balance money.Amount, audit models.AuditEntry) (models.VirtualTransfer, error) {
+	var transfer models.VirtualTransfer
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return transfer, err
+	}
+	defer tx.Rollback()
+
+	available, err := lockAvailable(tx, walletID, balance, 0)
+	if err != nil {
+		return transfer, err
+	}
+	if available < amount {
+		return transfer, fmt.Errorf("%w: available %s, need %s", ErrInsufficientBalance, available, amount)
+	}
+
+	id, err := insertVirtualTransfer(tx, walletID, amount)
+	if err != nil {
+		return transfer, err
+	}
+	if err := tx.Get(&transfer, `SELECT * FROM usdt_virtual_transfers WHERE id = $1`, id); err != nil {
+		return transfer, err
+	}
+	if err := recordAudit(tx, audit, nil, transfer); err != nil {
+		return transfer, err
+	}
+	return transfer, tx.Commit()
 }
 
 // Получить сумму всех pending виртуальных списаний
-func (r *WalletPostgres) SumPendingVirtualTransfers(walletID int64) (float64, error) {
-	var sum float64
+func (r *WalletPostgres) SumPendingVirtualTransfers(walletID int64) (money.Amount, error) {
+	var sum money.Amount
 	query := `SELECT COALESCE(SUM(amount), 0) FROM usdt_virtual_transfers WHERE wallet_id = $1 AND status = 'pending'`
 	err := r.db.Get(&sum, query, walletID)
 	return sum, err
 }
 
+// GetReservedBalance резервы кошелька, которые вычитаются из остатка в сети
+func (r *WalletPostgres) GetReservedBalance(walletID int64) (models.ReservedBalance, error) {
+	return reservedBalance(r.db, walletID, 0)
+}
+
+// SumActiveHolds сумма активных удержаний под заказы
+func (r *WalletPostgres) SumActiveHolds(walletID int64) (money.Amount, error) {
+	var sum money.Amount
+	query := `SELECT COALESCE(SUM(amount), 0) FROM balance_holds WHERE wallet_id = $1 AND status = 'active'`
+	err := r.db.Get(&sum, query, walletID)
+	return sum, err
+}
+
 // Получить все pending виртуальные списания
 func (r *WalletPostgres) GetPendingVirtualTransfers(walletID int64) ([]models.VirtualTransfer, error) {
 	var transfers []models.VirtualTransfer
@@ -268,21 +285,14 @@ func (r *WalletPostgres) GetPendingVirtualTransfers(walletID int64) ([]models.Vi
 // Обновить статус виртуальных списаний на processed
 func (r *WalletPostgres) MarkVirtualTransfersProcessed(ids []int64) error {
 	query := `UPDATE usdt_virtual_transfers SET status = 'processed', processed_at = NOW() WHERE id = ANY($1)`
-	_, err := r.db.Exec(query, ids)
-	return err
-}
-
-// Обновить баланс в таблице balances
-func (r *WalletPostgres) UpdateBalance(walletID int64, tokenSymbol string, amount float64) error {
-	query := `UPDATE balances SET amount = $1, updated_at = NOW() WHERE wallet_id = $2 AND token_symbol = $3`
-	_, err := r.db.Exec(query, amount, walletID, tokenSymbol)
+	_, err := r.db.Exec(query, pq.Array(ids))
 	return err
 }
 
 // GetAllWallets возвращает все кошельки
 func (r *WalletPostgres) GetAllWallets() ([]models.Wallet, error) {
 	var wallets []models.Wallet
-	query := `SELECT id, user_id, private_key, address, created_at FROM wallets`
+	query := `SELECT id, user_id, address, created_at FROM wallets`
 	err := r.db.Select(&wallets, query)
 	return wallets, err
 }
@@ -290,7 +300,7 @@ func (r *WalletPostgres) GetAllWallets() ([]models.Wallet, error) {
 // GetVirtualTransfersByWalletID возвращает все виртуальные списания по wallet_id
 func (r *WalletPostgres) GetVirtualTransfersByWalletID(walletID int64) ([]models.VirtualTransfer, error) {
 	var transfers []models.VirtualTransfer
-	query := `SELECT id, wallet_id, amount, status, created_at, processed_at FROM usdt_virtual_transfers WHERE wallet_id = $1`
+	query := `SELECT id, wallet_id, amount, status, settlement_id, tx_hash, created_at, processed_at FROM usdt_virtual_transfers WHERE wallet_id = $1`
 	err := r.db.Select(&transfers, query, walletID)
 	return transfers, err
 }
@@ -298,7 +308,7 @@ func (r *WalletPostgres) GetVirtualTransfersByWalletID(walletID int64) ([]models
 // GetTransactionsByWalletID возвращает все реальные списания по wallet_id и токену
 func (r *WalletPostgres) GetTransactionsByWalletID(walletID int64, tokenSymbol string) ([]models.Transaction, error) {
 	var txs []models.Transaction
-	query := `SELECT id, from_wallet_id, to_address, token_symbol, amount, tx_hash, status, created_at FROM transactions WHERE from_wallet_id = $1 AND token_symbol = $2`
+	query := `SELECT id, from_wallet_id, to_address, token_symbol, amount, tx_hash, status, created_at, failure_reason FROM transactions WHERE from_wallet_id = $1 AND token_symbol = $2`
 	err := r.db.Select(&txs, query, walletID, tokenSymbol)
 	return txs, err
 }
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ErrLeaseLost заявку за время обработки забрал другой воркер
+var ErrLeaseLost = errors.New("withdrawal job lease lost")
+
+type WithdrawalPostgres struct {
+	db *sqlx.DB
+}
+
+func NewWithdrawalPostgres(db *sqlx.DB) *WithdrawalPostgres {
+	return &WithdrawalPostgres{db: db}
+}
+
+// CreateWithdrawalJob создаёт заявку, если сумма помещается в доступный остаток кошелька
+// (balance в сети минус списания, удержания и другие выводы), и в той же транзакции переносит
+// её с кошелька пользователя на счёт выводов в пути. Не хватает остатка — ErrInsufficientBalance.
+// Запись audit о заявке пишется в ту же транзакцию.
+func (r *WithdrawalPostgres) CreateWithdrawalJob(job models.WithdrawalJob, balance money.Amount, audit models.AuditEntry) (models.WithdrawalJob, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return job, err
+	}
+	defer tx.Rollback()
+
+	available, err := lockAvailable(tx, job.WalletID, balance, 0)
+	if err != nil {
+		return job, err
+	}
+	if available < job.Amount {
+		return job, fmt.Errorf("%w: available %s, need %s", ErrInsufficientBalance, available, job.Amount)
+	}
+
+	var created models.WithdrawalJob
+	query := `
+	INSERT INTO withdrawal_jobs (wallet_id, telegram_id, from_address, to_address, token_symbol, amount)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	RETURNING *
+	`
+	err = tx.Get(&created, query, job.WalletID, job.TelegramID, job.FromAddress, job.ToAddress, job.TokenSymbol, job.Amount)
+	if err != nil {
+		return created, err
+	}
+
+	_, err = postEntry(tx, models.LedgerEntry{
+		Kind:      models.EntryWithdrawalReserve,
+		Reference: withdrawalReference(created.ID, "reserve"),
+		Postings: []models.Posting{
+			{Account: models.AccountWallet, WalletID: created.WalletID, TokenSymbol: created.TokenSymbol, Amount: -created.Amount},
+			{Account: models.AccountPendingWithdrawals, TokenSymbol: created.TokenSymbol, Amount: created.Amount},
+		},
+	})
+	if err != nil {
+		return created, err
+	}
+
+	// id заявки появляется только здесь, поэтому цель записи журнала подставляет репозиторий
+	audit.Target = fmt.Sprintf("withdrawal:%d", created.ID)
+	if err := recordAudit(tx, audit, nil, created); err != nil {
+		return created, err
+	}
+	return created, tx.Commit()
+}
+
+func (r *WithdrawalPostgres) GetWithdrawalJob(id int64) (models.WithdrawalJob, error) {
+	var job models.WithdrawalJob
+	query := `SELECT * FROM withdrawal_jobs WHERE id = $1`
+	err := r.db.Get(&job, query, id)
+	return job, err
+}
+
+// ClaimWithdrawalJob берёт в работу одну готовую к запуску заявку и выдаёт на неё аренду.
+// Заявки с действующей арендой пропускаются, поэтому несколько воркеров не берут одну и ту же.
+func (r *WithdrawalPostgres) ClaimWithdrawalJob(token string, lease time.Duration) (job models.WithdrawalJob, found bool, err error) {
+	query := `
+	UPDATE withdrawal_jobs SET lease_token = $1, locked_until = NOW() + $2 * INTERVAL '1 second'
+	WHERE id = (
+		SELECT id FROM withdrawal_jobs
+		WHERE state NOT IN ('confirmed', 'failed')
+		  AND next_run_at <= NOW()
+		  AND (locked_until IS NULL OR locked_until < NOW())
+		ORDER BY next_run_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	)
+	RETURNING *
+	`
+	err = r.db.Get(&job, query, token, lease.Seconds())
+	if errors.Is(err, sql.ErrNoRows) {
+		return job, false, nil
+	}
+	if err != nil {
+		return job, false, err
+	}
+	return job, true, nil
+}
+
+// SaveWithdrawalJob сохраняет состояние заявки, пока аренда job.LeaseToken действует.
+// release = true снимает аренду, и заявка снова доступна воркерам с next_run_at.
+// Вместе с состоянием в журнал пишутся газ с горячего кошелька и итог заявки, а если передан
+// audit — и запись в журнал аудита.
+func (r *WithdrawalPostgres) SaveWithdrawalJob(job models.WithdrawalJob, release bool, audit *models.AuditEntry) error {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `
+	UPDATE withdrawal_jobs SET
+		state = $1, gas_tx_id = $2, gas_signed_tx = $3, gas_amount = $4, tx_id = $5, signed_tx = $6, tx_expires_at = $7,
+		attempts = $8, last_error = $9, next_run_at = $10, updated_at = NOW(),
+		locked_until = CASE WHEN $11 THEN NULL ELSE locked_until END
+	WHERE id = $12 AND lease_token = $13
+	`
+	res, err := tx.Exec(query, job.State, job.GasTxID, job.GasSignedTx, job.GasAmount, job.TxID, job.SignedTx, job.TxExpiresAt,
+		job.Attempts, job.LastError, job.NextRunAt, release, job.ID, job.LeaseToken)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+
+	if err := postWithdrawalEntries(tx, job); err != nil {
+		return err
+	}
+	if audit != nil {
+		if err := recordAudit(tx, *audit, nil, nil); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// postWithdrawalEntries пишет проводки по итогу заявки (газ записывает GasManager при подтверждении).
+// Каждая проводка идемпотентна, поэтому повторное сохранение того же состояния журнал не меняет.
+func postWithdrawalEntries(tx *sqlx.Tx, job models.WithdrawalJob) error {
+	if job.State != models.WithdrawalConfirmed && job.State != models.WithdrawalFailed {
+		return nil
+	}
+	// Заявки, созданные до журнала, резерва не имеют — закрывать нечего
+	reserved, err := entryExists(tx, withdrawalReference(job.ID, "reserve"))
+	if err != nil || !reserved {
+		return err
+	}
+
+	// Подтверждённый вывод ушёл во внешний мир, неуспешный возвращается пользователю
+	entry := models.LedgerEntry{
+		Kind:      models.EntryWithdrawalSettle,
+		Reference: withdrawalReference(job.ID, "settle"),
+		Postings: []models.Posting{
+			{Account: models.AccountPendingWithdrawals, TokenSymbol: job.TokenSymbol, Amount: -job.Amount},
+			{Account: models.AccountExternal, TokenSymbol: job.TokenSymbol, Amount: job.Amount},
+		},
+	}
+	if job.State == models.WithdrawalFailed {
+		entry.Kind = models.EntryWithdrawalRelease
+		entry.Reference = withdrawalReference(job.ID, "release")
+		entry.Postings[1] = models.Posting{Account: models.AccountWallet, WalletID: job.WalletID, TokenSymbol: job.TokenSymbol, Amount: job.Amount}
+	}
+	_, err = postEntry(tx, entry)
+	return err
+}
+
+func withdrawalReference(id int64, step string) string {
+	return fmt.Sprintf("withdrawal:%d:%s", id, step)
+}
+
+// LockAvailableForWithdrawal доступный остаток для заявки job: balance в сети минус списания,
+// удержания и другие незавершённые выводы, посчитанный под блокировкой строки кошелька
+func (r *WithdrawalPostgres) LockAvailableForWithdrawal(job models.WithdrawalJob, balance money.Amount) (money.Amount, error) {
+	tx, err := r.db.Beginx()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	available, err := lockAvailable(tx, job.WalletID, balance, job.ID)
+	if err != nil {
+		return 0, err
+	}
+	return available, tx.Commit()
+}
@@ -0,0 +1,298 @@
+// Package sbpqr разбирает платёжные QR Системы быстрых платежей: ссылки НСПК
+// (https://qr.nspk.ru/<id>?type=02&bank=...&sum=...&cur=RUB&crc=...) и EMV-payload
+// (EMVCo Merchant-Presented Mode), в шаблоне счёта получателя которых указан НСПК.
+package sbpqr
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"production_wallet_back/pkg/money"
+)
+
+// Форматы QR
+const (
+	FormatNSPKLink = "nspk_link"
+	FormatEMV      = "emv"
+)
+
+// Типы QR НСПК
+const (
+	TypeStatic  = "static"  // 01: сумму вводит плательщик
+	TypeDynamic = "dynamic" // 02: сумма зашита в QR
+)
+
+const nspkHost = "qr.nspk.ru"
+
+var (
+	// ErrMalformed QR не разбирается или содержит недопустимые значения
+	ErrMalformed = errors.New("malformed QR payload")
+	// ErrNotSBP QR корректен, но не является платежом СБП
+	ErrNotSBP = errors.New("QR is not an SBP payment")
+
+	qrIDPattern   = regexp.MustCompile(`^[A-Z0-9]{32}$`)
+	bankIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+)
+
+// Payment разобранный платёжный QR. Amount в рублях, 0 — сумма не указана (статический QR).
+type Payment struct {
+	Format       string       `json:"format"`
+	QRID         string       `json:"qr_id,omitempty"`
+	Type         string       `json:"type,omitempty"`
+	BankID       string       `json:"bank_id,omitempty"`
+	Merchant     string       `json:"merchant,omitempty"`
+	MerchantCity string       `json:"merchant_city,omitempty"`
+	MCC          string       `json:"mcc,omitempty"`
+	Amount       money.Amount `json:"amount"`
+	Currency     string       `json:"currency"`
+	Purpose      string       `json:"purpose,omitempty"`
+}
+
+// Parse разбирает ссылку НСПК или EMV-payload СБП
+func Parse(raw string) (Payment, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return Payment{}, fmt.Errorf("%w: empty", ErrMalformed)
+	}
+	if strings.HasPrefix(raw, "000201") {
+		return parseEMV(raw)
+	}
+	return parseLink(raw)
+}
+
+// parseLink ссылка НСПК. sum — в копейках, cur — только RUB.
+// crc проверяется только по формату: алгоритм контрольной суммы ссылки НСПК не публикуется.
+func parseLink(raw string) (Payment, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return Payment{}, fmt.Errorf("%w: not a URL", ErrMalformed)
+	}
+	if !strings.EqualFold(u.Host, nspkHost) {
+		return Payment{}, fmt.Errorf("%w: host %s", ErrNotSBP, u.Host)
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return Payment{}, fmt.Errorf("%w: scheme %s", ErrMalformed, u.Scheme)
+	}
+
+	p := Payment{Format: FormatNSPKLink, Currency: "RUB"}
+	p.QRID = strings.Trim(u.Path, "/")
+	if !qrIDPattern.MatchString(p.QRID) {
+		return Payment{}, fmt.Errorf("%w: QR id %q", ErrMalformed, p.QRID)
+	}
+
+	q := u.Query()
+	switch q.Get("type") {
+	case "":
+	case "01":
+		p.Type = TypeStatic
+	case "02":
+		p.Type = TypeDynamic
+	default:
+		return Payment{}, fmt.Errorf("%w: type %q", ErrMalformed, q.Get("type"))
+	}
+	if bank := q.Get("bank"); bank != "" {
+		if !bankIDPattern.MatchString(bank) {
+			return Payment{}, fmt.Errorf("%w: bank %q", ErrMalformed, bank)
+		}
+		p.BankID = bank
+	}
+	if sum := q.Get("sum"); sum != "" {
+		kopecks, err := strconv.ParseInt(sum, 10, 64)
+		if err != nil || kopecks <= 0 {
+			return Payment{}, fmt.Errorf("%w: sum %q", ErrMalformed, sum)
+		}
+		if p.Amount, err = fromKopecks(kopecks); err != nil {
+			return Payment{}, err
+		}
+	}
+	if cur := q.Get("cur"); cur != "" && cur != "RUB" {
+		return Payment{}, fmt.Errorf("%w: currency %s", ErrNotSBP, cur)
+	}
+	if crc := q.Get("crc"); crc != "" && !isHex(crc, 4) {
+		return Payment{}, fmt.Errorf("%w: crc %q", ErrMalformed, crc)
+	}
+	p.Purpose = q.Get("payment_purpose")
+
+	if p.Type == TypeDynamic && p.Amount == 0 {
+		return Payment{}, fmt.Errorf("%w: dynamic QR without sum", ErrMalformed)
+	}
+	return p, nil
+}
+
+// parseEMV EMV-payload: поля ID(2) + длина(2) + значение, последним идёт CRC (63).
+// СБП — если один из шаблонов счёта получателя (26–51) относится к НСПК.
+func parseEMV(raw string) (Payment, error) {
+	fields, err := parseTLV(raw)
+	if err != nil {
+		return Payment{}, err
+	}
+	if err := checkCRC(raw, fields); err != nil {
+		return Payment{}, err
+	}
+	if fields["00"] != "01" {
+		return Payment{}, fmt.Errorf("%w: payload format %q", ErrMalformed, fields["00"])
+	}
+
+	p := Payment{
+		Format:       FormatEMV,
+		Merchant:     fields["59"],
+		MerchantCity: fields["60"],
+		MCC:          fields["52"],
+	}
+	switch fields["01"] {
+	case "", "11":
+		p.Type = TypeStatic
+	case "12":
+		p.Type = TypeDynamic
+	default:
+		return Payment{}, fmt.Errorf("%w: point of initiation %q", ErrMalformed, fields["01"])
+	}
+
+	sbp := false
+	for id := 26; id <= 51; id++ {
+		template, ok := fields[strconv.Itoa(id)]
+		if !ok {
+			continue
+		}
+		sub, err := parseTLV(template)
+		if err != nil {
+			return Payment{}, fmt.Errorf("merchant account %d: %w", id, err)
+		}
+		for _, v := range sub {
+			if !strings.Contains(strings.ToLower(v), "nspk") {
+				continue
+			}
+			sbp = true
+			// В шаблоне может лежать ссылка НСПК — из неё берутся id QR и банк
+			if link, err := parseLink(v); err == nil {
+				p.QRID, p.BankID = link.QRID, link.BankID
+			}
+		}
+	}
+	if !sbp {
+		return Payment{}, fmt.Errorf("%w: no NSPK merchant account", ErrNotSBP)
+	}
+
+	if cur := fields["53"]; cur != "643" {
+		return Payment{}, fmt.Errorf("%w: currency %q", ErrNotSBP, cur)
+	}
+	p.Currency = "RUB"
+	if country := fields["58"]; country != "" && country != "RU" {
+		return Payment{}, fmt.Errorf("%w: country %s", ErrNotSBP, country)
+	}
+	if amount := fields["54"]; amount != "" {
+		if p.Amount, err = money.Parse(amount); err != nil || p.Amount.Validate() != nil {
+			return Payment{}, fmt.Errorf("%w: amount %q", ErrMalformed, amount)
+		}
+	}
+	if extra, ok := fields["62"]; ok {
+		sub, err := parseTLV(extra)
+		if err != nil {
+			return Payment{}, fmt.Errorf("additional data: %w", err)
+		}
+		p.Purpose = sub["08"]
+	}
+
+	if p.Type == TypeDynamic && p.Amount == 0 {
+		return Payment{}, fmt.Errorf("%w: dynamic QR without amount", ErrMalformed)
+	}
+	return p, nil
+}
+
+func parseTLV(s string) (map[string]string, error) {
+	fields := make(map[string]string)
+	for i := 0; i < len(s); {
+		if i+4 > len(s) {
+			return nil, fmt.Errorf("%w: truncated field at %d", ErrMalformed, i)
+		}
+		id := s[i : i+2]
+		n, err := strconv.Atoi(s[i+2 : i+4])
+		if err != nil || !isDigits(id) || i+4+n > len(s) {
+			return nil, fmt.Errorf("%w: bad field %q at %d", ErrMalformed, id, i)
+		}
+		if _, dup := fields[id]; dup {
+			return nil, fmt.Errorf("%w: duplicate field %s", ErrMalformed, id)
+		}
+		fields[id] = s[i+4 : i+4+n]
+		i += 4 + n
+	}
+	return fields, nil
+}
+
+// checkCRC CRC-16/CCITT-FALSE по всему payload до значения поля 63 включительно с "6304"
+func checkCRC(raw string, fields map[string]string) error {
+	crc, ok := fields["63"]
+	if !ok || len(crc) != 4 || !strings.HasSuffix(raw, "6304"+crc) {
+		return fmt.Errorf("%w: CRC must be the last field", ErrMalformed)
+	}
+	want := fmt.Sprintf("%04X", crc16(raw[:len(raw)-4]))
+	if !strings.EqualFold(crc, want) {
+		return fmt.Errorf("%w: CRC %s, expected %s", ErrMalformed, crc, want)
+	}
+	return nil
+}
+
+func crc16(s string) uint16 {
+	crc := uint16(0xFFFF)
+	for i := 0; i < len(s); i++ {
+		crc ^= uint16(s[i]) << 8
+		for b := 0; b < 8; b++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+func fromKopecks(kopecks int64) (money.Amount, error) {
+	if kopecks > int64(money.Max/(money.One/100)) {
+		return 0, fmt.Errorf("%w: sum is out of range", ErrMalformed)
+	}
+	return money.Amount(kopecks) * (money.One / 100), nil
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+	for _, c := range strings.ToUpper(s) {
+		if !('0' <= c && c <= '9' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// Value хранит разобранный QR в JSONB
+func (p Payment) Value() (driver.Value, error) {
+	return json.Marshal(p)
+}
+
+func (p *Payment) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return json.Unmarshal(v, p)
+	case string:
+		return json.Unmarshal([]byte(v), p)
+	default:
+		return fmt.Errorf("sbpqr: cannot scan %T", src)
+	}
+}
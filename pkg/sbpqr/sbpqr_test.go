@@ -0,0 +1,102 @@
+package sbpqr
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"production_wallet_back/pkg/money"
+)
+
+const testQRID = "AD10006M8KH1E8N99MJPNDOO83TGBMK9"
+
+// tlv поле EMV: ID, длина из двух цифр и значение
+func tlv(id, value string) string {
+	return fmt.Sprintf("%s%02d%s", id, len(value), value)
+}
+
+// withCRC дописывает поле 63 с CRC-16/CCITT-FALSE, как это делает банк
+func withCRC(payload string) string {
+	payload += "6304"
+	return payload + fmt.Sprintf("%04X", crc16(payload))
+}
+
+// emvPayload динамический QR СБП на amount рублей со счётом получателя account
+func emvPayload(account, amount string) string {
+	payload := tlv("00", "01") + tlv("01", "12") + tlv("26", account) + tlv("52", "5812") + tlv("53", "643")
+	if amount != "" {
+		payload += tlv("54", amount)
+	}
+	return withCRC(payload + tlv("58", "RU") + tlv("59", "KAFE") + tlv("60", "MOSKVA") + tlv("62", tlv("08", "order 42")))
+}
+
+func TestCRC16(t *testing.T) {
+	// Контрольное значение CRC-16/CCITT-FALSE
+	if got := crc16("123456789"); got != 0x29B1 {
+		t.Fatalf("crc16 = %04X, want 29B1", got)
+	}
+}
+
+func TestParse(t *testing.T) {
+	nspkAccount := tlv("00", "ru.nspk") + tlv("01", "https://qr.nspk.ru/"+testQRID+"?bank=100000000111")
+	validEMV := emvPayload(nspkAccount, "1250.50")
+	// Получатель подменён после подсчёта CRC
+	badCRC := strings.Replace(validEMV, "KAFE", "KAFF", 1)
+
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr error
+		want    Payment
+	}{
+		{
+			name: "nspk link",
+			raw:  "https://qr.nspk.ru/" + testQRID + "?type=02&bank=100000000111&sum=125050&cur=RUB&crc=AB12",
+			want: Payment{Format: FormatNSPKLink, QRID: testQRID, Type: TypeDynamic, BankID: "100000000111", Amount: money.MustParse("1250.50"), Currency: "RUB"},
+		},
+		{
+			name: "static nspk link",
+			raw:  "https://qr.nspk.ru/" + testQRID + "?type=01&bank=100000000111",
+			want: Payment{Format: FormatNSPKLink, QRID: testQRID, Type: TypeStatic, BankID: "100000000111", Currency: "RUB"},
+		},
+		{
+			name: "emv",
+			raw:  validEMV,
+			want: Payment{Format: FormatEMV, QRID: testQRID, Type: TypeDynamic, BankID: "100000000111", Merchant: "KAFE", MerchantCity: "MOSKVA",
+				MCC: "5812", Amount: money.MustParse("1250.50"), Currency: "RUB", Purpose: "order 42"},
+		},
+		{name: "empty", raw: "  ", wantErr: ErrMalformed},
+		{name: "emv bad crc", raw: badCRC, wantErr: ErrMalformed},
+		{name: "emv crc not last", raw: validEMV + tlv("99", "x"), wantErr: ErrMalformed},
+		{name: "emv truncated field", raw: validEMV[:len(validEMV)-2], wantErr: ErrMalformed},
+		{name: "emv length past end", raw: withCRC(tlv("00", "01") + "2699ru.nspk"), wantErr: ErrMalformed},
+		{name: "emv truncated merchant account", raw: emvPayload("0007ru.nsp", "10"), wantErr: ErrMalformed},
+		{name: "emv dynamic without amount", raw: emvPayload(nspkAccount, ""), wantErr: ErrMalformed},
+		{name: "emv non-numeric amount", raw: emvPayload(nspkAccount, "12,50"), wantErr: ErrMalformed},
+		{name: "emv other scheme", raw: emvPayload(tlv("00", "com.visa")+tlv("01", "4111111111111111"), "10"), wantErr: ErrNotSBP},
+		{name: "link other host", raw: "https://qr.example.com/" + testQRID + "?type=02&sum=100", wantErr: ErrNotSBP},
+		{name: "link other currency", raw: "https://qr.nspk.ru/" + testQRID + "?type=02&sum=100&cur=USD", wantErr: ErrNotSBP},
+		{name: "link dynamic without sum", raw: "https://qr.nspk.ru/" + testQRID + "?type=02", wantErr: ErrMalformed},
+		{name: "link non-numeric sum", raw: "https://qr.nspk.ru/" + testQRID + "?type=02&sum=12.50", wantErr: ErrMalformed},
+		{name: "link zero sum", raw: "https://qr.nspk.ru/" + testQRID + "?type=02&sum=0", wantErr: ErrMalformed},
+		{name: "link sum out of range", raw: "https://qr.nspk.ru/" + testQRID + "?type=02&sum=9223372036854775807", wantErr: ErrMalformed},
+		{name: "link bad qr id", raw: "https://qr.nspk.ru/short?type=02&sum=100", wantErr: ErrMalformed},
+		{name: "link bad bank", raw: "https://qr.nspk.ru/" + testQRID + "?type=02&sum=100&bank=sber", wantErr: ErrMalformed},
+		{name: "link bad crc", raw: "https://qr.nspk.ru/" + testQRID + "?type=02&sum=100&crc=XYZ1", wantErr: ErrMalformed},
+		{name: "link bad type", raw: "https://qr.nspk.ru/" + testQRID + "?type=03&sum=100", wantErr: ErrMalformed},
+		{name: "link bad scheme", raw: "ftp://qr.nspk.ru/" + testQRID + "?type=02&sum=100", wantErr: ErrMalformed},
+		{name: "not a url", raw: "just text", wantErr: ErrMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.raw)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && got != tt.want {
+				t.Fatalf("payment = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/repository"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrAdminNotFound      = errors.New("admin user not found")
+	ErrAdminExists        = errors.New("admin user already exists")
+	ErrInvalidAdminRole   = errors.New("invalid admin role")
+	ErrInvalidAdminInput  = errors.New("invalid admin user")
+	ErrAdminSelfUpdate    = errors.New("admins cannot change their own role or disable themselves")
+)
+
+const minAdminPasswordLength = 12
+
+type AdminConfig struct {
+	SessionTTL time.Duration
+}
+
+type AdminService struct {
+	repos repository.Admin
+	cfg   AdminConfig
+	audit auditLog
+	// dummyHash сравнивается с паролем для несуществующего логина, чтобы время ответа не выдавало, есть ли такой админ
+	dummyHash []byte
+}
+
+func NewAdminService(repos *repository.Repository, cfg AdminConfig) *AdminService {
+	dummy, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+	return &AdminService{
+		repos:     repos.Admins,
+		cfg:       cfg,
+		audit:     auditLog{repos.Audit},
+		dummyHash: dummy,
+	}
+}
+
+// AdminActor инициатор действия — админ с логином name
+func AdminActor(name string) string {
+	return "admin:" + name
+}
+
+// Login проверяет пароль и открывает сессию админки. Токен возвращается один раз, в базе — только его хэш.
+// Адрес и User-Agent сессии берутся из meta.
+func (s *AdminService) Login(username, password string, meta models.RequestMeta) (models.AdminUser, models.AdminToken, error) {
+	admin, err := s.repos.GetAdminByUsername(strings.TrimSpace(username))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return admin, models.AdminToken{}, err
+	}
+	if err != nil {
+		bcrypt.CompareHashAndPassword(s.dummyHash, []byte(password))
+		return models.AdminUser{}, models.AdminToken{}, ErrInvalidCredentials
+	}
+	if bcrypt.CompareHashAndPassword([]byte(admin.PasswordHash), []byte(password)) != nil || admin.Disabled {
+		return models.AdminUser{}, models.AdminToken{}, ErrInvalidCredentials
+	}
+
+	token, err := newRefreshToken()
+	if err != nil {
+		return admin, models.AdminToken{}, err
+	}
+	expiresAt := time.Now().Add(s.cfg.SessionTTL)
+	sessionID, err := s.repos.CreateAdminSession(models.AdminSession{
+		AdminID:   admin.ID,
+		TokenHash: hashToken(token),
+		UserAgent: meta.UserAgent,
+		IP:        meta.IP,
+		ExpiresAt: expiresAt,
+	})
+	if err != nil {
+		return admin, models.AdminToken{}, err
+	}
+	meta.Actor = AdminActor(admin.Username)
+	s.audit.record(meta, models.AuditAdminLogin, adminTarget(admin.ID), nil, map[string]interface{}{"session_id": sessionID, "expires_at": expiresAt})
+	return admin, models.AdminToken{Token: token, ExpiresAt: expiresAt}, nil
+}
+
+func (s *AdminService) Logout(sessionID int64, meta models.RequestMeta) error {
+	if err := s.repos.RevokeAdminSession(sessionID); err != nil {
+		return err
+	}
+	s.audit.record(meta, models.AuditAdminLogout, "admin_session:"+strconv.FormatInt(sessionID, 10), nil, nil)
+	return nil
+}
+
+// ValidateAdminToken возвращает админа по токену сессии. Отозванная, истекшая сессия
+// или заблокированный админ — ErrSessionRevoked.
+func (s *AdminService) ValidateAdminToken(token string) (models.AdminUser, int64, error) {
+	session, err := s.repos.GetAdminSessionByHash(hashToken(token))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.AdminUser{}, 0, ErrInvalidToken
+		}
+		return models.AdminUser{}, 0, err
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return models.AdminUser{}, 0, ErrSessionRevoked
+	}
+	admin, err := s.repos.GetAdmin(session.AdminID)
+	if err != nil {
+		return admin, 0, err
+	}
+	if admin.Disabled {
+		return models.AdminUser{}, 0, ErrSessionRevoked
+	}
+	return admin, session.ID, nil
+}
+
+// CreateAdmin заводит админа с ролью role. Пароль не короче minAdminPasswordLength символов.
+func (s *AdminService) CreateAdmin(username, password, role string, meta models.RequestMeta) (models.AdminUser, error) {
+	username = strings.TrimSpace(username)
+	if username == "" || len(username) > 100 || strings.ContainsAny(username, ": ") {
+		return models.AdminUser{}, fmt.Errorf("%w: username must be 1-100 characters without spaces and ':'", ErrInvalidAdminInput)
+	}
+	if !models.ValidAdminRole(role) {
+		return models.AdminUser{}, ErrInvalidAdminRole
+	}
+	hash, err := hashAdminPassword(password)
+	if err != nil {
+		return models.AdminUser{}, err
+	}
+	admin, err := s.repos.CreateAdmin(models.AdminUser{Username: username, PasswordHash: hash, Role: role})
+	if errors.Is(err, repository.ErrAdminExists) {
+		return admin, ErrAdminExists
+	}
+	if err != nil {
+		return admin, err
+	}
+	s.audit.record(meta, models.AuditAdminCreate, adminTarget(admin.ID), nil, admin)
+	return admin, nil
+}
+
+func (s *AdminService) GetAdmins() ([]models.AdminUser, error) {
+	return s.repos.GetAdmins()
+}
+
+// UpdateAdmin меняет роль или блокирует админа; при блокировке его сессии отзываются.
+// Свою роль и блокировку менять нельзя, чтобы не остаться без суперадмина.
+func (s *AdminService) UpdateAdmin(actorID int64, id int64, input models.AdminUpdateInput, meta models.RequestMeta) (models.AdminUser, error) {
+	admin, err := s.repos.GetAdmin(id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return admin, ErrAdminNotFound
+		}
+		return admin, err
+	}
+	role, disabled := admin.Role, admin.Disabled
+	if input.Role != nil {
+		role = *input.Role
+	}
+	if input.Disabled != nil {
+		disabled = *input.Disabled
+	}
+	if !models.ValidAdminRole(role) {
+		return admin, ErrInvalidAdminRole
+	}
+	if actorID == id && (role != admin.Role || disabled != admin.Disabled) {
+		return admin, ErrAdminSelfUpdate
+	}
+	updated, err := s.repos.UpdateAdmin(id, role, disabled)
+	if err != nil {
+		return updated, err
+	}
+	s.audit.record(meta, models.AuditAdminUpdate, adminTarget(id), admin, updated)
+	return updated, nil
+}
+
+func (s *AdminService) SetAdminPassword(id int64, password string, meta models.RequestMeta) error {
+	hash, err := hashAdminPassword(password)
+	if err != nil {
+		return err
+	}
+	err = s.repos.SetAdminPassword(id, hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrAdminNotFound
+	}
+	if err != nil {
+		return err
+	}
+	s.audit.record(meta, models.AuditAdminPassword, adminTarget(id), nil, nil)
+	return nil
+}
+
+func adminTarget(id int64) string {
+	return "admin:" + strconv.FormatInt(id, 10)
+}
+
+func hashAdminPassword(password string) (string, error) {
+	// bcrypt учитывает только первые 72 байта
+	if len(password) < minAdminPasswordLength || len(password) > 72 {
+		return "", fmt.Errorf("%w: password must be %d-72 characters", ErrInvalidAdminInput, minAdminPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
@@ -0,0 +1,50 @@
+package service
+
+import (
+	"production_wallet_back/pkg/utils"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// AlertConfig предупреждения операторам из секции alerts конфига. Токен бота — из окружения.
+type AlertConfig struct {
+	ChatID   int64         // чат Telegram для предупреждений, 0 — только в лог
+	Interval time.Duration // одно и то же предупреждение не чаще раза в этот интервал
+	BotToken string
+}
+
+// alerter пишет предупреждения о деньгах, которые требуют внимания человека: низкий остаток
+// плательщика газа, зависшие и неуспешные выводы и расчёты
+type alerter struct {
+	cfg AlertConfig
+
+	mu   sync.Mutex
+	last map[string]time.Time
+}
+
+func newAlerter(cfg AlertConfig) *alerter {
+	return &alerter{cfg: cfg, last: make(map[string]time.Time)}
+}
+
+// alert пишет предупреждение в лог и в Telegram. Предупреждения с одним key отправляются
+// не чаще раза в Interval, остальные только логируются.
+func (a *alerter) alert(key, text string) {
+	a.mu.Lock()
+	if time.Since(a.last[key]) < a.cfg.Interval {
+		a.mu.Unlock()
+		logrus.Warn(text)
+		return
+	}
+	a.last[key] = time.Now()
+	a.mu.Unlock()
+
+	logrus.Warn(text)
+	if a.cfg.BotToken == "" || a.cfg.ChatID == 0 {
+		return
+	}
+	if err := utils.SendTelegramMessage(a.cfg.BotToken, a.cfg.ChatID, text); err != nil {
+		logrus.Errorf("alert: failed to send %s: %s", key, err)
+	}
+}
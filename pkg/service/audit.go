@@ -0,0 +1,104 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/audit"
+	"production_wallet_back/pkg/repository"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrInvalidAuditFilter = errors.New("invalid audit filter")
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+	auditVerifyBatch  = 1000
+)
+
+type AuditService struct {
+	repos repository.Audit
+}
+
+func NewAuditService(repos repository.Audit) *AuditService {
+	return &AuditService{repos: repos}
+}
+
+// GetEntries записи журнала по фильтру, новые первыми. Limit — от 1 до maxAuditLimit, 0 — defaultAuditLimit.
+func (s *AuditService) GetEntries(filter models.AuditFilter) ([]models.AuditEntry, error) {
+	if filter.Limit == 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit < 0 || filter.Limit > maxAuditLimit {
+		return nil, ErrInvalidAuditFilter
+	}
+	return s.repos.GetAuditEntries(filter)
+}
+
+// Verify проходит всю цепочку от первой записи и возвращает первую запись, на которой она сломана
+func (s *AuditService) Verify() (models.AuditVerification, error) {
+	verifier := audit.NewVerifier()
+	var afterID int64
+	for {
+		entries, err := s.repos.GetAuditChain(afterID, auditVerifyBatch)
+		if err != nil {
+			return verifier.Result(), err
+		}
+		if !verifier.Add(entries) || len(entries) < auditVerifyBatch {
+			return verifier.Result(), nil
+		}
+		afterID = entries[len(entries)-1].ID
+	}
+}
+
+// auditLog пишет в журнал действия сервисов: кто (meta.Actor), что, над чем и снимки до и после
+type auditLog struct {
+	repos repository.Audit
+}
+
+// record дописывает запись в журнал отдельной транзакцией. Ошибка логируется и возвращается:
+// действия, которые нельзя выполнить без следа (экспорт ключа), по ней отменяются.
+// Движения денег пишут запись в своей транзакции через auditEntry или auditSnapshot.
+func (a auditLog) record(meta models.RequestMeta, action, target string, before, after interface{}) error {
+	entry, err := auditSnapshot(meta, action, target, before, after)
+	if err == nil {
+		_, err = a.repos.AppendAudit(entry)
+	}
+	if err != nil {
+		logrus.Errorf("audit: failed to record %s %s by %s: %s", action, target, entry.Actor, err)
+	}
+	return err
+}
+
+// auditEntry запись журнала без снимков: их снимает репозиторий в транзакции, которая двигает
+// деньги, и пишет запись в ней же
+func auditEntry(meta models.RequestMeta, action, target string) (models.AuditEntry, error) {
+	entry := models.AuditEntry{
+		Actor:  meta.Actor,
+		Action: action,
+		Target: target,
+	}
+	if entry.Actor == "" {
+		entry.Actor = models.ActorSystem
+	}
+	var err error
+	if meta != (models.RequestMeta{Actor: meta.Actor}) {
+		entry.Metadata, err = json.Marshal(meta)
+	}
+	return entry, err
+}
+
+// auditSnapshot запись журнала со снимками, которые известны сервису заранее: её передают
+// в репозиторий, и он пишет её в транзакции вместе с сохранением состояния
+func auditSnapshot(meta models.RequestMeta, action, target string, before, after interface{}) (models.AuditEntry, error) {
+	entry, err := auditEntry(meta, action, target)
+	if err == nil && before != nil {
+		entry.Before, err = json.Marshal(before)
+	}
+	if err == nil && after != nil {
+		entry.After, err = json.Marshal(after)
+	}
+	return entry, err
+}
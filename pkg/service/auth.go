@@ -1,17 +1,63 @@
 package service
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"production_wallet_back/models"
 	"production_wallet_back/pkg/repository"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrInvalidToken   = errors.New("invalid token")
+	ErrSessionRevoked = errors.New("session revoked or expired")
+	// ErrWeakSecret секретом подписывается HMAC: пустой или короткий позволяет подделать подпись
+	ErrWeakSecret = errors.New("signing secret is too short")
 )
 
+// minSecretLength минимальная длина секретов подписи токенов и котировок, байт
+const minSecretLength = 32
+
+func checkSecret(secret string) error {
+	if len(secret) < minSecretLength {
+		return fmt.Errorf("%w: need at least %d bytes, got %d", ErrWeakSecret, minSecretLength, len(secret))
+	}
+	return nil
+}
+
+type AuthConfig struct {
+	TokenSecret string
+	AccessTTL   time.Duration
+	RefreshTTL  time.Duration
+}
+
 type AuthService struct {
 	repos repository.Authorization
+	cfg   AuthConfig
+}
+
+// accessClaims содержимое access-токена: subject — telegram_id, sid — id сессии
+type accessClaims struct {
+	SessionID int64 `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// Validate проверяет секрет подписи access-токенов
+func (c AuthConfig) Validate() error {
+	return checkSecret(c.TokenSecret)
 }
 
-func NewAuthService(repos repository.Authorization) *AuthService {
+func NewAuthService(repos repository.Authorization, cfg AuthConfig) *AuthService {
 	return &AuthService{
 		repos: repos,
+		cfg:   cfg,
 	}
 }
 
@@ -21,3 +67,141 @@ func (s *AuthService) CreateUser(user models.User) (int64, error) {
 func (s *AuthService) GetUserByTelegramId(telegramId int64) (models.User, error) {
 	return s.repos.GetUserByTelegramId(telegramId)
 }
+
+// Login находит или создаёт пользователя и открывает для него новую сессию
+func (s *AuthService) Login(input models.User, userAgent string) (models.User, models.TokenPair, error) {
+	user, err := s.repos.GetUserByTelegramId(input.TelegramID)
+	if errors.Is(err, sql.ErrNoRows) {
+		input.ID, err = s.repos.CreateUser(input)
+		user = input
+	}
+	if err != nil {
+		return models.User{}, models.TokenPair{}, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return models.User{}, models.TokenPair{}, err
+	}
+	sessionID, err := s.repos.CreateSession(models.Session{
+		TelegramID:       user.TelegramID,
+		RefreshTokenHash: hashToken(refreshToken),
+		UserAgent:        userAgent,
+		ExpiresAt:        time.Now().Add(s.cfg.RefreshTTL),
+	})
+	if err != nil {
+		return models.User{}, models.TokenPair{}, err
+	}
+
+	tokens, err := s.issueAccessToken(user.TelegramID, sessionID)
+	if err != nil {
+		return models.User{}, models.TokenPair{}, err
+	}
+	tokens.RefreshToken = refreshToken
+	return user, tokens, nil
+}
+
+// Refresh выдаёт новую пару токенов; старый refresh-токен после этого недействителен
+func (s *AuthService) Refresh(refreshToken string) (models.TokenPair, error) {
+	oldHash := hashToken(refreshToken)
+	session, err := s.repos.GetSessionByRefreshHash(oldHash)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TokenPair{}, ErrInvalidToken
+		}
+		return models.TokenPair{}, err
+	}
+	if session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return models.TokenPair{}, ErrSessionRevoked
+	}
+
+	newToken, err := newRefreshToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	err = s.repos.RotateSessionRefresh(session.ID, oldHash, hashToken(newToken), time.Now().Add(s.cfg.RefreshTTL))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return models.TokenPair{}, ErrSessionRevoked
+		}
+		return models.TokenPair{}, err
+	}
+
+	tokens, err := s.issueAccessToken(session.TelegramID, session.ID)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	tokens.RefreshToken = newToken
+	return tokens, nil
+}
+
+func (s *AuthService) Logout(sessionID int64) error {
+	return s.repos.RevokeSession(sessionID)
+}
+
+// LogoutAll завершает все сессии пользователя, например при потере телефона
+func (s *AuthService) LogoutAll(telegramID int64) error {
+	return s.repos.RevokeUserSessions(telegramID)
+}
+
+// ValidateAccessToken проверяет подпись и срок access-токена и что его сессия не отозвана
+func (s *AuthService) ValidateAccessToken(token string) (int64, int64, error) {
+	var claims accessClaims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return []byte(s.cfg.TokenSecret), nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return 0, 0, ErrInvalidToken
+	}
+
+	telegramID, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, 0, ErrInvalidToken
+	}
+
+	session, err := s.repos.GetSession(claims.SessionID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, 0, ErrSessionRevoked
+		}
+		return 0, 0, err
+	}
+	if session.TelegramID != telegramID || session.RevokedAt != nil || time.Now().After(session.ExpiresAt) {
+		return 0, 0, ErrSessionRevoked
+	}
+	return telegramID, session.ID, nil
+}
+
+func (s *AuthService) issueAccessToken(telegramID int64, sessionID int64) (models.TokenPair, error) {
+	expiresAt := time.Now().Add(s.cfg.AccessTTL)
+	claims := accessClaims{
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Subject:   strconv.FormatInt(telegramID, 10),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(s.cfg.TokenSecret))
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+	return models.TokenPair{
+		AccessToken:     signed,
+		AccessExpiresAt: expiresAt,
+	}, nil
+}
+
+func newRefreshToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// hashToken в базе хранится только sha256 от refresh-токена
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/tronclient"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrFeePayerNotConfigured = errors.New("fee-payer wallet is not configured")
+	ErrFeePayerLowBalance    = errors.New("fee-payer wallet balance is too low")
+	ErrGasTopUpPending       = errors.New("gas top-up to this address is already pending")
+
+	// errGasTopUpFailed перевод TRX попал в блок, но не выполнился: газ нужно докидывать заново
+	errGasTopUpFailed = errors.New("gas top-up failed on chain")
+)
+
+// pendingGasBatch сколько переводов газа в пути Run проверяет за проход
+const pendingGasBatch = 100
+
+// GasConfig настройки кошелька-плательщика газа из секции gas конфига. Ключ — из окружения.
+type GasConfig struct {
+	FeePayerKey    string        // приватный ключ кошелька, с которого докидывается TRX
+	LowBalance     money.Amount  // ниже этого остатка TRX уходит предупреждение
+	CheckInterval  time.Duration // как часто проверять остаток плательщика
+	ConfirmTimeout time.Duration // сколько /send-trx-for-gas ждёт подтверждения перевода
+	PollInterval   time.Duration // интервал опроса сети при ожидании
+}
+
+// GasManager докидывает с кошелька-плательщика ровно недостающий TRX на кошельки
+// пользователей, ждёт подтверждения и записывает потраченное в журнал как комиссию
+type GasManager struct {
+	chain   tronclient.Chain
+	ledger  repository.Ledger
+	topUps  repository.Gas
+	cfg     GasConfig
+	address string
+	alerts  *alerter
+}
+
+func NewGasManager(repos *repository.Repository, chain tronclient.Chain, alerts *alerter, cfg GasConfig) *GasManager {
+	g := &GasManager{
+		chain:  chain,
+		ledger: repos.Ledger,
+		topUps: repos.Gas,
+		cfg:    cfg,
+		alerts: alerts,
+	}
+	if cfg.FeePayerKey != "" {
+		address, err := tronclient.AddressFromPrivateKey(cfg.FeePayerKey)
+		if err != nil {
+			logrus.Errorf("Ключ плательщика газа не разобран: %s", err)
+		}
+		g.address = address
+	}
+	return g
+}
+
+// Run раз в CheckInterval проверяет остаток плательщика, а раз в PollInterval доводит
+// переводы газа в пути: подтверждает их или закрывает истёкшие. Останавливается по ctx.
+func (g *GasManager) Run(ctx context.Context) {
+	if g.address == "" {
+		logrus.Warn("Кошелёк-плательщик газа не настроен, TRX на переводы не докидывается")
+		return
+	}
+	logrus.Infof("Плательщик газа %s", g.address)
+	var lastCheck time.Time
+	for {
+		if time.Since(lastCheck) >= g.cfg.CheckInterval {
+			lastCheck = time.Now()
+			if _, err := g.checkBalance(); err != nil {
+				logrus.Errorf("gas: failed to check fee-payer balance: %s", err)
+			}
+		}
+		if err := g.confirmPending(); err != nil {
+			logrus.Errorf("gas: failed to confirm pending top-ups: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(g.cfg.PollInterval):
+		}
+	}
+}
+
+// confirmPending проверяет переводы газа в пути. Перевод, которого нет в сети и после
+// истечения, закрывается как expired, и адрес снова можно пополнять.
+func (g *GasManager) confirmPending() error {
+	topUps, err := g.topUps.GetPendingGasTopUps(pendingGasBatch)
+	if err != nil {
+		return err
+	}
+	for _, topUp := range topUps {
+		confirmed, err := g.Confirm(topUp.TxID, topUp.Amount, topUp.Description)
+		if errors.Is(err, errGasTopUpFailed) {
+			logrus.Warnf("gas: %s", err)
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !confirmed && time.Now().After(topUp.ExpiresAt) {
+			logrus.Warnf("gas: top-up %s to %s expired before reaching a block", topUp.TxID, topUp.Address)
+			if err := g.topUps.FinishGasTopUp(topUp.TxID, models.TxExpired); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Status остаток плательщика газа для админки
+func (g *GasManager) Status() (models.GasStatus, error) {
+	if g.address == "" {
+		return models.GasStatus{}, ErrFeePayerNotConfigured
+	}
+	balance, err := g.chain.GetTRXBalance(g.address)
+	if err != nil {
+		return models.GasStatus{}, err
+	}
+	return models.GasStatus{
+		Address:    g.address,
+		BalanceTRX: balance,
+		LowBalance: g.cfg.LowBalance,
+		Low:        balance < g.cfg.LowBalance,
+	}, nil
+}
+
+// Need возвращает TRX на address и сколько TRX нужно для перевода amount USDT на toAddress
+func (g *GasManager) Need(address string, toAddress string, amount money.Amount) (balance money.Amount, required money.Amount, err error) {
+	balance, err = g.chain.GetTRXBalance(address)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to check TRX balance: %v", err)
+	}
+	required, err = g.chain.EstimateRequiredTRX(address, toAddress, amount)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to estimate required TRX: %v", err)
+	}
+	return balance, required, nil
+}
+
+// SignTopUp подписывает перевод missing TRX с плательщика на address и записывает его в пути.
+// Подписанная транзакция возвращается вместе с JSON для сохранения до отправки. Если на address
+// уже идёт другой перевод газа, новый не подписывается — ErrGasTopUpPending. audit, если передан,
+// пишется вместе с записью о переводе; переводы под вывод и расчёт аудируются их итогом.
+func (g *GasManager) SignTopUp(address string, missing money.Amount, description string, audit *models.AuditEntry) (tronclient.SignedTx, string, error) {
+	if g.address == "" {
+		return tronclient.SignedTx{}, "", ErrFeePayerNotConfigured
+	}
+	balance, err := g.checkBalance()
+	if err != nil {
+		return tronclient.SignedTx{}, "", fmt.Errorf("failed to check fee-payer balance: %v", err)
+	}
+	if balance < missing {
+		return tronclient.SignedTx{}, "", fmt.Errorf("%w: have %s TRX, need %s", ErrFeePayerLowBalance, balance, missing)
+	}
+
+	signed, err := g.chain.SignTRXTransfer(g.cfg.FeePayerKey, address, missing)
+	if err != nil {
+		return signed, "", fmt.Errorf("failed to sign TRX for gas: %v", err)
+	}
+	raw, err := json.Marshal(signed.Raw)
+	if err != nil {
+		return signed, "", err
+	}
+	err = g.topUps.ReserveGasTopUp(models.GasTopUpTx{
+		TxID:        signed.TxID,
+		Address:     address,
+		Amount:      missing,
+		Description: description,
+		ExpiresAt:   signed.Expiration.Add(expiredTxGrace),
+	}, audit)
+	if errors.Is(err, repository.ErrGasTopUpPending) {
+		return tronclient.SignedTx{}, "", fmt.Errorf("%w: %s", ErrGasTopUpPending, address)
+	}
+	if err != nil {
+		return tronclient.SignedTx{}, "", fmt.Errorf("failed to reserve gas top-up: %v", err)
+	}
+	return signed, string(raw), nil
+}
+
+// Confirm проверяет перевод газа txID. Когда он выполнен, отправленное и сжёгшееся на сам
+// перевод записываются в комиссии; проводка идемпотентна, повторный вызов журнал не меняет.
+// Перевод, не выполнившийся в блоке, — errGasTopUpFailed.
+func (g *GasManager) Confirm(txID string, amount money.Amount, description string) (bool, error) {
+	info, err := g.chain.GetTransactionInfo(txID)
+	if err != nil {
+		return false, err
+	}
+	if !info.Found {
+		return false, nil
+	}
+	if !info.Succeeded() {
+		if err := g.topUps.FinishGasTopUp(txID, models.TxFailed); err != nil {
+			logrus.Errorf("gas: failed to close top-up %s: %s", txID, err)
+		}
+		return false, fmt.Errorf("%w: %s %s %s", errGasTopUpFailed, txID, info.Result, info.Message)
+	}
+
+	spent := amount + money.FromUnits(info.Fee)
+	_, err = g.ledger.Post(models.LedgerEntry{
+		Kind:        models.EntryGasTopUp,
+		Reference:   "gas:" + txID,
+		Description: description,
+		Postings: []models.Posting{
+			{Account: models.AccountHotWallet, TokenSymbol: "TRX", Amount: -spent},
+			{Account: models.AccountFees, TokenSymbol: "TRX", Amount: spent},
+		},
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to post gas top-up %s to ledger: %v", txID, err)
+	}
+	if err := g.topUps.FinishGasTopUp(txID, models.TxConfirmed); err != nil {
+		return false, fmt.Errorf("failed to close gas top-up %s: %v", txID, err)
+	}
+	if _, err := g.checkBalance(); err != nil {
+		logrus.Errorf("gas: failed to check fee-payer balance: %s", err)
+	}
+	return true, nil
+}
+
+// TopUp докидывает недостающий TRX на address под перевод amount USDT на toAddress и ждёт
+// подтверждения до ConfirmTimeout или отмены ctx. Если не дождался, GasTopUp возвращается
+// с Confirmed = false, а перевод подтверждает Run.
+func (g *GasManager) TopUp(ctx context.Context, address string, toAddress string, amount money.Amount, description string, audit *models.AuditEntry) (models.GasTopUp, error) {
+	gas := models.GasTopUp{Address: address}
+	var err error
+	gas.BalanceTRX, gas.RequiredTRX, err = g.Need(address, toAddress, amount)
+	if err != nil {
+		return gas, err
+	}
+	if gas.BalanceTRX >= gas.RequiredTRX {
+		gas.Confirmed = true
+		return gas, nil
+	}
+
+	gas.AddedTRX = gas.RequiredTRX - gas.BalanceTRX
+	logrus.Infof("TRX insufficient on %s: have %s, need %s. Adding %s TRX", address, gas.BalanceTRX, gas.RequiredTRX, gas.AddedTRX)
+	signed, raw, err := g.SignTopUp(address, gas.AddedTRX, description, audit)
+	if err != nil {
+		return gas, err
+	}
+	gas.TxID = signed.TxID
+	if _, err := broadcastStored(g.chain, raw); err != nil {
+		return gas, fmt.Errorf("failed to send TRX for gas: %v", err)
+	}
+
+	gas.Confirmed, err = g.wait(ctx, gas.TxID, gas.AddedTRX, description, time.Now().Add(g.cfg.ConfirmTimeout))
+	return gas, err
+}
+
+// wait опрашивает перевод газа до подтверждения, deadline или отмены ctx. Если к deadline
+// перевод не подтвердился, возвращается последняя ошибка проверки.
+func (g *GasManager) wait(ctx context.Context, txID string, amount money.Amount, description string, deadline time.Time) (bool, error) {
+	for {
+		confirmed, err := g.Confirm(txID, amount, description)
+		if errors.Is(err, errGasTopUpFailed) {
+			return false, err
+		}
+		if err != nil {
+			logrus.Warnf("gas: top-up %s: %s", txID, err)
+		}
+		if confirmed || time.Now().After(deadline) {
+			return confirmed, err
+		}
+		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
+		case <-time.After(g.cfg.PollInterval):
+		}
+	}
+}
+
+// checkBalance возвращает остаток плательщика и предупреждает, если он ниже LowBalance
+func (g *GasManager) checkBalance() (money.Amount, error) {
+	balance, err := g.chain.GetTRXBalance(g.address)
+	if err != nil {
+		return 0, err
+	}
+	if balance < g.cfg.LowBalance {
+		g.alerts.alert("gas:low_balance", fmt.Sprintf("⚠️ На кошельке-плательщике газа %s осталось %s TRX (порог %s)", g.address, balance, g.cfg.LowBalance))
+	}
+	return balance, nil
+}
+
+// TopUpGas докидывает с плательщика недостающий TRX на кошелёк пользователя под будущий
+// перевод amount USDT на toAddress и ждёт подтверждения
+func (s *WalletService) TopUpGas(ctx context.Context, telegramId int64, toAddress string, amount money.Amount, meta models.RequestMeta) (models.GasTopUp, error) {
+	if err := amount.Validate(); err != nil {
+		return models.GasTopUp{}, fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	wallet, err := s.repos.GetWallet(telegramId)
+	if err != nil {
+		return models.GasTopUp{}, err
+	}
+
+	// Запись аудита ложится вместе с записью о переводе до его отправки: не легла — TRX не уходит
+	entry, err := auditEntry(meta, models.AuditGasTopUp, walletTarget(wallet.WalletID))
+	if err != nil {
+		return models.GasTopUp{}, err
+	}
+	return s.gas.TopUp(ctx, wallet.Address, toAddress, amount, "gas top-up for "+wallet.Address, &entry)
+}
@@ -0,0 +1,55 @@
+package service
+
+import (
+	"context"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/repository"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// IdempotencyConfig настройки ключей идемпотентности из секции idempotency конфига
+type IdempotencyConfig struct {
+	LockTTL         time.Duration // через сколько незавершённый запрос с ключом можно повторить
+	Retention       time.Duration // сколько хранится ответ
+	CleanupInterval time.Duration
+}
+
+type IdempotencyService struct {
+	repos repository.Idempotency
+	cfg   IdempotencyConfig
+}
+
+func NewIdempotencyService(repos repository.Idempotency, cfg IdempotencyConfig) *IdempotencyService {
+	return &IdempotencyService{repos: repos, cfg: cfg}
+}
+
+func (s *IdempotencyService) StartRequest(key models.IdempotencyKey) (models.IdempotencyKey, bool, error) {
+	return s.repos.StartIdempotentRequest(key, s.cfg.LockTTL)
+}
+
+func (s *IdempotencyService) CompleteRequest(id int64, statusCode int, contentType string, body []byte) error {
+	return s.repos.CompleteIdempotentRequest(id, statusCode, contentType, body)
+}
+
+func (s *IdempotencyService) ReleaseRequest(id int64) error {
+	return s.repos.ReleaseIdempotentRequest(id)
+}
+
+// Run удаляет ключи старше Retention. Останавливается по ctx.
+func (s *IdempotencyService) Run(ctx context.Context) {
+	for {
+		deleted, err := s.repos.DeleteIdempotencyKeys(time.Now().Add(-s.cfg.Retention))
+		if err != nil {
+			logrus.Errorf("idempotency cleanup: %s", err)
+		} else if deleted > 0 {
+			logrus.Infof("Удалено ключей идемпотентности: %d", deleted)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.cfg.CleanupInterval):
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package service
+
+import (
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/repository"
+
+	"github.com/sirupsen/logrus"
+)
+
+type LedgerService struct {
+	repos repository.Ledger
+}
+
+func NewLedgerService(repos repository.Ledger) *LedgerService {
+	return &LedgerService{repos: repos}
+}
+
+func (s *LedgerService) GetAccounts() ([]models.LedgerAccount, error) {
+	return s.repos.GetAccounts()
+}
+
+func (s *LedgerService) GetWalletStatement(walletID int64, limit int) ([]models.LedgerLine, error) {
+	return s.repos.GetWalletLines(walletID, limit)
+}
+
+// Reconcile сверяет balances с журналом. Любое расхождение — ошибка: balances меняется только проводками.
+func (s *LedgerService) Reconcile() ([]models.BalanceMismatch, error) {
+	mismatches, err := s.repos.Reconcile()
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range mismatches {
+		logrus.Warnf("Баланс кошелька %d %s расходится с журналом: %s в balances, %s в журнале",
+			m.WalletID, m.TokenSymbol, m.Balance, m.LedgerBalance)
+	}
+	return mismatches, nil
+}
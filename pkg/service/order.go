@@ -0,0 +1,444 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/sbpqr"
+	"production_wallet_back/pkg/tronclient"
+	"production_wallet_back/pkg/utils"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrOrderNotFound     = errors.New("order not found")
+	ErrInvalidTransition = errors.New("order state transition is not allowed")
+	ErrInvalidOrderTTL   = errors.New("invalid order ttl")
+	ErrInvalidOrderState = errors.New("unknown order state")
+	ErrInvalidQR         = errors.New("invalid SBP QR")
+	ErrOrderClaimed      = errors.New("order is claimed by another operator")
+	ErrBankReference     = errors.New("bank reference is required")
+	ErrNoReceipt         = errors.New("order has no receipt")
+	ErrRefundSettled     = errors.New("order funds are already being settled to treasury, refund them on chain")
+)
+
+// OrderConfig настройки заказов из секции orders конфига
+type OrderConfig struct {
+	TTL           time.Duration // срок жизни заказа, если клиент не передал свой
+	MaxTTL        time.Duration
+	SweepInterval time.Duration // как часто просроченные заказы переводятся в expired
+	BatchSize     int
+	ClaimLease    time.Duration // на сколько оператор берёт заказ в работу
+	BotToken      string        // бот для уведомлений пользователям, из окружения
+}
+
+// orderTransitions допустимые переходы заказа. paid можно только вернуть,
+// expired, cancelled и refunded — конечные состояния.
+var orderTransitions = map[string][]string{
+	models.OrderCreated:          {models.OrderAwaitingOperator, models.OrderCancelled, models.OrderExpired},
+	models.OrderAwaitingOperator: {models.OrderPaid, models.OrderCancelled, models.OrderExpired},
+	models.OrderPaid:             {models.OrderRefunded},
+}
+
+// activeOrderStates заказы, которые ещё ждут оператора
+var activeOrderStates = []string{models.OrderCreated, models.OrderAwaitingOperator}
+
+type OrderService struct {
+	repos     repository.Order
+	wallets   repository.Wallet
+	quoteRepo repository.Quote
+	chain     tronclient.Chain
+	cfg       OrderConfig
+	quotes    QuoteConfig
+}
+
+func NewOrderService(repos *repository.Repository, chain tronclient.Chain, cfg OrderConfig, quotes QuoteConfig) *OrderService {
+	return &OrderService{
+		repos:     repos.Orders,
+		wallets:   repos.Wallet,
+		quoteRepo: repos.Quotes,
+		chain:     chain,
+		cfg:       cfg,
+		quotes:    quotes,
+	}
+}
+
+// UserActor инициатор перехода — пользователь с telegram_id
+func UserActor(telegramId int64) string {
+	return "user:" + strconv.FormatInt(telegramId, 10)
+}
+
+// OperatorActor инициатор действия — оператор с именем name
+func OperatorActor(name string) string {
+	return "operator:" + name
+}
+
+// CreateOrder создаёт заказ от имени пользователя по котировке quoteID: Summa и Crypto берутся
+// из неё, а не от клиента. QRCode должен быть QR СБП, сумма в нём — совпадать с котировкой.
+// Сумма Crypto удерживается с доступного остатка кошелька, если его не хватает —
+// ErrInsufficientFunds. ttl — срок жизни QR, 0 — TTL из конфига.
+func (s *OrderService) CreateOrder(qr models.OrderQR, quoteID string, ttl time.Duration, meta models.RequestMeta) (models.OrderQR, error) {
+	quote, err := s.quoteRepo.GetQuote(quoteID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.OrderQR{}, ErrQuoteNotFound
+	}
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	if err := checkQuote(s.quotes.Secret, quote, qr.TelegramId); err != nil {
+		return models.OrderQR{}, err
+	}
+	if quote.FromCurrency != "RUB" || quote.ToCurrency != "USDT" {
+		return models.OrderQR{}, fmt.Errorf("%w: order needs a RUB -> USDT quote", ErrQuoteInvalid)
+	}
+	qr.QuoteID = &quote.ID
+	qr.Summa = quote.Amount.Float64()
+	qr.Crypto = quote.Converted
+
+	payment, err := sbpqr.Parse(qr.QRCode)
+	if err != nil {
+		return models.OrderQR{}, fmt.Errorf("%w: %v", ErrInvalidQR, err)
+	}
+	if payment.Amount != 0 && payment.Amount != quote.Amount {
+		return models.OrderQR{}, fmt.Errorf("%w: QR amount %s RUB does not match quote amount %s RUB", ErrInvalidQR, payment.Amount, quote.Amount)
+	}
+	qr.QRData = &payment
+
+	if err := qr.Crypto.Validate(); err != nil {
+		return models.OrderQR{}, fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	if ttl == 0 {
+		ttl = s.cfg.TTL
+	}
+	if ttl <= 0 || ttl > s.cfg.MaxTTL {
+		return models.OrderQR{}, fmt.Errorf("%w: must be between 1s and %s", ErrInvalidOrderTTL, s.cfg.MaxTTL)
+	}
+	qr.ExpiresAt = time.Now().Add(ttl)
+	wallet, err := s.wallets.GetWallet(qr.TelegramId)
+	if err != nil {
+		return models.OrderQR{}, ErrWalletNotFound
+	}
+	balance, err := s.chain.GetUSDTBalance(wallet.Address)
+	if err != nil {
+		return models.OrderQR{}, fmt.Errorf("failed to get real balance: %v", err)
+	}
+
+	entry, err := auditEntry(meta, models.AuditOrderCreate, "")
+	if err != nil {
+		return models.OrderQR{}, err
+	}
+	order, err := s.repos.CreateOrder(qr, wallet.WalletID, balance, UserActor(qr.TelegramId), entry)
+	if errors.Is(err, repository.ErrInsufficientBalance) {
+		return order, fmt.Errorf("%w: %v", ErrInsufficientFunds, err)
+	}
+	if errors.Is(err, repository.ErrQuoteUnavailable) {
+		return order, ErrQuoteUsed
+	}
+	if err != nil {
+		return order, err
+	}
+	logrus.Infof("Заказ %d: %v RUB / %s USDT от %d", order.Id, order.Summa, order.Crypto, order.TelegramId)
+	go s.notifyOperators(order)
+	return order, nil
+}
+
+// notifyOperators сообщает операторам о новом заказе. Заказ уже в очереди, ошибки
+// отправки на его состояние не влияют.
+func (s *OrderService) notifyOperators(order models.OrderQR) {
+	logrus.Println("Отправка уведомления на почту")
+	utils.SendMailMailjet(order.TelegramId, order.QRCode, order.Summa, order.Crypto.Float64())
+	utils.SendMail(order.TelegramId, order.QRCode, order.Summa, order.Crypto.Float64())
+}
+
+// GetOrderState заказ пользователя с историей переходов. Чужой заказ — ErrOrderNotFound.
+func (s *OrderService) GetOrderState(telegramId int64, orderId int64) (models.OrderState, error) {
+	state, err := s.getOrderState(orderId)
+	if err != nil {
+		return state, err
+	}
+	if state.TelegramId != telegramId {
+		return models.OrderState{}, ErrOrderNotFound
+	}
+	// Кто из операторов работает с заказом, пользователю не показывается
+	state.ClaimedBy, state.ClaimExpiresAt, state.Actions = nil, nil, []models.OrderAction{}
+	return state, nil
+}
+
+// GetOrders заказы в состояниях states, по умолчанию — ожидающие оператора
+func (s *OrderService) GetOrders(states []string) ([]models.OrderQR, error) {
+	if len(states) == 0 {
+		states = activeOrderStates
+	}
+	for _, state := range states {
+		if !isOrderState(state) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidOrderState, state)
+		}
+	}
+	return s.repos.GetOrdersByStates(states)
+}
+
+// GetOrder заказ с удержанием, историей переходов и действиями операторов для админки
+func (s *OrderService) GetOrder(orderId int64) (models.OrderState, error) {
+	return s.getOrderState(orderId)
+}
+
+// ClaimOrder берёт заказ в работу оператору на ClaimLease. Пока аренда действует, другие
+// операторы его не возьмут и не оплатят.
+func (s *OrderService) ClaimOrder(orderId int64, operator string, meta models.RequestMeta) (models.OrderState, error) {
+	order, err := s.getOrder(orderId)
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	if order.State != models.OrderAwaitingOperator {
+		return models.OrderState{}, fmt.Errorf("%w: order is %s", ErrInvalidTransition, order.State)
+	}
+	if time.Now().After(order.ExpiresAt) {
+		return models.OrderState{}, fmt.Errorf("%w: order %d expired", ErrInvalidTransition, order.Id)
+	}
+	actor := OperatorActor(operator)
+	entry, err := auditEntry(meta, models.AuditOrderClaim, orderTarget(orderId))
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	_, err = s.repos.ClaimOrder(orderId, actor, s.cfg.ClaimLease, entry)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrderClaimed) {
+			return models.OrderState{}, fmt.Errorf("%w: %s", ErrOrderClaimed, claimedBy(order))
+		}
+		return models.OrderState{}, err
+	}
+	logrus.Infof("Заказ %d взят в работу: %s", orderId, actor)
+	return s.getOrderState(orderId)
+}
+
+// ReleaseOrder возвращает взятый оператором заказ в общую очередь
+func (s *OrderService) ReleaseOrder(orderId int64, operator string, meta models.RequestMeta) (models.OrderState, error) {
+	if _, err := s.getOrder(orderId); err != nil {
+		return models.OrderState{}, err
+	}
+	entry, err := auditEntry(meta, models.AuditOrderRelease, orderTarget(orderId))
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	_, err = s.repos.ReleaseOrder(orderId, OperatorActor(operator), entry)
+	if err != nil {
+		if errors.Is(err, repository.ErrOrderClaimed) {
+			return models.OrderState{}, fmt.Errorf("%w: order is not claimed by you", ErrOrderClaimed)
+		}
+		return models.OrderState{}, err
+	}
+	return s.getOrderState(orderId)
+}
+
+// PayOrder отмечает оплату QR оператором, взявшим заказ. bankReference — номер операции
+// в банке, обязателен; чек необязателен.
+func (s *OrderService) PayOrder(orderId int64, operator string, payment models.OrderPayment, meta models.RequestMeta) (models.OrderState, error) {
+	if payment.BankReference == "" || len(payment.BankReference) > 100 {
+		return models.OrderState{}, ErrBankReference
+	}
+	order, err := s.getOrder(orderId)
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	if !canTransition(order.State, models.OrderPaid) {
+		return models.OrderState{}, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.State, models.OrderPaid)
+	}
+	if time.Now().After(order.ExpiresAt) {
+		return models.OrderState{}, fmt.Errorf("%w: order %d expired at %s", ErrInvalidTransition, order.Id, order.ExpiresAt.Format(time.RFC3339))
+	}
+
+	actor := OperatorActor(operator)
+	entry, err := auditEntry(meta, models.AuditOrderPay, orderTarget(orderId))
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	_, err = s.repos.PayOrder(orderId, actor, payment, entry)
+	switch {
+	case errors.Is(err, repository.ErrOrderClaimed):
+		return models.OrderState{}, fmt.Errorf("%w: claim the order before paying", ErrOrderClaimed)
+	case errors.Is(err, repository.ErrOrderStateChanged):
+		return models.OrderState{}, fmt.Errorf("%w: %v", ErrInvalidTransition, err)
+	case err != nil:
+		return models.OrderState{}, err
+	}
+	logrus.Infof("Заказ %d оплачен: %s, операция %s", orderId, actor, payment.BankReference)
+	return s.getOrderState(orderId)
+}
+
+// GetOrderReceipt путь к файлу чека об оплате заказа
+func (s *OrderService) GetOrderReceipt(orderId int64) (string, error) {
+	order, err := s.getOrder(orderId)
+	if err != nil {
+		return "", err
+	}
+	if order.ReceiptPath == nil {
+		return "", ErrNoReceipt
+	}
+	return *order.ReceiptPath, nil
+}
+
+// Run раз в SweepInterval переводит просроченные заказы в expired, снимая удержания,
+// сообщает об этом пользователям и снимает истёкшие аренды операторов. Останавливается по ctx.
+func (s *OrderService) Run(ctx context.Context) {
+	logrus.Infof("Просрочка заказов запущена, TTL по умолчанию %s", s.cfg.TTL)
+	for {
+		s.expireOverdue()
+		if released, err := s.repos.ReleaseExpiredClaims(); err != nil {
+			logrus.Errorf("order sweeper: %s", err)
+		} else if released > 0 {
+			logrus.Infof("Снято истёкших аренд заказов: %d", released)
+		}
+		select {
+		case <-ctx.Done():
+			logrus.Info("Просрочка заказов остановлена")
+			return
+		case <-time.After(s.cfg.SweepInterval):
+		}
+	}
+}
+
+// expireOverdue переводит в expired пачки просроченных заказов, пока они есть
+func (s *OrderService) expireOverdue() {
+	for {
+		orders, err := s.repos.GetOverdueOrders(s.cfg.BatchSize)
+		if err != nil {
+			logrus.Errorf("order sweeper: %s", err)
+			return
+		}
+		expired := 0
+		for _, order := range orders {
+			if _, err := s.transition(order, models.OrderExpired, models.ActorSystem, "ttl elapsed", models.SystemRequest()); err != nil {
+				// Оператор мог успеть оплатить заказ — тогда переход уже не нужен
+				logrus.Warnf("Заказ %d не переведён в expired: %s", order.Id, err)
+				continue
+			}
+			expired++
+			s.notify(order.TelegramId, fmt.Sprintf("Срок оплаты заказа №%d на %v ₽ истёк. Удержанные %s USDT снова доступны.", order.Id, order.Summa, order.Crypto))
+		}
+		if expired == 0 || len(orders) < s.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+// notify отправляет пользователю сообщение в Telegram. Ошибка только логируется.
+func (s *OrderService) notify(telegramId int64, text string) {
+	if s.cfg.BotToken == "" {
+		return
+	}
+	if err := utils.SendTelegramMessage(s.cfg.BotToken, telegramId, text); err != nil {
+		logrus.Errorf("Уведомление %d не отправлено: %s", telegramId, err)
+	}
+}
+
+func (s *OrderService) OrdersHistory(telegramId int64) ([]models.OrderQR, error) {
+	return s.repos.OrdersHistory(telegramId)
+}
+
+// CancelOrder отмена заказа пользователем, пока оператор его не оплатил
+func (s *OrderService) CancelOrder(telegramId int64, orderId int64, reason string, meta models.RequestMeta) (models.OrderState, error) {
+	order, err := s.getOrder(orderId)
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	if order.TelegramId != telegramId {
+		return models.OrderState{}, ErrOrderNotFound
+	}
+	return s.transition(order, models.OrderCancelled, UserActor(telegramId), reason, meta)
+}
+
+// TransitionOrder переводит заказ в состояние to, если переход из текущего состояния допустим.
+// Оплата идёт только через PayOrder, с арендой и номером операции.
+func (s *OrderService) TransitionOrder(orderId int64, to, actor, reason string, meta models.RequestMeta) (models.OrderState, error) {
+	if to == models.OrderPaid {
+		return models.OrderState{}, fmt.Errorf("%w: orders are paid via PayOrder", ErrInvalidTransition)
+	}
+	order, err := s.getOrder(orderId)
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	return s.transition(order, to, actor, reason, meta)
+}
+
+func (s *OrderService) transition(order models.OrderQR, to, actor, reason string, meta models.RequestMeta) (models.OrderState, error) {
+	if !canTransition(order.State, to) {
+		return models.OrderState{}, fmt.Errorf("%w: %s -> %s", ErrInvalidTransition, order.State, to)
+	}
+	entry, err := auditEntry(meta, models.AuditOrderTransition, orderTarget(order.Id))
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	_, err = s.repos.TransitionOrder(order.Id, order.State, to, actor, reason, entry)
+	if errors.Is(err, repository.ErrOrderStateChanged) {
+		return models.OrderState{}, fmt.Errorf("%w: %v", ErrInvalidTransition, err)
+	}
+	if errors.Is(err, repository.ErrRefundSettled) {
+		return models.OrderState{}, fmt.Errorf("%w: %v", ErrRefundSettled, err)
+	}
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	logrus.Infof("Заказ %d: %s -> %s (%s)", order.Id, order.State, to, actor)
+	return s.getOrderState(order.Id)
+}
+
+func (s *OrderService) getOrder(orderId int64) (models.OrderQR, error) {
+	order, err := s.repos.GetOrder(orderId)
+	if errors.Is(err, sql.ErrNoRows) {
+		return order, ErrOrderNotFound
+	}
+	return order, err
+}
+
+func (s *OrderService) getOrderState(orderId int64) (models.OrderState, error) {
+	order, err := s.getOrder(orderId)
+	if err != nil {
+		return models.OrderState{}, err
+	}
+	state := models.OrderState{OrderQR: order, HasReceipt: order.ReceiptPath != nil}
+	hold, found, err := s.repos.GetOrderHold(orderId)
+	if err != nil {
+		return state, err
+	}
+	if found {
+		state.Hold = &hold
+	}
+	if state.Transitions, err = s.repos.GetOrderTransitions(orderId); err != nil {
+		return state, err
+	}
+	state.Actions, err = s.repos.GetOrderActions(orderId)
+	return state, err
+}
+
+func orderTarget(id int64) string {
+	return "order:" + strconv.FormatInt(id, 10)
+}
+
+func claimedBy(order models.OrderQR) string {
+	if order.ClaimedBy == nil || order.ClaimExpiresAt == nil {
+		return "order is claimed"
+	}
+	return fmt.Sprintf("claimed by %s until %s", *order.ClaimedBy, order.ClaimExpiresAt.Format(time.RFC3339))
+}
+
+func isOrderState(state string) bool {
+	if _, ok := orderTransitions[state]; ok {
+		return true
+	}
+	return state == models.OrderExpired || state == models.OrderCancelled || state == models.OrderRefunded
+}
+
+func canTransition(from, to string) bool {
+	for _, state := range orderTransitions[from] {
+		if state == to {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrQuotesNotConfigured = errors.New("quote signing secret is not configured")
+	ErrQuoteNotFound       = errors.New("quote not found")
+	ErrQuoteExpired        = errors.New("quote expired")
+	ErrQuoteUsed           = errors.New("quote already used")
+	ErrQuoteInvalid        = errors.New("quote is not valid for this operation")
+)
+
+// QuoteConfig котировки курса: секрет подписи из окружения и срок действия из секции quotes конфига
+type QuoteConfig struct {
+	Secret string
+	TTL    time.Duration
+}
+
+// Validate проверяет секрет подписи котировок
+func (c QuoteConfig) Validate() error {
+	return checkSecret(c.Secret)
+}
+
+func newQuoteID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// signQuote HMAC-SHA256 от всех полей, которые определяют суммы заказа
+func signQuote(secret string, q models.Quote) (string, error) {
+	if secret == "" {
+		return "", ErrQuotesNotConfigured
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s|%d|%s|%s|%s|%s|%s|%d",
+		q.ID, q.TelegramID, q.FromCurrency, q.ToCurrency,
+		strconv.FormatFloat(q.Rate, 'f', -1, 64), q.Amount, q.Converted, q.ExpiresAt.Unix())
+	return hex.EncodeToString(mac.Sum(nil)), nil
+}
+
+// checkQuote проверяет, что котировка выдана сервером этому пользователю, не истекла
+// и не использована
+func checkQuote(secret string, q models.Quote, telegramId int64) error {
+	signature, err := signQuote(secret, q)
+	if err != nil {
+		return err
+	}
+	if !hmac.Equal([]byte(signature), []byte(q.Signature)) || q.TelegramID != telegramId {
+		return ErrQuoteNotFound
+	}
+	if q.UsedAt != nil {
+		return ErrQuoteUsed
+	}
+	if time.Now().After(q.ExpiresAt) {
+		return ErrQuoteExpired
+	}
+	return nil
+}
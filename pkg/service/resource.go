@@ -0,0 +1,345 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/money"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/tronclient"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var ErrStakeNotConfigured = errors.New("energy treasury is not configured")
+
+// ResourceConfig настройки делегирования энергии из секции resources конфига. Ключ — из окружения.
+type ResourceConfig struct {
+	Enabled      bool
+	TreasuryKey  string        // приватный ключ казначейства, застейкавшего TRX под энергию
+	PollInterval time.Duration // пауза между шагами и интервал опроса сети
+	Lease        time.Duration
+	MaxHold      time.Duration // энергия отзывается не позже этого срока, даже если перевод не завершился
+	MaxAttempts  int           // после стольких ошибок делегирования перевод идёт без него
+	MaxBackoff   time.Duration
+}
+
+// ResourceManager делегирует энергию со стейка казначейства на кошелёк пользователя перед
+// переводом USDT и отзывает её после. Без делегирования перевод сжигает TRX на энергию.
+type ResourceManager struct {
+	repos   repository.Delegation
+	chain   tronclient.Chain
+	cfg     ResourceConfig
+	address string
+	audit   auditLog
+}
+
+func NewResourceManager(repos *repository.Repository, chain tronclient.Chain, cfg ResourceConfig) *ResourceManager {
+	m := &ResourceManager{
+		repos: repos.Delegations,
+		chain: chain,
+		cfg:   cfg,
+		audit: auditLog{repos.Audit},
+	}
+	if cfg.Enabled && cfg.TreasuryKey != "" {
+		address, err := tronclient.AddressFromPrivateKey(cfg.TreasuryKey)
+		if err != nil {
+			logrus.Errorf("Ключ казначейства энергии не разобран: %s", err)
+		}
+		m.address = address
+	}
+	return m
+}
+
+func (m *ResourceManager) enabled() bool {
+	return m.address != ""
+}
+
+// Prepare готовит энергию под перевод amount USDT с from на to. reference — чей это перевод,
+// повторные вызовы возвращают то же делегирование. false — делегирование ещё не в блоке,
+// перевод нужно отложить; true — можно считать газ и подписывать.
+func (m *ResourceManager) Prepare(reference string, from string, to string, amount money.Amount) (bool, error) {
+	if !m.enabled() {
+		return true, nil
+	}
+	d, found, err := m.repos.GetDelegation(reference)
+	if err != nil {
+		return false, err
+	}
+	if !found {
+		fee, err := m.chain.EstimateTransferFee(from, to, amount)
+		if err != nil {
+			return false, err
+		}
+		missing := fee.EnergyBurned
+		if missing <= 0 {
+			return true, nil
+		}
+		resources, err := m.chain.GetAccountResources(from)
+		if err != nil {
+			return false, err
+		}
+		stake, err := resources.StakeForEnergy(missing)
+		if err != nil {
+			return false, err
+		}
+
+		var created bool
+		d, created, err = m.repos.CreateDelegation(models.EnergyDelegation{
+			Reference:       reference,
+			ReceiverAddress: from,
+			Energy:          missing,
+			Amount:          stake,
+		})
+		if err != nil {
+			return false, err
+		}
+		if created {
+			logrus.Infof("Делегирование %d (%s): %d энергии (%s TRX стейка) на %s", d.ID, reference, missing, stake, from)
+		}
+	}
+	return d.State != models.DelegationDelegating, nil
+}
+
+// Release отмечает перевод reference завершённым: энергия будет отозвана на ближайшем шаге
+func (m *ResourceManager) Release(reference string) {
+	if !m.enabled() {
+		return
+	}
+	if err := m.repos.ReleaseDelegation(reference); err != nil {
+		// Делегирование всё равно будет отозвано через MaxHold
+		logrus.Errorf("resources: failed to release %s: %s", reference, err)
+	}
+}
+
+// Stake замораживает amount TRX казначейства под энергию
+func (m *ResourceManager) Stake(amount money.Amount, meta models.RequestMeta) (string, error) {
+	if !m.enabled() {
+		return "", ErrStakeNotConfigured
+	}
+	if err := amount.Validate(); err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	signed, err := m.chain.SignFreezeBalance(m.cfg.TreasuryKey, amount, tronclient.ResourceEnergy)
+	if err != nil {
+		return "", err
+	}
+	txID, err := m.chain.BroadcastTransaction(signed.Raw)
+	if err != nil {
+		return "", err
+	}
+	logrus.Infof("Казначейство %s: заморожено %s TRX под энергию, %s", m.address, amount, txID)
+	m.audit.record(meta, models.AuditStake, "treasury:"+m.address, nil, map[string]interface{}{
+		"amount": amount,
+		"tx_id":  txID,
+	})
+	return txID, nil
+}
+
+// Status стейк казначейства и неотозванные делегирования
+func (m *ResourceManager) Status() (models.ResourceStatus, error) {
+	if !m.enabled() {
+		return models.ResourceStatus{}, ErrStakeNotConfigured
+	}
+	status := models.ResourceStatus{TreasuryAddress: m.address}
+	var err error
+	status.DelegatableTRX, err = m.chain.GetDelegatableStake(m.address, tronclient.ResourceEnergy)
+	if err != nil {
+		return status, err
+	}
+	resources, err := m.chain.GetAccountResources(m.address)
+	if err != nil {
+		return status, err
+	}
+	status.Energy = resources.AvailableEnergy()
+	status.Delegations, err = m.repos.GetOpenDelegations()
+	return status, err
+}
+
+// Run доводит делегирования до блока и отзывает энергию завершённых переводов. Останавливается по ctx.
+func (m *ResourceManager) Run(ctx context.Context) {
+	if !m.enabled() {
+		logrus.Info("Делегирование энергии отключено, переводы сжигают TRX")
+		return
+	}
+	logrus.Infof("Делегирование энергии запущено, казначейство %s", m.address)
+
+	for {
+		m.processReady()
+		select {
+		case <-ctx.Done():
+			logrus.Info("Делегирование энергии остановлено")
+			return
+		case <-time.After(m.cfg.PollInterval):
+		}
+	}
+}
+
+// processReady выполняет по шагу всех делегирований, готовых к запуску
+func (m *ResourceManager) processReady() {
+	for {
+		token, err := newLeaseToken()
+		if err != nil {
+			logrus.Errorf("resources: %s", err)
+			return
+		}
+		d, found, err := m.repos.ClaimDelegation(token, m.cfg.Lease)
+		if err != nil {
+			logrus.Errorf("resources: failed to claim delegation: %s", err)
+			return
+		}
+		if !found {
+			return
+		}
+		m.process(d)
+	}
+}
+
+// process выполняет один шаг делегирования и сохраняет результат, снимая аренду
+func (m *ResourceManager) process(d models.EnergyDelegation) {
+	from := d.State
+
+	var err error
+	switch d.State {
+	case models.DelegationDelegating:
+		err = m.delegate(&d)
+	case models.DelegationActive, models.DelegationReclaiming:
+		// Активное делегирование забирается в работу, только когда перевод завершён или истёк MaxHold
+		err = m.reclaim(&d)
+	default:
+		err = fmt.Errorf("unexpected state %q", d.State)
+	}
+
+	d.NextRunAt = time.Now()
+	switch {
+	case errors.Is(err, repository.ErrLeaseLost):
+		logrus.Warnf("Делегирование %d: аренду забрал другой воркер", d.ID)
+		return
+	case errors.Is(err, errNotReady):
+		d.NextRunAt = time.Now().Add(m.cfg.PollInterval)
+	case err != nil:
+		d.Attempts++
+		d.LastError = err.Error()
+		d.NextRunAt = time.Now().Add(m.backoff(d.Attempts))
+		// Перевод ждёт делегирования, поэтому оно не повторяется бесконечно. Отзыв повторяется,
+		// пока энергия не вернётся.
+		if d.State == models.DelegationDelegating && d.DelegateTxID == "" && d.Attempts >= m.cfg.MaxAttempts {
+			d.State = models.DelegationFailed
+		}
+	case d.State == models.DelegationActive:
+		d.NextRunAt = time.Now().Add(m.cfg.MaxHold)
+	}
+
+	if err != nil && !errors.Is(err, errNotReady) {
+		logrus.Errorf("Делегирование %d (%s), попытка %d: %s", d.ID, from, d.Attempts, err)
+	}
+	if d.State != from {
+		logrus.Infof("Делегирование %d (%s): %s -> %s", d.ID, d.Reference, from, d.State)
+	}
+	if err := m.repos.SaveDelegation(d, true); err != nil {
+		logrus.Errorf("Делегирование %d: не удалось сохранить состояние: %s", d.ID, err)
+	}
+}
+
+// delegate подписывает и сохраняет делегирование до отправки, затем ждёт его блока
+func (m *ResourceManager) delegate(d *models.EnergyDelegation) error {
+	if d.DelegateTxID == "" {
+		if d.Released {
+			d.State = models.DelegationFailed
+			d.LastError = "transfer finished before delegation"
+			return nil
+		}
+		stake, err := m.chain.GetDelegatableStake(m.address, tronclient.ResourceEnergy)
+		if err != nil {
+			return err
+		}
+		if stake < d.Amount {
+			// Ждать бесполезно: стейк освобождается только отзывом других делегирований
+			d.State = models.DelegationFailed
+			return fmt.Errorf("treasury can delegate %s TRX, need %s", stake, d.Amount)
+		}
+
+		signed, err := m.chain.SignDelegateResource(m.cfg.TreasuryKey, d.ReceiverAddress, d.Amount, tronclient.ResourceEnergy)
+		if err != nil {
+			return fmt.Errorf("failed to sign delegation: %v", err)
+		}
+		if err := m.store(d, signed); err != nil {
+			return err
+		}
+		d.DelegateTxID = signed.TxID
+		if err := m.repos.SaveDelegation(*d, false); err != nil {
+			return err
+		}
+	}
+	return m.settle(d, &d.DelegateTxID, models.DelegationActive)
+}
+
+// reclaim подписывает и сохраняет отзыв энергии до отправки, затем ждёт его блока
+func (m *ResourceManager) reclaim(d *models.EnergyDelegation) error {
+	if d.ReclaimTxID == "" {
+		signed, err := m.chain.SignUndelegateResource(m.cfg.TreasuryKey, d.ReceiverAddress, d.Amount, tronclient.ResourceEnergy)
+		if err != nil {
+			return fmt.Errorf("failed to sign reclaim: %v", err)
+		}
+		if err := m.store(d, signed); err != nil {
+			return err
+		}
+		d.ReclaimTxID = signed.TxID
+		d.State = models.DelegationReclaiming
+		if err := m.repos.SaveDelegation(*d, false); err != nil {
+			return err
+		}
+	}
+	return m.settle(d, &d.ReclaimTxID, models.DelegationReclaimed)
+}
+
+func (m *ResourceManager) store(d *models.EnergyDelegation, signed tronclient.SignedTx) error {
+	raw, err := json.Marshal(signed.Raw)
+	if err != nil {
+		return err
+	}
+	d.SignedTx, d.TxExpiresAt = string(raw), &signed.Expiration
+	return nil
+}
+
+// settle (пере)отправляет сохранённую транзакцию txID и переводит делегирование в next,
+// когда она выполнена. Неуспешная или истёкшая транзакция сбрасывается и подписывается заново.
+func (m *ResourceManager) settle(d *models.EnergyDelegation, txID *string, next string) error {
+	info, err := m.chain.GetTransactionInfo(*txID)
+	if err != nil {
+		return err
+	}
+	if info.Found {
+		if !info.Succeeded() {
+			failed := *txID
+			*txID, d.SignedTx, d.TxExpiresAt = "", "", nil
+			return fmt.Errorf("transaction %s failed: %s %s", failed, info.Result, info.Message)
+		}
+		d.SignedTx, d.TxExpiresAt = "", nil
+		d.State = next
+		d.LastError = ""
+		return nil
+	}
+
+	_, err = broadcastStored(m.chain, d.SignedTx)
+	if errors.Is(err, tronclient.ErrTransactionExpired) || (d.TxExpiresAt != nil && time.Now().After(*d.TxExpiresAt)) {
+		if d.TxExpiresAt != nil && time.Now().Before(d.TxExpiresAt.Add(expiredTxGrace)) {
+			return errNotReady
+		}
+		logrus.Warnf("Делегирование %d: транзакция %s истекла, подписываем заново", d.ID, *txID)
+		*txID, d.SignedTx, d.TxExpiresAt = "", "", nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to broadcast: %v", err)
+	}
+	return errNotReady
+}
+
+func (m *ResourceManager) backoff(attempts int) time.Duration {
+	d := m.cfg.PollInterval << min(attempts, 16)
+	return min(d, m.cfg.MaxBackoff)
+}
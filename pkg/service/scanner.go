@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/tronclient"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// depositCheckpoint имя checkpoint сканера входящих USDT
+const depositCheckpoint = "usdt_deposits"
+
+// ScannerConfig настройки сканера депозитов из секции scanner конфига
+type ScannerConfig struct {
+	Enabled       bool
+	Confirmations int64         // сколько блоков должно быть поверх перевода перед зачислением
+	PollInterval  time.Duration // пауза, когда новых блоков нет
+	StartBlock    int64         // с какого блока начинать при первом запуске, 0 — с текущего
+	BatchBlocks   int64         // сколько блоков обрабатывать за один проход
+}
+
+type ScannerService struct {
+	repos repository.Deposit
+	chain tronclient.Chain
+	cfg   ScannerConfig
+}
+
+func NewScannerService(repos *repository.Repository, chain tronclient.Chain, cfg ScannerConfig) *ScannerService {
+	return &ScannerService{repos: repos.Deposits, chain: chain, cfg: cfg}
+}
+
+// Run идёт по блокам от сохранённого checkpoint, записывает входящие переводы USDT на кошельки
+// пользователей и зачисляет их после нужного числа подтверждений. Останавливается по ctx.
+func (s *ScannerService) Run(ctx context.Context) {
+	if !s.cfg.Enabled {
+		logrus.Info("Сканер депозитов выключен")
+		return
+	}
+	logrus.Infof("Сканер депозитов запущен, подтверждений: %d", s.cfg.Confirmations)
+
+	for {
+		caughtUp, err := s.tick()
+		if err != nil {
+			logrus.Errorf("deposit scanner: %s", err)
+		}
+
+		wait := time.Duration(0)
+		if caughtUp || err != nil {
+			wait = s.cfg.PollInterval
+		}
+		select {
+		case <-ctx.Done():
+			logrus.Info("Сканер депозитов остановлен")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// tick обрабатывает очередную пачку блоков. caughtUp = true, если сканер дошёл до головы сети.
+func (s *ScannerService) tick() (caughtUp bool, err error) {
+	head, err := s.chain.GetNowBlockNumber()
+	if err != nil {
+		return false, err
+	}
+
+	last, found, err := s.repos.GetCheckpoint(depositCheckpoint)
+	if err != nil {
+		return false, fmt.Errorf("failed to read checkpoint: %v", err)
+	}
+	if !found {
+		last = head - 1
+		if s.cfg.StartBlock > 0 {
+			last = s.cfg.StartBlock - 1
+		}
+		logrus.Infof("Сканер депозитов начинает с блока %d", last+1)
+	}
+
+	to := min(head, last+max(s.cfg.BatchBlocks, 1))
+	for block := last + 1; block <= to; block++ {
+		if err := s.scanBlock(block); err != nil {
+			return false, err
+		}
+	}
+
+	if err := s.confirmDeposits(head); err != nil {
+		return false, err
+	}
+	return to == head, nil
+}
+
+func (s *ScannerService) scanBlock(block int64) error {
+	transfers, err := s.chain.GetUSDTTransfers(block)
+	if err != nil {
+		return err
+	}
+
+	var deposits []models.Deposit
+	if len(transfers) > 0 {
+		addresses := make([]string, 0, len(transfers))
+		for _, t := range transfers {
+			addresses = append(addresses, t.To)
+		}
+		wallets, err := s.repos.GetWalletIDsByAddresses(addresses)
+		if err != nil {
+			return fmt.Errorf("failed to match block %d recipients: %v", block, err)
+		}
+
+		for _, t := range transfers {
+			walletID, ok := wallets[t.To]
+			if !ok {
+				continue
+			}
+			logrus.Infof("Найден депозит %s USDT на %s, tx %s", t.Amount, t.To, t.TxID)
+			deposits = append(deposits, models.Deposit{
+				WalletID:    walletID,
+				TxHash:      t.TxID,
+				LogIndex:    t.LogIndex,
+				BlockNumber: t.BlockNumber,
+				FromAddress: t.From,
+				TokenSymbol: "USDT",
+				Amount:      t.Amount,
+			})
+		}
+	}
+
+	if err := s.repos.SaveBlockDeposits(depositCheckpoint, block, deposits); err != nil {
+		return fmt.Errorf("failed to save block %d: %v", block, err)
+	}
+	return nil
+}
+
+// confirmDeposits зачисляет депозиты, набравшие нужное число подтверждений.
+// Перед зачислением транзакция перепроверяется в сети на случай реорганизации.
+func (s *ScannerService) confirmDeposits(head int64) error {
+	deposits, err := s.repos.GetDepositsToConfirm(head - s.cfg.Confirmations)
+	if err != nil {
+		return fmt.Errorf("failed to get deposits to confirm: %v", err)
+	}
+
+	for _, d := range deposits {
+		info, err := s.chain.GetTransactionInfo(d.TxHash)
+		if err != nil {
+			return err
+		}
+		if !info.Succeeded() || info.BlockNumber != d.BlockNumber {
+			logrus.Warnf("Транзакция депозита %s не найдена в блоке %d, депозит %d отменён", d.TxHash, d.BlockNumber, d.ID)
+			if err := s.repos.MarkDepositOrphaned(d.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		entry, err := auditEntry(models.SystemRequest(), models.AuditDepositCredit, walletTarget(d.WalletID))
+		if err != nil {
+			return err
+		}
+		if err := s.repos.CreditDeposit(d.ID, entry); err != nil {
+			return fmt.Errorf("failed to credit deposit %d: %v", d.ID, err)
+		}
+		logrus.Infof("Депозит %d (%s %s) зачислен на кошелёк %d", d.ID, d.Amount, d.TokenSymbol, d.WalletID)
+	}
+	return nil
+}
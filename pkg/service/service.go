@@ -1,43 +1,66 @@
 package service
 
 import (
+	"context"
 	"production_wallet_back/models"
+	"production_wallet_back/pkg/keystore"
+	"production_wallet_back/pkg/money"
 	"production_wallet_back/pkg/repository"
 	"production_wallet_back/pkg/tronclient"
+	"time"
 )
 
 type Authorization interface {
 	GetUserByTelegramId(telegramId int64) (models.User, error)
 	CreateUser(models.User) (int64, error)
+
+	Login(input models.User, userAgent string) (models.User, models.TokenPair, error)
+	Refresh(refreshToken string) (models.TokenPair, error)
+	Logout(sessionID int64) error
+	LogoutAll(telegramID int64) error
+	ValidateAccessToken(token string) (telegramID int64, sessionID int64, err error)
+}
+
+// Admin пользователи админки, их роли и сессии
+type Admin interface {
+	Login(username, password string, meta models.RequestMeta) (models.AdminUser, models.AdminToken, error)
+	Logout(sessionID int64, meta models.RequestMeta) error
+	ValidateAdminToken(token string) (admin models.AdminUser, sessionID int64, err error)
+	CreateAdmin(username, password, role string, meta models.RequestMeta) (models.AdminUser, error)
+	GetAdmins() ([]models.AdminUser, error)
+	UpdateAdmin(actorID int64, id int64, input models.AdminUpdateInput, meta models.RequestMeta) (models.AdminUser, error)
+	SetAdminPassword(id int64, password string, meta models.RequestMeta) error
+}
+
+// Audit журнал аудита: поиск записей и проверка цепочки хэшей
+type Audit interface {
+	GetEntries(filter models.AuditFilter) ([]models.AuditEntry, error)
+	Verify() (models.AuditVerification, error)
 }
+
 type Wallet interface {
 	CreateWallet(userID int64, privKey, address string) (int64, error)
 	GetWallet(telegramId int64) (models.WalletResponce, error)
 	InitBalance(walletID int64, tokenSymbol string) error
 	GetBalance(telegramId int64) ([]models.Balance, error)
-	GetUSDTBalance(address string) (float64, error)
-	Deposit(telegramId int64, tokenSymbol string, amount float64) error
-	Withdraw(privKey string, toAddress string, amount float64) (string, error)
-	WithdrawWithContract(privKey string, toAddress string, amount float64, contractAddress string) (string, error)
-	ApproveUSDT(privKey string, spenderAddress string, amount float64) (string, error)
-	SendTRXForGas(fromPrivKey string, toAddress string, amount float64) (string, error)
+	GetUSDTBalance(address string) (money.Amount, error)
+	GetTRXBalance(address string) (money.Amount, error)
+	EstimateTransferFee(fromAddr string, toAddr string, amount money.Amount) (tronclient.FeeEstimate, error)
+	GetTransactionInfo(txID string) (tronclient.TransactionInfo, error)
+	Deposit(telegramId int64, tokenSymbol string, amount money.Amount, reference string, meta models.RequestMeta) error
+	TopUpGas(ctx context.Context, telegramId int64, toAddress string, amount money.Amount, meta models.RequestMeta) (models.GasTopUp, error)
 	GetTransactions(telegramId int64) ([]models.Transaction, error)
-	Pay(telegramId int64, tokenSymbol string, amount float64) error
-	Convert(models.ConvertRequest) (error, models.ConvertResponse)
-	GetAPIKey() string
+	Pay(telegramId int64, tokenSymbol string, amount money.Amount) error
+	Convert(telegramId int64, req models.ConvertRequest) (error, models.ConvertResponse)
 
-	CreateOrder(qr models.OrderQR) (int, error)
-	OrdersHistory(telegramId int64) ([]models.OrderQR, error)
-	GetOrderState(orderId int) (bool, error)
-	GetOrders() ([]models.OrderQR, error)
-	PayQR(orderId int) (bool, error)
-	GetPrivatKey(telegramId int64) (string, error)
-	AddVirtualTransfer(walletID int64, amount float64) error
-	SumPendingVirtualTransfers(walletID int64) (float64, error)
+	GetPrivatKey(telegramId int64, meta models.RequestMeta) (string, error)
+	VirtualWithdraw(telegramId int64, amount money.Amount, meta models.RequestMeta) (models.VirtualTransfer, error)
+	SumPendingVirtualTransfers(walletID int64) (money.Amount, error)
+	SumActiveHolds(walletID int64) (money.Amount, error)
+	GetReservedBalance(walletID int64) (models.ReservedBalance, error)
 	GetPendingVirtualTransfers(walletID int64) ([]models.VirtualTransfer, error)
 	MarkVirtualTransfersProcessed(ids []int64) error
 	GetWalletByAddress(address string) (models.WalletResponce, error)
-	UpdateBalance(walletID int64, tokenSymbol string, amount float64) error
 
 	// Новый метод для админки
 	GetAllWallets() ([]models.Wallet, error)
@@ -47,16 +70,124 @@ type Wallet interface {
 	GetTransactionsByWalletID(walletID int64, tokenSymbol string) ([]models.Transaction, error)
 }
 
+// Order заказы на оплату СБП QR, переходы между их состояниями и фоновая просрочка
+type Order interface {
+	CreateOrder(qr models.OrderQR, quoteID string, ttl time.Duration, meta models.RequestMeta) (models.OrderQR, error)
+	GetOrderState(telegramId int64, orderId int64) (models.OrderState, error)
+	GetOrders(states []string) ([]models.OrderQR, error)
+	OrdersHistory(telegramId int64) ([]models.OrderQR, error)
+	CancelOrder(telegramId int64, orderId int64, reason string, meta models.RequestMeta) (models.OrderState, error)
+	TransitionOrder(orderId int64, to, actor, reason string, meta models.RequestMeta) (models.OrderState, error)
+
+	GetOrder(orderId int64) (models.OrderState, error)
+	ClaimOrder(orderId int64, operator string, meta models.RequestMeta) (models.OrderState, error)
+	ReleaseOrder(orderId int64, operator string, meta models.RequestMeta) (models.OrderState, error)
+	PayOrder(orderId int64, operator string, payment models.OrderPayment, meta models.RequestMeta) (models.OrderState, error)
+	GetOrderReceipt(orderId int64) (string, error)
+	Run(ctx context.Context)
+}
+
+// Scanner фоновый сканер входящих депозитов
+type Scanner interface {
+	Run(ctx context.Context)
+}
+
+// Withdrawal очередь выводов и воркеры, которые её обрабатывают
+type Withdrawal interface {
+	Withdraw(telegramId int64, toAddress string, amount money.Amount, meta models.RequestMeta) (models.WithdrawalJob, error)
+	GetWithdrawal(telegramId int64, id int64) (models.WithdrawalJob, error)
+	Run(ctx context.Context)
+}
+
+// Tracker фоновая проверка статусов отправленных транзакций
+type Tracker interface {
+	Run(ctx context.Context)
+	GetFailedTransactions(limit int) ([]models.FailedTransaction, error)
+}
+
+// Settlement фоновый расчёт по виртуальным списаниям: перевод собранных сумм на казначейство
+type Settlement interface {
+	Run(ctx context.Context)
+}
+
+// Gas кошелёк-плательщик газа: остаток и предупреждения о его нехватке
+type Gas interface {
+	Status() (models.GasStatus, error)
+	Run(ctx context.Context)
+}
+
+// Resources стейк казначейства под энергию и делегирования на кошельки пользователей
+type Resources interface {
+	Stake(amount money.Amount, meta models.RequestMeta) (string, error)
+	Status() (models.ResourceStatus, error)
+	Run(ctx context.Context)
+}
+
+// Ledger журнал двойной записи: остатки счетов, выписки и сверка с balances
+type Ledger interface {
+	GetAccounts() ([]models.LedgerAccount, error)
+	GetWalletStatement(walletID int64, limit int) ([]models.LedgerLine, error)
+	Reconcile() ([]models.BalanceMismatch, error)
+}
+
+// Idempotency хранилище ключей Idempotency-Key и сохранённых ответов
+type Idempotency interface {
+	StartRequest(key models.IdempotencyKey) (models.IdempotencyKey, bool, error)
+	CompleteRequest(id int64, statusCode int, contentType string, body []byte) error
+	ReleaseRequest(id int64) error
+	Run(ctx context.Context)
+}
+
+type Config struct {
+	Auth        AuthConfig
+	Admin       AdminConfig
+	Wallet      WalletConfig
+	Orders      OrderConfig
+	Quotes      QuoteConfig
+	Scanner     ScannerConfig
+	Withdrawals WithdrawalConfig
+	Tracker     TrackerConfig
+	Idempotency IdempotencyConfig
+	Settlement  SettlementConfig
+	Gas         GasConfig
+	Alerts      AlertConfig
+	Resources   ResourceConfig
+}
+
 type Service struct {
 	Authorization
 	Wallet
+	Admin       Admin
+	Audit       Audit
+	Order       Order
+	Scanner     Scanner
+	Withdrawal  Withdrawal
+	Tracker     Tracker
+	Ledger      Ledger
+	Idempotency Idempotency
+	Settlement  Settlement
+	Gas         Gas
+	Resources   Resources
 }
 
-func NewService(repos *repository.Repository) *Service {
+func NewService(repos *repository.Repository, chain tronclient.Chain, keys *keystore.Keystore, cfg Config) *Service {
+	alerts := newAlerter(cfg.Alerts)
+	gas := NewGasManager(repos, chain, alerts, cfg.Gas)
+	resources := NewResourceManager(repos, chain, cfg.Resources)
 	return &Service{
-		Authorization: NewAuthService(repos.Authorization),
-		Wallet: NewWalletService(repos.Wallet, tronclient.NewTronHTTPClient("dbd1331e-96a5-493e-9fa5-1f37bc008b1f",
-			"TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t")),
+		Authorization: NewAuthService(repos.Authorization, cfg.Auth),
+		Wallet:        NewWalletService(repos, chain, keys, gas, cfg.Wallet, cfg.Quotes),
+		Admin:         NewAdminService(repos, cfg.Admin),
+		Audit:         NewAuditService(repos.Audit),
+		Order:         NewOrderService(repos, chain, cfg.Orders, cfg.Quotes),
+		Scanner:       NewScannerService(repos, chain, cfg.Scanner),
+		Withdrawal:    NewWithdrawalService(repos, chain, keys, gas, resources, alerts, cfg.Withdrawals),
+		Tracker:       NewTrackerService(repos.Transactions, chain, cfg.Tracker),
+		Ledger:        NewLedgerService(repos.Ledger),
+		Idempotency:   NewIdempotencyService(repos.Idempotency, cfg.Idempotency),
+		Settlement:    NewSettlementService(repos, chain, keys, gas, resources, alerts, cfg.Settlement),
+		Gas:           gas,
+		Resources:     resources,
 	}
 }
 
@@ -0,0 +1,340 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/keystore"
+	"production_wallet_back/pkg/money"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/tronclient"
+	"strconv"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SettlementConfig настройки расчёта по виртуальным списаниям из секции settlement конфига
+type SettlementConfig struct {
+	Enabled         bool
+	TreasuryAddress string        // куда переводятся собранные списания
+	Interval        time.Duration // как часто собирать pending-списания в пакеты
+	PollInterval    time.Duration // пауза между шагами пакетов и интервал опроса сети
+	MinAmount       money.Amount  // меньшие суммы копятся до следующего сбора
+	Confirmations   int64
+	Lease           time.Duration
+	MaxAttempts     int // после стольких ошибок до подписи пакет failed, списания уходят в следующий; нехватка USDT не считается
+	MaxBackoff      time.Duration
+}
+
+type SettlementService struct {
+	repos        repository.Settlement
+	wallets      repository.Wallet
+	transactions repository.Transaction
+	chain        tronclient.Chain
+	keys         *keystore.Keystore
+	gas          *GasManager
+	resources    *ResourceManager
+	alerts       *alerter
+	cfg          SettlementConfig
+}
+
+func NewSettlementService(repos *repository.Repository, chain tronclient.Chain, keys *keystore.Keystore, gas *GasManager, resources *ResourceManager, alerts *alerter, cfg SettlementConfig) *SettlementService {
+	return &SettlementService{
+		repos:        repos.Settlements,
+		wallets:      repos.Wallet,
+		transactions: repos.Transactions,
+		chain:        chain,
+		keys:         keys,
+		gas:          gas,
+		resources:    resources,
+		alerts:       alerts,
+		cfg:          cfg,
+	}
+}
+
+// Run раз в Interval собирает pending виртуальные списания в пакеты по кошелькам и
+// доводит пакеты до подтверждённого перевода на казначейство. Останавливается по ctx.
+func (s *SettlementService) Run(ctx context.Context) {
+	if !s.cfg.Enabled {
+		logrus.Info("Расчёт по виртуальным списаниям отключён")
+		return
+	}
+	if err := tronclient.ValidateAddress(s.cfg.TreasuryAddress); err != nil {
+		logrus.Errorf("Расчёт по виртуальным списаниям не запущен: адрес казначейства: %s", err)
+		return
+	}
+	logrus.Infof("Расчёт по виртуальным списаниям запущен, казначейство %s", s.cfg.TreasuryAddress)
+
+	var lastBatch time.Time
+	for {
+		if time.Since(lastBatch) >= s.cfg.Interval {
+			lastBatch = time.Now()
+			s.createSettlements()
+		}
+		s.processReady()
+
+		select {
+		case <-ctx.Done():
+			logrus.Info("Расчёт по виртуальным списаниям остановлен")
+			return
+		case <-time.After(s.cfg.PollInterval):
+		}
+	}
+}
+
+// createSettlements собирает новые пакеты; запись аудита о пакете пишется вместе с ним
+func (s *SettlementService) createSettlements() {
+	entry, err := auditEntry(models.SystemRequest(), models.AuditSettlementCreate, "")
+	if err != nil {
+		logrus.Errorf("settlement: %s", err)
+		return
+	}
+	created, err := s.repos.CreateSettlements(s.cfg.TreasuryAddress, s.cfg.MinAmount, entry)
+	if err != nil {
+		logrus.Errorf("settlement: failed to create settlements: %s", err)
+	}
+	for _, st := range created {
+		logrus.Infof("Пакет расчёта %d: %s USDT с %s", st.ID, st.Amount, st.FromAddress)
+	}
+}
+
+// processReady выполняет по шагу всех пакетов, готовых к запуску
+func (s *SettlementService) processReady() {
+	for {
+		token, err := newLeaseToken()
+		if err != nil {
+			logrus.Errorf("settlement: %s", err)
+			return
+		}
+		st, found, err := s.repos.ClaimSettlement(token, s.cfg.Lease)
+		if err != nil {
+			logrus.Errorf("settlement: failed to claim settlement: %s", err)
+			return
+		}
+		if !found {
+			return
+		}
+		s.process(st)
+	}
+}
+
+// process выполняет один шаг пакета и сохраняет результат, снимая аренду
+func (s *SettlementService) process(st models.Settlement) {
+	from := st.State
+
+	var err error
+	switch st.State {
+	case models.SettlementPending:
+		err = s.prepare(&st)
+	case models.SettlementBroadcast:
+		err = s.broadcast(&st)
+	default:
+		err = fmt.Errorf("unexpected state %q", st.State)
+	}
+
+	st.NextRunAt = time.Now()
+	switch {
+	case errors.Is(err, repository.ErrLeaseLost):
+		logrus.Warnf("Пакет расчёта %d: аренду забрал другой воркер", st.ID)
+		return
+	case errors.Is(err, errNotReady):
+		st.NextRunAt = time.Now().Add(s.cfg.PollInterval)
+	case errors.Is(err, ErrInsufficientFunds):
+		// В сети меньше, чем уже списано виртуально. failed вернул бы списания в новый пакет
+		// с той же суммой, поэтому пакет ждёт с backoff, пока кошелёк не разберут вручную.
+		st.Attempts++
+		st.LastError = err.Error()
+		st.NextRunAt = time.Now().Add(s.backoff(st.Attempts))
+		s.alerts.alert(settlementTarget(st.ID), fmt.Sprintf("⚠️ Пакет расчёта %d: на кошельке %s не хватает USDT для перевода на казначейство: %s", st.ID, st.FromAddress, err))
+	case err != nil:
+		st.Attempts++
+		st.LastError = err.Error()
+		st.NextRunAt = time.Now().Add(s.backoff(st.Attempts))
+		// Подписанный перевод ещё может попасть в блок, поэтому в broadcast пакет
+		// не бросается по числу попыток — только по окончательной ошибке
+		if isPermanent(err) || st.State == models.SettlementPending && st.Attempts >= s.cfg.MaxAttempts {
+			st.State = models.SettlementFailed
+		}
+	}
+
+	if err != nil && !errors.Is(err, errNotReady) {
+		logrus.Errorf("Пакет расчёта %d (%s), попытка %d: %s", st.ID, from, st.Attempts, err)
+	}
+	if st.State != from {
+		logrus.Infof("Пакет расчёта %d: %s -> %s", st.ID, from, st.State)
+	}
+	finished := st.State != from && (st.State == models.SettlementConfirmed || st.State == models.SettlementFailed)
+	var entry *models.AuditEntry
+	if finished {
+		finish, err := auditSnapshot(models.SystemRequest(), models.AuditSettlementFinish, settlementTarget(st.ID), map[string]string{"state": from}, st)
+		if err != nil {
+			logrus.Errorf("Пакет расчёта %d: не удалось собрать запись аудита: %s", st.ID, err)
+			return
+		}
+		entry = &finish
+	}
+	if err := s.repos.SaveSettlement(st, true, entry); err != nil {
+		logrus.Errorf("Пакет расчёта %d: не удалось сохранить состояние: %s", st.ID, err)
+		return
+	}
+	if st.State == models.SettlementFailed && from != models.SettlementFailed {
+		s.alerts.alert(settlementTarget(st.ID), fmt.Sprintf("⚠️ Пакет расчёта %d на %s USDT с %s не выполнен: %s", st.ID, st.Amount, st.FromAddress, st.LastError))
+	}
+	if finished {
+		s.resources.Release(settlementTarget(st.ID))
+	}
+}
+
+func settlementTarget(id int64) string {
+	return "settlement:" + strconv.FormatInt(id, 10)
+}
+
+// prepare проверяет остаток, энергию и газ, а затем подписывает перевод на казначейство и сохраняет
+// его вместе с переходом в broadcast до отправки
+func (s *SettlementService) prepare(st *models.Settlement) error {
+	balance, err := s.chain.GetUSDTBalance(st.FromAddress)
+	if err != nil {
+		return fmt.Errorf("failed to check USDT balance: %v", err)
+	}
+	if balance < st.Amount {
+		return fmt.Errorf("%w: have %s, need %s", ErrInsufficientFunds, balance, st.Amount)
+	}
+
+	// Газ, докинутый раньше, сначала должен подтвердиться и попасть в журнал
+	if st.GasTxID != "" {
+		return s.fundGas(st)
+	}
+	ready, err := s.resources.Prepare(settlementTarget(st.ID), st.FromAddress, st.ToAddress, st.Amount)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return errNotReady
+	}
+	trx, required, err := s.gas.Need(st.FromAddress, st.ToAddress, st.Amount)
+	if err != nil {
+		return err
+	}
+	if trx < required {
+		missing := required - trx
+		logrus.Infof("Пакет расчёта %d: на %s %s TRX, нужно %s, докидываем %s", st.ID, st.FromAddress, trx, required, missing)
+		gasTx, raw, err := s.gas.SignTopUp(st.FromAddress, missing, fmt.Sprintf("settlement %d", st.ID), nil)
+		if errors.Is(err, ErrGasTopUpPending) {
+			return errNotReady
+		}
+		if err != nil {
+			return err
+		}
+		st.GasTxID, st.GasSignedTx, st.GasAmount = gasTx.TxID, raw, missing
+		if err := s.repos.SaveSettlement(*st, false, nil); err != nil {
+			return err
+		}
+		return s.fundGas(st)
+	}
+
+	privKey, err := signingKey(s.wallets, s.keys, st.TelegramID)
+	if err != nil {
+		return err
+	}
+	signed, err := s.chain.SignUSDTTransfer(privKey, st.ToAddress, st.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to sign USDT transfer: %v", err)
+	}
+	raw, err := json.Marshal(signed.Raw)
+	if err != nil {
+		return err
+	}
+	_, err = s.transactions.CreatePendingTransaction(models.Transaction{
+		FromWalletID: st.WalletID,
+		ToAddress:    st.ToAddress,
+		TokenSymbol:  st.TokenSymbol,
+		Amount:       st.Amount,
+		TxHash:       &signed.TxID,
+		ExpiresAt:    &signed.Expiration,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save transaction: %v", err)
+	}
+
+	st.TxID, st.SignedTx, st.TxExpiresAt = signed.TxID, string(raw), &signed.Expiration
+	st.State = models.SettlementBroadcast
+	if err := s.repos.SaveSettlement(*st, false, nil); err != nil {
+		return err
+	}
+	return s.broadcast(st)
+}
+
+// fundGas ждёт подтверждения сохранённого перевода TRX с плательщика, (пере)отправляя его.
+// После подтверждения газ будет проверен заново на следующем шаге.
+func (s *SettlementService) fundGas(st *models.Settlement) error {
+	confirmed, err := s.gas.Confirm(st.GasTxID, st.GasAmount, fmt.Sprintf("settlement %d", st.ID))
+	if errors.Is(err, errGasTopUpFailed) {
+		st.GasTxID, st.GasSignedTx, st.GasAmount = "", "", 0
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if confirmed {
+		st.GasTxID, st.GasSignedTx, st.GasAmount = "", "", 0
+		return nil
+	}
+
+	if _, err := broadcastStored(s.chain, st.GasSignedTx); err != nil {
+		if !errors.Is(err, tronclient.ErrTransactionExpired) {
+			return fmt.Errorf("failed to broadcast TRX for gas: %v", err)
+		}
+		if info, err := s.chain.GetTransactionInfo(st.GasTxID); err != nil || info.Found {
+			return errNotReady
+		}
+		// Перевод TRX не попал в сеть — на следующем шаге газ будет подписан заново
+		st.GasTxID, st.GasSignedTx, st.GasAmount = "", "", 0
+	}
+	return errNotReady
+}
+
+// broadcast (пере)отправляет сохранённый перевод и ждёт Confirmations блоков поверх него
+func (s *SettlementService) broadcast(st *models.Settlement) error {
+	info, err := s.chain.GetTransactionInfo(st.TxID)
+	if err != nil {
+		return err
+	}
+	if info.Found {
+		if !info.Succeeded() {
+			return fmt.Errorf("%w: transaction %s failed: %s %s", errTransactionFailed, st.TxID, info.Result, info.Message)
+		}
+		head, err := s.chain.GetNowBlockNumber()
+		if err != nil {
+			return err
+		}
+		if head-info.BlockNumber < s.cfg.Confirmations {
+			return errNotReady
+		}
+		st.State = models.SettlementConfirmed
+		st.LastError = ""
+		return nil
+	}
+
+	_, err = broadcastStored(s.chain, st.SignedTx)
+	if errors.Is(err, tronclient.ErrTransactionExpired) || (st.TxExpiresAt != nil && time.Now().After(*st.TxExpiresAt)) {
+		if st.TxExpiresAt != nil && time.Now().Before(st.TxExpiresAt.Add(expiredTxGrace)) {
+			return errNotReady
+		}
+		logrus.Warnf("Пакет расчёта %d: транзакция %s истекла, подписываем заново", st.ID, st.TxID)
+		st.TxID, st.SignedTx, st.TxExpiresAt = "", "", nil
+		st.State = models.SettlementPending
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to broadcast USDT transfer: %v", err)
+	}
+	return errNotReady
+}
+
+func (s *SettlementService) backoff(attempts int) time.Duration {
+	d := s.cfg.PollInterval << min(attempts, 16)
+	return min(d, s.cfg.MaxBackoff)
+}
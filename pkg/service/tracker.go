@@ -0,0 +1,116 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/tronclient"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// TrackerConfig настройки трекера транзакций из секции tracker конфига
+type TrackerConfig struct {
+	Confirmations int64 // сколько блоков поверх транзакции нужно для confirmed
+	PollInterval  time.Duration
+	BatchSize     int
+	ExpireAfter   time.Duration // для записей без expires_at: через сколько после создания ненайденная транзакция считается expired
+}
+
+type TrackerService struct {
+	repos repository.Transaction
+	chain tronclient.Chain
+	cfg   TrackerConfig
+}
+
+func NewTrackerService(repos repository.Transaction, chain tronclient.Chain, cfg TrackerConfig) *TrackerService {
+	return &TrackerService{repos: repos, chain: chain, cfg: cfg}
+}
+
+// Run опрашивает gettransactioninfobyid для всех pending транзакций и переводит их в
+// confirmed, failed или expired. Останавливается по ctx.
+func (s *TrackerService) Run(ctx context.Context) {
+	logrus.Infof("Трекер транзакций запущен, подтверждений: %d", s.cfg.Confirmations)
+	for {
+		if err := s.tick(); err != nil {
+			logrus.Errorf("transaction tracker: %s", err)
+		}
+		select {
+		case <-ctx.Done():
+			logrus.Info("Трекер транзакций остановлен")
+			return
+		case <-time.After(s.cfg.PollInterval):
+		}
+	}
+}
+
+func (s *TrackerService) GetFailedTransactions(limit int) ([]models.FailedTransaction, error) {
+	return s.repos.GetFailedTransactions(limit)
+}
+
+func (s *TrackerService) tick() error {
+	txs, err := s.repos.GetPendingTransactions(s.cfg.BatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to get pending transactions: %v", err)
+	}
+	if len(txs) == 0 {
+		return nil
+	}
+	head, err := s.chain.GetNowBlockNumber()
+	if err != nil {
+		return err
+	}
+
+	for _, tx := range txs {
+		if err := s.track(tx, head); err != nil {
+			logrus.Errorf("transaction tracker: %s: %s", *tx.TxHash, err)
+		}
+	}
+	return nil
+}
+
+func (s *TrackerService) track(tx models.Transaction, head int64) error {
+	info, err := s.chain.GetTransactionInfo(*tx.TxHash)
+	if err != nil {
+		return err
+	}
+
+	if !info.Found {
+		deadline := tx.CreatedAt.Add(s.cfg.ExpireAfter)
+		if tx.ExpiresAt != nil {
+			deadline = tx.ExpiresAt.Add(expiredTxGrace)
+		}
+		if time.Now().Before(deadline) {
+			return nil
+		}
+		tx.Status = models.TxExpired
+		tx.FailureReason = "transaction was not included in a block before expiration"
+		logrus.Warnf("Транзакция %s истекла, не попав в блок", *tx.TxHash)
+		return s.repos.UpdateTransactionStatus(tx)
+	}
+
+	tx.BlockNumber = &info.BlockNumber
+	tx.Result = info.Result
+	tx.EnergyUsed = info.EnergyUsed
+	tx.EnergyFee = info.EnergyFee
+	tx.NetFee = info.NetFee
+	tx.Fee = info.Fee
+
+	switch {
+	case !info.Succeeded():
+		tx.Status = models.TxFailed
+		tx.FailureReason = info.Result
+		if info.Message != "" {
+			tx.FailureReason += ": " + info.Message
+		}
+		logrus.Warnf("Транзакция %s кошелька %d не выполнена: %s", *tx.TxHash, tx.FromWalletID, tx.FailureReason)
+	case head-info.BlockNumber >= s.cfg.Confirmations:
+		tx.Status = models.TxConfirmed
+	default:
+		// В блоке, но подтверждений ещё мало
+		return nil
+	}
+	return s.repos.UpdateTransactionStatus(tx)
+}
@@ -6,51 +6,84 @@ import (
 	"log"
 	"production_wallet_back/models"
 	"production_wallet_back/pkg/cache"
+	"production_wallet_back/pkg/keystore"
+	"production_wallet_back/pkg/money"
 	"production_wallet_back/pkg/repository"
 	"production_wallet_back/pkg/tronclient"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-resty/resty/v2"
 )
 
-type WalletService struct {
-	repos      repository.Wallet
-	tronClient *tronclient.TronHTTPClient
+var (
+	ErrWalletNotFound  = errors.New("wallet not found")
+	ErrDepositReplayed = errors.New("deposit with this reference is already posted")
+)
+
+// WalletConfig секреты кошелькового сервиса, берутся из окружения
+type WalletConfig struct {
+	CoinGeckoAPIKey string
 }
 
-func NewWalletService(repos repository.Wallet, tronclient *tronclient.TronHTTPClient) *WalletService {
+type WalletService struct {
+	repos     repository.Wallet
+	ledger    repository.Ledger
+	quoteRepo repository.Quote
+	chain     tronclient.Chain
+	keys      *keystore.Keystore
+	cfg       WalletConfig
+	quotes    QuoteConfig
+	gas       *GasManager
+	audit     auditLog
+}
+
+func NewWalletService(repos *repository.Repository, chain tronclient.Chain, keys *keystore.Keystore, gas *GasManager, cfg WalletConfig, quotes QuoteConfig) *WalletService {
 	return &WalletService{
-		repos:      repos,
-		tronClient: tronclient,
+		repos:     repos.Wallet,
+		ledger:    repos.Ledger,
+		quoteRepo: repos.Quotes,
+		chain:     chain,
+		keys:      keys,
+		cfg:       cfg,
+		quotes:    quotes,
+		gas:       gas,
+		audit:     auditLog{repos.Audit},
 	}
 }
 
-func (s *WalletService) GetPrivatKey(telegramId int64) (string, error) {
-	return s.repos.GetPrivatKey(telegramId)
-}
-
-func (s *WalletService) OrdersHistory(telegramId int64) ([]models.OrderQR, error) {
-	return s.repos.OrdersHistory(telegramId)
-}
-
-func (s *WalletService) PayQR(orderId int) (bool, error) {
-	return s.repos.PayQR(orderId)
-}
-
-func (s *WalletService) GetOrders() ([]models.OrderQR, error) {
-	return s.repos.GetOrders()
-}
-
-func (s *WalletService) GetOrderState(orderId int) (bool, error) {
-	return s.repos.GetOrderState(orderId)
+// GetPrivatKey экспорт расшифрованного ключа для админки. Без записи в журнал аудита ключ не выдаётся.
+func (s *WalletService) GetPrivatKey(telegramId int64, meta models.RequestMeta) (string, error) {
+	wallet, err := s.repos.GetWallet(telegramId)
+	if err != nil {
+		return "", ErrWalletNotFound
+	}
+	if err := s.audit.record(meta, models.AuditKeyExport, walletTarget(wallet.WalletID), nil, wallet); err != nil {
+		return "", fmt.Errorf("failed to record key export: %v", err)
+	}
+	return s.walletPrivateKey(telegramId)
 }
 
-func (s *WalletService) CreateOrder(qr models.OrderQR) (int, error) {
-	return s.repos.CreateOrder(qr)
+// walletPrivateKey расшифровывает ключ кошелька пользователя. Используется только для подписи.
+func (s *WalletService) walletPrivateKey(telegramId int64) (string, error) {
+	key, err := s.repos.GetWalletKey(telegramId)
+	if err != nil {
+		return "", err
+	}
+	plain, err := s.keys.Decrypt(key.EncryptedKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt wallet key: %v", err)
+	}
+	return string(plain), nil
 }
 
 func (s *WalletService) CreateWallet(userID int64, privKey, address string) (int64, error) {
-	return s.repos.CreateWallet(userID, privKey, address)
+	key, err := s.keys.Encrypt([]byte(privKey))
+	if err != nil {
+		return 0, fmt.Errorf("failed to encrypt wallet key: %v", err)
+	}
+	return s.repos.CreateWallet(userID, address, key)
 }
 
 func (s *WalletService) InitBalance(walletID int64, tokenSymbol string) error {
@@ -68,66 +101,44 @@ func (s *WalletService) GetWalletByAddress(address string) (models.WalletResponc
 func (s *WalletService) GetBalance(telegramId int64) ([]models.Balance, error) {
 	return s.repos.GetBalances(telegramId)
 }
-func (s *WalletService) GetUSDTBalance(address string) (float64, error) {
-	return s.tronClient.GetUSDTBalance(address)
-}
-func (s *WalletService) Deposit(telegramId int64, tokenSymbol string, amount float64) error {
-	return s.repos.Deposit(telegramId, tokenSymbol, amount)
+func (s *WalletService) GetUSDTBalance(address string) (money.Amount, error) {
+	return s.chain.GetUSDTBalance(address)
 }
 
-func (s *WalletService) Withdraw(privKey string, toAddress string, amount float64) (string, error) {
-	// Используем тот же контракт USDT, что и в клиенте
-	txID, err := s.tronClient.SendUSDT(privKey, toAddress, amount)
-	if err != nil {
-		return "", fmt.Errorf("failed to send USDT: %v", err)
-	}
-	return txID, nil
+func (s *WalletService) GetTRXBalance(address string) (money.Amount, error) {
+	return s.chain.GetTRXBalance(address)
 }
 
-// WithdrawWithContract позволяет указать адрес контракта USDT
-func (s *WalletService) WithdrawWithContract(privKey string, toAddress string, amount float64, contractAddress string) (string, error) {
-	fmt.Printf("=== WithdrawWithContract DEBUG ===\n")
-	fmt.Printf("Contract Address: %s\n", contractAddress)
-
-	// Создаем временный клиент с указанным контрактом
-	tempClient := tronclient.NewTronHTTPClient(s.GetAPIKey(), contractAddress)
+func (s *WalletService) EstimateTransferFee(fromAddr string, toAddr string, amount money.Amount) (tronclient.FeeEstimate, error) {
+	return s.chain.EstimateTransferFee(fromAddr, toAddr, amount)
+}
 
-	fmt.Printf("Temp client created with contract: %s\n", tempClient.USDTContract)
+func (s *WalletService) GetTransactionInfo(txID string) (tronclient.TransactionInfo, error) {
+	return s.chain.GetTransactionInfo(txID)
+}
 
-	txID, err := tempClient.SendUSDT(privKey, toAddress, amount)
+// Deposit ручное зачисление на кошелёк пользователя. Только из админки: проводка идёт против
+// внешнего счёта, то есть создаёт остаток. Без записи в журнале аудита не выполняется.
+func (s *WalletService) Deposit(telegramId int64, tokenSymbol string, amount money.Amount, reference string, meta models.RequestMeta) error {
+	if err := amount.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	entry, err := auditEntry(meta, models.AuditDeposit, UserActor(telegramId))
 	if err != nil {
-		return "", fmt.Errorf("failed to send USDT: %v", err)
+		return err
 	}
-
-	fmt.Printf("=== WithdrawWithContract COMPLETED ===\n")
-	return txID, nil
+	err = s.repos.Deposit(telegramId, tokenSymbol, amount, reference, entry)
+	if errors.Is(err, repository.ErrDepositReplayed) {
+		return fmt.Errorf("%w: %s", ErrDepositReplayed, reference)
+	}
+	return err
 }
 
-//func (s *WalletService) Withdraw(telegramId int64, ToAddress string, tokenSymbol string, amount float64) error {
-//	balance, err := s.repos.GetBalances(telegramId)
-//	logrus.Infof(fmt.Sprintf("balances %+v", balance))
-//	if err != nil {
-//		return err
-//	}
-//	if balance[0].Amount < amount {
-//		return errors.New("insufficient funds")
-//	}
-//	err = s.repos.WithdrawBalance(balance[0].WalletID, amount, tokenSymbol)
-//	if err != nil {
-//		return err
-//	}
-//	err = s.repos.CreateTransaction(balance[0].WalletID, ToAddress, tokenSymbol, amount, "pending", "")
-//	if err != nil {
-//		return errors.New(fmt.Sprintf("Failed to save transaction: %s", err))
-//	}
-//	return nil
-//}
-
 func (s *WalletService) GetTransactions(telegramId int64) ([]models.Transaction, error) {
 	return s.repos.GetTransactions(telegramId)
 }
 
-func (s *WalletService) Pay(telegramId int64, tokenSymbol string, amount float64) error {
+func (s *WalletService) Pay(telegramId int64, tokenSymbol string, amount money.Amount) error {
 
 	err := s.repos.Pay(telegramId, tokenSymbol, amount)
 	if err != nil {
@@ -137,26 +148,63 @@ func (s *WalletService) Pay(telegramId int64, tokenSymbol string, amount float64
 	return err
 }
 
-func (s *WalletService) Convert(convertReq models.ConvertRequest) (error, models.ConvertResponse) {
+// Convert считает сумму по текущему курсу и выдаёт подписанную котировку, которая хранится
+// на сервере QuoteConfig.TTL. Заказ создаётся только по id котировки.
+func (s *WalletService) Convert(telegramId int64, convertReq models.ConvertRequest) (error, models.ConvertResponse) {
 	var response models.ConvertResponse
 	from := strings.ToLower(convertReq.From)
 	to := strings.ToLower(convertReq.To)
-	if from == "" || to == "" || convertReq.Amount <= 0 {
+	if from == "" || to == "" || convertReq.Amount.Validate() != nil {
 		return errors.New("Неверно переданы данные в тело запроса для конвертации"), response
 	}
 
-	key := currencyID(convertReq.To) + "_" + convertReq.From
+	rate, err := s.rate(from, to)
+	if err != nil {
+		return err, response
+	}
+	converted, err := convertReq.Amount.DivRate(rate)
+	if err != nil {
+		return err, response
+	}
+
+	id, err := newQuoteID()
+	if err != nil {
+		return err, response
+	}
+	quote := models.Quote{
+		ID:           id,
+		TelegramID:   telegramId,
+		FromCurrency: strings.ToUpper(from),
+		ToCurrency:   strings.ToUpper(to),
+		Rate:         rate,
+		Amount:       convertReq.Amount,
+		Converted:    converted,
+		ExpiresAt:    time.Now().Add(s.quotes.TTL).Truncate(time.Second),
+	}
+	if quote.Signature, err = signQuote(s.quotes.Secret, quote); err != nil {
+		return err, response
+	}
+	if err := s.quoteRepo.CreateQuote(quote); err != nil {
+		return fmt.Errorf("failed to save quote: %v", err), response
+	}
+
+	response = models.ConvertResponse{
+		ConvertedAmount: converted,
+		Currency:        quote.ToCurrency,
+		Message:         fmt.Sprintf("Переведите %s на адрес  Tx..", converted),
+		Wallet:          "Tx...",
+		Quote:           &quote,
+	}
+	return nil, response
+}
+
+// rate курс to в валюте from: из кэша или от CoinGecko
+func (s *WalletService) rate(from, to string) (float64, error) {
+	key := currencyID(to) + "_" + from
 
 	// Попробуем получить курс из кэша
 	if rate, found := cache.GetCachedRate(key); found {
-		converted := convertReq.Amount / rate
-		response = models.ConvertResponse{
-			ConvertedAmount: converted,
-			Currency:        strings.ToUpper(convertReq.To),
-			Message:         fmt.Sprintf("Переведите %.2f на адрес  Tx..", converted),
-			Wallet:          "Tx...",
-		}
-		return nil, response
+		return rate, nil
 	}
 	// Если в кэше нет — запрос к CoinGecko
 	url := "https://api.coingecko.com/api/v3/simple/price?ids=" + currencyID(to) + "&vs_currencies=" + from
@@ -165,7 +213,7 @@ func (s *WalletService) Convert(convertReq models.ConvertRequest) (error, models
 	log.Println("Запрос к API CoinGecko:", url)
 
 	resp, err := client.R().
-		SetHeader("x-cg-demo-api-key", "CG-wmi7LpR5B84uad7kPFE1knYa").
+		SetHeader("x-cg-demo-api-key", s.cfg.CoinGeckoAPIKey).
 		SetHeader("Accept", "application/json").
 		SetResult(map[string]map[string]float64{}).
 		Get(url)
@@ -173,28 +221,18 @@ func (s *WalletService) Convert(convertReq models.ConvertRequest) (error, models
 	if err != nil || resp.IsError() {
 		log.Println("Ошибка при получении курса:", err)
 		log.Println("Ответ от API:", resp)
-		return errors.New("Не удалось получить курс"), response
+		return 0, errors.New("Не удалось получить курс")
 	}
 
 	data := *resp.Result().(*map[string]map[string]float64)
 	rate := data[currencyID(to)][from]
 
 	if rate == 0 {
-		return errors.New("Некорректный курс"), response
+		return 0, errors.New("Некорректный курс")
 	}
 
 	cache.SetCachedRate(key, rate)
-
-	converted := convertReq.Amount / rate
-
-	response = models.ConvertResponse{
-		ConvertedAmount: converted,
-		Currency:        strings.ToUpper(convertReq.To),
-		Message:         fmt.Sprintf("Переведите %.2f на адрес  Tx..", converted),
-		Wallet:          "Tx...",
-	}
-
-	return nil, response
+	return rate, nil
 }
 
 func currencyID(symbol string) string {
@@ -210,25 +248,47 @@ func currencyID(symbol string) string {
 	}
 }
 
-func (s *WalletService) ApproveUSDT(privKey string, spenderAddress string, amount float64) (string, error) {
-	return s.tronClient.ApproveUSDT(privKey, spenderAddress, amount)
+// VirtualWithdraw виртуально списывает amount USDT с кошелька пользователя telegramId в пределах
+// остатка в сети за вычетом уже ожидающих виртуальных списаний
+func (s *WalletService) VirtualWithdraw(telegramId int64, amount money.Amount, meta models.RequestMeta) (models.VirtualTransfer, error) {
+	if err := amount.Validate(); err != nil {
+		return models.VirtualTransfer{}, fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	wallet, err := s.repos.GetWallet(telegramId)
+	if err != nil {
+		return models.VirtualTransfer{}, ErrWalletNotFound
+	}
+	balance, err := s.chain.GetUSDTBalance(wallet.Address)
+	if err != nil {
+		return models.VirtualTransfer{}, fmt.Errorf("failed to get real balance: %v", err)
+	}
+
+	entry, err := auditEntry(meta, models.AuditVirtualWithdraw, walletTarget(wallet.WalletID))
+	if err != nil {
+		return models.VirtualTransfer{}, err
+	}
+	transfer, err := s.repos.ReserveVirtualTransfer(wallet.WalletID, amount, balance, entry)
+	if errors.Is(err, repository.ErrInsufficientBalance) {
+		return transfer, fmt.Errorf("%w: %v", ErrInsufficientFunds, err)
+	}
+	return transfer, err
 }
 
-func (s *WalletService) GetAPIKey() string {
-	return s.tronClient.APIKey
+func walletTarget(walletID int64) string {
+	return "wallet:" + strconv.FormatInt(walletID, 10)
 }
 
-// SendTRXForGas sends TRX to cover gas fees
-func (s *WalletService) SendTRXForGas(fromPrivKey string, toAddress string, amount float64) (string, error) {
-	return s.tronClient.SendTRXForGas(fromPrivKey, toAddress, amount)
+func (s *WalletService) SumPendingVirtualTransfers(walletID int64) (money.Amount, error) {
+	return s.repos.SumPendingVirtualTransfers(walletID)
 }
 
-func (s *WalletService) AddVirtualTransfer(walletID int64, amount float64) error {
-	return s.repos.AddVirtualTransfer(walletID, amount)
+func (s *WalletService) SumActiveHolds(walletID int64) (money.Amount, error) {
+	return s.repos.SumActiveHolds(walletID)
 }
 
-func (s *WalletService) SumPendingVirtualTransfers(walletID int64) (float64, error) {
-	return s.repos.SumPendingVirtualTransfers(walletID)
+// GetReservedBalance резервы кошелька: доступный остаток — остаток в сети минус их сумма
+func (s *WalletService) GetReservedBalance(walletID int64) (models.ReservedBalance, error) {
+	return s.repos.GetReservedBalance(walletID)
 }
 
 func (s *WalletService) GetPendingVirtualTransfers(walletID int64) ([]models.VirtualTransfer, error) {
@@ -239,10 +299,6 @@ func (s *WalletService) MarkVirtualTransfersProcessed(ids []int64) error {
 	return s.repos.MarkVirtualTransfersProcessed(ids)
 }
 
-func (s *WalletService) UpdateBalance(walletID int64, tokenSymbol string, amount float64) error {
-	return s.repos.UpdateBalance(walletID, tokenSymbol, amount)
-}
-
 func (s *WalletService) GetAllWallets() ([]models.Wallet, error) {
 	return s.repos.GetAllWallets()
 }
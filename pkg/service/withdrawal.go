@@ -0,0 +1,462 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"production_wallet_back/models"
+	"production_wallet_back/pkg/keystore"
+	"production_wallet_back/pkg/money"
+	"production_wallet_back/pkg/repository"
+	"production_wallet_back/pkg/tronclient"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	ErrInvalidAmount      = errors.New("amount must be greater than 0")
+	ErrInsufficientFunds  = errors.New("insufficient available USDT balance")
+	ErrWithdrawalNotFound = errors.New("withdrawal not found")
+
+	// errNotReady шаг ждёт событий в сети: заявка откладывается без увеличения attempts
+	errNotReady = errors.New("waiting for network")
+)
+
+// expiredTxGrace сколько ждать после истечения подписанной транзакции, прежде чем
+// считать, что она точно не попала в блок, и подписывать новую
+const expiredTxGrace = time.Minute
+
+// WithdrawalConfig настройки воркеров вывода из секции withdrawals конфига
+type WithdrawalConfig struct {
+	Workers      int
+	PollInterval time.Duration // пауза, когда готовых заявок нет, и интервал опроса сети
+	Lease        time.Duration // на сколько воркер забирает заявку
+	MaxBackoff   time.Duration
+	MaxAttempts  int // после стольких ошибок подряд заявка failed, резерв снимается
+}
+
+type WithdrawalService struct {
+	repos        repository.Withdrawal
+	wallets      repository.Wallet
+	transactions repository.Transaction
+	chain        tronclient.Chain
+	keys         *keystore.Keystore
+	gas          *GasManager
+	resources    *ResourceManager
+	alerts       *alerter
+	cfg          WithdrawalConfig
+}
+
+func NewWithdrawalService(repos *repository.Repository, chain tronclient.Chain, keys *keystore.Keystore, gas *GasManager, resources *ResourceManager, alerts *alerter, cfg WithdrawalConfig) *WithdrawalService {
+	return &WithdrawalService{
+		repos:        repos.Withdrawals,
+		wallets:      repos.Wallet,
+		transactions: repos.Transactions,
+		chain:        chain,
+		keys:         keys,
+		gas:          gas,
+		resources:    resources,
+		alerts:       alerts,
+		cfg:          cfg,
+	}
+}
+
+// Withdraw ставит вывод USDT в очередь и сразу возвращает заявку. Сумма должна помещаться
+// в доступный остаток в сети и сразу резервируется в журнале; газ проверяет воркер.
+func (s *WithdrawalService) Withdraw(telegramId int64, toAddress string, amount money.Amount, meta models.RequestMeta) (models.WithdrawalJob, error) {
+	if err := amount.Validate(); err != nil {
+		return models.WithdrawalJob{}, fmt.Errorf("%w: %v", ErrInvalidAmount, err)
+	}
+	if err := tronclient.ValidateAddress(toAddress); err != nil {
+		return models.WithdrawalJob{}, err
+	}
+
+	wallet, err := s.wallets.GetWallet(telegramId)
+	if err != nil {
+		return models.WithdrawalJob{}, err
+	}
+	balance, err := s.chain.GetUSDTBalance(wallet.Address)
+	if err != nil {
+		return models.WithdrawalJob{}, fmt.Errorf("failed to check USDT balance: %v", err)
+	}
+	entry, err := auditEntry(meta, models.AuditWithdrawalRequest, "")
+	if err != nil {
+		return models.WithdrawalJob{}, err
+	}
+	job, err := s.repos.CreateWithdrawalJob(models.WithdrawalJob{
+		WalletID:    wallet.WalletID,
+		TelegramID:  telegramId,
+		FromAddress: wallet.Address,
+		ToAddress:   toAddress,
+		TokenSymbol: "USDT",
+		Amount:      amount,
+	}, balance, entry)
+	if errors.Is(err, repository.ErrInsufficientBalance) {
+		return job, fmt.Errorf("%w: %v", ErrInsufficientFunds, err)
+	}
+	if err != nil {
+		return job, err
+	}
+	logrus.Infof("Заявка на вывод %d: %s USDT с %s на %s", job.ID, amount, wallet.Address, toAddress)
+	return job, nil
+}
+
+// GetWithdrawal возвращает заявку пользователя
+func (s *WithdrawalService) GetWithdrawal(telegramId int64, id int64) (models.WithdrawalJob, error) {
+	job, err := s.repos.GetWithdrawalJob(id)
+	if err != nil || job.TelegramID != telegramId {
+		return models.WithdrawalJob{}, ErrWithdrawalNotFound
+	}
+	return job, nil
+}
+
+// Run запускает пул воркеров, которые двигают заявки по состояниям. Останавливается по ctx.
+func (s *WithdrawalService) Run(ctx context.Context) {
+	logrus.Infof("Воркеры вывода запущены: %d", s.cfg.Workers)
+
+	var wg sync.WaitGroup
+	for i := 0; i < max(s.cfg.Workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.work(ctx)
+		}()
+	}
+	wg.Wait()
+	logrus.Info("Воркеры вывода остановлены")
+}
+
+func (s *WithdrawalService) work(ctx context.Context) {
+	for {
+		token, err := newLeaseToken()
+		if err != nil {
+			logrus.Errorf("withdrawal worker: %s", err)
+			return
+		}
+		job, found, err := s.repos.ClaimWithdrawalJob(token, s.cfg.Lease)
+		if err != nil {
+			logrus.Errorf("withdrawal worker: failed to claim job: %s", err)
+		}
+		if found {
+			s.process(job)
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.cfg.PollInterval):
+		}
+	}
+}
+
+// process выполняет один шаг заявки и сохраняет результат, снимая аренду
+func (s *WithdrawalService) process(job models.WithdrawalJob) {
+	from := job.State
+
+	var err error
+	switch job.State {
+	case models.WithdrawalRequested:
+		err = s.checkFunds(&job)
+	case models.WithdrawalGasFunding:
+		err = s.fundGas(&job)
+	case models.WithdrawalSigning:
+		err = s.sign(&job)
+	case models.WithdrawalBroadcast:
+		err = s.broadcast(&job)
+	default:
+		err = fmt.Errorf("unexpected state %q", job.State)
+	}
+
+	job.NextRunAt = time.Now()
+	switch {
+	case errors.Is(err, repository.ErrLeaseLost):
+		logrus.Warnf("Заявка %d: аренду забрал другой воркер", job.ID)
+		return
+	case errors.Is(err, errNotReady):
+		job.NextRunAt = time.Now().Add(s.cfg.PollInterval)
+	case isPermanent(err):
+		job.State = models.WithdrawalFailed
+		job.LastError = err.Error()
+	case err != nil:
+		job.Attempts++
+		job.LastError = err.Error()
+		job.NextRunAt = time.Now().Add(s.backoff(job.Attempts))
+		if s.cfg.MaxAttempts > 0 && job.Attempts >= s.cfg.MaxAttempts {
+			if canAbandon(job) {
+				job.State = models.WithdrawalFailed
+			} else {
+				s.alerts.alert(withdrawalTarget(job.ID)+":stuck", fmt.Sprintf("⚠️ Вывод %d: %d попыток, перевод уже в сети, заявка ждёт: %s", job.ID, job.Attempts, err))
+			}
+		}
+	}
+
+	if err != nil && !errors.Is(err, errNotReady) {
+		logrus.Errorf("Заявка %d (%s): %s", job.ID, from, err)
+	}
+	if job.State == models.WithdrawalFailed && from != models.WithdrawalFailed {
+		s.alerts.alert(withdrawalTarget(job.ID), fmt.Sprintf("⚠️ Вывод %d %s USDT на %s не выполнен: %s", job.ID, job.Amount, job.ToAddress, job.LastError))
+	}
+	if job.State != from {
+		logrus.Infof("Заявка %d: %s -> %s", job.ID, from, job.State)
+	}
+	// Итог заявки пишется в журнал аудита в той же транзакции: без записи состояние не сохранится
+	finished := job.State != from && (job.State == models.WithdrawalConfirmed || job.State == models.WithdrawalFailed)
+	var entry *models.AuditEntry
+	if finished {
+		finish, err := auditSnapshot(models.SystemRequest(), models.AuditWithdrawalFinish, withdrawalTarget(job.ID), map[string]string{"state": from}, job)
+		if err != nil {
+			logrus.Errorf("Заявка %d: не удалось собрать запись аудита: %s", job.ID, err)
+			return
+		}
+		entry = &finish
+	}
+	if err := s.repos.SaveWithdrawalJob(job, true, entry); err != nil {
+		logrus.Errorf("Заявка %d: не удалось сохранить состояние: %s", job.ID, err)
+		return
+	}
+	if finished {
+		s.resources.Release(withdrawalTarget(job.ID))
+	}
+}
+
+// canAbandon можно ли закрыть заявку как failed: ни перевод TRX на газ, ни подписанный перевод
+// USDT ещё не могут попасть в блок. Иначе снятый резерв разойдётся с тем, что уйдёт в сети.
+func canAbandon(job models.WithdrawalJob) bool {
+	switch job.State {
+	case models.WithdrawalRequested, models.WithdrawalSigning:
+		return true
+	}
+	return false
+}
+
+func withdrawalTarget(id int64) string {
+	return "withdrawal:" + strconv.FormatInt(id, 10)
+}
+
+// checkFunds проверяет доступный остаток, ждёт энергию от казначейства и проверяет газ.
+// Если TRX не хватает, подписывает и сохраняет перевод недостающего TRX с плательщика газа,
+// а затем отправляет его.
+func (s *WithdrawalService) checkFunds(job *models.WithdrawalJob) error {
+	balance, err := s.chain.GetUSDTBalance(job.FromAddress)
+	if err != nil {
+		return fmt.Errorf("failed to check USDT balance: %v", err)
+	}
+	available, err := s.repos.LockAvailableForWithdrawal(*job, balance)
+	if err != nil {
+		return fmt.Errorf("failed to get available balance: %v", err)
+	}
+	if available < job.Amount {
+		return fmt.Errorf("%w: have %s, need %s", ErrInsufficientFunds, available, job.Amount)
+	}
+
+	ready, err := s.resources.Prepare(withdrawalTarget(job.ID), job.FromAddress, job.ToAddress, job.Amount)
+	if err != nil {
+		return err
+	}
+	if !ready {
+		return errNotReady
+	}
+	trx, required, err := s.gas.Need(job.FromAddress, job.ToAddress, job.Amount)
+	if err != nil {
+		return err
+	}
+	if trx >= required {
+		job.State = models.WithdrawalSigning
+		return nil
+	}
+
+	missing := required - trx
+	logrus.Infof("Заявка %d: на %s %s TRX, нужно %s, докидываем %s", job.ID, job.FromAddress, trx, required, missing)
+	gasTx, raw, err := s.gas.SignTopUp(job.FromAddress, missing, fmt.Sprintf("withdrawal %d", job.ID), nil)
+	if errors.Is(err, ErrGasTopUpPending) {
+		// На адрес уже идёт другой перевод газа: ждём его и пересчитываем недостачу
+		return errNotReady
+	}
+	if err != nil {
+		return err
+	}
+	job.GasTxID, job.GasSignedTx, job.GasAmount = gasTx.TxID, raw, missing
+	job.State = models.WithdrawalGasFunding
+	// Сохраняем до отправки: после падения будет отправлена эта же транзакция
+	if err := s.repos.SaveWithdrawalJob(*job, false, nil); err != nil {
+		return err
+	}
+	return s.fundGas(job)
+}
+
+// fundGas ждёт подтверждения сохранённого перевода TRX, (пере)отправляя его. После
+// подтверждения газ проверяется заново: если оценка выросла, заявка докидывает разницу.
+func (s *WithdrawalService) fundGas(job *models.WithdrawalJob) error {
+	confirmed, err := s.gas.Confirm(job.GasTxID, job.GasAmount, fmt.Sprintf("withdrawal %d", job.ID))
+	if errors.Is(err, errGasTopUpFailed) {
+		job.GasTxID, job.GasSignedTx, job.GasAmount = "", "", 0
+		job.State = models.WithdrawalRequested
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if confirmed {
+		trx, required, err := s.gas.Need(job.FromAddress, job.ToAddress, job.Amount)
+		if err != nil {
+			return err
+		}
+		job.State = models.WithdrawalSigning
+		if trx < required {
+			job.GasTxID, job.GasSignedTx, job.GasAmount = "", "", 0
+			job.State = models.WithdrawalRequested
+		}
+		return nil
+	}
+
+	if _, err := s.broadcastStored(job.GasSignedTx); err != nil {
+		if !errors.Is(err, tronclient.ErrTransactionExpired) {
+			return fmt.Errorf("failed to broadcast TRX for gas: %v", err)
+		}
+		// Перевод TRX не попал в сеть вовремя — пересчитываем газ с начала
+		if info, err := s.chain.GetTransactionInfo(job.GasTxID); err != nil || info.Found {
+			return errNotReady
+		}
+		job.GasTxID, job.GasSignedTx, job.GasAmount = "", "", 0
+		job.State = models.WithdrawalRequested
+		return nil
+	}
+	return errNotReady
+}
+
+// sign подписывает перевод USDT и сохраняет его вместе с переходом в broadcast до отправки
+func (s *WithdrawalService) sign(job *models.WithdrawalJob) error {
+	privKey, err := s.walletPrivateKey(job.TelegramID)
+	if err != nil {
+		return err
+	}
+	signed, err := s.chain.SignUSDTTransfer(privKey, job.ToAddress, job.Amount)
+	if err != nil {
+		return fmt.Errorf("failed to sign USDT transfer: %v", err)
+	}
+	raw, err := json.Marshal(signed.Raw)
+	if err != nil {
+		return err
+	}
+
+	// Запись в transactions создаётся до отправки: если подпись так и не уйдёт в сеть,
+	// трекер переведёт её в expired
+	_, err = s.transactions.CreatePendingTransaction(models.Transaction{
+		FromWalletID: job.WalletID,
+		ToAddress:    job.ToAddress,
+		TokenSymbol:  job.TokenSymbol,
+		Amount:       job.Amount,
+		TxHash:       &signed.TxID,
+		ExpiresAt:    &signed.Expiration,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save transaction: %v", err)
+	}
+
+	job.TxID, job.SignedTx, job.TxExpiresAt = signed.TxID, string(raw), &signed.Expiration
+	job.State = models.WithdrawalBroadcast
+	if err := s.repos.SaveWithdrawalJob(*job, false, nil); err != nil {
+		return err
+	}
+	return s.broadcast(job)
+}
+
+// broadcast (пере)отправляет сохранённую транзакцию и ждёт её в блоке. Новая подпись
+// делается, только если старая транзакция истекла и точно не попала в сеть.
+func (s *WithdrawalService) broadcast(job *models.WithdrawalJob) error {
+	info, err := s.chain.GetTransactionInfo(job.TxID)
+	if err != nil {
+		return err
+	}
+	if info.Found {
+		if !info.Succeeded() {
+			return fmt.Errorf("%w: transaction %s failed: %s %s", errTransactionFailed, job.TxID, info.Result, info.Message)
+		}
+		// Дальше подтверждения транзакции отслеживает трекер по записи в transactions
+		job.State = models.WithdrawalConfirmed
+		job.LastError = ""
+		return nil
+	}
+
+	_, err = s.broadcastStored(job.SignedTx)
+	if errors.Is(err, tronclient.ErrTransactionExpired) || (job.TxExpiresAt != nil && time.Now().After(*job.TxExpiresAt)) {
+		// Истёкшая транзакция в блок уже не попадёт, но узел мог ещё не показать уже включённую
+		if job.TxExpiresAt != nil && time.Now().Before(job.TxExpiresAt.Add(expiredTxGrace)) {
+			return errNotReady
+		}
+		logrus.Warnf("Заявка %d: транзакция %s истекла, подписываем заново", job.ID, job.TxID)
+		job.TxID, job.SignedTx, job.TxExpiresAt = "", "", nil
+		job.State = models.WithdrawalSigning
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to broadcast USDT transfer: %v", err)
+	}
+	return errNotReady
+}
+
+func (s *WithdrawalService) broadcastStored(signedTx string) (string, error) {
+	return broadcastStored(s.chain, signedTx)
+}
+
+func (s *WithdrawalService) walletPrivateKey(telegramId int64) (string, error) {
+	return signingKey(s.wallets, s.keys, telegramId)
+}
+
+// broadcastStored отправляет подписанную транзакцию, сохранённую в JSON
+func broadcastStored(chain tronclient.Chain, signedTx string) (string, error) {
+	decoder := json.NewDecoder(bytes.NewReader([]byte(signedTx)))
+	decoder.UseNumber()
+	var raw map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return "", fmt.Errorf("failed to decode stored transaction: %v", err)
+	}
+	return chain.BroadcastTransaction(raw)
+}
+
+// signingKey расшифровывает ключ кошелька для подписи. Ключ, который не расшифровывается, — errKeyUnavailable.
+func signingKey(wallets repository.Wallet, keys *keystore.Keystore, telegramId int64) (string, error) {
+	key, err := wallets.GetWalletKey(telegramId)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := keys.Decrypt(key.EncryptedKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errKeyUnavailable, err)
+	}
+	return string(plaintext), nil
+}
+
+func (s *WithdrawalService) backoff(attempts int) time.Duration {
+	d := s.cfg.PollInterval << min(attempts, 16)
+	return min(d, s.cfg.MaxBackoff)
+}
+
+var (
+	errTransactionFailed = errors.New("transaction failed on chain")
+	errKeyUnavailable    = errors.New("wallet key unavailable")
+)
+
+// isPermanent ошибки, после которых повторять заявку бессмысленно
+func isPermanent(err error) bool {
+	return errors.Is(err, ErrInsufficientFunds) ||
+		errors.Is(err, ErrFeePayerNotConfigured) ||
+		errors.Is(err, errTransactionFailed) ||
+		errors.Is(err, errKeyUnavailable)
+}
+
+func newLeaseToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,89 @@
+package tronclient
+
+import (
+	"errors"
+	"fmt"
+	"production_wallet_back/pkg/money"
+	"time"
+
+	"github.com/mr-tron/base58"
+)
+
+// ErrTransactionExpired is returned by BroadcastTransaction when the signed transaction
+// is past its expiration and can never be included in a block
+var ErrTransactionExpired = errors.New("transaction expired")
+
+// Chain is the set of TRON network operations the services depend on.
+// TronHTTPClient talks to TronGrid, FakeChain simulates a node in memory.
+type Chain interface {
+	GetUSDTBalance(address string) (money.Amount, error)
+	GetTRXBalance(address string) (money.Amount, error)
+
+	SendUSDT(fromPrivKey string, toAddress string, amount money.Amount) (string, error)
+	SendTRXForGas(fromPrivKey string, toAddress string, amount money.Amount) (string, error)
+	SignUSDTTransfer(fromPrivKey string, toAddress string, amount money.Amount) (SignedTx, error)
+	SignTRXTransfer(fromPrivKey string, toAddress string, amount money.Amount) (SignedTx, error)
+	BroadcastTransaction(signedTx map[string]interface{}) (string, error)
+
+	EstimateTransferEnergy(fromAddr string, toAddr string, amount money.Amount) (int64, error)
+	EstimateRequiredTRX(fromAddr string, toAddr string, amount money.Amount) (money.Amount, error)
+	EstimateTransferFee(fromAddr string, toAddr string, amount money.Amount) (FeeEstimate, error)
+	GetChainParameters() (ChainParameters, error)
+
+	GetTransactionInfo(txID string) (TransactionInfo, error)
+
+	GetAccountResources(address string) (AccountResources, error)
+	GetDelegatableStake(address string, resource string) (money.Amount, error)
+	SignFreezeBalance(ownerPrivKey string, amount money.Amount, resource string) (SignedTx, error)
+	SignDelegateResource(ownerPrivKey string, receiver string, amount money.Amount, resource string) (SignedTx, error)
+	SignUndelegateResource(ownerPrivKey string, receiver string, amount money.Amount, resource string) (SignedTx, error)
+
+	GetNowBlockNumber() (int64, error)
+	GetUSDTTransfers(blockNum int64) ([]TRC20Transfer, error)
+}
+
+var (
+	_ Chain = (*TronHTTPClient)(nil)
+	_ Chain = (*FakeChain)(nil)
+)
+
+// SignedTx is a signed transaction that has not necessarily been broadcast yet.
+// It can be stored and broadcast again as is: the network accepts it at most once,
+// and after Expiration it is rejected for good.
+type SignedTx struct {
+	TxID       string
+	Expiration time.Time
+	Raw        map[string]interface{}
+}
+
+func newSignedTx(raw map[string]interface{}) (SignedTx, error) {
+	txID, ok := raw["txID"].(string)
+	if !ok || txID == "" {
+		return SignedTx{}, errors.New("missing txID in signed transaction")
+	}
+	rawData, _ := raw["raw_data"].(map[string]interface{})
+	expiration, ok := rawData["expiration"].(float64)
+	if !ok {
+		return SignedTx{}, errors.New("missing raw_data.expiration in signed transaction")
+	}
+	return SignedTx{
+		TxID:       txID,
+		Expiration: time.UnixMilli(int64(expiration)),
+		Raw:        raw,
+	}, nil
+}
+
+// ValidateAddress checks that address is a base58check TRON address
+func ValidateAddress(address string) error {
+	decoded, err := base58.Decode(address)
+	if err != nil || len(decoded) != 25 || decoded[0] != 0x41 {
+		return fmt.Errorf("invalid TRON address: %s", address)
+	}
+	return nil
+}
+
+// AddressFromPrivateKey returns the base58 TRON address of a hex private key
+func AddressFromPrivateKey(privHex string) (string, error) {
+	address, _, _, err := getTronAddressAndHexFromPrivKey(privHex)
+	return address, err
+}
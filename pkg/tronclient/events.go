@@ -0,0 +1,128 @@
+package tronclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"production_wallet_back/pkg/money"
+	"strings"
+
+	"github.com/mr-tron/base58"
+)
+
+// transferTopic is keccak256("Transfer(address,address,uint256)")
+const transferTopic = "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+// TRC20Transfer is one USDT Transfer event. TxID and LogIndex identify it uniquely.
+type TRC20Transfer struct {
+	TxID        string
+	LogIndex    int
+	BlockNumber int64
+	From        string
+	To          string
+	Amount      money.Amount
+}
+
+// GetNowBlockNumber returns the number of the latest block
+func (c *TronHTTPClient) GetNowBlockNumber() (int64, error) {
+	response, err := c.postWithClient(nil, "/wallet/getnowblock", map[string]interface{}{})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get now block: %v", err)
+	}
+
+	var block struct {
+		BlockHeader struct {
+			RawData struct {
+				Number int64 `json:"number"`
+			} `json:"raw_data"`
+		} `json:"block_header"`
+	}
+	if err := json.Unmarshal(response, &block); err != nil {
+		return 0, fmt.Errorf("failed to parse now block: %v", err)
+	}
+	return block.BlockHeader.RawData.Number, nil
+}
+
+// GetUSDTTransfers returns successful USDT Transfer events from the block
+func (c *TronHTTPClient) GetUSDTTransfers(blockNum int64) ([]TRC20Transfer, error) {
+	response, err := c.postWithClient(nil, "/wallet/gettransactioninfobyblocknum", map[string]interface{}{
+		"num": blockNum,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to get block %d transactions: %v", blockNum, err)
+	}
+
+	var infos []struct {
+		ID          string `json:"id"`
+		BlockNumber int64  `json:"blockNumber"`
+		Receipt     struct {
+			Result string `json:"result"`
+		} `json:"receipt"`
+		Log []struct {
+			Address string   `json:"address"`
+			Topics  []string `json:"topics"`
+			Data    string   `json:"data"`
+		} `json:"log"`
+	}
+	if err := json.Unmarshal(response, &infos); err != nil {
+		return nil, fmt.Errorf("failed to parse block %d transactions: %v", blockNum, err)
+	}
+
+	// В логах адрес контракта без префикса 41
+	contract := strings.TrimPrefix(base58CheckToHex(c.USDTContract), "41")
+
+	var transfers []TRC20Transfer
+	for _, info := range infos {
+		if info.Receipt.Result != "" && info.Receipt.Result != "SUCCESS" {
+			continue
+		}
+		for i, log := range info.Log {
+			if !strings.EqualFold(log.Address, contract) || len(log.Topics) != 3 || log.Topics[0] != transferTopic {
+				continue
+			}
+			from, err := topicToAddress(log.Topics[1])
+			if err != nil {
+				return nil, err
+			}
+			to, err := topicToAddress(log.Topics[2])
+			if err != nil {
+				return nil, err
+			}
+			value, ok := new(big.Int).SetString(log.Data, 16)
+			if !ok {
+				return nil, fmt.Errorf("invalid transfer value in %s: %q", info.ID, log.Data)
+			}
+			amount, err := money.FromBig(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid transfer value in %s: %v", info.ID, err)
+			}
+
+			transfers = append(transfers, TRC20Transfer{
+				TxID:        info.ID,
+				LogIndex:    i,
+				BlockNumber: blockNum,
+				From:        from,
+				To:          to,
+				Amount:      amount,
+			})
+		}
+	}
+	return transfers, nil
+}
+
+// topicToAddress converts an indexed address topic (32 bytes) to base58check
+func topicToAddress(topic string) (string, error) {
+	raw, err := hex.DecodeString(topic)
+	if err != nil || len(raw) != 32 {
+		return "", fmt.Errorf("invalid address topic %q", topic)
+	}
+	return hexToBase58(append([]byte{0x41}, raw[12:]...)), nil
+}
+
+func hexToBase58(addr []byte) string {
+	first := sha256.Sum256(addr)
+	second := sha256.Sum256(first[:])
+	return base58.Encode(append(addr, second[:4]...))
+}
@@ -0,0 +1,482 @@
+package tronclient
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"production_wallet_back/pkg/money"
+	"sort"
+	"sync"
+	"time"
+)
+
+// FakeChain is a deterministic in-memory TRON node for running the API offline.
+// Balances are kept in integer base units (SUN for TRX, 10^-6 for USDT).
+// A signed transaction changes balances when it is broadcast and is placed into the next
+// block: it becomes visible after MineBlocks(1).
+type FakeChain struct {
+	EnergyPerTransfer int64         // energy used by one TRC20 transfer
+	EnergyPrice       int64         // SUN burned per energy unit not covered by staked energy
+	EnergyPerTRX      int64         // energy given by one TRX staked for energy
+	BandwidthFee      int64         // SUN burned per transaction for bandwidth
+	TxLifetime        time.Duration // how long a signed transaction can be broadcast
+
+	mu     sync.Mutex
+	height int64
+	seq    int64
+	usdt   map[string]int64
+	trx    map[string]int64
+	energy map[string]int64
+	staked map[string]int64 // SUN staked for energy and not delegated
+	lent   map[string]int64 // SUN delegated, keyed by owner|receiver
+	txs    map[string]*fakeTx
+}
+
+type fakeTx struct {
+	id         string
+	kind       string
+	from       string
+	to         string
+	amount     int64
+	expiration time.Time
+	submitted  bool
+	block      int64
+	result     string
+	fee        int64
+	energy     int64
+}
+
+var errUnknownTransaction = errors.New("unknown transaction")
+
+func NewFakeChain() *FakeChain {
+	return &FakeChain{
+		EnergyPerTransfer: 28_000,
+		EnergyPrice:       420,
+		EnergyPerTRX:      10,
+		BandwidthFee:      345_000,
+		TxLifetime:        time.Minute,
+		usdt:              make(map[string]int64),
+		trx:               make(map[string]int64),
+		energy:            make(map[string]int64),
+		staked:            make(map[string]int64),
+		lent:              make(map[string]int64),
+		txs:               make(map[string]*fakeTx),
+	}
+}
+
+// SetUSDTBalance sets the USDT balance of address
+func (f *FakeChain) SetUSDTBalance(address string, amount money.Amount) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.usdt[address] = amount.Units()
+}
+
+// SetTRXBalance sets the TRX balance of address
+func (f *FakeChain) SetTRXBalance(address string, amount money.Amount) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.trx[address] = amount.Units()
+}
+
+// SetEnergy sets the staked energy available to address
+func (f *FakeChain) SetEnergy(address string, energy int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.energy[address] = energy
+}
+
+// ReceiveUSDT simulates an incoming transfer from an outside address and returns its txID
+func (f *FakeChain) ReceiveUSDT(from string, toAddress string, amount money.Amount) (string, error) {
+	if err := ValidateAddress(from); err != nil {
+		return "", err
+	}
+	if err := ValidateAddress(toAddress); err != nil {
+		return "", err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tx := f.newTx("usdt", from, toAddress, amount.Units())
+	tx.result = "SUCCESS"
+	tx.submitted = true
+	tx.block = f.height + 1
+	f.usdt[toAddress] += tx.amount
+	return tx.id, nil
+}
+
+// MineBlocks advances the chain by n blocks
+func (f *FakeChain) MineBlocks(n int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.height += n
+}
+
+// Height returns the number of the latest block
+func (f *FakeChain) Height() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.height
+}
+
+func (f *FakeChain) GetUSDTBalance(address string) (money.Amount, error) {
+	if err := ValidateAddress(address); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return money.FromUnits(f.usdt[address]), nil
+}
+
+func (f *FakeChain) GetTRXBalance(address string) (money.Amount, error) {
+	if err := ValidateAddress(address); err != nil {
+		return 0, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return money.FromUnits(f.trx[address]), nil
+}
+
+func (f *FakeChain) SendUSDT(fromPrivKey string, toAddress string, amount money.Amount) (string, error) {
+	signedTx, err := f.SignUSDTTransfer(fromPrivKey, toAddress, amount)
+	if err != nil {
+		return "", err
+	}
+	return f.BroadcastTransaction(signedTx.Raw)
+}
+
+func (f *FakeChain) SendTRXForGas(fromPrivKey string, toAddress string, amount money.Amount) (string, error) {
+	signedTx, err := f.SignTRXTransfer(fromPrivKey, toAddress, amount)
+	if err != nil {
+		return "", err
+	}
+	return f.BroadcastTransaction(signedTx.Raw)
+}
+
+func (f *FakeChain) SignUSDTTransfer(fromPrivKey string, toAddress string, amount money.Amount) (SignedTx, error) {
+	fromAddr, _, _, err := getTronAddressAndHexFromPrivKey(fromPrivKey)
+	if err != nil {
+		return SignedTx{}, fmt.Errorf("failed to get address from private key: %v", err)
+	}
+	if err := ValidateAddress(toAddress); err != nil {
+		return SignedTx{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.usdt[fromAddr] < amount.Units() {
+		return SignedTx{}, fmt.Errorf("insufficient USDT balance: have %s, need %s", money.FromUnits(f.usdt[fromAddr]), amount)
+	}
+	return f.signedTx(f.newTx("usdt", fromAddr, toAddress, amount.Units())), nil
+}
+
+func (f *FakeChain) SignTRXTransfer(fromPrivKey string, toAddress string, amount money.Amount) (SignedTx, error) {
+	fromAddr, _, _, err := getTronAddressAndHexFromPrivKey(fromPrivKey)
+	if err != nil {
+		return SignedTx{}, fmt.Errorf("failed to get address from private key: %v", err)
+	}
+	if err := ValidateAddress(toAddress); err != nil {
+		return SignedTx{}, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.signedTx(f.newTx("trx", fromAddr, toAddress, amount.Units())), nil
+}
+
+// BroadcastTransaction applies a transaction signed by this fake. Broadcasting it
+// again returns the same txID without touching balances, like on the real network.
+func (f *FakeChain) BroadcastTransaction(signedTx map[string]interface{}) (string, error) {
+	txID, _ := signedTx["txID"].(string)
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	tx, ok := f.txs[txID]
+	if !ok {
+		return "", fmt.Errorf("broadcast failed: %w %s", errUnknownTransaction, txID)
+	}
+	if tx.submitted {
+		return tx.id, nil
+	}
+	if time.Now().After(tx.expiration) {
+		return "", ErrTransactionExpired
+	}
+
+	switch tx.kind {
+	case "usdt":
+		f.applyUSDT(tx)
+	case "trx":
+		if err := f.applyTRX(tx); err != nil {
+			return "", err
+		}
+	case "freeze", "delegate", "undelegate":
+		if err := f.applyStake(tx); err != nil {
+			return "", err
+		}
+	}
+	tx.submitted = true
+	tx.block = f.height + 1
+	return tx.id, nil
+}
+
+// applyUSDT executes a USDT transfer. Caller must hold f.mu.
+func (f *FakeChain) applyUSDT(tx *fakeTx) {
+	// Staked energy is spent first, the rest is burned from the TRX balance
+	staked := min(f.energy[tx.from], f.EnergyPerTransfer)
+	fee := (f.EnergyPerTransfer-staked)*f.EnergyPrice + f.BandwidthFee
+	f.energy[tx.from] -= staked
+	tx.energy = f.EnergyPerTransfer
+
+	if f.trx[tx.from] < fee {
+		// The transaction is still included, but fails and burns what is left
+		tx.result = "OUT_OF_ENERGY"
+		tx.fee = f.trx[tx.from]
+		f.trx[tx.from] = 0
+		return
+	}
+	tx.fee = fee
+	f.trx[tx.from] -= fee
+	if f.usdt[tx.from] < tx.amount {
+		tx.result = "REVERT"
+		return
+	}
+
+	tx.result = "SUCCESS"
+	f.usdt[tx.from] -= tx.amount
+	f.usdt[tx.to] += tx.amount
+}
+
+// applyTRX executes a TRX transfer. Caller must hold f.mu.
+func (f *FakeChain) applyTRX(tx *fakeTx) error {
+	if f.trx[tx.from] < tx.amount+f.BandwidthFee {
+		return fmt.Errorf("broadcast failed with code CONTRACT_VALIDATE_ERROR: insufficient TRX balance: have %s, need %s",
+			money.FromUnits(f.trx[tx.from]), money.FromUnits(tx.amount+f.BandwidthFee))
+	}
+	tx.result = "SUCCESS"
+	tx.fee = f.BandwidthFee
+	f.trx[tx.from] -= tx.amount + f.BandwidthFee
+	f.trx[tx.to] += tx.amount
+	return nil
+}
+
+// applyStake executes a Stake 2.0 transaction. Energy moves with the stake at once;
+// the real network also regenerates used energy over 24 hours, which is not simulated.
+// Caller must hold f.mu.
+func (f *FakeChain) applyStake(tx *fakeTx) error {
+	if f.trx[tx.from] < f.BandwidthFee {
+		return fmt.Errorf("broadcast failed with code BANDWITH_ERROR: account %s has no TRX for bandwidth", tx.from)
+	}
+	energy := tx.amount / money.One.Units() * f.EnergyPerTRX
+	key := tx.from + "|" + tx.to
+
+	switch tx.kind {
+	case "freeze":
+		if f.trx[tx.from] < tx.amount+f.BandwidthFee {
+			return fmt.Errorf("broadcast failed with code CONTRACT_VALIDATE_ERROR: frozenBalance must be less than or equal to accountBalance")
+		}
+		f.trx[tx.from] -= tx.amount
+		f.staked[tx.from] += tx.amount
+		f.energy[tx.from] += energy
+	case "delegate":
+		if f.staked[tx.from] < tx.amount {
+			return fmt.Errorf("broadcast failed with code CONTRACT_VALIDATE_ERROR: delegateBalance must be less than or equal to available FreezeEnergyV2 balance")
+		}
+		f.staked[tx.from] -= tx.amount
+		f.lent[key] += tx.amount
+		f.energy[tx.from] -= min(energy, f.energy[tx.from])
+		f.energy[tx.to] += energy
+	case "undelegate":
+		if f.lent[key] < tx.amount {
+			return fmt.Errorf("broadcast failed with code CONTRACT_VALIDATE_ERROR: insufficient delegatedFrozenBalance(Energy)")
+		}
+		f.lent[key] -= tx.amount
+		f.staked[tx.from] += tx.amount
+		f.energy[tx.to] -= min(energy, f.energy[tx.to])
+		f.energy[tx.from] += energy
+	}
+	tx.result = "SUCCESS"
+	tx.fee = f.BandwidthFee
+	f.trx[tx.from] -= f.BandwidthFee
+	return nil
+}
+
+func (f *FakeChain) EstimateTransferEnergy(fromAddr string, toAddr string, amount money.Amount) (int64, error) {
+	if err := ValidateAddress(fromAddr); err != nil {
+		return 0, err
+	}
+	if err := ValidateAddress(toAddr); err != nil {
+		return 0, err
+	}
+	return f.EnergyPerTransfer, nil
+}
+
+func (f *FakeChain) EstimateRequiredTRX(fromAddr string, toAddr string, amount money.Amount) (money.Amount, error) {
+	est, err := f.EstimateTransferFee(fromAddr, toAddr, amount)
+	if err != nil {
+		return 0, err
+	}
+	return est.BurnTRX, nil
+}
+
+// EstimateTransferFee prices a transfer like the real client. The fake has no bandwidth,
+// so every transaction burns BandwidthFee.
+func (f *FakeChain) EstimateTransferFee(fromAddr string, toAddr string, amount money.Amount) (FeeEstimate, error) {
+	energy, err := f.EstimateTransferEnergy(fromAddr, toAddr, amount)
+	if err != nil {
+		return FeeEstimate{}, err
+	}
+	params, _ := f.GetChainParameters()
+	resources, err := f.GetAccountResources(fromAddr)
+	if err != nil {
+		return FeeEstimate{}, err
+	}
+	return estimateFee(params, resources, energy, usdtTransferSize), nil
+}
+
+func (f *FakeChain) GetChainParameters() (ChainParameters, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return ChainParameters{
+		EnergyFee:      f.EnergyPrice,
+		TransactionFee: f.BandwidthFee / usdtTransferSize,
+	}, nil
+}
+
+// GetTransactionInfo mirrors /wallet/gettransactioninfobyid: not found until
+// the transaction is in a block
+func (f *FakeChain) GetTransactionInfo(txID string) (TransactionInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	info := TransactionInfo{TxID: txID}
+	tx, ok := f.txs[txID]
+	if !ok || !tx.submitted || tx.block > f.height {
+		return info, nil
+	}
+	burned := max(tx.fee-f.BandwidthFee, 0)
+	info.Found = true
+	info.BlockNumber = tx.block
+	info.Result = tx.result
+	info.EnergyUsed = tx.energy
+	info.EnergyFee = burned
+	info.NetFee = tx.fee - burned
+	info.Fee = tx.fee
+	return info, nil
+}
+
+// fakeEnergyWeight is the network-wide stake reported by GetAccountResources, in TRX
+const fakeEnergyWeight = 1_000_000_000
+
+func (f *FakeChain) GetAccountResources(address string) (AccountResources, error) {
+	if err := ValidateAddress(address); err != nil {
+		return AccountResources{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return AccountResources{
+		EnergyLimit:       f.energy[address],
+		TotalEnergyLimit:  fakeEnergyWeight * f.EnergyPerTRX,
+		TotalEnergyWeight: fakeEnergyWeight,
+	}, nil
+}
+
+func (f *FakeChain) GetDelegatableStake(address string, resource string) (money.Amount, error) {
+	if err := ValidateAddress(address); err != nil {
+		return 0, err
+	}
+	if resource != ResourceEnergy {
+		return 0, nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return money.FromUnits(f.staked[address]), nil
+}
+
+func (f *FakeChain) SignFreezeBalance(ownerPrivKey string, amount money.Amount, resource string) (SignedTx, error) {
+	return f.signStake(ownerPrivKey, "freeze", "", amount, resource)
+}
+
+func (f *FakeChain) SignDelegateResource(ownerPrivKey string, receiver string, amount money.Amount, resource string) (SignedTx, error) {
+	return f.signStake(ownerPrivKey, "delegate", receiver, amount, resource)
+}
+
+func (f *FakeChain) SignUndelegateResource(ownerPrivKey string, receiver string, amount money.Amount, resource string) (SignedTx, error) {
+	return f.signStake(ownerPrivKey, "undelegate", receiver, amount, resource)
+}
+
+// signStake registers a staking transaction; only energy is simulated
+func (f *FakeChain) signStake(ownerPrivKey string, kind string, receiver string, amount money.Amount, resource string) (SignedTx, error) {
+	owner, _, _, err := getTronAddressAndHexFromPrivKey(ownerPrivKey)
+	if err != nil {
+		return SignedTx{}, fmt.Errorf("failed to get address from private key: %v", err)
+	}
+	if resource != ResourceEnergy {
+		return SignedTx{}, fmt.Errorf("fake chain supports only %s", ResourceEnergy)
+	}
+	if receiver != "" {
+		if err := ValidateAddress(receiver); err != nil {
+			return SignedTx{}, err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.signedTx(f.newTx(kind, owner, receiver, amount.Units())), nil
+}
+
+func (f *FakeChain) GetNowBlockNumber() (int64, error) {
+	return f.Height(), nil
+}
+
+func (f *FakeChain) GetUSDTTransfers(blockNum int64) ([]TRC20Transfer, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if blockNum > f.height {
+		return nil, fmt.Errorf("block %d is not produced yet", blockNum)
+	}
+
+	var transfers []TRC20Transfer
+	for _, tx := range f.txs {
+		if !tx.submitted || tx.block != blockNum || tx.kind != "usdt" || tx.result != "SUCCESS" {
+			continue
+		}
+		transfers = append(transfers, TRC20Transfer{
+			TxID:        tx.id,
+			BlockNumber: tx.block,
+			From:        tx.from,
+			To:          tx.to,
+			Amount:      money.FromUnits(tx.amount),
+		})
+	}
+	// Map iteration order is random, the scanner expects a stable one
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].TxID < transfers[j].TxID })
+	return transfers, nil
+}
+
+// newTx registers a signed, not yet broadcast transaction. Caller must hold f.mu.
+func (f *FakeChain) newTx(kind, from, to string, amount int64) *fakeTx {
+	f.seq++
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%d|%s|%s|%s|%d", f.seq, kind, from, to, amount)))
+	tx := &fakeTx{
+		id:         hex.EncodeToString(sum[:]),
+		kind:       kind,
+		from:       from,
+		to:         to,
+		amount:     amount,
+		expiration: time.Now().Add(f.TxLifetime),
+	}
+	f.txs[tx.id] = tx
+	return tx
+}
+
+func (f *FakeChain) signedTx(tx *fakeTx) SignedTx {
+	return SignedTx{
+		TxID:       tx.id,
+		Expiration: tx.expiration,
+		Raw: map[string]interface{}{
+			"txID":      tx.id,
+			"raw_data":  map[string]interface{}{"expiration": float64(tx.expiration.UnixMilli())},
+			"signature": []string{},
+		},
+	}
+}
@@ -0,0 +1,171 @@
+package tronclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"production_wallet_back/pkg/money"
+	"sync"
+	"time"
+)
+
+// usdtTransferSize is the bandwidth, in bytes, of a signed TRC20 transfer
+const usdtTransferSize = 345
+
+// ChainParameters are the fee parameters of the network from /wallet/getchainparameters
+type ChainParameters struct {
+	EnergyFee      int64 `json:"energy_fee"`      // SUN burned per energy unit (getEnergyFee)
+	TransactionFee int64 `json:"transaction_fee"` // SUN burned per byte of bandwidth (getTransactionFee)
+}
+
+// FeeEstimate splits the cost of a USDT transfer into what staked resources cover and what is burned
+type FeeEstimate struct {
+	Energy             int64        `json:"energy"`
+	EnergyFromStake    int64        `json:"energy_from_stake"`
+	EnergyBurned       int64        `json:"energy_burned"`
+	Bandwidth          int64        `json:"bandwidth"`
+	BandwidthFromStake int64        `json:"bandwidth_from_stake"` // staked or free daily bandwidth
+	BandwidthBurned    int64        `json:"bandwidth_burned"`
+	EnergyFee          int64        `json:"energy_fee"`
+	TransactionFee     int64        `json:"transaction_fee"`
+	BurnTRX            money.Amount `json:"burn_trx"`  // TRX the sender must hold
+	FeeLimit           money.Amount `json:"fee_limit"` // cap on TRX burned for energy if stake runs out
+}
+
+// estimateFee prices energy and bandwidth of a transaction against what the account has.
+// Bandwidth is not split: if neither staked nor free bandwidth covers the whole transaction,
+// all of it is burned.
+func estimateFee(params ChainParameters, resources AccountResources, energy int64, bandwidth int64) FeeEstimate {
+	est := FeeEstimate{
+		Energy:         energy,
+		Bandwidth:      bandwidth,
+		EnergyFee:      params.EnergyFee,
+		TransactionFee: params.TransactionFee,
+	}
+	est.EnergyFromStake = min(energy, resources.AvailableEnergy())
+	est.EnergyBurned = energy - est.EnergyFromStake
+
+	staked := resources.NetLimit - resources.NetUsed
+	free := resources.FreeNetLimit - resources.FreeNetUsed
+	if staked >= bandwidth || free >= bandwidth {
+		est.BandwidthFromStake = bandwidth
+	} else {
+		est.BandwidthBurned = bandwidth
+	}
+
+	est.BurnTRX = money.FromUnits(est.EnergyBurned*params.EnergyFee + est.BandwidthBurned*params.TransactionFee)
+	// Energy estimate already has a safety margin; the limit covers the whole transfer being
+	// paid by burning, so a stake drained between estimate and execution does not fail it
+	est.FeeLimit = money.FromUnits(energy * params.EnergyFee)
+	return est
+}
+
+// feeCache keeps chain parameters and account resources between requests.
+// Resources are cached briefly and dropped after every broadcast, since transactions spend them.
+type feeCache struct {
+	mu          sync.Mutex
+	params      ChainParameters
+	paramsAt    time.Time
+	resources   map[string]AccountResources
+	resourcesAt map[string]time.Time
+}
+
+func newFeeCache() *feeCache {
+	return &feeCache{
+		resources:   make(map[string]AccountResources),
+		resourcesAt: make(map[string]time.Time),
+	}
+}
+
+func (f *feeCache) getParams(ttl time.Duration) (ChainParameters, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.params, !f.paramsAt.IsZero() && time.Since(f.paramsAt) < ttl
+}
+
+func (f *feeCache) setParams(params ChainParameters) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.params, f.paramsAt = params, time.Now()
+}
+
+func (f *feeCache) getResources(address string, ttl time.Duration) (AccountResources, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	at, ok := f.resourcesAt[address]
+	return f.resources[address], ok && time.Since(at) < ttl
+}
+
+func (f *feeCache) setResources(address string, resources AccountResources) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.resources[address], f.resourcesAt[address] = resources, time.Now()
+}
+
+func (f *feeCache) forgetResources() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	clear(f.resources)
+	clear(f.resourcesAt)
+}
+
+// GetChainParameters returns energy and bandwidth prices, cached for ParamsTTL
+func (c *TronHTTPClient) GetChainParameters() (ChainParameters, error) {
+	if params, ok := c.cache.getParams(c.ParamsTTL); ok {
+		return params, nil
+	}
+	response, err := c.postWithClient(nil, "/wallet/getchainparameters", map[string]interface{}{})
+	if err != nil {
+		return ChainParameters{}, fmt.Errorf("failed to get chain parameters: %v", err)
+	}
+
+	var raw struct {
+		ChainParameter []struct {
+			Key   string `json:"key"`
+			Value int64  `json:"value"`
+		} `json:"chainParameter"`
+	}
+	if err := json.Unmarshal(response, &raw); err != nil {
+		return ChainParameters{}, fmt.Errorf("failed to parse chain parameters: %v", err)
+	}
+	var params ChainParameters
+	for _, p := range raw.ChainParameter {
+		switch p.Key {
+		case "getEnergyFee":
+			params.EnergyFee = p.Value
+		case "getTransactionFee":
+			params.TransactionFee = p.Value
+		}
+	}
+	if params.EnergyFee <= 0 || params.TransactionFee <= 0 {
+		return ChainParameters{}, fmt.Errorf("chain parameters lack getEnergyFee or getTransactionFee")
+	}
+	c.cache.setParams(params)
+	return params, nil
+}
+
+// EstimateTransferFee estimates what a USDT transfer from fromAddr costs with the live prices
+// and the sender's current energy and bandwidth
+func (c *TronHTTPClient) EstimateTransferFee(fromAddr string, toAddr string, amount money.Amount) (FeeEstimate, error) {
+	energy, err := c.EstimateTransferEnergy(fromAddr, toAddr, amount)
+	if err != nil {
+		return FeeEstimate{}, fmt.Errorf("failed to estimate energy: %v", err)
+	}
+	params, err := c.GetChainParameters()
+	if err != nil {
+		return FeeEstimate{}, err
+	}
+	resources, err := c.GetAccountResources(fromAddr)
+	if err != nil {
+		return FeeEstimate{}, err
+	}
+	return estimateFee(params, resources, energy, usdtTransferSize), nil
+}
+
+// EstimateRequiredTRX estimates the TRX burned by a USDT transfer
+func (c *TronHTTPClient) EstimateRequiredTRX(fromAddr string, toAddr string, amount money.Amount) (money.Amount, error) {
+	est, err := c.EstimateTransferFee(fromAddr, toAddr, amount)
+	if err != nil {
+		return 0, err
+	}
+	return est.BurnTRX, nil
+}
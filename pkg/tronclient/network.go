@@ -0,0 +1,24 @@
+package tronclient
+
+// Network describes one TRON network profile from the `network` section of config.yaml
+type Network struct {
+	Name         string   `mapstructure:"name"`
+	GridURL      string   `mapstructure:"trongrid_url"`  // main full node / TronGrid HTTP API
+	ScanURL      string   `mapstructure:"tronscan_url"`  // TronScan API used as a balance fallback, empty to disable
+	Endpoints    []string `mapstructure:"endpoints"`     // fallback nodes tried when the main one is unreachable
+	USDTContract string   `mapstructure:"usdt_contract"` // base58 address of the USDT TRC20 contract
+}
+
+// endpoints returns the main URL followed by the fallback nodes without duplicates
+func (n Network) endpoints() []string {
+	seen := make(map[string]bool)
+	var urls []string
+	for _, url := range append([]string{n.GridURL}, n.Endpoints...) {
+		if url == "" || seen[url] {
+			continue
+		}
+		seen[url] = true
+		urls = append(urls, url)
+	}
+	return urls
+}
@@ -0,0 +1,177 @@
+package tronclient
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"production_wallet_back/pkg/money"
+	"time"
+)
+
+// Stake 2.0 resource types
+const (
+	ResourceEnergy    = "ENERGY"
+	ResourceBandwidth = "BANDWIDTH"
+)
+
+// AccountResources mirrors /wallet/getaccountresource: the account's own limits together
+// with network totals that define how much energy one staked TRX gives
+type AccountResources struct {
+	EnergyLimit       int64 `json:"energy_limit"` // from own stake and stake delegated to the account
+	EnergyUsed        int64 `json:"energy_used"`
+	NetLimit          int64 `json:"net_limit"`
+	NetUsed           int64 `json:"net_used"`
+	FreeNetLimit      int64 `json:"free_net_limit"`
+	FreeNetUsed       int64 `json:"free_net_used"`
+	TotalEnergyLimit  int64 `json:"total_energy_limit"`  // energy the network hands out per day
+	TotalEnergyWeight int64 `json:"total_energy_weight"` // TRX staked for energy network-wide
+}
+
+// AvailableEnergy returns energy the account can spend right now without burning TRX
+func (r AccountResources) AvailableEnergy() int64 {
+	return max(r.EnergyLimit-r.EnergyUsed, 0)
+}
+
+// StakeForEnergy returns how much staked TRX gives energy, rounded up to whole TRX
+func (r AccountResources) StakeForEnergy(energy int64) (money.Amount, error) {
+	if r.TotalEnergyLimit <= 0 || r.TotalEnergyWeight <= 0 {
+		return 0, fmt.Errorf("network energy totals are unknown")
+	}
+	trx := (energy*r.TotalEnergyWeight + r.TotalEnergyLimit - 1) / r.TotalEnergyLimit
+	return money.FromUnits(max(trx, 1) * money.One.Units()), nil
+}
+
+// GetAccountResources returns energy and bandwidth of address, cached for ResourcesTTL
+func (c *TronHTTPClient) GetAccountResources(address string) (AccountResources, error) {
+	if err := ValidateAddress(address); err != nil {
+		return AccountResources{}, err
+	}
+	if resources, ok := c.cache.getResources(address, c.ResourcesTTL); ok {
+		return resources, nil
+	}
+	response, err := c.postWithClient(nil, "/wallet/getaccountresource", map[string]interface{}{
+		"address": base58CheckToHex(address),
+		"visible": false,
+	})
+	if err != nil {
+		return AccountResources{}, fmt.Errorf("failed to get account resources: %v", err)
+	}
+
+	var raw struct {
+		EnergyLimit       int64 `json:"EnergyLimit"`
+		EnergyUsed        int64 `json:"EnergyUsed"`
+		NetLimit          int64 `json:"NetLimit"`
+		NetUsed           int64 `json:"NetUsed"`
+		FreeNetLimit      int64 `json:"freeNetLimit"`
+		FreeNetUsed       int64 `json:"freeNetUsed"`
+		TotalEnergyLimit  int64 `json:"TotalEnergyLimit"`
+		TotalEnergyWeight int64 `json:"TotalEnergyWeight"`
+	}
+	if err := json.Unmarshal(response, &raw); err != nil {
+		return AccountResources{}, fmt.Errorf("failed to parse account resources: %v", err)
+	}
+	resources := AccountResources(raw)
+	c.cache.setResources(address, resources)
+	return resources, nil
+}
+
+// GetDelegatableStake returns how much TRX staked by address for resource can still be delegated
+func (c *TronHTTPClient) GetDelegatableStake(address string, resource string) (money.Amount, error) {
+	if err := ValidateAddress(address); err != nil {
+		return 0, err
+	}
+	resourceType := 0
+	if resource == ResourceEnergy {
+		resourceType = 1
+	}
+	response, err := c.postWithClient(nil, "/wallet/getcandelegatedmaxsize", map[string]interface{}{
+		"owner_address": base58CheckToHex(address),
+		"type":          resourceType,
+		"visible":       false,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to get delegatable stake: %v", err)
+	}
+
+	var raw struct {
+		MaxSize int64 `json:"max_size"`
+	}
+	if err := json.Unmarshal(response, &raw); err != nil {
+		return 0, fmt.Errorf("failed to parse delegatable stake: %v", err)
+	}
+	return money.FromUnits(raw.MaxSize), nil
+}
+
+// SignFreezeBalance signs a Stake 2.0 freezebalancev2: amount TRX of the owner is staked for resource
+func (c *TronHTTPClient) SignFreezeBalance(ownerPrivKey string, amount money.Amount, resource string) (SignedTx, error) {
+	return c.signResourceTx(ownerPrivKey, "/wallet/freezebalancev2", func(ownerHex string) map[string]interface{} {
+		return map[string]interface{}{
+			"owner_address":  ownerHex,
+			"frozen_balance": amount.Units(),
+			"resource":       resource,
+			"visible":        false,
+		}
+	})
+}
+
+// SignDelegateResource signs a delegateresource: resource of amount staked TRX goes to receiver.
+// Delegation is not locked, so it can be reclaimed at once.
+func (c *TronHTTPClient) SignDelegateResource(ownerPrivKey string, receiver string, amount money.Amount, resource string) (SignedTx, error) {
+	if err := ValidateAddress(receiver); err != nil {
+		return SignedTx{}, err
+	}
+	return c.signResourceTx(ownerPrivKey, "/wallet/delegateresource", func(ownerHex string) map[string]interface{} {
+		return map[string]interface{}{
+			"owner_address":    ownerHex,
+			"receiver_address": base58CheckToHex(receiver),
+			"balance":          amount.Units(),
+			"resource":         resource,
+			"lock":             false,
+			"visible":          false,
+		}
+	})
+}
+
+// SignUndelegateResource signs an undelegateresource: resource of amount staked TRX is taken back from receiver
+func (c *TronHTTPClient) SignUndelegateResource(ownerPrivKey string, receiver string, amount money.Amount, resource string) (SignedTx, error) {
+	if err := ValidateAddress(receiver); err != nil {
+		return SignedTx{}, err
+	}
+	return c.signResourceTx(ownerPrivKey, "/wallet/undelegateresource", func(ownerHex string) map[string]interface{} {
+		return map[string]interface{}{
+			"owner_address":    ownerHex,
+			"receiver_address": base58CheckToHex(receiver),
+			"balance":          amount.Units(),
+			"resource":         resource,
+			"visible":          false,
+		}
+	})
+}
+
+// signResourceTx builds a staking transaction on the node and signs it locally
+func (c *TronHTTPClient) signResourceTx(ownerPrivKey string, path string, params func(ownerHex string) map[string]interface{}) (SignedTx, error) {
+	_, ownerHex, privKey, err := getTronAddressAndHexFromPrivKey(ownerPrivKey)
+	if err != nil {
+		return SignedTx{}, fmt.Errorf("failed to get address from private key: %v", err)
+	}
+
+	client := &http.Client{Timeout: time.Second * 30}
+	rawTx, err := c.postWithClient(client, path, params(ownerHex))
+	if err != nil {
+		return SignedTx{}, fmt.Errorf("failed to create %s transaction: %v", path, err)
+	}
+
+	// Node rejects invalid requests with {"Error": "..."} instead of a transaction
+	var nodeErr struct {
+		Error string `json:"Error"`
+	}
+	if err := json.Unmarshal(rawTx, &nodeErr); err == nil && nodeErr.Error != "" {
+		return SignedTx{}, fmt.Errorf("%s: %s", path, nodeErr.Error)
+	}
+
+	signed, err := signTransaction(rawTx, privKey)
+	if err != nil {
+		return SignedTx{}, fmt.Errorf("failed to sign %s transaction: %v", path, err)
+	}
+	return newSignedTx(signed)
+}
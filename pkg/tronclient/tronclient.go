@@ -11,129 +11,99 @@ import (
 	"io"
 	"math/big"
 	"net/http"
+	"production_wallet_back/pkg/money"
 	"strconv"
 	"time"
 
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/mr-tron/base58"
+	"github.com/sirupsen/logrus"
 )
 
-const (
-	tronGridAPI = "https://api.trongrid.io"
-	tronScanAPI = "https://tronscan.org"
-)
-
-// Alternative endpoints in case main one is down
-var alternativeEndpoints = []string{
-	"https://api.trongrid.io",
-	"https://api.shasta.trongrid.io", // Testnet (for testing)
-}
-
 type TronHTTPClient struct {
 	APIKey       string
 	USDTContract string
-}
+	Network      Network
+	ParamsTTL    time.Duration // how long chain parameters are cached
+	ResourcesTTL time.Duration // how long account energy and bandwidth are cached
 
-func NewTronHTTPClient(apiKey string, usdtContract string) *TronHTTPClient {
-	fmt.Printf("=== NewTronHTTPClient DEBUG ===\n")
-	fmt.Printf("API Key: %s\n", apiKey)
-	fmt.Printf("USDT Contract: %s\n", usdtContract)
+	cache *feeCache
+}
 
+func NewTronHTTPClient(apiKey string, network Network) *TronHTTPClient {
 	client := &TronHTTPClient{
 		APIKey:       apiKey,
-		USDTContract: usdtContract,
+		USDTContract: network.USDTContract,
+		Network:      network,
+		ParamsTTL:    10 * time.Minute,
+		ResourcesTTL: 3 * time.Second,
+		cache:        newFeeCache(),
 	}
-
-	fmt.Printf("Client created with contract: %s\n", client.USDTContract)
-	fmt.Printf("=== NewTronHTTPClient COMPLETED ===\n")
-
+	logrus.Debugf("tron: network %s (%v), USDT contract %s", network.Name, network.endpoints(), network.USDTContract)
 	return client
 }
 
-func (c *TronHTTPClient) SendUSDT(fromPrivKey string, toAddress string, amount float64) (string, error) {
+func (c *TronHTTPClient) SendUSDT(fromPrivKey string, toAddress string, amount money.Amount) (string, error) {
+	signedTx, err := c.SignUSDTTransfer(fromPrivKey, toAddress, amount)
+	if err != nil {
+		return "", err
+	}
+	return c.BroadcastTransaction(signedTx.Raw)
+}
+
+// SignUSDTTransfer builds and signs a USDT transfer without broadcasting it
+func (c *TronHTTPClient) SignUSDTTransfer(fromPrivKey string, toAddress string, amount money.Amount) (SignedTx, error) {
 	// Get the sender's address from private key
 	fromAddr, fromAddrHex, privKey, err := getTronAddressAndHexFromPrivKey(fromPrivKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to get address from private key: %v", err)
+		return SignedTx{}, fmt.Errorf("failed to get address from private key: %v", err)
 	}
 
-	fmt.Println("=== SendUSDT DEBUG ===")
-	fmt.Println("From Address:", fromAddr)
-	fmt.Println("To Address:", toAddress)
-	fmt.Println("Contract Address (base58):", c.USDTContract)
-	fmt.Printf("Amount: %.6f\n", amount)
+	logrus.Debugf("From Address: %s", fromAddr)
+	logrus.Debugf("To Address: %s", toAddress)
+	logrus.Debugf("Contract Address (base58): %s", c.USDTContract)
+	logrus.Debugf("Amount: %s", amount)
 
 	// Check USDT balance first
 	balance, err := c.GetUSDTBalance(fromAddr)
 	if err != nil {
-		return "", fmt.Errorf("failed to check USDT balance: %v", err)
+		return SignedTx{}, fmt.Errorf("failed to check USDT balance: %v", err)
 	}
-	fmt.Printf("Current USDT balance: %.6f\n", balance)
+	logrus.Debugf("Current USDT balance: %s", balance)
 
 	if balance < amount {
-		return "", fmt.Errorf("insufficient USDT balance: have %.6f, need %.6f", balance, amount)
+		return SignedTx{}, fmt.Errorf("insufficient USDT balance: have %s, need %s", balance, amount)
 	}
 
-	// Estimate energy required
-	estimatedEnergy, err := c.EstimateTransferEnergy(fromAddr, toAddress, amount)
+	// Estimate what the transfer burns with live prices and the sender's resources
+	fee, err := c.EstimateTransferFee(fromAddr, toAddress, amount)
 	if err != nil {
-		return "", fmt.Errorf("failed to estimate energy: %v", err)
+		return SignedTx{}, err
 	}
-	fmt.Printf("Estimated energy required: %d\n", estimatedEnergy)
+	logrus.Debugf("Energy: %d (%d from stake, %d burned), bandwidth: %d (%d burned), burn: %s TRX, fee limit: %s TRX",
+		fee.Energy, fee.EnergyFromStake, fee.EnergyBurned, fee.Bandwidth, fee.BandwidthBurned, fee.BurnTRX, fee.FeeLimit)
 
 	// Check TRX balance
 	trxBalance, err := c.GetTRXBalance(fromAddr)
 	if err != nil {
-		return "", fmt.Errorf("failed to check TRX balance: %v", err)
+		return SignedTx{}, fmt.Errorf("failed to check TRX balance: %v", err)
 	}
-	fmt.Printf("Current TRX balance: %.6f\n", trxBalance)
-
-	// Calculate required TRX for energy
-	// Using current TRON energy price: 420 SUN per energy
-	const energyPrice = 420 // SUN per energy unit
-	requiredTRX := float64(estimatedEnergy) * float64(energyPrice) / 1_000_000
-	fmt.Printf("Required TRX for energy: %.6f\n", requiredTRX)
-
-	// Add 20% buffer for safety (reduced from 50%)
-	requiredTRXWithBuffer := requiredTRX * 1.2
-
-	// If TRX balance is insufficient, try with minimal fee limit
-	if trxBalance < requiredTRXWithBuffer {
-		fmt.Printf("Warning: TRX balance (%.6f) is less than estimated requirement (%.6f)\n", trxBalance, requiredTRXWithBuffer)
-
-		// Try with available TRX balance (minus small safety margin)
-		availableTRX := trxBalance * 0.95 // Use 95% of available balance
-		if availableTRX < 0.001 {         // Minimum 0.001 TRX
-			return "", fmt.Errorf("insufficient TRX balance for energy: have %.6f TRX, need at least 0.001 TRX", trxBalance)
-		}
-
-		fmt.Printf("Using available TRX: %.6f (instead of estimated %.6f)\n", availableTRX, requiredTRXWithBuffer)
-		requiredTRXWithBuffer = availableTRX
+	logrus.Debugf("Current TRX balance: %s", trxBalance)
+	if trxBalance < fee.BurnTRX {
+		return SignedTx{}, fmt.Errorf("insufficient TRX balance for fee: have %s TRX, need %s TRX", trxBalance, fee.BurnTRX)
 	}
 
 	// Convert addresses to hex
 	contractHex := base58CheckToHex(c.USDTContract)
 	toAddrHex := base58CheckToHex(toAddress)
 
-	fmt.Println("From (hex):", fromAddrHex)
-	fmt.Println("To (hex):", toAddrHex)
-	fmt.Println("Contract (hex):", contractHex)
+	logrus.Debugf("From (hex): %s", fromAddrHex)
+	logrus.Debugf("To (hex): %s", toAddrHex)
+	logrus.Debugf("Contract (hex): %s", contractHex)
 
 	// Encode transfer parameters
 	params := encodeTransferParams(toAddress, amount)
-	fmt.Println("Encoded Params:", params)
-
-	// Create transaction parameters with dynamic fee limit
-	feeLimitSun := int64(requiredTRXWithBuffer * 1_000_000) // Convert TRX to SUN
-
-	// Ensure minimum fee limit for USDT transfers
-	if feeLimitSun < 2_000_000 { // If less than 2 TRX
-		fmt.Printf("Setting minimum fee limit: 2 TRX (estimated: %.6f TRX)\n", requiredTRXWithBuffer)
-		feeLimitSun = 2_000_000 // 2 TRX in SUN (минимальный лимит для USDT)
-	} else if feeLimitSun > 5_000_000 { // If more than 5 TRX
-		fmt.Printf("Warning: Fee limit too high (%.6f TRX), using maximum limit\n", requiredTRXWithBuffer)
-		feeLimitSun = 5_000_000 // 5 TRX in SUN (максимальный лимит)
-	}
+	logrus.Debugf("Encoded Params: %s", params)
 
 	param := map[string]interface{}{
 		"owner_address":     fromAddrHex,
@@ -141,14 +111,12 @@ func (c *TronHTTPClient) SendUSDT(fromPrivKey string, toAddress string, amount f
 		"function_selector": "transfer(address,uint256)",
 		"parameter":         params[8:], // Remove methodID
 		"call_value":        0,
-		"fee_limit":         feeLimitSun,
+		"fee_limit":         fee.FeeLimit.Units(),
 		"visible":           false,
 	}
 
-	fmt.Println("=== Transaction Parameters ===")
 	paramJSON, _ := json.MarshalIndent(param, "", "  ")
-	fmt.Println(string(paramJSON))
-	fmt.Println("===========================")
+	logrus.Debugf("Transaction Parameters: %s", string(paramJSON))
 
 	// Create transaction with increased timeout
 	client := &http.Client{
@@ -157,25 +125,25 @@ func (c *TronHTTPClient) SendUSDT(fromPrivKey string, toAddress string, amount f
 
 	var rawTx []byte
 	maxRetries := 5 // Increase retries
-	fmt.Printf("Creating transaction with %d retries...\n", maxRetries)
+	logrus.Debugf("Creating transaction with %d retries...", maxRetries)
 	for i := 0; i < maxRetries; i++ {
-		fmt.Printf("Creating transaction attempt %d/%d...\n", i+1, maxRetries)
+		logrus.Debugf("Creating transaction attempt %d/%d...", i+1, maxRetries)
 		rawTx, err = c.postWithClient(client, "/wallet/triggersmartcontract", param)
 		if err == nil {
-			fmt.Printf("Transaction created successfully on attempt %d\n", i+1)
+			logrus.Debugf("Transaction created successfully on attempt %d", i+1)
 			break
 		}
-		fmt.Printf("Attempt %d failed: %v\n", i+1, err)
+		logrus.Debugf("Attempt %d failed: %v", i+1, err)
 		if i < maxRetries-1 {
-			fmt.Printf("Waiting 5 seconds before retry...\n")
+			logrus.Debugf("Waiting 5 seconds before retry...")
 			time.Sleep(time.Second * 5) // Increase delay between retries
 		}
 	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create transaction after %d attempts: %v", maxRetries, err)
+		return SignedTx{}, fmt.Errorf("failed to create transaction after %d attempts: %v", maxRetries, err)
 	}
 
-	fmt.Println("RAW TX (triggersmartcontract):", string(rawTx))
+	logrus.Debugf("RAW TX (triggersmartcontract): %s", string(rawTx))
 
 	// Sign transaction
 	var signedTx map[string]interface{}
@@ -184,72 +152,21 @@ func (c *TronHTTPClient) SendUSDT(fromPrivKey string, toAddress string, amount f
 		if err == nil {
 			break
 		}
-		fmt.Printf("Signing attempt %d failed: %v\n", i+1, err)
+		logrus.Debugf("Signing attempt %d failed: %v", i+1, err)
 		if i < maxRetries-1 {
 			time.Sleep(time.Second * 1)
 		}
 	}
 	if err != nil {
-		return "", fmt.Errorf("failed to sign transaction after %d attempts: %v", maxRetries, err)
-	}
-
-	// Add delay before broadcasting
-	time.Sleep(time.Second * 2)
-
-	// Broadcast transaction with increased timeout
-	var broadcastResult []byte
-	broadcastClient := &http.Client{
-		Timeout: time.Second * 120, // Увеличиваем timeout до 120 секунд
-	}
-
-	fmt.Printf("Broadcasting transaction with %d retries...\n", maxRetries)
-	for i := 0; i < maxRetries; i++ {
-		fmt.Printf("Broadcast attempt %d/%d...\n", i+1, maxRetries)
-		broadcastResult, err = c.postWithClient(broadcastClient, "/wallet/broadcasttransaction", signedTx)
-		if err == nil {
-			fmt.Printf("Broadcast successful on attempt %d\n", i+1)
-			break
-		}
-		fmt.Printf("Broadcast attempt %d failed: %v\n", i+1, err)
-		if i < maxRetries-1 {
-			fmt.Printf("Waiting 10 seconds before retry...\n")
-			time.Sleep(time.Second * 10) // Увеличиваем задержку между попытками
-		}
-	}
-	if err != nil {
-		return "", fmt.Errorf("failed to broadcast transaction after %d attempts: %v", maxRetries, err)
-	}
-
-	fmt.Println("Broadcast result:", string(broadcastResult))
-
-	// Parse broadcast result
-	var result map[string]interface{}
-	if err := json.Unmarshal(broadcastResult, &result); err != nil {
-		return "", fmt.Errorf("failed to parse broadcast result: %v", err)
+		return SignedTx{}, fmt.Errorf("failed to sign transaction after %d attempts: %v", maxRetries, err)
 	}
 
-	// Check for errors in broadcast result
-	if code, ok := result["code"].(string); ok && code != "" {
-		message := ""
-		if msg, ok := result["message"].(string); ok {
-			message = msg
-		}
-		return "", fmt.Errorf("broadcast failed with code %s: %s", code, message)
-	}
-
-	// Get transaction ID
-	txID, ok := result["txid"].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid txid in response: %v", result)
-	}
-
-	return txID, nil
+	return newSignedTx(signedTx)
 }
 
-func (c *TronHTTPClient) GetUSDTBalance(address string) (float64, error) {
-	fmt.Printf("=== GetUSDTBalance DEBUG ===\n")
-	fmt.Printf("Address: %s\n", address)
-	fmt.Printf("USDT Contract: %s\n", c.USDTContract)
+func (c *TronHTTPClient) GetUSDTBalance(address string) (money.Amount, error) {
+	logrus.Debugf("Address: %s", address)
+	logrus.Debugf("USDT Contract: %s", c.USDTContract)
 
 	decoded, err := base58.Decode(address)
 	if err != nil || len(decoded) != 25 {
@@ -260,8 +177,8 @@ func (c *TronHTTPClient) GetUSDTBalance(address string) (float64, error) {
 	addrBody := addr[1:] // без префикса 0x41
 	addrHex := hex.EncodeToString(addr)
 
-	fmt.Printf("Address (hex): %s\n", addrHex)
-	fmt.Printf("Address body (hex): %x\n", addrBody)
+	logrus.Debugf("Address (hex): %s", addrHex)
+	logrus.Debugf("Address body (hex): %x", addrBody)
 
 	param := map[string]interface{}{
 		"owner_address":     addrHex,
@@ -271,97 +188,85 @@ func (c *TronHTTPClient) GetUSDTBalance(address string) (float64, error) {
 		"visible":           false,
 	}
 
-	fmt.Printf("Request params: %+v\n", param)
+	logrus.Debugf("Request params: %+v", param)
 
 	response, err := c.post("/wallet/triggerconstantcontract", param)
 	if err != nil {
-		fmt.Printf("API call failed: %v\n", err)
+		logrus.Debugf("API call failed: %v", err)
 		return 0, err
 	}
 
-	fmt.Printf("API response: %s\n", string(response))
+	logrus.Debugf("API response: %s", string(response))
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(response, &result); err != nil {
-		fmt.Printf("JSON unmarshal failed: %v\n", err)
+		logrus.Debugf("JSON unmarshal failed: %v", err)
 		return 0, err
 	}
 
-	fmt.Printf("Parsed result: %+v\n", result)
+	logrus.Debugf("Parsed result: %+v", result)
 
 	constants, ok := result["constant_result"].([]interface{})
 	if !ok || len(constants) == 0 {
-		fmt.Printf("Empty constant_result: %+v\n", result)
+		logrus.Debugf("Empty constant_result: %+v", result)
 		return 0, errors.New("empty constant_result")
 	}
 
 	hexStr, _ := constants[0].(string)
-	fmt.Printf("Balance hex: %s\n", hexStr)
+	logrus.Debugf("Balance hex: %s", hexStr)
 
-	balance := new(big.Int)
-	balance.SetString(hexStr, 16)
+	balance, ok := new(big.Int).SetString(hexStr, 16)
+	if !ok {
+		return 0, fmt.Errorf("invalid balance %q", hexStr)
+	}
 
-	usdtBalance := float64(balance.Int64()) / 1e6
-	fmt.Printf("USDT Balance: %.6f\n", usdtBalance)
-	fmt.Printf("=== GetUSDTBalance COMPLETED ===\n")
+	usdtBalance, err := money.FromBig(balance)
+	if err != nil {
+		return 0, err
+	}
+	logrus.Debugf("USDT Balance: %s", usdtBalance)
 
 	return usdtBalance, nil
 }
 
 func (c *TronHTTPClient) post(path string, payload interface{}) ([]byte, error) {
 	b, _ := json.Marshal(payload)
-	url := tronGridAPI + path
-	fmt.Printf("POST %s\nPayload: %s\n", url, string(b))
+	endpoints := c.Network.endpoints()
+	if len(endpoints) == 0 {
+		return nil, errors.New("no TRON endpoints configured")
+	}
 
 	client := &http.Client{
 		Timeout: time.Second * 120, // увеличиваем таймаут до 2 минут
 	}
 
-	// Retry logic for TronGrid API calls
-	maxRetries := 3
+	// Retry logic for TronGrid API calls, each attempt goes to the next endpoint
+	maxRetries := max(3, len(endpoints))
 	var lastErr error
 
 	for attempt := 1; attempt <= maxRetries; attempt++ {
-		fmt.Printf("Attempt %d/%d for %s\n", attempt, maxRetries, path)
-
-		req, _ := http.NewRequest("POST", url, bytes.NewBuffer(b))
-		req.Header.Set("Content-Type", "application/json")
-		req.Header.Set("TRON-PRO-API-KEY", c.APIKey)
-
-		resp, err := client.Do(req)
-		if err != nil {
-			lastErr = err
-			fmt.Printf("HTTP error (attempt %d): %v\n", attempt, err)
-
-			if attempt < maxRetries {
-				fmt.Printf("Waiting 5 seconds before retry...\n")
-				time.Sleep(time.Second * 5)
-				continue
-			}
-			return nil, err
-		}
-		defer resp.Body.Close()
+		url := endpoints[(attempt-1)%len(endpoints)] + path
+		logrus.Debugf("tron: POST %s (attempt %d/%d)", url, attempt, maxRetries)
 
-		responseBody, err := io.ReadAll(resp.Body)
+		responseBody, err := c.do(client, url, b)
 		if err != nil {
 			lastErr = err
-			fmt.Printf("Read body error (attempt %d): %v\n", attempt, err)
+			logrus.Debugf("tron: POST %s (attempt %d) failed: %v", url, attempt, err)
 
 			if attempt < maxRetries {
-				fmt.Printf("Waiting 5 seconds before retry...\n")
 				time.Sleep(time.Second * 5)
 				continue
 			}
 			return nil, err
 		}
 
-		fmt.Printf("Response from %s (attempt %d): %s\n", path, attempt, string(responseBody))
 		return responseBody, nil
 	}
 
 	return nil, fmt.Errorf("failed after %d attempts, last error: %v", maxRetries, lastErr)
 }
 
+// postWithClient sends one request, falling back to the next endpoint on transport errors
 func (c *TronHTTPClient) postWithClient(client *http.Client, path string, payload interface{}) ([]byte, error) {
 	if client == nil {
 		client = &http.Client{
@@ -370,9 +275,27 @@ func (c *TronHTTPClient) postWithClient(client *http.Client, path string, payloa
 	}
 
 	b, _ := json.Marshal(payload)
-	req, _ := http.NewRequest("POST", tronGridAPI+path, bytes.NewBuffer(b))
+	lastErr := errors.New("no TRON endpoints configured")
+	for _, endpoint := range c.Network.endpoints() {
+		body, err := c.do(client, endpoint+path, b)
+		if err == nil {
+			return body, nil
+		}
+		logrus.Debugf("tron: endpoint %s failed: %v", endpoint, err)
+		lastErr = err
+	}
+	return nil, lastErr
+}
+
+func (c *TronHTTPClient) do(client *http.Client, url string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("TRON-PRO-API-KEY", c.APIKey)
+	if c.APIKey != "" {
+		req.Header.Set("TRON-PRO-API-KEY", c.APIKey)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
@@ -398,7 +321,7 @@ func base58CheckToHex(address string) string {
 	return hex.EncodeToString(raw)
 }
 
-func encodeTransferParams(toAddress string, amount float64) string {
+func encodeTransferParams(toAddress string, amount money.Amount) string {
 	// Method ID for transfer(address,uint256)
 	methodID := "a9059cbb"
 
@@ -419,17 +342,14 @@ func encodeTransferParams(toAddress string, amount float64) string {
 	// Remove the 0x41 prefix and pad to 32 bytes
 	addrParam := fmt.Sprintf("%064x", raw[1:])
 
-	// Convert amount to sun (6 decimals) and pad to 32 bytes
-	amountInt := big.NewInt(int64(amount * 1e6))
-	amountParam := fmt.Sprintf("%064x", amountInt)
+	// Amount is already in base units (6 decimals), pad to 32 bytes
+	amountParam := fmt.Sprintf("%064x", amount.Big())
 
 	// Combine method ID and parameters
 	return methodID + addrParam + amountParam
 }
 
 func getTronAddressAndHexFromPrivKey(privHex string) (string, string, *ecdsa.PrivateKey, error) {
-	fmt.Println("=== Getting TRON Address from Private Key ===")
-	fmt.Printf("Private Key (hex): %s\n", privHex)
 
 	privBytes, err := hex.DecodeString(privHex)
 	if err != nil {
@@ -443,27 +363,26 @@ func getTronAddressAndHexFromPrivKey(privHex string) (string, string, *ecdsa.Pri
 
 	pubKey := privKey.PublicKey
 	pubBytes := crypto.FromECDSAPub(&pubKey)
-	fmt.Printf("Public Key (hex): %x\n", pubBytes)
+	logrus.Debugf("Public Key (hex): %x", pubBytes)
 
 	pubKeyHash := crypto.Keccak256(pubBytes[1:])
-	fmt.Printf("Public Key Hash (hex): %x\n", pubKeyHash)
+	logrus.Debugf("Public Key Hash (hex): %x", pubKeyHash)
 
 	addr := append([]byte{0x41}, pubKeyHash[12:]...)
-	fmt.Printf("TRON Address (hex): %x\n", addr)
+	logrus.Debugf("TRON Address (hex): %x", addr)
 
 	// Calculate checksum
 	first := sha256.Sum256(addr)
 	second := sha256.Sum256(first[:])
 	checksum := second[:4]
-	fmt.Printf("Checksum (hex): %x\n", checksum)
+	logrus.Debugf("Checksum (hex): %x", checksum)
 
 	full := append(addr, checksum...)
-	fmt.Printf("Full Address with Checksum (hex): %x\n", full)
+	logrus.Debugf("Full Address with Checksum (hex): %x", full)
 
 	base58Addr := base58.Encode(full)
-	fmt.Printf("Base58 Address: %s\n", base58Addr)
-	fmt.Printf("Hex Address: %s\n", hex.EncodeToString(addr))
-	fmt.Println("=== Address Generation Complete ===")
+	logrus.Debugf("Base58 Address: %s", base58Addr)
+	logrus.Debugf("Hex Address: %s", hex.EncodeToString(addr))
 
 	return base58Addr, hex.EncodeToString(addr), privKey, nil
 }
@@ -480,8 +399,7 @@ func signTransaction(rawTx []byte, privKey *ecdsa.PrivateKey) (map[string]interf
 		txObj = t
 	}
 
-	fmt.Println("=== Signing Transaction ===")
-	fmt.Printf("Raw Transaction: %+v\n", txObj)
+	logrus.Debugf("Raw Transaction: %+v", txObj)
 
 	// Get raw_data_hex
 	rawDataHex, ok := txObj["raw_data_hex"].(string)
@@ -489,7 +407,7 @@ func signTransaction(rawTx []byte, privKey *ecdsa.PrivateKey) (map[string]interf
 		return nil, errors.New("missing raw_data_hex in transaction")
 	}
 
-	fmt.Printf("Raw Data Hex to Sign: %s\n", rawDataHex)
+	logrus.Debugf("Raw Data Hex to Sign: %s", rawDataHex)
 
 	// Decode hex string to bytes
 	rawDataBytes, err := hex.DecodeString(rawDataHex)
@@ -499,7 +417,7 @@ func signTransaction(rawTx []byte, privKey *ecdsa.PrivateKey) (map[string]interf
 
 	// Create hash of the raw data
 	hash := sha256.Sum256(rawDataBytes)
-	fmt.Printf("Hash to Sign (hex): %x\n", hash)
+	logrus.Debugf("Hash to Sign (hex): %x", hash)
 
 	// Get the address from the private key for verification
 	pubKey := privKey.Public().(*ecdsa.PublicKey)
@@ -508,7 +426,7 @@ func signTransaction(rawTx []byte, privKey *ecdsa.PrivateKey) (map[string]interf
 
 	// Convert to TRON address format
 	tronAddress := append([]byte{0x41}, address...)
-	fmt.Printf("Signing with TRON address (hex): %x\n", tronAddress)
+	logrus.Debugf("Signing with TRON address (hex): %x", tronAddress)
 
 	// Sign the hash
 	sig, err := crypto.Sign(hash[:], privKey)
@@ -516,39 +434,37 @@ func signTransaction(rawTx []byte, privKey *ecdsa.PrivateKey) (map[string]interf
 		return nil, fmt.Errorf("failed to sign transaction: %v", err)
 	}
 
-	fmt.Printf("Signature (hex): %x\n", sig)
+	logrus.Debugf("Signature (hex): %x", sig)
 
 	// Add signature to transaction
 	txObj["signature"] = []string{hex.EncodeToString(sig)}
 
 	signedJSON, _ := json.MarshalIndent(txObj, "", "  ")
-	fmt.Printf("Signed Transaction: %s\n", string(signedJSON))
-	fmt.Println("=== Signing Complete ===")
+	logrus.Debugf("Signed Transaction: %s", string(signedJSON))
 
 	return txObj, nil
 }
 
 // ApproveUSDT approves the contract to spend USDT tokens
-func (c *TronHTTPClient) ApproveUSDT(fromPrivKey string, spenderAddress string, amount float64) (string, error) {
+func (c *TronHTTPClient) ApproveUSDT(fromPrivKey string, spenderAddress string, amount money.Amount) (string, error) {
 	// Get the sender's address from private key
 	fromAddr, fromAddrHex, privKey, err := getTronAddressAndHexFromPrivKey(fromPrivKey)
 	if err != nil {
 		return "", fmt.Errorf("failed to get address from private key: %v", err)
 	}
 
-	fmt.Println("=== ApproveUSDT DEBUG ===")
-	fmt.Println("From Address:", fromAddr)
-	fmt.Println("From Address Hex:", fromAddrHex)
-	fmt.Println("Spender Address:", spenderAddress)
-	fmt.Println("Contract Address (base58):", c.USDTContract)
-	fmt.Printf("Amount: %.6f\n", amount)
+	logrus.Debugf("From Address: %s", fromAddr)
+	logrus.Debugf("From Address Hex: %s", fromAddrHex)
+	logrus.Debugf("Spender Address: %s", spenderAddress)
+	logrus.Debugf("Contract Address (base58): %s", c.USDTContract)
+	logrus.Debugf("Amount: %s", amount)
 
 	// Convert addresses to hex
 	contractHex := base58CheckToHex(c.USDTContract)
 	spenderHex := base58CheckToHex(spenderAddress)
 
-	fmt.Println("Contract Hex:", contractHex)
-	fmt.Println("Spender Hex:", spenderHex)
+	logrus.Debugf("Contract Hex: %s", contractHex)
+	logrus.Debugf("Spender Hex: %s", spenderHex)
 
 	// Method ID for approve(address,uint256)
 	methodID := "095ea7b3"
@@ -563,17 +479,16 @@ func (c *TronHTTPClient) ApproveUSDT(fromPrivKey string, spenderAddress string,
 	}
 	spenderParam := fmt.Sprintf("%064x", spenderBytes[1:]) // Remove 41 prefix and pad
 
-	// Convert amount to sun (6 decimals) and pad to 32 bytes
-	amountInt := big.NewInt(int64(amount * 1e6))
-	amountParam := fmt.Sprintf("%064x", amountInt)
+	// Amount is already in base units (6 decimals), pad to 32 bytes
+	amountParam := fmt.Sprintf("%064x", amount.Big())
 
 	// Combine parameters
 	params := methodID + spenderParam + amountParam
 
-	fmt.Println("Method ID:", methodID)
-	fmt.Println("Spender Param:", spenderParam)
-	fmt.Println("Amount Param:", amountParam)
-	fmt.Println("Full Params:", params)
+	logrus.Debugf("Method ID: %s", methodID)
+	logrus.Debugf("Spender Param: %s", spenderParam)
+	logrus.Debugf("Amount Param: %s", amountParam)
+	logrus.Debugf("Full Params: %s", params)
 
 	// Create transaction parameters
 	param := map[string]interface{}{
@@ -587,7 +502,7 @@ func (c *TronHTTPClient) ApproveUSDT(fromPrivKey string, spenderAddress string,
 	}
 
 	paramJSON, _ := json.MarshalIndent(param, "", "  ")
-	fmt.Println("Transaction Parameters:", string(paramJSON))
+	logrus.Debugf("Transaction Parameters: %s", string(paramJSON))
 
 	// Create transaction with increased timeout
 	client := &http.Client{
@@ -601,7 +516,7 @@ func (c *TronHTTPClient) ApproveUSDT(fromPrivKey string, spenderAddress string,
 		if err == nil {
 			break
 		}
-		fmt.Printf("Attempt %d failed: %v\n", i+1, err)
+		logrus.Debugf("Attempt %d failed: %v", i+1, err)
 		if i < maxRetries-1 {
 			time.Sleep(time.Second * 3)
 		}
@@ -610,7 +525,7 @@ func (c *TronHTTPClient) ApproveUSDT(fromPrivKey string, spenderAddress string,
 		return "", fmt.Errorf("failed to create transaction after %d attempts: %v", maxRetries, err)
 	}
 
-	fmt.Println("RAW TX (triggersmartcontract):", string(rawTx))
+	logrus.Debugf("RAW TX (triggersmartcontract): %s", string(rawTx))
 
 	// Parse raw transaction to verify its structure
 	var rawTxMap map[string]interface{}
@@ -625,7 +540,7 @@ func (c *TronHTTPClient) ApproveUSDT(fromPrivKey string, spenderAddress string,
 		if err == nil {
 			break
 		}
-		fmt.Printf("Signing attempt %d failed: %v\n", i+1, err)
+		logrus.Debugf("Signing attempt %d failed: %v", i+1, err)
 		if i < maxRetries-1 {
 			time.Sleep(time.Second * 2)
 		}
@@ -635,51 +550,9 @@ func (c *TronHTTPClient) ApproveUSDT(fromPrivKey string, spenderAddress string,
 	}
 
 	signedJSON, _ := json.MarshalIndent(signedTx, "", "  ")
-	fmt.Println("Signed Transaction:", string(signedJSON))
+	logrus.Debugf("Signed Transaction: %s", string(signedJSON))
 
-	// Add delay before broadcasting
-	time.Sleep(time.Second * 3)
-
-	// Broadcast transaction
-	var broadcastResult []byte
-	for i := 0; i < maxRetries; i++ {
-		broadcastResult, err = c.postWithClient(client, "/wallet/broadcasttransaction", signedTx)
-		if err == nil {
-			break
-		}
-		fmt.Printf("Broadcast attempt %d failed: %v\n", i+1, err)
-		if i < maxRetries-1 {
-			time.Sleep(time.Second * 4)
-		}
-	}
-	if err != nil {
-		return "", fmt.Errorf("failed to broadcast transaction after %d attempts: %v", maxRetries, err)
-	}
-
-	fmt.Println("Broadcast result:", string(broadcastResult))
-
-	// Parse broadcast result
-	var result map[string]interface{}
-	if err := json.Unmarshal(broadcastResult, &result); err != nil {
-		return "", fmt.Errorf("failed to parse broadcast result: %v", err)
-	}
-
-	// Check for errors in broadcast result
-	if code, ok := result["code"].(string); ok && code != "" {
-		message := ""
-		if msg, ok := result["message"].(string); ok {
-			message = msg
-		}
-		return "", fmt.Errorf("broadcast failed with code %s: %s", code, message)
-	}
-
-	// Get transaction ID
-	txID, ok := result["txid"].(string)
-	if !ok {
-		return "", fmt.Errorf("invalid txid in response: %v", result)
-	}
-
-	return txID, nil
+	return c.BroadcastTransaction(signedTx)
 }
 
 // GetTransactionStatus проверяет статус транзакции
@@ -701,27 +574,30 @@ func (c *TronHTTPClient) GetTransactionStatus(txID string) (map[string]interface
 }
 
 // GetTRXBalance gets the TRX balance of an address
-func (c *TronHTTPClient) GetTRXBalance(address string) (float64, error) {
-	// Try TronGrid first, fallback to TronScan if it fails
+func (c *TronHTTPClient) GetTRXBalance(address string) (money.Amount, error) {
+	// Try TronGrid first, fallback to TronScan if it fails. A missing account is a zero
+	// balance, but a failed request is an error: callers top up gas from it.
 	balance, err := c.getTRXBalanceFromTronGrid(address)
-	if err != nil {
-		fmt.Printf("TronGrid failed: %v, trying TronScan...\n", err)
-		balance, err = c.getTRXBalanceFromTronScan(address)
-		if err != nil {
-			fmt.Printf("TronScan also failed: %v, returning 0 balance\n", err)
-			// Return 0 balance if both APIs fail (account might not exist)
-			return 0, nil
-		}
+	if err == nil {
+		return balance, nil
+	}
+	if c.Network.ScanURL == "" {
+		return 0, fmt.Errorf("failed to get TRX balance: %v", err)
+	}
+	logrus.Debugf("tron: TronGrid TRX balance failed: %v, trying TronScan", err)
+	balance, scanErr := c.getTRXBalanceFromTronScan(address)
+	if scanErr != nil {
+		return 0, fmt.Errorf("failed to get TRX balance: %v; TronScan: %v", err, scanErr)
 	}
 	return balance, nil
 }
 
-func (c *TronHTTPClient) getTRXBalanceFromTronScan(address string) (float64, error) {
+func (c *TronHTTPClient) getTRXBalanceFromTronScan(address string) (money.Amount, error) {
 	client := &http.Client{
 		Timeout: time.Second * 10,
 	}
 
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/account/balance/%s", tronScanAPI, address), nil)
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/api/account/balance/%s", c.Network.ScanURL, address), nil)
 	if err != nil {
 		return 0, fmt.Errorf("failed to create request: %v", err)
 	}
@@ -737,20 +613,22 @@ func (c *TronHTTPClient) getTRXBalanceFromTronScan(address string) (float64, err
 		return 0, fmt.Errorf("failed to read response: %v", err)
 	}
 
-	fmt.Printf("TronScan balance response: %s\n", string(body))
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("TronScan returned %s", resp.Status)
+	}
 
 	var result struct {
-		Balance float64 `json:"balance"`
+		Balance int64 `json:"balance"` // SUN
 	}
 
 	if err := json.Unmarshal(body, &result); err != nil {
 		return 0, fmt.Errorf("failed to parse TronScan response: %v", err)
 	}
 
-	return result.Balance / 1_000_000, nil
+	return money.FromUnits(result.Balance), nil
 }
 
-func (c *TronHTTPClient) getTRXBalanceFromTronGrid(address string) (float64, error) {
+func (c *TronHTTPClient) getTRXBalanceFromTronGrid(address string) (money.Amount, error) {
 	// Convert address to hex
 	addrHex := base58CheckToHex(address)
 
@@ -766,52 +644,39 @@ func (c *TronHTTPClient) getTRXBalanceFromTronGrid(address string) (float64, err
 		return 0, fmt.Errorf("failed to get account info: %v", err)
 	}
 
-	fmt.Printf("TronGrid balance response: %s\n", string(response))
+	logrus.Debugf("TronGrid balance response: %s", string(response))
 
 	var result map[string]interface{}
-	if err := json.Unmarshal(response, &result); err != nil {
+	decoder := json.NewDecoder(bytes.NewReader(response))
+	decoder.UseNumber()
+	if err := decoder.Decode(&result); err != nil {
 		return 0, fmt.Errorf("failed to parse response: %v", err)
 	}
 
-	// Try different possible balance fields
-	var balance float64
-
-	// Try balance as string first
-	if balStr, ok := result["balance"].(string); ok {
-		balInt64, err := strconv.ParseInt(balStr, 10, 64)
-		if err == nil {
-			balance = float64(balInt64)
-		}
-	}
-
-	// Try balance as float64
-	if balance == 0 {
-		if balFloat, ok := result["balance"].(float64); ok {
-			balance = balFloat
+	// Balance is in SUN, either a number or a string
+	var balance int64
+	switch bal := result["balance"].(type) {
+	case string:
+		if balInt64, err := strconv.ParseInt(bal, 10, 64); err == nil {
+			balance = balInt64
 		}
-	}
-
-	// Try balance as json.Number
-	if balance == 0 {
-		if balNum, ok := result["balance"].(json.Number); ok {
-			if balFloat, err := balNum.Float64(); err == nil {
-				balance = balFloat
-			}
+	case json.Number:
+		if balInt64, err := bal.Int64(); err == nil {
+			balance = balInt64
 		}
 	}
 
 	// If account doesn't exist or has no balance, the API might return empty response
 	if len(result) == 0 || balance == 0 {
-		fmt.Printf("Warning: Account %s might not exist or has 0 balance\n", address)
+		logrus.Warnf("Account %s might not exist or has 0 balance", address)
 		return 0, nil
 	}
 
-	// Convert from SUN to TRX
-	return balance / 1_000_000, nil
+	return money.FromUnits(balance), nil
 }
 
 // EstimateTransferEnergy estimates the energy required for a USDT transfer
-func (c *TronHTTPClient) EstimateTransferEnergy(fromAddr string, toAddr string, amount float64) (int64, error) {
+func (c *TronHTTPClient) EstimateTransferEnergy(fromAddr string, toAddr string, amount money.Amount) (int64, error) {
 	// Convert addresses to hex
 	fromAddrHex := base58CheckToHex(fromAddr)
 	contractHex := base58CheckToHex(c.USDTContract)
@@ -834,7 +699,7 @@ func (c *TronHTTPClient) EstimateTransferEnergy(fromAddr string, toAddr string,
 		return 0, fmt.Errorf("failed to estimate energy: %v", err)
 	}
 
-	fmt.Printf("Energy estimation response: %s\n", string(response))
+	logrus.Debugf("Energy estimation response: %s", string(response))
 
 	var result map[string]interface{}
 	if err := json.Unmarshal(response, &result); err != nil {
@@ -860,61 +725,46 @@ func (c *TronHTTPClient) EstimateTransferEnergy(fromAddr string, toAddr string,
 		// Use a more realistic default value for USDT transfers
 		// Typical USDT transfer uses around 15,000-25,000 energy
 		energyUsed = 20000
-		fmt.Println("Warning: Using default energy estimation of 20,000")
+		logrus.Warnf("Using default energy estimation of 20,000")
 	}
 
 	// Add 20% buffer for safety
 	return int64(energyUsed * 1.2), nil
 }
 
-// EstimateRequiredTRX estimates the TRX required for a USDT transfer
-func (c *TronHTTPClient) EstimateRequiredTRX(fromAddr string, toAddr string, amount float64) (float64, error) {
-	// Estimate energy required
-	estimatedEnergy, err := c.EstimateTransferEnergy(fromAddr, toAddr, amount)
+// SendTRXForGas sends a small amount of TRX to cover gas fees
+func (c *TronHTTPClient) SendTRXForGas(fromPrivKey string, toAddress string, amount money.Amount) (string, error) {
+	signedTx, err := c.SignTRXTransfer(fromPrivKey, toAddress, amount)
 	if err != nil {
-		return 0, fmt.Errorf("failed to estimate energy: %v", err)
+		return "", err
 	}
-
-	// Calculate required TRX for energy
-	// Using current TRON energy price: 420 SUN per energy
-	const energyPrice = 420 // SUN per energy unit
-	requiredTRX := float64(estimatedEnergy) * float64(energyPrice) / 1_000_000
-
-	// Use the actual estimated TRX amount
-	fmt.Printf("Estimated TRX required: %.6f (based on %d energy units)\n", requiredTRX, estimatedEnergy)
-
-	// Add 20% buffer for safety
-	requiredTRXWithBuffer := requiredTRX * 1.2
-
-	return requiredTRXWithBuffer, nil
+	return c.BroadcastTransaction(signedTx.Raw)
 }
 
-// SendTRXForGas sends a small amount of TRX to cover gas fees
-func (c *TronHTTPClient) SendTRXForGas(fromPrivKey string, toAddress string, amount float64) (string, error) {
+// SignTRXTransfer builds and signs a TRX transfer without broadcasting it
+func (c *TronHTTPClient) SignTRXTransfer(fromPrivKey string, toAddress string, amount money.Amount) (SignedTx, error) {
 	// Get the sender's address from private key
 	fromAddr, fromAddrHex, privKey, err := getTronAddressAndHexFromPrivKey(fromPrivKey)
 	if err != nil {
-		return "", fmt.Errorf("failed to get address from private key: %v", err)
+		return SignedTx{}, fmt.Errorf("failed to get address from private key: %v", err)
 	}
 
-	fmt.Println("=== SendTRXForGas DEBUG ===")
-	fmt.Println("From Address:", fromAddr)
-	fmt.Println("To Address:", toAddress)
-	fmt.Printf("Amount: %.6f TRX\n", amount)
+	logrus.Debugf("From Address: %s", fromAddr)
+	logrus.Debugf("To Address: %s", toAddress)
+	logrus.Debugf("Amount: %s TRX", amount)
 
 	// Check TRX balance first
 	balance, err := c.GetTRXBalance(fromAddr)
 	if err != nil {
-		return "", fmt.Errorf("failed to check TRX balance: %v", err)
+		return SignedTx{}, fmt.Errorf("failed to check TRX balance: %v", err)
 	}
-	fmt.Printf("Current TRX balance: %.6f\n", balance)
+	logrus.Debugf("Current TRX balance: %s", balance)
 
 	if balance < amount {
-		return "", fmt.Errorf("insufficient TRX balance: have %.6f, need %.6f", balance, amount)
+		return SignedTx{}, fmt.Errorf("insufficient TRX balance: have %s, need %s", balance, amount)
 	}
 
-	// Convert amount to SUN
-	amountSun := int64(amount * 1_000_000)
+	amountSun := amount.Units()
 
 	// Create transaction parameters
 	param := map[string]interface{}{
@@ -924,10 +774,8 @@ func (c *TronHTTPClient) SendTRXForGas(fromPrivKey string, toAddress string, amo
 		"visible":       false,
 	}
 
-	fmt.Println("=== TRX Transfer Parameters ===")
 	paramJSON, _ := json.MarshalIndent(param, "", "  ")
-	fmt.Println(string(paramJSON))
-	fmt.Println("===========================")
+	logrus.Debugf("TRX Transfer Parameters: %s", string(paramJSON))
 
 	// Create transaction
 	client := &http.Client{
@@ -941,16 +789,16 @@ func (c *TronHTTPClient) SendTRXForGas(fromPrivKey string, toAddress string, amo
 		if err == nil {
 			break
 		}
-		fmt.Printf("Attempt %d failed: %v\n", i+1, err)
+		logrus.Debugf("Attempt %d failed: %v", i+1, err)
 		if i < maxRetries-1 {
 			time.Sleep(time.Second * 2)
 		}
 	}
 	if err != nil {
-		return "", fmt.Errorf("failed to create TRX transaction: %v", err)
+		return SignedTx{}, fmt.Errorf("failed to create TRX transaction: %v", err)
 	}
 
-	fmt.Println("RAW TX (createtransaction):", string(rawTx))
+	logrus.Debugf("RAW TX (createtransaction): %s", string(rawTx))
 
 	// Sign transaction
 	var signedTx map[string]interface{}
@@ -959,32 +807,46 @@ func (c *TronHTTPClient) SendTRXForGas(fromPrivKey string, toAddress string, amo
 		if err == nil {
 			break
 		}
-		fmt.Printf("Signing attempt %d failed: %v\n", i+1, err)
+		logrus.Debugf("Signing attempt %d failed: %v", i+1, err)
 		if i < maxRetries-1 {
 			time.Sleep(time.Second * 1)
 		}
 	}
 	if err != nil {
-		return "", fmt.Errorf("failed to sign TRX transaction: %v", err)
+		return SignedTx{}, fmt.Errorf("failed to sign TRX transaction: %v", err)
+	}
+
+	return newSignedTx(signedTx)
+}
+
+// BroadcastTransaction отправляет подписанную транзакцию в сеть и возвращает её txid.
+// Повторная отправка той же подписанной транзакции не приводит к двойному списанию.
+func (c *TronHTTPClient) BroadcastTransaction(signedTx map[string]interface{}) (string, error) {
+	client := &http.Client{
+		Timeout: time.Second * 120,
 	}
 
-	// Broadcast transaction
 	var broadcastResult []byte
+	var err error
+	maxRetries := 5
+	logrus.Debugf("Broadcasting transaction with %d retries...", maxRetries)
 	for i := 0; i < maxRetries; i++ {
-		broadcastResult, err = c.post("/wallet/broadcasttransaction", signedTx)
+		logrus.Debugf("Broadcast attempt %d/%d...", i+1, maxRetries)
+		broadcastResult, err = c.postWithClient(client, "/wallet/broadcasttransaction", signedTx)
 		if err == nil {
 			break
 		}
-		fmt.Printf("Broadcast attempt %d failed: %v\n", i+1, err)
+		logrus.Debugf("Broadcast attempt %d failed: %v", i+1, err)
 		if i < maxRetries-1 {
-			time.Sleep(time.Second * 2)
+			logrus.Debugf("Waiting 5 seconds before retry...")
+			time.Sleep(time.Second * 5)
 		}
 	}
 	if err != nil {
-		return "", fmt.Errorf("failed to broadcast TRX transaction: %v", err)
+		return "", fmt.Errorf("failed to broadcast transaction after %d attempts: %v", maxRetries, err)
 	}
 
-	fmt.Println("Broadcast result:", string(broadcastResult))
+	logrus.Debugf("Broadcast result: %s", string(broadcastResult))
 
 	// Parse broadcast result
 	var result map[string]interface{}
@@ -994,6 +856,15 @@ func (c *TronHTTPClient) SendTRXForGas(fromPrivKey string, toAddress string, amo
 
 	// Check for errors in broadcast result
 	if code, ok := result["code"].(string); ok && code != "" {
+		switch code {
+		case "DUP_TRANSACTION_ERROR":
+			// Транзакция уже принята сетью раньше — повторная отправка ничего не меняет
+			if txID, ok := signedTx["txID"].(string); ok {
+				return txID, nil
+			}
+		case "TRANSACTION_EXPIRATION_ERROR":
+			return "", ErrTransactionExpired
+		}
 		message := ""
 		if msg, ok := result["message"].(string); ok {
 			message = msg
@@ -1006,6 +877,8 @@ func (c *TronHTTPClient) SendTRXForGas(fromPrivKey string, toAddress string, amo
 	if !ok {
 		return "", fmt.Errorf("invalid txid in response: %v", result)
 	}
+	// Accepted transaction spends energy and bandwidth: cached resources are stale
+	c.cache.forgetResources()
 
 	return txID, nil
 }
@@ -0,0 +1,50 @@
+package tronclient
+
+import (
+	"strings"
+	"testing"
+
+	"production_wallet_back/pkg/money"
+)
+
+func TestEncodeTransferParams(t *testing.T) {
+	// USDT contract address, hex 41a614f803b6fd780986a42c78ec9c7f77e6ded13c
+	const to = "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgjLj6t"
+	addr := strings.Repeat("0", 24) + "a614f803b6fd780986a42c78ec9c7f77e6ded13c"
+
+	tests := []struct {
+		name   string
+		amount money.Amount
+		value  string
+	}{
+		{name: "one usdt", amount: money.MustParse("1"), value: "f4240"},
+		{name: "smallest unit", amount: 1, value: "1"},
+		{name: "fraction", amount: money.MustParse("12.345678"), value: "bc614e"},
+		{name: "max", amount: money.Max, value: "de0b6b3a7640000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := encodeTransferParams(to, tt.amount)
+			want := "a9059cbb" + addr + strings.Repeat("0", 64-len(tt.value)) + tt.value
+			if got != want {
+				t.Fatalf("encodeTransferParams = %s, want %s", got, want)
+			}
+			if len(got) != 8+64+64 {
+				t.Fatalf("len = %d, want 136", len(got))
+			}
+		})
+	}
+}
+
+func TestEncodeTransferParamsInvalidAddress(t *testing.T) {
+	for _, to := range []string{"not-an-address0OIl", "TR7NHqjeKQxGTCi8q8ZY4pL8otSzgj", ""} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("encodeTransferParams(%q) did not panic", to)
+				}
+			}()
+			encodeTransferParams(to, money.One)
+		}()
+	}
+}
@@ -0,0 +1,84 @@
+package tronclient
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// TransactionInfo is the typed result of /wallet/gettransactioninfobyid.
+// Found is false while the transaction is not in a block.
+type TransactionInfo struct {
+	TxID        string    `json:"tx_id"`
+	Found       bool      `json:"found"`
+	BlockNumber int64     `json:"block_number,omitempty"`
+	BlockTime   time.Time `json:"block_time,omitempty"`
+	Result      string    `json:"result,omitempty"`  // receipt.result, SUCCESS for a successful transaction
+	Message     string    `json:"message,omitempty"` // decoded resMessage of a failed transaction
+	EnergyUsed  int64     `json:"energy_used"`
+	EnergyFee   int64     `json:"energy_fee"` // SUN burned for energy
+	NetUsage    int64     `json:"net_usage"`
+	NetFee      int64     `json:"net_fee"` // SUN burned for bandwidth
+	Fee         int64     `json:"fee"`     // total SUN burned
+}
+
+// Succeeded reports whether the transaction is in a block and executed successfully
+func (i TransactionInfo) Succeeded() bool {
+	return i.Found && i.Result == "SUCCESS"
+}
+
+// GetTransactionInfo returns the execution result of a transaction
+func (c *TronHTTPClient) GetTransactionInfo(txID string) (TransactionInfo, error) {
+	response, err := c.postWithClient(nil, "/wallet/gettransactioninfobyid", map[string]interface{}{
+		"value": txID,
+	})
+	if err != nil {
+		return TransactionInfo{}, fmt.Errorf("failed to get transaction info: %v", err)
+	}
+
+	var raw struct {
+		ID             string `json:"id"`
+		Fee            int64  `json:"fee"`
+		BlockNumber    int64  `json:"blockNumber"`
+		BlockTimeStamp int64  `json:"blockTimeStamp"`
+		Result         string `json:"result"`
+		ResMessage     string `json:"resMessage"`
+		Receipt        struct {
+			EnergyUsageTotal int64  `json:"energy_usage_total"`
+			EnergyFee        int64  `json:"energy_fee"`
+			NetUsage         int64  `json:"net_usage"`
+			NetFee           int64  `json:"net_fee"`
+			Result           string `json:"result"`
+		} `json:"receipt"`
+	}
+	if err := json.Unmarshal(response, &raw); err != nil {
+		return TransactionInfo{}, fmt.Errorf("failed to parse transaction info: %v", err)
+	}
+
+	info := TransactionInfo{TxID: txID}
+	if raw.ID == "" {
+		return info, nil
+	}
+	info.Found = true
+	info.BlockNumber = raw.BlockNumber
+	info.BlockTime = time.UnixMilli(raw.BlockTimeStamp)
+	info.EnergyUsed = raw.Receipt.EnergyUsageTotal
+	info.EnergyFee = raw.Receipt.EnergyFee
+	info.NetUsage = raw.Receipt.NetUsage
+	info.NetFee = raw.Receipt.NetFee
+	info.Fee = raw.Fee
+
+	// У обычных переводов TRX receipt.result нет, неуспех отмечается только верхним result: FAILED
+	info.Result = raw.Receipt.Result
+	if info.Result == "" {
+		info.Result = "SUCCESS"
+		if raw.Result == "FAILED" {
+			info.Result = "FAILED"
+		}
+	}
+	if msg, err := hex.DecodeString(raw.ResMessage); err == nil {
+		info.Message = string(msg)
+	}
+	return info, nil
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/go-resty/resty/v2"
+)
+
+// SendTelegramMessage отправляет сообщение пользователю от имени бота
+func SendTelegramMessage(botToken string, chatID int64, text string) error {
+	if botToken == "" {
+		return errors.New("telegram bot token is not configured")
+	}
+	var result struct {
+		OK          bool   `json:"ok"`
+		Description string `json:"description"`
+	}
+	resp, err := resty.New().R().
+		SetBody(map[string]interface{}{
+			"chat_id": chatID,
+			"text":    text,
+		}).
+		SetResult(&result).
+		SetError(&result).
+		Post("https://api.telegram.org/bot" + botToken + "/sendMessage")
+	if err != nil {
+		return err
+	}
+	if resp.IsError() || !result.OK {
+		return fmt.Errorf("telegram: %s %s", resp.Status(), result.Description)
+	}
+	return nil
+}
@@ -0,0 +1,13 @@
+-- Сессии пользователей: refresh-токены хранятся только в виде хэша
+CREATE TABLE sessions
+(
+    id                 SERIAL PRIMARY KEY,
+    telegram_id        BIGINT    NOT NULL REFERENCES users (telegram_id) ON DELETE CASCADE,
+    refresh_token_hash TEXT      NOT NULL UNIQUE,
+    user_agent         TEXT,
+    expires_at         TIMESTAMP NOT NULL,
+    revoked_at         TIMESTAMP,
+    created_at         TIMESTAMP DEFAULT NOW()
+);
+
+CREATE INDEX idx_sessions_telegram_id ON sessions (telegram_id);
@@ -0,0 +1,3 @@
+DROP INDEX idx_wallets_key_version;
+ALTER TABLE wallets DROP COLUMN key_version;
+ALTER TABLE wallets DROP COLUMN wrapped_key;
@@ -0,0 +1,6 @@
+-- Приватные ключи шифруются ключом данных (DEK), который обёрнут мастер-ключом версии key_version.
+-- key_version = 0 — старые записи с ключом в открытом виде, их перешифровывает cmd/rekey
+ALTER TABLE wallets ADD COLUMN wrapped_key TEXT NOT NULL DEFAULT '';
+ALTER TABLE wallets ADD COLUMN key_version INTEGER NOT NULL DEFAULT 0;
+
+CREATE INDEX idx_wallets_key_version ON wallets (key_version);
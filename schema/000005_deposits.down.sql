@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS scanner_checkpoints;
+DROP TABLE IF EXISTS deposits;
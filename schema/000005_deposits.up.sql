@@ -0,0 +1,25 @@
+-- Входящие переводы USDT, найденные сканером блоков.
+-- Один перевод = одно событие Transfer, поэтому ключ (tx_hash, log_index)
+CREATE TABLE deposits (
+    id BIGSERIAL PRIMARY KEY,
+    wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+    tx_hash VARCHAR(64) NOT NULL,
+    log_index INTEGER NOT NULL,
+    block_number BIGINT NOT NULL,
+    from_address VARCHAR(64) NOT NULL,
+    token_symbol VARCHAR(10) NOT NULL,
+    amount NUMERIC(30, 6) NOT NULL,
+    status VARCHAR(20) NOT NULL DEFAULT 'pending', -- 'pending', 'credited' или 'orphaned'
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    credited_at TIMESTAMP,
+    UNIQUE (tx_hash, log_index)
+);
+
+CREATE INDEX idx_deposits_status_block ON deposits (status, block_number);
+
+-- Последний полностью обработанный блок для каждого сканера
+CREATE TABLE scanner_checkpoints (
+    name VARCHAR(50) PRIMARY KEY,
+    block_number BIGINT NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
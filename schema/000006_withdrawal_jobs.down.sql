@@ -0,0 +1 @@
+DROP TABLE IF EXISTS withdrawal_jobs;
@@ -0,0 +1,30 @@
+-- Заявки на вывод USDT. Воркер двигает заявку по состояниям:
+-- requested -> gas_funding -> signing -> broadcast -> confirmed | failed
+-- Подписанные транзакции сохраняются до отправки, поэтому после падения воркер
+-- повторяет отправку той же транзакции, а не подписывает новую.
+CREATE TABLE withdrawal_jobs (
+    id BIGSERIAL PRIMARY KEY,
+    wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+    telegram_id BIGINT NOT NULL,
+    from_address VARCHAR(64) NOT NULL,
+    to_address VARCHAR(64) NOT NULL,
+    token_symbol VARCHAR(10) NOT NULL,
+    amount NUMERIC(30, 6) NOT NULL,
+    state VARCHAR(20) NOT NULL DEFAULT 'requested',
+    gas_tx_id VARCHAR(64) NOT NULL DEFAULT '',
+    gas_signed_tx TEXT NOT NULL DEFAULT '',
+    tx_id VARCHAR(64) NOT NULL DEFAULT '',
+    signed_tx TEXT NOT NULL DEFAULT '',
+    tx_expires_at TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    lease_token VARCHAR(64) NOT NULL DEFAULT '',
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_withdrawal_jobs_runnable ON withdrawal_jobs (next_run_at)
+    WHERE state NOT IN ('confirmed', 'failed');
+CREATE INDEX idx_withdrawal_jobs_wallet_state ON withdrawal_jobs (wallet_id, state);
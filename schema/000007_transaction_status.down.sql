@@ -0,0 +1,13 @@
+DROP INDEX IF EXISTS idx_transactions_status;
+ALTER TABLE transactions DROP COLUMN updated_at;
+ALTER TABLE transactions DROP COLUMN fee;
+ALTER TABLE transactions DROP COLUMN net_fee;
+ALTER TABLE transactions DROP COLUMN energy_fee;
+ALTER TABLE transactions DROP COLUMN energy_used;
+ALTER TABLE transactions DROP COLUMN failure_reason;
+ALTER TABLE transactions DROP COLUMN result;
+ALTER TABLE transactions DROP COLUMN block_number;
+ALTER TABLE transactions DROP COLUMN expires_at;
+ALTER TABLE transactions DROP CONSTRAINT transactions_status_check;
+ALTER TABLE transactions ALTER COLUMN status DROP NOT NULL;
+ALTER TABLE transactions ALTER COLUMN status SET DEFAULT 'confirmed';
@@ -0,0 +1,19 @@
+-- Статус транзакции выставляет трекер по gettransactioninfobyid:
+-- pending -> confirmed | failed | expired
+UPDATE transactions SET status = 'confirmed' WHERE status IS NULL OR status NOT IN ('pending', 'confirmed', 'failed', 'expired');
+ALTER TABLE transactions ALTER COLUMN status SET DEFAULT 'pending';
+ALTER TABLE transactions ALTER COLUMN status SET NOT NULL;
+ALTER TABLE transactions ADD CONSTRAINT transactions_status_check
+    CHECK (status IN ('pending', 'confirmed', 'failed', 'expired'));
+
+ALTER TABLE transactions ADD COLUMN expires_at TIMESTAMP;       -- после этого момента транзакция не попадёт в блок
+ALTER TABLE transactions ADD COLUMN block_number BIGINT;
+ALTER TABLE transactions ADD COLUMN result TEXT NOT NULL DEFAULT '';         -- receipt.result
+ALTER TABLE transactions ADD COLUMN failure_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE transactions ADD COLUMN energy_used BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE transactions ADD COLUMN energy_fee BIGINT NOT NULL DEFAULT 0;    -- SUN
+ALTER TABLE transactions ADD COLUMN net_fee BIGINT NOT NULL DEFAULT 0;       -- SUN
+ALTER TABLE transactions ADD COLUMN fee BIGINT NOT NULL DEFAULT 0;           -- SUN
+ALTER TABLE transactions ADD COLUMN updated_at TIMESTAMP DEFAULT NOW();
+
+CREATE INDEX idx_transactions_status ON transactions (status);
@@ -0,0 +1,6 @@
+ALTER TABLE withdrawal_jobs DROP COLUMN gas_amount;
+DROP TABLE IF EXISTS ledger_postings;
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_accounts;
+DROP FUNCTION IF EXISTS ledger_forbid_change();
+DROP FUNCTION IF EXISTS ledger_check_entry_balanced();
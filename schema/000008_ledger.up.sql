@@ -0,0 +1,89 @@
+-- Журнал двойной записи. Каждое движение средств — проводка (ledger_entries)
+-- из нескольких строк (ledger_postings), сумма строк проводки по каждому токену равна нулю.
+-- Положительная сумма увеличивает остаток счёта, отрицательная уменьшает.
+-- balances остаётся проекцией счетов кошельков и меняется в той же транзакции, что и журнал.
+CREATE TABLE ledger_accounts (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(100) NOT NULL UNIQUE, -- wallet:<wallet_id>:<token> или <kind>:<token>
+    kind VARCHAR(30) NOT NULL CHECK (kind IN
+        ('wallet', 'hot_wallet', 'fees', 'pending_withdrawals', 'order_settlement', 'external')),
+    wallet_id INTEGER REFERENCES wallets (id),
+    token_symbol VARCHAR(10) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK ((kind = 'wallet') = (wallet_id IS NOT NULL))
+);
+
+CREATE TABLE ledger_entries (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(30) NOT NULL,
+    reference VARCHAR(100) UNIQUE, -- ключ идемпотентности, например deposit:<id>
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE ledger_postings (
+    id BIGSERIAL PRIMARY KEY,
+    entry_id BIGINT NOT NULL REFERENCES ledger_entries (id),
+    account_id INTEGER NOT NULL REFERENCES ledger_accounts (id),
+    amount NUMERIC(30, 6) NOT NULL CHECK (amount <> 0)
+);
+
+CREATE INDEX idx_ledger_postings_entry ON ledger_postings (entry_id);
+CREATE INDEX idx_ledger_postings_account ON ledger_postings (account_id);
+
+-- Несбалансированная проводка не может быть закоммичена
+CREATE FUNCTION ledger_check_entry_balanced() RETURNS TRIGGER AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1 FROM ledger_postings p
+        JOIN ledger_accounts a ON a.id = p.account_id
+        WHERE p.entry_id = NEW.entry_id
+        GROUP BY a.token_symbol
+        HAVING SUM(p.amount) <> 0
+    ) THEN
+        RAISE EXCEPTION 'ledger entry % is not balanced', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER ledger_postings_balanced
+    AFTER INSERT ON ledger_postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_entry_balanced();
+
+-- Журнал только дописывается: исправления делаются новой проводкой
+CREATE FUNCTION ledger_forbid_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'ledger is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER ledger_entries_append_only BEFORE UPDATE OR DELETE ON ledger_entries
+    FOR EACH ROW EXECUTE FUNCTION ledger_forbid_change();
+CREATE TRIGGER ledger_postings_append_only BEFORE UPDATE OR DELETE ON ledger_postings
+    FOR EACH ROW EXECUTE FUNCTION ledger_forbid_change();
+
+-- Сумма TRX, отправленная с горячего кошелька на газ заявки
+ALTER TABLE withdrawal_jobs ADD COLUMN gas_amount NUMERIC(30, 6) NOT NULL DEFAULT 0;
+
+-- Входящие остатки: текущие balances переносятся в журнал против внешнего счёта
+INSERT INTO ledger_accounts (code, kind, wallet_id, token_symbol)
+SELECT 'wallet:' || wallet_id || ':' || token_symbol, 'wallet', wallet_id, token_symbol FROM balances;
+INSERT INTO ledger_accounts (code, kind, token_symbol)
+SELECT DISTINCT 'external:' || token_symbol, 'external', token_symbol FROM balances;
+
+INSERT INTO ledger_entries (kind, reference, description)
+SELECT 'opening_balance', 'opening:' || wallet_id || ':' || token_symbol, 'balance before ledger was introduced'
+FROM balances WHERE amount <> 0;
+
+INSERT INTO ledger_postings (entry_id, account_id, amount)
+SELECT e.id, a.id, b.amount
+FROM balances b
+JOIN ledger_entries e ON e.reference = 'opening:' || b.wallet_id || ':' || b.token_symbol
+JOIN ledger_accounts a ON a.code = 'wallet:' || b.wallet_id || ':' || b.token_symbol
+UNION ALL
+SELECT e.id, a.id, -b.amount
+FROM balances b
+JOIN ledger_entries e ON e.reference = 'opening:' || b.wallet_id || ':' || b.token_symbol
+JOIN ledger_accounts a ON a.code = 'external:' || b.token_symbol;
@@ -0,0 +1,19 @@
+-- Ключи идемпотентности запросов, двигающих деньги. Повтор запроса с тем же
+-- Idempotency-Key получает сохранённый ответ, а не выполняется второй раз.
+CREATE TABLE idempotency_keys (
+    id BIGSERIAL PRIMARY KEY,
+    telegram_id BIGINT NOT NULL,
+    key VARCHAR(255) NOT NULL,
+    method VARCHAR(10) NOT NULL,
+    path TEXT NOT NULL,
+    request_hash VARCHAR(64) NOT NULL, -- sha256 от метода, пути и тела запроса
+    status_code INTEGER,               -- NULL, пока запрос выполняется
+    content_type TEXT NOT NULL DEFAULT '',
+    response_body BYTEA,
+    locked_until TIMESTAMP NOT NULL,   -- после этого момента незавершённый запрос можно повторить
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    completed_at TIMESTAMP,
+    UNIQUE (telegram_id, key)
+);
+
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys (created_at);
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_virtual_transfers_settlement;
+ALTER TABLE usdt_virtual_transfers DROP COLUMN tx_hash;
+ALTER TABLE usdt_virtual_transfers DROP COLUMN settlement_id;
+DROP TABLE IF EXISTS settlements;
@@ -0,0 +1,35 @@
+-- Расчёт по виртуальным списаниям: pending-списания кошелька собираются в пакет
+-- и одним переводом USDT уходят на адрес казначейства.
+-- pending -> broadcast -> confirmed | failed
+CREATE TABLE settlements (
+    id BIGSERIAL PRIMARY KEY,
+    wallet_id INTEGER NOT NULL REFERENCES wallets (id) ON DELETE CASCADE,
+    telegram_id BIGINT NOT NULL,
+    from_address VARCHAR(64) NOT NULL,
+    to_address VARCHAR(64) NOT NULL,
+    token_symbol VARCHAR(10) NOT NULL,
+    amount NUMERIC(30, 6) NOT NULL,
+    state VARCHAR(20) NOT NULL DEFAULT 'pending',
+    gas_tx_id VARCHAR(64) NOT NULL DEFAULT '',
+    gas_signed_tx TEXT NOT NULL DEFAULT '',
+    gas_amount NUMERIC(30, 6) NOT NULL DEFAULT 0,
+    tx_id VARCHAR(64) NOT NULL DEFAULT '',
+    signed_tx TEXT NOT NULL DEFAULT '',
+    tx_expires_at TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    lease_token VARCHAR(64) NOT NULL DEFAULT '',
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_settlements_runnable ON settlements (next_run_at)
+    WHERE state NOT IN ('confirmed', 'failed');
+
+-- Списание остаётся pending, пока перевод его пакета не подтверждён
+ALTER TABLE usdt_virtual_transfers ADD COLUMN settlement_id BIGINT REFERENCES settlements (id);
+ALTER TABLE usdt_virtual_transfers ADD COLUMN tx_hash VARCHAR(64);
+
+CREATE INDEX idx_virtual_transfers_settlement ON usdt_virtual_transfers (settlement_id);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS order_transitions;
+DROP INDEX IF EXISTS idx_orderqr_state;
+ALTER TABLE orderqr DROP COLUMN updated_at;
+ALTER TABLE orderqr DROP COLUMN created_at;
+ALTER TABLE orderqr DROP COLUMN state;
@@ -0,0 +1,24 @@
+-- Состояния заказа вместо флага ispaid:
+-- created -> awaiting_operator -> paid -> refunded
+-- created | awaiting_operator -> expired | cancelled
+ALTER TABLE orderqr ADD COLUMN state VARCHAR(20) NOT NULL DEFAULT 'created'
+    CHECK (state IN ('created', 'awaiting_operator', 'paid', 'expired', 'cancelled', 'refunded'));
+ALTER TABLE orderqr ADD COLUMN created_at TIMESTAMP NOT NULL DEFAULT NOW();
+ALTER TABLE orderqr ADD COLUMN updated_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+UPDATE orderqr SET state = CASE WHEN ispaid THEN 'paid' ELSE 'awaiting_operator' END;
+
+CREATE INDEX idx_orderqr_state ON orderqr (state);
+
+-- История переходов: кто и когда перевёл заказ из одного состояния в другое
+CREATE TABLE order_transitions (
+    id BIGSERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orderqr (id) ON DELETE CASCADE,
+    from_state VARCHAR(20) NOT NULL DEFAULT '', -- пусто для создания заказа
+    to_state VARCHAR(20) NOT NULL,
+    actor VARCHAR(100) NOT NULL,                -- user:<telegram_id>, operator, admin или system
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_order_transitions_order ON order_transitions (order_id, id);
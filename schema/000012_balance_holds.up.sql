@@ -0,0 +1,21 @@
+-- Удержания под заказы СБП: сумма заказа недоступна для списаний, пока заказ не оплачен
+-- (удержание становится виртуальным списанием) или не отменён/просрочен (удержание снимается)
+CREATE TABLE balance_holds (
+    id BIGSERIAL PRIMARY KEY,
+    wallet_id INTEGER NOT NULL REFERENCES wallets (id),
+    order_id INTEGER NOT NULL UNIQUE REFERENCES orderqr (id) ON DELETE CASCADE,
+    amount NUMERIC(20, 6) NOT NULL CHECK (amount > 0),
+    status VARCHAR(20) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'captured', 'released')),
+    virtual_transfer_id BIGINT REFERENCES usdt_virtual_transfers (id),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    closed_at TIMESTAMP
+);
+
+CREATE INDEX idx_balance_holds_wallet_active ON balance_holds (wallet_id) WHERE status = 'active';
+
+-- Заказы, уже ждущие оператора, удерживают свою сумму
+INSERT INTO balance_holds (wallet_id, order_id, amount)
+SELECT w.id, o.id, o.crypto
+FROM orderqr o
+JOIN wallets w ON w.user_id = o.telegram_id
+WHERE o.state IN ('created', 'awaiting_operator') AND o.crypto > 0;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_orderqr_active_expires;
+ALTER TABLE orderqr DROP COLUMN expires_at;
@@ -0,0 +1,6 @@
+-- Срок жизни заказа: после expires_at неоплаченный заказ переводится в expired
+ALTER TABLE orderqr ADD COLUMN expires_at TIMESTAMP;
+UPDATE orderqr SET expires_at = GREATEST(created_at, NOW()) + INTERVAL '15 minutes';
+ALTER TABLE orderqr ALTER COLUMN expires_at SET NOT NULL;
+
+CREATE INDEX idx_orderqr_active_expires ON orderqr (expires_at) WHERE state IN ('created', 'awaiting_operator');
@@ -0,0 +1,2 @@
+ALTER TABLE orderqr DROP COLUMN quote_id;
+DROP TABLE IF EXISTS quotes;
@@ -0,0 +1,18 @@
+-- Котировки курса: Convert фиксирует курс и суммы, заказ создаётся только по действующей котировке
+CREATE TABLE quotes (
+    id VARCHAR(32) PRIMARY KEY,
+    telegram_id BIGINT NOT NULL,
+    from_currency VARCHAR(10) NOT NULL,
+    to_currency VARCHAR(10) NOT NULL,
+    rate DOUBLE PRECISION NOT NULL CHECK (rate > 0),
+    amount NUMERIC(20, 6) NOT NULL CHECK (amount > 0),    -- сумма в from_currency
+    converted NUMERIC(20, 6) NOT NULL CHECK (converted > 0), -- сумма в to_currency
+    signature VARCHAR(64) NOT NULL,                        -- HMAC-SHA256 полей котировки
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMP,                                     -- по котировке создан заказ
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_quotes_expires ON quotes (expires_at);
+
+ALTER TABLE orderqr ADD COLUMN quote_id VARCHAR(32) UNIQUE REFERENCES quotes (id);
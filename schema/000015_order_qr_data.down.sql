@@ -0,0 +1 @@
+ALTER TABLE orderqr DROP COLUMN qr_data;
@@ -0,0 +1,2 @@
+-- Разобранный QR СБП: получатель, сумма, валюта, назначение. NULL — заказы до разбора QR.
+ALTER TABLE orderqr ADD COLUMN qr_data JSONB;
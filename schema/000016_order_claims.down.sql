@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_orderqr_claim_expires;
+DROP TABLE IF EXISTS order_actions;
+ALTER TABLE orderqr DROP COLUMN receipt_path;
+ALTER TABLE orderqr DROP COLUMN bank_reference;
+ALTER TABLE orderqr DROP COLUMN claim_expires_at;
+ALTER TABLE orderqr DROP COLUMN claimed_by;
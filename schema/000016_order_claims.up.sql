@@ -0,0 +1,18 @@
+-- Заказ берёт в работу один оператор на срок аренды; оплата — только взявшим оператором
+ALTER TABLE orderqr ADD COLUMN claimed_by VARCHAR(100);
+ALTER TABLE orderqr ADD COLUMN claim_expires_at TIMESTAMPTZ;
+ALTER TABLE orderqr ADD COLUMN bank_reference VARCHAR(100);
+ALTER TABLE orderqr ADD COLUMN receipt_path TEXT;
+
+-- Действия операторов с заказами: взял, отпустил, оплатил
+CREATE TABLE order_actions (
+    id BIGSERIAL PRIMARY KEY,
+    order_id INTEGER NOT NULL REFERENCES orderqr (id) ON DELETE CASCADE,
+    actor VARCHAR(100) NOT NULL,
+    action VARCHAR(20) NOT NULL CHECK (action IN ('claim', 'release', 'pay')),
+    details TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_order_actions_order ON order_actions (order_id, id);
+CREATE INDEX idx_orderqr_claim_expires ON orderqr (claim_expires_at) WHERE claimed_by IS NOT NULL;
@@ -0,0 +1,27 @@
+-- Энергия, делегированная со стейка казначейства на кошелёк пользователя под один перевод USDT.
+-- reference — чей перевод: withdrawal:<id> или settlement:<id>.
+-- delegating -> active -> reclaiming -> reclaimed; failed — делегировать не удалось, перевод жжёт TRX
+CREATE TABLE energy_delegations (
+    id BIGSERIAL PRIMARY KEY,
+    reference VARCHAR(100) NOT NULL UNIQUE,
+    receiver_address VARCHAR(64) NOT NULL,
+    energy BIGINT NOT NULL,
+    amount NUMERIC(30, 6) NOT NULL,
+    state VARCHAR(20) NOT NULL DEFAULT 'delegating'
+        CHECK (state IN ('delegating', 'active', 'reclaiming', 'reclaimed', 'failed')),
+    released BOOLEAN NOT NULL DEFAULT FALSE,
+    delegate_tx_id VARCHAR(64) NOT NULL DEFAULT '',
+    reclaim_tx_id VARCHAR(64) NOT NULL DEFAULT '',
+    signed_tx TEXT NOT NULL DEFAULT '',
+    tx_expires_at TIMESTAMP,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    last_error TEXT NOT NULL DEFAULT '',
+    next_run_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    lease_token VARCHAR(64) NOT NULL DEFAULT '',
+    locked_until TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_energy_delegations_runnable ON energy_delegations (next_run_at)
+    WHERE state NOT IN ('reclaimed', 'failed');
@@ -0,0 +1,4 @@
+UPDATE balance_holds SET status = 'captured' WHERE status = 'refunded';
+ALTER TABLE balance_holds DROP CONSTRAINT balance_holds_status_check;
+ALTER TABLE balance_holds ADD CONSTRAINT balance_holds_status_check
+    CHECK (status IN ('active', 'captured', 'released'));
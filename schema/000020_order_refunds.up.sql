@@ -0,0 +1,5 @@
+-- Возврат оплаченного заказа аннулирует его виртуальное списание (status = 'voided')
+-- и закрывает удержание как refunded
+ALTER TABLE balance_holds DROP CONSTRAINT balance_holds_status_check;
+ALTER TABLE balance_holds ADD CONSTRAINT balance_holds_status_check
+    CHECK (status IN ('active', 'captured', 'released', 'refunded'));
@@ -0,0 +1,18 @@
+-- Переводы TRX с плательщика газа на кошельки пользователей. На один адрес одновременно
+-- в пути не больше одного перевода: второй не подписывается, пока первый не подтвердится,
+-- не провалится или не истечёт, иначе оба посчитали бы недостачу от одного остатка.
+-- pending -> confirmed | failed | expired
+CREATE TABLE gas_topups (
+    id BIGSERIAL PRIMARY KEY,
+    tx_id VARCHAR(64) NOT NULL UNIQUE,
+    address VARCHAR(64) NOT NULL,
+    amount NUMERIC(30, 6) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    status VARCHAR(20) NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'confirmed', 'failed', 'expired')),
+    expires_at TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    updated_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX idx_gas_topups_pending_address ON gas_topups (address) WHERE status = 'pending';
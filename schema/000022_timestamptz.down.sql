@@ -0,0 +1,28 @@
+ALTER TABLE gas_topups ALTER COLUMN expires_at TYPE TIMESTAMP;
+
+ALTER TABLE energy_delegations
+    ALTER COLUMN tx_expires_at TYPE TIMESTAMP,
+    ALTER COLUMN next_run_at TYPE TIMESTAMP,
+    ALTER COLUMN locked_until TYPE TIMESTAMP;
+
+ALTER TABLE orderqr ALTER COLUMN expires_at TYPE TIMESTAMP;
+
+ALTER TABLE settlements
+    ALTER COLUMN tx_expires_at TYPE TIMESTAMP,
+    ALTER COLUMN next_run_at TYPE TIMESTAMP,
+    ALTER COLUMN locked_until TYPE TIMESTAMP;
+
+ALTER TABLE idempotency_keys
+    ALTER COLUMN locked_until TYPE TIMESTAMP,
+    ALTER COLUMN completed_at TYPE TIMESTAMP;
+
+ALTER TABLE withdrawal_jobs
+    ALTER COLUMN tx_expires_at TYPE TIMESTAMP,
+    ALTER COLUMN next_run_at TYPE TIMESTAMP,
+    ALTER COLUMN locked_until TYPE TIMESTAMP;
+
+ALTER TABLE transactions ALTER COLUMN expires_at TYPE TIMESTAMP;
+
+ALTER TABLE sessions
+    ALTER COLUMN expires_at TYPE TIMESTAMP,
+    ALTER COLUMN revoked_at TYPE TIMESTAMP;
@@ -0,0 +1,32 @@
+-- Моменты, которые пишет Go и сравнивает с time.Now() или с NOW() в запросах, хранятся с зоной.
+-- В timestamp without time zone lib/pq отбрасывает смещение, а читает значение как UTC:
+-- при TZ процесса не UTC срок истечения сдвигается на смещение зоны, и ещё живая транзакция
+-- выглядит истёкшей. Старые значения переводятся в зоне сессии (TimeZone), как их писал NOW().
+ALTER TABLE sessions
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN revoked_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE transactions ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE withdrawal_jobs
+    ALTER COLUMN tx_expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN next_run_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN locked_until TYPE TIMESTAMPTZ;
+
+ALTER TABLE idempotency_keys
+    ALTER COLUMN locked_until TYPE TIMESTAMPTZ,
+    ALTER COLUMN completed_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE settlements
+    ALTER COLUMN tx_expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN next_run_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN locked_until TYPE TIMESTAMPTZ;
+
+ALTER TABLE orderqr ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
+
+ALTER TABLE energy_delegations
+    ALTER COLUMN tx_expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN next_run_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN locked_until TYPE TIMESTAMPTZ;
+
+ALTER TABLE gas_topups ALTER COLUMN expires_at TYPE TIMESTAMPTZ;